@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"strings"
+)
+
+// Resource is the resource of a privilege, as reported by connectionStatus.
+// An empty DB or Collection matches every database or collection.
+type Resource struct {
+	DB          string `bson:"db"`
+	Collection  string `bson:"collection"`
+	Cluster     bool   `bson:"cluster"`
+	AnyResource bool   `bson:"anyResource"`
+}
+
+func (r Resource) String() string {
+	switch {
+	case r.AnyResource:
+		return "any resource"
+	case r.Cluster:
+		return "the cluster"
+	}
+	dbName, collection := r.DB, r.Collection
+	if dbName == "" {
+		dbName = "*"
+	}
+	if collection == "" {
+		collection = "*"
+	}
+	return dbName + "." + collection
+}
+
+// covers returns true if a privilege on r applies to all of other. System
+// collections are not covered by privileges on every collection.
+func (r Resource) covers(other Resource) bool {
+	switch {
+	case r.AnyResource:
+		return true
+	case r.Cluster || other.Cluster || other.AnyResource:
+		return r.Cluster == other.Cluster && !other.AnyResource
+	}
+	if r.DB != "" && r.DB != other.DB {
+		return false
+	}
+	if r.Collection == "" {
+		return other.Collection == "" || !strings.HasPrefix(other.Collection, "system.")
+	}
+	return r.Collection == other.Collection
+}
+
+// Privilege is a set of actions allowed on a resource.
+type Privilege struct {
+	Resource Resource `bson:"resource"`
+	Actions  []string `bson:"actions"`
+}
+
+// UserName is a user or role name and the database it is defined on.
+type UserName struct {
+	Name string `bson:"user"`
+	DB   string `bson:"db"`
+}
+
+func (u UserName) String() string {
+	return u.Name + "@" + u.DB
+}
+
+// ConnectionStatus describes the users authenticated on a connection and
+// the privileges they have between them.
+type ConnectionStatus struct {
+	Users []UserName `bson:"authenticatedUsers"`
+	Roles []struct {
+		Name string `bson:"role"`
+		DB   string `bson:"db"`
+	} `bson:"authenticatedUserRoles"`
+	Privileges []Privilege `bson:"authenticatedUserPrivileges"`
+}
+
+// GetConnectionStatus runs connectionStatus to find the users authenticated
+// on the connection and their privileges.
+func GetConnectionStatus(commander db.CommandRunner) (*ConnectionStatus, error) {
+	result := struct {
+		AuthInfo ConnectionStatus `bson:"authInfo"`
+	}{}
+	err := commander.Run(bson.D{{"connectionStatus", 1}, {"showPrivileges", true}}, &result, "admin")
+	if err != nil {
+		return nil, fmt.Errorf("error running connectionStatus: %v", err)
+	}
+	return &result.AuthInfo, nil
+}
+
+// RequiredAction is an action a tool needs to perform on a resource, and
+// the reason it needs to.
+type RequiredAction struct {
+	Action   string
+	Resource Resource
+	Reason   string
+}
+
+func (r RequiredAction) String() string {
+	return fmt.Sprintf("%v on %v", r.Action, r.Resource)
+}
+
+// Allows returns true if the privileges of the connection include the
+// required action, either by name or through anyAction.
+func (status *ConnectionStatus) Allows(required RequiredAction) bool {
+	for _, privilege := range status.Privileges {
+		if !privilege.Resource.covers(required.Resource) {
+			continue
+		}
+		for _, action := range privilege.Actions {
+			if action == required.Action || action == "anyAction" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteConnectionReport writes a report of the authenticated users and
+// whether they have each required action. It returns the actions that are
+// missing. If no user is authenticated, access control is assumed to be
+// disabled and nothing is reported missing.
+func WriteConnectionReport(out io.Writer, status *ConnectionStatus, required []RequiredAction) []RequiredAction {
+	if len(status.Users) == 0 {
+		fmt.Fprintln(out, "no authenticated users; assuming access control is disabled, so no privileges are checked")
+		return nil
+	}
+	fmt.Fprintf(out, "authenticated as %v\n", joinUserNames(status.Users))
+	roles := make([]UserName, 0, len(status.Roles))
+	for _, role := range status.Roles {
+		roles = append(roles, UserName{role.Name, role.DB})
+	}
+	fmt.Fprintf(out, "roles: %v\n", joinUserNames(roles))
+
+	missing := []RequiredAction{}
+	for _, action := range required {
+		result := "ok"
+		if !status.Allows(action) {
+			result = "MISSING"
+			missing = append(missing, action)
+		}
+		fmt.Fprintf(out, "%-8v%v (%v)\n", result, action, action.Reason)
+	}
+	return missing
+}
+
+func joinUserNames(names []UserName) string {
+	if len(names) == 0 {
+		return "(none)"
+	}
+	strs := make([]string, 0, len(names))
+	for _, name := range names {
+		strs = append(strs, name.String())
+	}
+	return strings.Join(strs, ", ")
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestPrivilegeChecks(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a user who can read every database and write to 'app'", t, func() {
+		status := &ConnectionStatus{
+			Users: []UserName{{"backup", "admin"}},
+			Privileges: []Privilege{
+				{Resource{}, []string{"find", "listCollections", "listIndexes"}},
+				{Resource{DB: "app"}, []string{"insert", "createIndex"}},
+				{Resource{Cluster: true}, []string{"listDatabases"}},
+			},
+		}
+		find := func(db, collection string) RequiredAction {
+			return RequiredAction{Action: "find", Resource: Resource{DB: db, Collection: collection}}
+		}
+
+		Convey("privileges on every collection should cover any normal collection", func() {
+			So(status.Allows(find("", "")), ShouldBeTrue)
+			So(status.Allows(find("app", "")), ShouldBeTrue)
+			So(status.Allows(find("other", "c")), ShouldBeTrue)
+		})
+
+		Convey("system collections should need their own privileges", func() {
+			So(status.Allows(find("admin", "system.users")), ShouldBeFalse)
+		})
+
+		Convey("privileges on one database should not cover others", func() {
+			insert := RequiredAction{Action: "insert", Resource: Resource{DB: "app", Collection: "c"}}
+			So(status.Allows(insert), ShouldBeTrue)
+			insert.Resource.DB = "other"
+			So(status.Allows(insert), ShouldBeFalse)
+			insert.Resource.DB = ""
+			So(status.Allows(insert), ShouldBeFalse)
+		})
+
+		Convey("cluster privileges should only cover the cluster", func() {
+			listDatabases := RequiredAction{Action: "listDatabases", Resource: Resource{Cluster: true}}
+			So(status.Allows(listDatabases), ShouldBeTrue)
+			listDatabases.Resource = Resource{}
+			So(status.Allows(listDatabases), ShouldBeFalse)
+		})
+
+		Convey("anyAction on anyResource should only be allowed with that privilege", func() {
+			everything := RequiredAction{Action: "anyAction", Resource: Resource{AnyResource: true}}
+			So(status.Allows(everything), ShouldBeFalse)
+			status.Privileges = append(status.Privileges,
+				Privilege{Resource{AnyResource: true}, []string{"anyAction"}})
+			So(status.Allows(everything), ShouldBeTrue)
+			So(status.Allows(find("admin", "system.users")), ShouldBeTrue)
+		})
+
+		Convey("the report should list missing actions", func() {
+			out := &bytes.Buffer{}
+			missing := WriteConnectionReport(out, status, []RequiredAction{
+				{Action: "find", Resource: Resource{DB: "app"}, Reason: "reading"},
+				{Action: "dropCollection", Resource: Resource{DB: "app"}, Reason: "dropping"},
+			})
+			So(len(missing), ShouldEqual, 1)
+			So(missing[0].Action, ShouldEqual, "dropCollection")
+			So(out.String(), ShouldContainSubstring, "authenticated as backup@admin")
+			So(out.String(), ShouldContainSubstring, "MISSING dropCollection on app.* (dropping)")
+		})
+	})
+
+	Convey("Without an authenticated user nothing should be reported missing", t, func() {
+		out := &bytes.Buffer{}
+		missing := WriteConnectionReport(out, &ConnectionStatus{}, []RequiredAction{
+			{Action: "insert", Resource: Resource{}, Reason: "inserting"},
+		})
+		So(missing, ShouldBeEmpty)
+	})
+}
@@ -61,6 +61,45 @@ func GetExtendedBsonD(doc bson.D) (bson.D, error) {
 	return bsonDoc, nil
 }
 
+// OrderLike returns converted, a value converted from extended JSON, with
+// each plain document in it rebuilt as a bson.D in the key order of
+// ordered, the same JSON decoded with json.UnmarshalOrderedBsonD. Extended
+// JSON is converted from documents decoded as maps, which lose the order
+// of their keys; this puts it back.
+func OrderLike(converted, ordered interface{}) interface{} {
+	switch value := converted.(type) {
+	case bson.D:
+		keys, ok := ordered.(bson.D)
+		if !ok || len(keys) != len(value) {
+			return value
+		}
+		for i := range value {
+			value[i].Value = OrderLike(value[i].Value, keys[i].Value)
+		}
+		return value
+	case map[string]interface{}:
+		keys, ok := ordered.(bson.D)
+		if !ok {
+			return value
+		}
+		document := make(bson.D, 0, len(keys))
+		for _, key := range keys {
+			document = append(document, bson.DocElem{key.Name, OrderLike(value[key.Name], key.Value)})
+		}
+		return document
+	case []interface{}:
+		elems, ok := ordered.([]interface{})
+		if !ok || len(elems) != len(value) {
+			return value
+		}
+		for i := range value {
+			value[i] = OrderLike(value[i], elems[i])
+		}
+		return value
+	}
+	return converted
+}
+
 // FindValueByKey returns the value of keyName in document. If keyName is not found
 // in the top-level of the document, ErrNoSuchField is returned as the error.
 func FindValueByKey(keyName string, document *bson.D) (interface{}, error) {
@@ -148,6 +187,22 @@ func ParseSpecialKeys(doc map[string]interface{}) (interface{}, error) {
 			}
 		}
 
+		if jsonValue, ok := doc["$numberDouble"]; ok {
+			switch v := jsonValue.(type) {
+			case string:
+				// canonical extended JSON spells the special values
+				// "NaN", "Infinity" and "-Infinity"
+				return strconv.ParseFloat(v, 64)
+
+			default:
+				return nil, errors.New("expected $numberDouble field to have string value")
+			}
+		}
+
+		if _, ok := doc["$numberDecimal"]; ok {
+			return nil, errors.New("Decimal128 ($numberDecimal) values are not supported")
+		}
+
 		if jsonValue, ok := doc["$timestamp"]; ok {
 			ts := json.Timestamp{}
 
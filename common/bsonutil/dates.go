@@ -0,0 +1,72 @@
+package bsonutil
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"time"
+)
+
+// RFC3339DateFormat is the layout of dates written as plain RFC 3339
+// strings, with the millisecond precision of BSON dates.
+const RFC3339DateFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// DatesToRFC3339 returns value with every date in it, at any depth of
+// documents and arrays, replaced by a string in RFC3339DateFormat. Dates
+// outside the years 0 to 9999, which RFC 3339 cannot represent, are left
+// as dates, to be written as extended JSON $date values.
+func DatesToRFC3339(value interface{}) interface{} {
+	return mapDates(value, func(leaf interface{}) interface{} {
+		if date, ok := leaf.(time.Time); ok {
+			if year := date.UTC().Year(); year >= 0 && year <= 9999 {
+				return date.UTC().Format(RFC3339DateFormat)
+			}
+		}
+		return leaf
+	})
+}
+
+// DatesFromRFC3339 returns value with every string in it, at any depth of
+// documents and arrays, that is a date in RFC3339DateFormat, with exactly
+// millisecond precision, replaced by that date. It undoes DatesToRFC3339,
+// but also converts any other string that happens to be such a date.
+func DatesFromRFC3339(value interface{}) interface{} {
+	return mapDates(value, func(leaf interface{}) interface{} {
+		if text, ok := leaf.(string); ok {
+			if date, err := time.Parse(RFC3339DateFormat, text); err == nil {
+				return date
+			}
+		}
+		return leaf
+	})
+}
+
+// mapDates returns value with convert applied to each value that is not a
+// document or an array.
+func mapDates(value interface{}, convert func(interface{}) interface{}) interface{} {
+	switch typed := value.(type) {
+	case bson.D:
+		mapped := make(bson.D, len(typed))
+		for i, elem := range typed {
+			mapped[i] = bson.DocElem{elem.Name, mapDates(elem.Value, convert)}
+		}
+		return mapped
+	case bson.M:
+		mapped := bson.M{}
+		for key, elem := range typed {
+			mapped[key] = mapDates(elem, convert)
+		}
+		return mapped
+	case map[string]interface{}:
+		mapped := map[string]interface{}{}
+		for key, elem := range typed {
+			mapped[key] = mapDates(elem, convert)
+		}
+		return mapped
+	case []interface{}:
+		mapped := make([]interface{}, len(typed))
+		for i, elem := range typed {
+			mapped[i] = mapDates(elem, convert)
+		}
+		return mapped
+	}
+	return convert(value)
+}
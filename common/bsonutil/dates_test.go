@@ -0,0 +1,85 @@
+package bsonutil
+
+import (
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+	"time"
+)
+
+func TestRFC3339Dates(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a document holding dates at several depths", t, func() {
+		date := time.Date(2020, 1, 2, 3, 4, 5, 6e6, time.UTC)
+		doc := bson.D{
+			{"top", date},
+			{"nested", bson.M{"$lt": date}},
+			{"array", []interface{}{date, "text"}},
+		}
+
+		Convey("dates should be written as RFC 3339 strings", func() {
+			converted := DatesToRFC3339(doc).(bson.D)
+			So(converted[0].Value, ShouldEqual, "2020-01-02T03:04:05.006Z")
+			So(converted[1].Value.(bson.M)["$lt"], ShouldEqual, "2020-01-02T03:04:05.006Z")
+			So(converted[2].Value.([]interface{})[1], ShouldEqual, "text")
+
+			Convey("and read back as the same dates", func() {
+				parsed := DatesFromRFC3339(converted).(bson.D)
+				So(parsed[0].Value.(time.Time).Equal(date), ShouldBeTrue)
+				So(parsed[1].Value.(bson.M)["$lt"].(time.Time).Equal(date), ShouldBeTrue)
+				So(parsed[2].Value.([]interface{})[0].(time.Time).Equal(date), ShouldBeTrue)
+				So(parsed[2].Value.([]interface{})[1], ShouldEqual, "text")
+			})
+		})
+	})
+
+	Convey("Strings without exactly millisecond precision should not become dates", t, func() {
+		for _, text := range []string{"2020-01-02T03:04:05Z", "2020-01-02T03:04:05.123456Z", "2020-01-02"} {
+			So(DatesFromRFC3339(text), ShouldEqual, text)
+		}
+	})
+
+	Convey("Dates written to metadata as RFC 3339 should read back the same", t, func() {
+		// roundTrip writes the value as a metadata file does and parses it
+		// back as mongorestore does
+		roundTrip := func(value bson.D) bson.D {
+			converted, err := ConvertBSONValueToJSON(DatesToRFC3339(value))
+			So(err, ShouldBeNil)
+			jsonBytes, err := json.Marshal(converted)
+			So(err, ShouldBeNil)
+			decoded := bson.D{}
+			So(json.Unmarshal(jsonBytes, &decoded), ShouldBeNil)
+			parsed, err := GetExtendedBsonD(decoded)
+			So(err, ShouldBeNil)
+			return DatesFromRFC3339(parsed).(bson.D)
+		}
+
+		Convey("with their milliseconds, before and after the epoch", func() {
+			for _, date := range []time.Time{
+				time.Date(2020, 1, 2, 3, 4, 5, 999e6, time.UTC),
+				time.Date(1969, 12, 31, 23, 59, 59, 1e6, time.UTC),
+				time.Date(9999, 12, 31, 23, 59, 59, 999e6, time.UTC),
+			} {
+				parsed := roundTrip(bson.D{{"d", date}})
+				So(parsed[0].Value, ShouldHaveSameTypeAs, time.Time{})
+				So(parsed[0].Value.(time.Time).Equal(date), ShouldBeTrue)
+			}
+		})
+
+		Convey("as $date with $numberLong outside the years RFC 3339 can represent", func() {
+			date := time.Date(12000, 1, 1, 0, 0, 0, 5e6, time.UTC)
+			converted, err := ConvertBSONValueToJSON(DatesToRFC3339(bson.D{{"d", date}}))
+			So(err, ShouldBeNil)
+			jsonBytes, err := json.Marshal(converted)
+			So(err, ShouldBeNil)
+			So(string(jsonBytes), ShouldContainSubstring, "$numberLong")
+
+			parsed := roundTrip(bson.D{{"d", date}})
+			So(parsed[0].Value.(time.Time).Equal(date), ShouldBeTrue)
+		})
+	})
+}
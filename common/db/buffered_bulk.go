@@ -2,6 +2,8 @@ package db
 
 import (
 	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -15,8 +17,12 @@ type BufferedBulkInserter struct {
 	collection      *mgo.Collection
 	continueOnError bool
 	docLimit        int
+	byteLimit       int
 	byteCount       int
 	docCount        int
+	flushCallback   func(docCount int, err error)
+	maxRetries      int
+	backoff         util.Backoff
 }
 
 // NewBufferedBulkInserter returns an initialized BufferedBulkInserter
@@ -27,6 +33,7 @@ func NewBufferedBulkInserter(collection *mgo.Collection, docLimit int,
 		collection:      collection,
 		continueOnError: continueOnError,
 		docLimit:        docLimit,
+		byteLimit:       MaxMessageSize,
 	}
 	bb.resetBulk()
 	return bb
@@ -50,7 +57,7 @@ func (bb *BufferedBulkInserter) Insert(doc interface{}) error {
 		return fmt.Errorf("bson encoding error: %v", err)
 	}
 	// flush if we are full
-	if bb.docCount >= bb.docLimit || bb.byteCount+len(rawBytes) > MaxMessageSize {
+	if bb.docCount >= bb.docLimit || bb.byteCount+len(rawBytes) > bb.byteLimit {
 		err = bb.Flush()
 	}
 	// buffer the document
@@ -60,14 +67,62 @@ func (bb *BufferedBulkInserter) Insert(doc interface{}) error {
 	return err
 }
 
+// SetByteLimit makes the inserter flush before the buffered documents would
+// exceed byteLimit bytes in total, as well as when the doc limit is reached.
+// Limits above MaxMessageSize, the default, are lowered to it. A document
+// larger than the limit is still inserted, in a batch of its own.
+func (bb *BufferedBulkInserter) SetByteLimit(byteLimit int) {
+	if byteLimit > MaxMessageSize {
+		byteLimit = MaxMessageSize
+	}
+	bb.byteLimit = byteLimit
+}
+
+// SetFlushCallback registers a function that is called after every bulk
+// insert with the number of documents sent and the error returned, if any.
+func (bb *BufferedBulkInserter) SetFlushCallback(callback func(docCount int, err error)) {
+	bb.flushCallback = callback
+}
+
+// SetRetryPolicy makes each bulk insert that fails with a connection error
+// be retried up to maxRetries times, or without limit if it is negative,
+// waiting according to backoff in between.
+func (bb *BufferedBulkInserter) SetRetryPolicy(maxRetries int, backoff util.Backoff) {
+	bb.maxRetries = maxRetries
+	bb.backoff = backoff
+}
+
 // Flush writes all buffered documents in one bulk insert then resets the buffer.
 func (bb *BufferedBulkInserter) Flush() error {
 	if bb.docCount == 0 {
 		return nil
 	}
 	defer bb.resetBulk()
-	if _, err := bb.bulk.Run(); err != nil {
+	err := util.Retry(bb.maxRetries, bb.backoff, bb.refreshOnConnectionError, func() error {
+		_, err := bb.bulk.Run()
+		return err
+	})
+	if bb.flushCallback != nil {
+		bb.flushCallback(bb.docCount, err)
+	}
+	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// refreshOnConnectionError returns true and resets the collection's session,
+// so that it reconnects, if err is a connection error. Once the retry
+// budget is spent there is no retry to prepare for, so it only returns true.
+func (bb *BufferedBulkInserter) refreshOnConnectionError(err error) bool {
+	if !IsConnectionError(err) {
+		return false
+	}
+	if bb.backoff.Budget.Spent() {
+		return true
+	}
+	log.Logf(log.Always, "retrying bulk insert into %v after connection error: %v",
+		bb.collection.FullName, err)
+	bb.collection.Database.Session.Refresh()
+	return true
+}
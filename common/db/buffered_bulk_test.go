@@ -5,6 +5,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/testutil"
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/mgo.v2/bson"
+	"strings"
 	"testing"
 )
 
@@ -98,6 +99,35 @@ func TestBufferedBulkInserterInserts(t *testing.T) {
 			})
 		})
 
+		Convey("using a test collection with a doc limit of 100 and a byte limit of 1MB", func() {
+			testCol := session.DB("tools-test").C("bulk4")
+			bufBulk = NewBufferedBulkInserter(testCol, 100, false)
+			bufBulk.SetByteLimit(1024 * 1024)
+			flushes := []int{}
+			bufBulk.SetFlushCallback(func(docCount int, err error) {
+				So(err, ShouldBeNil)
+				flushes = append(flushes, docCount)
+			})
+
+			Convey("inserting small documents between two large ones", func() {
+				large := strings.Repeat("x", 600*1024)
+				So(bufBulk.Insert(bson.M{"_id": 0, "s": large}), ShouldBeNil)
+				for i := 1; i <= 150; i++ {
+					So(bufBulk.Insert(bson.M{"_id": i}), ShouldBeNil)
+				}
+				So(bufBulk.Insert(bson.M{"_id": 151, "s": large}), ShouldBeNil)
+				So(bufBulk.Insert(bson.M{"_id": 152, "s": large}), ShouldBeNil)
+				So(bufBulk.Flush(), ShouldBeNil)
+
+				Convey("should end batches at whichever limit is reached first", func() {
+					So(flushes, ShouldResemble, []int{100, 52, 1})
+					count, err := testCol.Count()
+					So(err, ShouldBeNil)
+					So(count, ShouldEqual, 153)
+				})
+			})
+		})
+
 		Reset(func() {
 			session.DB("tools-test").DropDatabase()
 		})
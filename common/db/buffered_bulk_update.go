@@ -0,0 +1,263 @@
+package db
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// The largest batch of operations a write command may hold on any server
+// version, and the size of a batch that leaves room for the rest of the
+// command within the maximum BSON document size.
+const (
+	maxWriteBatchCount = 1000
+	maxWriteBatchBytes = MaxBSONSize - 16*1024
+)
+
+// BulkWriteError is the error of one operation of a batch sent by a
+// BufferedBulkUpdater.
+type BulkWriteError struct {
+	// position of the operation in its batch
+	Index  int    `bson:"index"`
+	Code   int    `bson:"code"`
+	ErrMsg string `bson:"errmsg"`
+	// the key of a duplicate key error, which newer servers report either
+	// in the write error itself or in its errInfo
+	KeyPattern bson.D `bson:"keyPattern"`
+	KeyValue   bson.D `bson:"keyValue"`
+	ErrInfo    struct {
+		KeyPattern bson.D `bson:"keyPattern"`
+		KeyValue   bson.D `bson:"keyValue"`
+	} `bson:"errInfo"`
+}
+
+func (writeErr BulkWriteError) Error() string {
+	return writeErr.ErrMsg
+}
+
+// IsDup returns true if the operation failed because of a duplicate key.
+func (writeErr BulkWriteError) IsDup() bool {
+	return mgo.IsDup(&mgo.QueryError{Code: writeErr.Code, Message: writeErr.ErrMsg})
+}
+
+// IsDupID returns true if the operation failed because of a duplicate key
+// in the _id index, as when an upsert's selector does not match the
+// document with its _id, rather than in another unique index. The key the
+// server reports is used if there is one; older servers only name the
+// index in the message.
+func (writeErr BulkWriteError) IsDupID() bool {
+	if !writeErr.IsDup() {
+		return false
+	}
+	fields := dupKeyFields(writeErr.ErrInfo.KeyPattern, writeErr.ErrInfo.KeyValue)
+	if fields == nil {
+		fields = dupKeyFields(writeErr.KeyPattern, writeErr.KeyValue)
+	}
+	if fields != nil {
+		return len(fields) == 1 && fields[0] == "_id"
+	}
+	return strings.Contains(writeErr.ErrMsg, "index: _id_ ") ||
+		strings.Contains(writeErr.ErrMsg, ".$_id_ ")
+}
+
+// dupKeyFields returns the names of the fields of a duplicate key, from its
+// index key pattern or else its value, or nil if neither is reported.
+func dupKeyFields(keyPattern, keyValue bson.D) []string {
+	key := keyPattern
+	if len(key) == 0 {
+		key = keyValue
+	}
+	if len(key) == 0 {
+		return nil
+	}
+	fields := make([]string, len(key))
+	for i, elem := range key {
+		fields[i] = elem.Name
+	}
+	return fields
+}
+
+// BulkWriteResult is the reply to a batch sent by a BufferedBulkUpdater.
+type BulkWriteResult struct {
+	// operations in the batch
+	Count int `bson:"-"`
+	// documents matched or upserted by updates, or removed; upserted
+	// documents are also listed in Upserted
+	N        int `bson:"n"`
+	Upserted []struct {
+		Index int         `bson:"index"`
+		ID    interface{} `bson:"_id"`
+	} `bson:"upserted"`
+	WriteErrors       []BulkWriteError `bson:"writeErrors"`
+	WriteConcernError *struct {
+		Code   int    `bson:"code"`
+		ErrMsg string `bson:"errmsg"`
+	} `bson:"writeConcernError"`
+}
+
+// BufferedBulkUpdater is the counterpart of BufferedBulkInserter for
+// upserts and removals by selector, which mgo's Bulk cannot send: it queues
+// them up and sends them in update and delete write commands when the
+// operation limit (or maximum batch size) is reached. Operations are sent in
+// the order they are queued; since a command holds only one kind of
+// operation, switching between upserts and removals sends the queued ones
+// first. Must be flushed at the end to ensure that all operations are sent.
+type BufferedBulkUpdater struct {
+	collection       *mgo.Collection
+	continueOnError  bool
+	opLimit          int
+	byteLimit        int
+	byteCount        int
+	command          string
+	ops              []bson.Raw
+	flushCallback    func(result *BulkWriteResult, err error)
+	writeErrorFilter func(writeErr BulkWriteError) bool
+	maxRetries       int
+	backoff          util.Backoff
+}
+
+// NewBufferedBulkUpdater returns an initialized BufferedBulkUpdater for
+// writing. Unless continueOnError is set, a batch stops at the first
+// operation that fails.
+func NewBufferedBulkUpdater(collection *mgo.Collection, opLimit int,
+	continueOnError bool) *BufferedBulkUpdater {
+	if opLimit <= 0 || opLimit > maxWriteBatchCount {
+		opLimit = maxWriteBatchCount
+	}
+	return &BufferedBulkUpdater{
+		collection:      collection,
+		continueOnError: continueOnError,
+		opLimit:         opLimit,
+		byteLimit:       maxWriteBatchBytes,
+	}
+}
+
+// Upsert queues an update of the document matching selector, inserting it
+// if there is none. An update without operators replaces the document. If
+// the buffer is full, the queued operations are sent, returning any error
+// that occurs.
+func (bu *BufferedBulkUpdater) Upsert(selector, update interface{}) error {
+	return bu.add("update", bson.D{{"q", selector}, {"u", update}, {"upsert", true}})
+}
+
+// Remove queues a removal of the document matching selector. If the buffer
+// is full, the queued operations are sent, returning any error that occurs.
+func (bu *BufferedBulkUpdater) Remove(selector interface{}) error {
+	return bu.add("delete", bson.D{{"q", selector}, {"limit", 1}})
+}
+
+func (bu *BufferedBulkUpdater) add(command string, op bson.D) error {
+	rawBytes, err := bson.Marshal(op)
+	if err != nil {
+		return fmt.Errorf("bson encoding error: %v", err)
+	}
+	// flush if we are full, or the operation needs a different command
+	if len(bu.ops) >= bu.opLimit || bu.byteCount+len(rawBytes) > bu.byteLimit ||
+		(len(bu.ops) > 0 && command != bu.command) {
+		err = bu.Flush()
+	}
+	bu.command = command
+	bu.ops = append(bu.ops, bson.Raw{Kind: 0x03, Data: rawBytes})
+	bu.byteCount += len(rawBytes)
+	return err
+}
+
+// SetByteLimit makes the updater send the queued operations before they
+// would exceed byteLimit bytes in total, as well as when the operation limit
+// is reached. Limits above the largest batch a command can hold, the
+// default, are lowered to it.
+func (bu *BufferedBulkUpdater) SetByteLimit(byteLimit int) {
+	if byteLimit > maxWriteBatchBytes {
+		byteLimit = maxWriteBatchBytes
+	}
+	bu.byteLimit = byteLimit
+}
+
+// SetFlushCallback registers a function that is called after every batch
+// with the server's reply, if any, and the error Flush returns.
+func (bu *BufferedBulkUpdater) SetFlushCallback(callback func(result *BulkWriteResult, err error)) {
+	bu.flushCallback = callback
+}
+
+// SetWriteErrorFilter registers a function that returns true for the errors
+// of single operations that are expected, such as duplicate keys, which are
+// then not returned by Flush. The operations are still counted as failed in
+// the result passed to the flush callback.
+func (bu *BufferedBulkUpdater) SetWriteErrorFilter(filter func(writeErr BulkWriteError) bool) {
+	bu.writeErrorFilter = filter
+}
+
+// SetRetryPolicy makes each batch that fails with a connection error be
+// retried up to maxRetries times, or without limit if it is negative,
+// waiting according to backoff in between.
+func (bu *BufferedBulkUpdater) SetRetryPolicy(maxRetries int, backoff util.Backoff) {
+	bu.maxRetries = maxRetries
+	bu.backoff = backoff
+}
+
+// Flush sends all queued operations in one write command then resets the
+// buffer. It returns an error if the command fails, or the first error of
+// an operation that is not filtered out.
+func (bu *BufferedBulkUpdater) Flush() error {
+	if len(bu.ops) == 0 {
+		return nil
+	}
+	listField := "updates"
+	if bu.command == "delete" {
+		listField = "deletes"
+	}
+	command := bson.D{
+		{bu.command, bu.collection.Name},
+		{listField, bu.ops},
+		{"ordered", !bu.continueOnError},
+		{"writeConcern", WriteConcernDocument(bu.collection.Database.Session.Safe())},
+	}
+	result := &BulkWriteResult{Count: len(bu.ops)}
+	defer func() {
+		bu.ops = nil
+		bu.byteCount = 0
+	}()
+	err := util.Retry(bu.maxRetries, bu.backoff, bu.refreshOnConnectionError, func() error {
+		*result = BulkWriteResult{Count: len(bu.ops)}
+		return bu.collection.Database.Run(command, result)
+	})
+	if err == nil {
+		err = bu.resultError(result)
+	}
+	if bu.flushCallback != nil {
+		bu.flushCallback(result, err)
+	}
+	return err
+}
+
+// resultError returns the first error of the reply that is not filtered out.
+func (bu *BufferedBulkUpdater) resultError(result *BulkWriteResult) error {
+	for _, writeErr := range result.WriteErrors {
+		if bu.writeErrorFilter == nil || !bu.writeErrorFilter(writeErr) {
+			return writeErr
+		}
+	}
+	if result.WriteConcernError != nil {
+		return fmt.Errorf("write concern error: %v", result.WriteConcernError.ErrMsg)
+	}
+	return nil
+}
+
+// refreshOnConnectionError returns true and resets the collection's session,
+// so that it reconnects, if err is a connection error. Once the retry
+// budget is spent there is no retry to prepare for, so it only returns true.
+func (bu *BufferedBulkUpdater) refreshOnConnectionError(err error) bool {
+	if !IsConnectionError(err) {
+		return false
+	}
+	if bu.backoff.Budget.Spent() {
+		return true
+	}
+	log.Logf(log.Always, "retrying bulk %v of %v after connection error: %v",
+		bu.command, bu.collection.FullName, err)
+	bu.collection.Database.Session.Refresh()
+	return true
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestBufferedBulkUpdater(t *testing.T) {
+
+	testutil.VerifyTestType(t, "db")
+
+	Convey("With a valid session", t, func() {
+		opts := options.ToolOptions{
+			Connection: &options.Connection{
+				Port: DefaultTestPort,
+			},
+			SSL:  &options.SSL{},
+			Auth: &options.Auth{},
+		}
+		provider, err := NewSessionProvider(opts)
+		So(err, ShouldBeNil)
+		session, err := provider.GetSession()
+		So(err, ShouldBeNil)
+		testCol := session.DB("tools-test").C("bulkupdate")
+		testCol.DropCollection()
+		So(testCol.Insert(bson.M{"_id": 1, "a": 1}, bson.M{"_id": 2, "a": 2}), ShouldBeNil)
+
+		Convey("upserts and removals should be sent in order, in batches", func() {
+			results := []*BulkWriteResult{}
+			bulk := NewBufferedBulkUpdater(testCol, 2, false)
+			bulk.SetFlushCallback(func(result *BulkWriteResult, err error) {
+				So(err, ShouldBeNil)
+				results = append(results, result)
+			})
+			So(bulk.Upsert(bson.M{"_id": 1}, bson.M{"$set": bson.M{"b": 1}}), ShouldBeNil)
+			So(bulk.Upsert(bson.M{"_id": 3}, bson.M{"a": 3}), ShouldBeNil)
+			So(bulk.Upsert(bson.M{"_id": 4}, bson.M{"a": 4}), ShouldBeNil)
+			So(bulk.Remove(bson.M{"_id": 2}), ShouldBeNil)
+			So(bulk.Remove(bson.M{"_id": 4}), ShouldBeNil)
+			So(bulk.Flush(), ShouldBeNil)
+
+			So(len(results), ShouldEqual, 3)
+			So(results[0].Count, ShouldEqual, 2)
+			So(results[0].N, ShouldEqual, 2)
+			So(len(results[0].Upserted), ShouldEqual, 1)
+			So(results[1].Count, ShouldEqual, 1)
+			So(results[2].N, ShouldEqual, 2)
+
+			ids := []bson.M{}
+			So(testCol.Find(nil).Sort("_id").All(&ids), ShouldBeNil)
+			So(ids, ShouldResemble, []bson.M{{"_id": 1, "a": 1, "b": 1}, {"_id": 3, "a": 3}})
+		})
+
+		Convey("the errors of single operations should be returned unless filtered", func() {
+			// replacing the _id of a document is an error
+			bulk := NewBufferedBulkUpdater(testCol, 10, true)
+			So(bulk.Upsert(bson.M{"_id": 1}, bson.M{"_id": 5}), ShouldBeNil)
+			So(bulk.Upsert(bson.M{"_id": 2}, bson.M{"$set": bson.M{"b": 2}}), ShouldBeNil)
+			err := bulk.Flush()
+			So(err, ShouldNotBeNil)
+			_, ok := err.(BulkWriteError)
+			So(ok, ShouldBeTrue)
+
+			bulk.SetWriteErrorFilter(func(writeErr BulkWriteError) bool { return writeErr.Index == 0 })
+			var result *BulkWriteResult
+			bulk.SetFlushCallback(func(r *BulkWriteResult, err error) { result = r })
+			So(bulk.Upsert(bson.M{"_id": 1}, bson.M{"_id": 5}), ShouldBeNil)
+			So(bulk.Flush(), ShouldBeNil)
+			So(len(result.WriteErrors), ShouldEqual, 1)
+		})
+
+		Reset(func() {
+			testCol.DropCollection()
+			session.Close()
+		})
+	})
+}
+
+func TestBulkWriteErrorIsDupID(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With duplicate key errors in a write command reply", t, func() {
+		decode := func(writeErr bson.M) BulkWriteError {
+			raw, err := bson.Marshal(bson.M{"writeErrors": []bson.M{writeErr}})
+			So(err, ShouldBeNil)
+			result := BulkWriteResult{}
+			So(bson.Unmarshal(raw, &result), ShouldBeNil)
+			So(len(result.WriteErrors), ShouldEqual, 1)
+			return result.WriteErrors[0]
+		}
+
+		Convey("the key pattern in errInfo should be used over the message", func() {
+			writeErr := decode(bson.M{"index": 0, "code": 11000,
+				"errmsg":  "E11000 duplicate key error collection: test.c index: _id_ dup key",
+				"errInfo": bson.M{"keyPattern": bson.D{{"email", 1}}, "keyValue": bson.D{{"email", "a"}}}})
+			So(writeErr.IsDupID(), ShouldBeFalse)
+
+			writeErr = decode(bson.M{"index": 0, "code": 11000, "errmsg": "E11000 duplicate key error",
+				"errInfo": bson.M{"keyPattern": bson.D{{"_id", 1}}}})
+			So(writeErr.IsDupID(), ShouldBeTrue)
+		})
+
+		Convey("the key value should be used without a key pattern", func() {
+			writeErr := decode(bson.M{"index": 0, "code": 11000, "errmsg": "E11000 duplicate key error",
+				"keyValue": bson.D{{"_id", 5}}})
+			So(writeErr.IsDupID(), ShouldBeTrue)
+
+			writeErr = decode(bson.M{"index": 0, "code": 11000, "errmsg": "E11000 duplicate key error",
+				"keyValue": bson.D{{"_id", 5}, {"a", 1}}})
+			So(writeErr.IsDupID(), ShouldBeFalse)
+		})
+
+		Convey("the index named in the message should be used without a key", func() {
+			writeErr := decode(bson.M{"index": 0, "code": 11000,
+				"errmsg": "E11000 duplicate key error collection: test.c index: _id_ dup key: { : 1 }"})
+			So(writeErr.IsDupID(), ShouldBeTrue)
+
+			writeErr = decode(bson.M{"index": 0, "code": 11000,
+				"errmsg": "E11000 duplicate key error collection: test.c index: email_1 dup key: { : \"a\" }"})
+			So(writeErr.IsDupID(), ShouldBeFalse)
+		})
+
+		Convey("other errors should not be duplicate _id errors", func() {
+			writeErr := decode(bson.M{"index": 0, "code": 2, "errmsg": "bad value",
+				"errInfo": bson.M{"keyPattern": bson.D{{"_id", 1}}}})
+			So(writeErr.IsDupID(), ShouldBeFalse)
+		})
+	})
+}
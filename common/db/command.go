@@ -106,6 +106,48 @@ func (sp *SessionProvider) GetNodeType() (NodeType, error) {
 	return Standalone, nil
 }
 
+// MaxBSONObjectSize returns the largest document size, in bytes, that the
+// connected server accepts, as reported by isMaster. Servers too old to
+// report it get MaxBSONSize.
+func (sp *SessionProvider) MaxBSONObjectSize() (int, error) {
+	session, err := sp.GetSession()
+	if err != nil {
+		return 0, err
+	}
+	session.SetSocketTimeout(0)
+	defer session.Close()
+	masterDoc := struct {
+		MaxBSONObjectSize int `bson:"maxBsonObjectSize"`
+	}{}
+	err = session.Run("isMaster", &masterDoc)
+	if err != nil {
+		return 0, err
+	}
+	if masterDoc.MaxBSONObjectSize <= 0 {
+		return MaxBSONSize, nil
+	}
+	return masterDoc.MaxBSONObjectSize, nil
+}
+
+// ReplicaSetName returns the name of the replica set the connected server
+// belongs to, or an empty string if it is not a replica set member.
+func (sp *SessionProvider) ReplicaSetName() (string, error) {
+	session, err := sp.GetSession()
+	if err != nil {
+		return "", err
+	}
+	session.SetSocketTimeout(0)
+	defer session.Close()
+	masterDoc := struct {
+		SetName string `bson:"setName"`
+	}{}
+	err = session.Run("isMaster", &masterDoc)
+	if err != nil {
+		return "", err
+	}
+	return masterDoc.SetName, nil
+}
+
 // IsReplicaSet returns a boolean which is true if the connected server is part
 // of a replica set.
 func (sp *SessionProvider) IsReplicaSet() (bool, error) {
@@ -125,6 +167,39 @@ func (sp *SessionProvider) IsMongos() (bool, error) {
 	return nodeType == Mongos, nil
 }
 
+// IsConfigServer returns true if the connected server was started as a
+// config server, by looking at the result of calling getCmdLineOpts.
+func (sp *SessionProvider) IsConfigServer() (bool, error) {
+	session, err := sp.GetSession()
+	if err != nil {
+		return false, err
+	}
+	session.SetSocketTimeout(0)
+	defer session.Close()
+	cmdLineOpts := struct {
+		Argv   []string `bson:"argv"`
+		Parsed struct {
+			ConfigSvr bool `bson:"configsvr"`
+			Sharding  struct {
+				ClusterRole string `bson:"clusterRole"`
+			} `bson:"sharding"`
+		} `bson:"parsed"`
+	}{}
+	err = session.Run("getCmdLineOpts", &cmdLineOpts)
+	if err != nil {
+		return false, err
+	}
+	if cmdLineOpts.Parsed.ConfigSvr || cmdLineOpts.Parsed.Sharding.ClusterRole == "configsvr" {
+		return true, nil
+	}
+	for _, arg := range cmdLineOpts.Argv {
+		if arg == "--configsvr" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // SupportsRepairCursor takes in an example db and collection name and
 // returns true if the connected server supports the repairCursor command.
 // It returns false and the error that occurred if it is not supported.
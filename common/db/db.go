@@ -5,8 +5,10 @@ package db
 import (
 	"errors"
 	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/password"
+	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	"io"
@@ -59,6 +61,14 @@ type SessionProvider struct {
 
 	// flags for generating the master session
 	flags sessionFlag
+
+	// the most connections the master session and its copies may open to
+	// each server; 0 leaves the driver's default
+	poolLimit int
+
+	// tokens bounding the number of workers holding a connection at once;
+	// nil if there is no limit
+	connectionTokens chan struct{}
 }
 
 // ApplyOpsResponse represents the response from an 'applyOps' command.
@@ -78,6 +88,22 @@ type Oplog struct {
 	Query     bson.M              `bson:"o2"`
 }
 
+// OplogMetadata describes the oplog that mongodump --oplog captured, and is
+// written next to it in oplog.metadata.json, so that its format can be
+// known when it is replayed.
+type OplogMetadata struct {
+	// the collection the entries were read from, oplog.rs for replica
+	// sets or oplog.$main for master/slave
+	Collection string `json:"collection"`
+	// the version of the server the entries were read from
+	ServerVersion string `json:"serverVersion"`
+	// with mongodump --oplogOnly, the window of entries dumped, exclusive
+	// of Since and inclusive of Until, as <time_t>:<ordinal>; Until is
+	// the Since of the next increment
+	Since string `json:"since,omitempty"`
+	Until string `json:"until,omitempty"`
+}
+
 // Returns a session connected to the database server for which the
 // session provider is configured.
 func (self *SessionProvider) GetSession() (*mgo.Session, error) {
@@ -103,10 +129,26 @@ func (self *SessionProvider) GetSession() (*mgo.Session, error) {
 	if (self.flags & Monotonic) > 0 {
 		self.masterSession.SetMode(mgo.Monotonic, true)
 	}
+	if self.poolLimit > 0 {
+		self.masterSession.SetPoolLimit(self.poolLimit)
+	}
 	// copy the provider's master session, for connection pooling
 	return self.masterSession.Copy(), nil
 }
 
+// Close closes the provider's master session, if it was created, so that
+// its connections are released. Sessions already returned by GetSession
+// keep their connections until they are closed themselves.
+func (self *SessionProvider) Close() {
+	self.masterSessionLock.Lock()
+	defer self.masterSessionLock.Unlock()
+
+	if self.masterSession != nil {
+		self.masterSession.Close()
+		self.masterSession = nil
+	}
+}
+
 // SetFlags allows certain modifications to the masterSession after
 // initial creation.
 func (self *SessionProvider) SetFlags(flagBits sessionFlag) {
@@ -120,6 +162,48 @@ func (self *SessionProvider) SetFlags(flagBits sessionFlag) {
 	self.flags = flagBits
 }
 
+// SetPoolLimit sets the maximum number of connections that the sessions
+// returned by GetSession may open to each server; callers wait for a free
+// connection beyond it. A limit of zero or less leaves the driver's
+// default. Sessions already returned keep the limit they had.
+func (self *SessionProvider) SetPoolLimit(limit int) {
+	self.masterSessionLock.Lock()
+	defer self.masterSessionLock.Unlock()
+
+	self.poolLimit = limit
+	if self.masterSession != nil && limit > 0 {
+		self.masterSession.SetPoolLimit(limit)
+	}
+}
+
+// SetMaxConnections limits the number of callers that may hold a connection
+// token from AcquireConnection at once. A limit of zero or less removes it.
+// It must be called before any tokens are acquired.
+func (self *SessionProvider) SetMaxConnections(limit int) {
+	if limit <= 0 {
+		self.connectionTokens = nil
+		return
+	}
+	self.connectionTokens = make(chan struct{}, limit)
+}
+
+// AcquireConnection blocks until a connection token is available under the
+// limit set by SetMaxConnections, and returns a function that releases it.
+// Workers should hold a token for as long as they use their own session.
+func (self *SessionProvider) AcquireConnection() (release func()) {
+	if self.connectionTokens == nil {
+		return func() {}
+	}
+	select {
+	case self.connectionTokens <- struct{}{}:
+	default:
+		log.Logf(log.Info, "waiting for a free connection (limited to %v by --maxConnections)",
+			cap(self.connectionTokens))
+		self.connectionTokens <- struct{}{}
+	}
+	return func() { <-self.connectionTokens }
+}
+
 // NewSessionProvider constructs a session provider but does not attempt to
 // create the initial session.
 func NewSessionProvider(opts options.ToolOptions) (*SessionProvider, error) {
@@ -129,6 +213,7 @@ func NewSessionProvider(opts options.ToolOptions) (*SessionProvider, error) {
 	// finalize auth options, filling in missing passwords
 	if opts.Auth.ShouldAskForPassword() {
 		opts.Auth.Password = password.Prompt()
+		log.RedactSecret(opts.Auth.Password)
 	}
 
 	// create the connector for dialing the database
@@ -144,11 +229,15 @@ func NewSessionProvider(opts options.ToolOptions) (*SessionProvider, error) {
 
 // IsConnectionError returns a boolean indicating if a given error is due to
 // an error in an underlying DB connection (as opposed to some other write
-// failure such as a duplicate key error)
+// failure such as a duplicate key error). Running out of time to retry a
+// connection error is itself a connection error.
 func IsConnectionError(err error) bool {
 	if err == nil {
 		return false
 	}
+	if _, ok := err.(util.RetryBudgetError); ok {
+		return true
+	}
 	if err.Error() == ErrNoReachableServers.Error() {
 		return true
 	}
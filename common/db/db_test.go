@@ -6,6 +6,7 @@ import (
 	. "github.com/smartystreets/goconvey/convey"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestNewSessionProvider(t *testing.T) {
@@ -49,6 +50,26 @@ func TestNewSessionProvider(t *testing.T) {
 
 		})
 
+		Convey("closing it should close the master session", func() {
+			opts := options.ToolOptions{
+				Connection: &options.Connection{
+					Port: DefaultTestPort,
+				},
+				SSL:  &options.SSL{},
+				Auth: &options.Auth{},
+			}
+			provider, err := NewSessionProvider(opts)
+			So(err, ShouldBeNil)
+			// closing a provider that never connected does nothing
+			provider.Close()
+			session, err := provider.GetSession()
+			So(err, ShouldBeNil)
+			session.Close()
+			provider.Close()
+			So(provider.masterSession, ShouldBeNil)
+
+		})
+
 	})
 
 }
@@ -61,3 +82,46 @@ type listDatabasesCommand struct {
 func (self *listDatabasesCommand) AsRunnable() interface{} {
 	return "listDatabases"
 }
+
+func TestAcquireConnection(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a session provider limited to two connections", t, func() {
+		provider := &SessionProvider{}
+		provider.SetMaxConnections(2)
+
+		Convey("a third caller should block until a token is released", func() {
+			releaseOne := provider.AcquireConnection()
+			releaseTwo := provider.AcquireConnection()
+
+			acquired := make(chan struct{})
+			go func() {
+				release := provider.AcquireConnection()
+				close(acquired)
+				release()
+			}()
+
+			select {
+			case <-acquired:
+				t.Fatal("acquired a connection above the limit")
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			releaseOne()
+			select {
+			case <-acquired:
+			case <-time.After(time.Second):
+				t.Fatal("never acquired a released connection")
+			}
+			releaseTwo()
+		})
+	})
+
+	Convey("Without a limit, acquiring should never block", t, func() {
+		provider := &SessionProvider{}
+		for i := 0; i < 100; i++ {
+			provider.AcquireConnection()
+		}
+	})
+}
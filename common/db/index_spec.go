@@ -0,0 +1,118 @@
+package db
+
+import (
+	"fmt"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// knownIndexOptions lists the index spec fields that current servers accept.
+// Servers from 3.4 on reject index specs with any other field.
+var knownIndexOptions = map[string]bool{
+	"v":                       true,
+	"key":                     true,
+	"name":                    true,
+	"ns":                      true,
+	"unique":                  true,
+	"background":              true,
+	"sparse":                  true,
+	"expireAfterSeconds":      true,
+	"storageEngine":           true,
+	"partialFilterExpression": true,
+	"collation":               true,
+	"weights":                 true,
+	"default_language":        true,
+	"language_override":       true,
+	"textIndexVersion":        true,
+	"2dsphereIndexVersion":    true,
+	"bits":                    true,
+	"min":                     true,
+	"max":                     true,
+	"bucketSize":              true,
+	"hidden":                  true,
+	"wildcardProjection":      true,
+}
+
+// knownIndexTypes lists the string values allowed in an index key pattern.
+var knownIndexTypes = map[string]bool{
+	"2d":          true,
+	"2dsphere":    true,
+	"geoHaystack": true,
+	"hashed":      true,
+	"text":        true,
+}
+
+// CheckIndexSpec inspects an index spec, as returned by GetIndexes, for
+// features that are deprecated or that newer servers refuse to create.
+// It returns a description of each problem found.
+func CheckIndexSpec(index bson.D) []string {
+	problems := []string{}
+	var key bson.D
+	var hasTTL bool
+	for _, elem := range index {
+		switch elem.Name {
+		case "key":
+			key, _ = elem.Value.(bson.D)
+		case "v":
+			if version, ok := toFloat(elem.Value); ok && version == 0 {
+				problems = append(problems,
+					"index version 0 cannot be built by MongoDB 3.2 and later; "+
+						"restore it without --keepIndexVersion")
+			}
+		case "dropDups":
+			problems = append(problems,
+				"the dropDups option was removed in MongoDB 3.0 and is ignored or rejected by newer servers")
+		case "expireAfterSeconds":
+			hasTTL = true
+		default:
+			if !knownIndexOptions[elem.Name] {
+				problems = append(problems, fmt.Sprintf(
+					"unknown index option '%v' is rejected by MongoDB 3.4 and later", elem.Name))
+			}
+		}
+	}
+
+	for _, field := range key {
+		switch value := field.Value.(type) {
+		case string:
+			switch {
+			case value == "2d":
+				problems = append(problems, fmt.Sprintf(
+					"field '%v' uses a legacy 2d geospatial index; consider 2dsphere", field.Name))
+			case value == "geoHaystack":
+				problems = append(problems, fmt.Sprintf(
+					"field '%v' uses a geoHaystack index, which was removed in MongoDB 5.0", field.Name))
+			case !knownIndexTypes[value]:
+				problems = append(problems, fmt.Sprintf(
+					"field '%v' has unknown index type '%v', which MongoDB 3.4 and later reject",
+					field.Name, value))
+			}
+		default:
+			if number, ok := toFloat(value); !ok || number == 0 {
+				problems = append(problems, fmt.Sprintf(
+					"field '%v' has key value %v; MongoDB 3.4 and later only accept "+
+						"non-zero numbers or index type names", field.Name, value))
+			}
+		}
+	}
+
+	if hasTTL && len(key) > 1 {
+		problems = append(problems,
+			"expireAfterSeconds on a compound index is ignored; documents will not expire")
+	}
+	return problems
+}
+
+// toFloat returns the numeric value of a BSON number.
+func toFloat(value interface{}) (float64, bool) {
+	switch number := value.(type) {
+	case int:
+		return float64(number), true
+	case int32:
+		return float64(number), true
+	case int64:
+		return float64(number), true
+	case float64:
+		return number, true
+	}
+	return 0, false
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestCheckIndexSpec(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When checking dumped index specs", t, func() {
+
+		Convey("ordinary indexes should have no problems", func() {
+			So(CheckIndexSpec(bson.D{
+				{"v", 1},
+				{"key", bson.D{{"a", 1}, {"b", -1.0}}},
+				{"name", "a_1_b_-1"},
+				{"unique", true},
+			}), ShouldBeEmpty)
+			So(CheckIndexSpec(bson.D{
+				{"v", 2},
+				{"key", bson.D{{"loc", "2dsphere"}}},
+				{"name", "loc_2dsphere"},
+				{"2dsphereIndexVersion", 3},
+			}), ShouldBeEmpty)
+		})
+
+		Convey("hidden and wildcard indexes should have no problems", func() {
+			So(CheckIndexSpec(bson.D{
+				{"v", 2},
+				{"key", bson.D{{"a", 1}}},
+				{"name", "a_1"},
+				{"hidden", true},
+			}), ShouldBeEmpty)
+			So(CheckIndexSpec(bson.D{
+				{"v", 2},
+				{"key", bson.D{{"$**", 1}}},
+				{"name", "$**_1"},
+				{"wildcardProjection", bson.D{{"a", 0}}},
+			}), ShouldBeEmpty)
+		})
+
+		Convey("legacy geo indexes should be reported", func() {
+			So(len(CheckIndexSpec(bson.D{
+				{"key", bson.D{{"loc", "2d"}}},
+				{"name", "loc_2d"},
+			})), ShouldEqual, 1)
+		})
+
+		Convey("invalid key values and options should each be reported", func() {
+			problems := CheckIndexSpec(bson.D{
+				{"v", 0},
+				{"key", bson.D{{"a", 0}, {"b", "asc"}}},
+				{"name", "a_0_b_asc"},
+				{"dropDups", true},
+				{"safe", true},
+			})
+			So(len(problems), ShouldEqual, 5)
+		})
+
+		Convey("TTL options on compound indexes should be reported", func() {
+			So(len(CheckIndexSpec(bson.D{
+				{"key", bson.D{{"a", 1}, {"b", 1}}},
+				{"name", "a_1_b_1"},
+				{"expireAfterSeconds", 60},
+			})), ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"fmt"
+	"gopkg.in/mgo.v2/bson"
+	"strconv"
+	"strings"
+)
+
+// ParseTimestampFlag takes in a string the form of <time_t>:<ordinal>,
+// where <time_t> is the seconds since the UNIX epoch, and <ordinal> represents
+// a counter of operations in the oplog that occurred in the specified second.
+// It parses this timestamp string and returns a bson.MongoTimestamp type.
+func ParseTimestampFlag(ts string) (bson.MongoTimestamp, error) {
+	var seconds, increment int
+	timestampFields := strings.Split(ts, ":")
+	if len(timestampFields) > 2 {
+		return 0, fmt.Errorf("too many : characters")
+	}
+
+	seconds, err := strconv.Atoi(timestampFields[0])
+	if err != nil {
+		return 0, fmt.Errorf("error parsing timestamp seconds: %v", err)
+	}
+
+	// parse the increment field if it exists
+	if len(timestampFields) == 2 {
+		if len(timestampFields[1]) > 0 {
+			increment, err = strconv.Atoi(timestampFields[1])
+			if err != nil {
+				return 0, fmt.Errorf("error parsing timestamp increment: %v", err)
+			}
+		} else {
+			// handle the case where the user writes "<time_t>:" with no ordinal
+			increment = 0
+		}
+	}
+
+	timestamp := (int64(seconds) << 32) | int64(increment)
+	return bson.MongoTimestamp(timestamp), nil
+}
+
+// FormatTimestamp formats a timestamp as <time_t>:<ordinal>, the form
+// ParseTimestampFlag reads.
+func FormatTimestamp(ts bson.MongoTimestamp) string {
+	return fmt.Sprintf("%v:%v", int64(ts)>>32, int64(ts)&0xffffffff)
+}
@@ -0,0 +1,21 @@
+package db
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestFormatTimestamp(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("A formatted timestamp should parse back to itself", t, func() {
+		ts := bson.MongoTimestamp(1456833600<<32 | 7)
+		So(FormatTimestamp(ts), ShouldEqual, "1456833600:7")
+		parsed, err := ParseTimestampFlag(FormatTimestamp(ts))
+		So(err, ShouldBeNil)
+		So(parsed, ShouldEqual, ts)
+	})
+}
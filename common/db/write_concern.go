@@ -6,6 +6,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 	"strconv"
 )
 
@@ -121,3 +122,26 @@ func BuildWriteConcern(writeConcern string, nodeType NodeType) (*mgo.Safe, error
 	)
 	return sessionSafety, nil
 }
+
+// WriteConcernDocument converts a session's safety, as returned by
+// BuildWriteConcern, to the writeConcern document of a write command.
+func WriteConcernDocument(sessionSafety *mgo.Safe) bson.D {
+	if sessionSafety == nil {
+		return bson.D{{w, 0}}
+	}
+	var wValue interface{} = sessionSafety.W
+	if sessionSafety.WMode != "" {
+		wValue = sessionSafety.WMode
+	}
+	writeConcern := bson.D{{w, wValue}}
+	if sessionSafety.J {
+		writeConcern = append(writeConcern, bson.DocElem{j, true})
+	}
+	if sessionSafety.FSync {
+		writeConcern = append(writeConcern, bson.DocElem{fSync, true})
+	}
+	if sessionSafety.WTimeout > 0 {
+		writeConcern = append(writeConcern, bson.DocElem{wTimeout, sessionSafety.WTimeout})
+	}
+	return writeConcern
+}
@@ -2,6 +2,8 @@ package db
 
 import (
 	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 	"testing"
 )
 
@@ -164,3 +166,22 @@ func TestConstructWCObject(t *testing.T) {
 		})
 	})
 }
+
+func TestWriteConcernDocument(t *testing.T) {
+	Convey("Given a session's safety, on calling WriteConcernDocument...", t, func() {
+
+		Convey("an unacknowledged write concern should be w: 0", func() {
+			So(WriteConcernDocument(nil), ShouldResemble, bson.D{{"w", 0}})
+		})
+
+		Convey("a write mode should be used as w, with the fields that are set", func() {
+			safety := &mgo.Safe{W: 2, WMode: "majority", J: true, WTimeout: 500}
+			So(WriteConcernDocument(safety), ShouldResemble,
+				bson.D{{"w", "majority"}, {"j", true}, {"wtimeout", 500}})
+		})
+
+		Convey("a number of servers should be used as w without a write mode", func() {
+			So(WriteConcernDocument(&mgo.Safe{W: 1}), ShouldResemble, bson.D{{"w", 1}})
+		})
+	})
+}
@@ -4,6 +4,7 @@ package intents
 import (
 	"github.com/mongodb/mongo-tools/common/log"
 	"gopkg.in/mgo.v2/bson"
+	"sort"
 	"sync"
 )
 
@@ -17,13 +18,29 @@ type Intent struct {
 	// File locations as absolute paths
 	BSONPath     string
 	MetadataPath string
+	IndexesPath  string
 
 	// Collection options
 	Options *bson.D
 
+	// The _id index spec listCollections reported for the collection, if any
+	IDIndex *bson.D
+
 	// File/collection size, for some prioritizer implementations.
 	// Units don't matter as long as they are consistent for a given use case.
 	Size int64
+
+	// Position of the collection in its database when it was dumped,
+	// counting from 1, or 0 if unknown
+	CreationOrder int
+
+	// Namespaces that should be restored before this one, such as the
+	// collection a view is defined on
+	DependsOn []string
+
+	// Intents restored right after this one by the same routine, instead of
+	// being scheduled on their own; see Manager.Attach
+	Attached []*Intent `bson:"-"`
 }
 
 func (it *Intent) Namespace() string {
@@ -87,6 +104,13 @@ type Manager struct {
 	// the IntentPrioritizer interface encapsulates this.
 	prioritizer     IntentPrioritizer
 	priotitizerLock *sync.Mutex
+	// signaled, with priotitizerLock held, when an intent finishes or the
+	// manager is closed, which may make a held back intent ready
+	changed *sync.Cond
+	// intents popped but not yet finished
+	active int
+	// set by Close, after which Pop returns nil
+	closed bool
 
 	// special cases that should be saved but not be part of the queue.
 	// used to deal with oplog and user/roles restoration, which are
@@ -96,6 +120,19 @@ type Manager struct {
 	rolesIntent   *Intent
 	versionIntent *Intent
 	indexIntents  map[string]*Intent
+
+	// when set, intents beyond this many are spilled to a temporary file
+	// until the manager is finalized; see SetMaxIntentsInMemory
+	maxInMemory int
+	spill       *intentSpill
+	spillErr    error
+
+	// databases whose intents are scheduled before (true) or after (false)
+	// all others; see ScheduleDatabase
+	databaseOrder map[string]bool
+
+	// namespace of the intent each attached intent is restored with; see Attach
+	attachments map[string]string
 }
 
 func NewCategorizingIntentManager() *Manager {
@@ -106,16 +143,21 @@ func NewCategorizingIntentManager() *Manager {
 }
 
 func NewIntentManager() *Manager {
+	lock := &sync.Mutex{}
 	return &Manager{
 		intents:                 map[string]*Intent{},
 		intentsByDiscoveryOrder: []*Intent{},
-		priotitizerLock:         &sync.Mutex{},
+		priotitizerLock:         lock,
+		changed:                 sync.NewCond(lock),
 	}
 }
 
 // HasConfigDBIntent returns a bool indicating if any of the intents refer to the "config" database.
 // This can be used to check for possible unwanted conflicts before restoring to a sharded system.
 func (mgr *Manager) HasConfigDBIntent() bool {
+	if mgr.spill != nil && mgr.spill.databases["config"] {
+		return true
+	}
 	for _, intent := range mgr.intentsByDiscoveryOrder {
 		if intent.DB == "config" {
 			return true
@@ -124,6 +166,44 @@ func (mgr *Manager) HasConfigDBIntent() bool {
 	return false
 }
 
+// Intents returns all intents in the order they were discovered. It must
+// be called before Finalize. Intents spilled to disk are not included; use
+// ForEach to see them too.
+func (manager *Manager) Intents() []*Intent {
+	intents := make([]*Intent, len(manager.intentsByDiscoveryOrder))
+	copy(intents, manager.intentsByDiscoveryOrder)
+	return intents
+}
+
+// OrderByCreation reorders the intents of each database by their
+// CreationOrder, leaving intents without one where they are. It must be
+// called before Finalize.
+func (manager *Manager) OrderByCreation() {
+	if manager.spill != nil {
+		manager.spill.orderByCreation = true
+	}
+	orderByCreation(manager.intentsByDiscoveryOrder)
+}
+
+func orderByCreation(intents []*Intent) {
+	positions := map[string][]int{}
+	for i, intent := range intents {
+		if intent.CreationOrder > 0 {
+			positions[intent.DB] = append(positions[intent.DB], i)
+		}
+	}
+	for _, indexes := range positions {
+		ordered := make([]*Intent, len(indexes))
+		for i, index := range indexes {
+			ordered[i] = intents[index]
+		}
+		sort.Stable(byCreationOrder(ordered))
+		for i, index := range indexes {
+			intents[index] = ordered[i]
+		}
+	}
+}
+
 // Put inserts an intent into the manager. Intents for the same collection
 // are merged together, so that BSON and metadata files for the same collection
 // are returned in the same intent.
@@ -177,22 +257,83 @@ func (manager *Manager) Put(intent *Intent) {
 		if existing.MetadataPath == "" {
 			existing.MetadataPath = intent.MetadataPath
 		}
+		if existing.IndexesPath == "" {
+			existing.IndexesPath = intent.IndexesPath
+		}
 		return
 	}
 
+	manager.spillBefore(intent)
+	if manager.spill != nil && manager.spill.databases[intent.DB] {
+		log.Logf(log.Always, "warning: %v is restored separately from other files of the same "+
+			"collection, because intents of database %v were already written to disk", intent.Namespace(), intent.DB)
+	}
+
 	// if key doesn't already exist, add it to the manager
 	manager.intents[intent.Namespace()] = intent
 	manager.intentsByDiscoveryOrder = append(manager.intentsByDiscoveryOrder, intent)
 }
 
-// Pop returns the next available intent from the manager. If the manager is
-// empty, it returns nil. Pop is thread safe.
+// Attach schedules the intent of the attached namespace as part of the
+// intent of namespace, such as the chunks collection of a GridFS bucket with
+// its files collection: rather than being returned by Pop on its own, it is
+// added to that intent's Attached intents. Both must be of the same database,
+// and the intent of namespace must not itself be attached. If there is no
+// intent for namespace, the attached intent is scheduled as usual. Attach
+// must be called before Finalize.
+func (manager *Manager) Attach(namespace, attached string) {
+	if manager.attachments == nil {
+		manager.attachments = map[string]string{}
+	}
+	manager.attachments[attached] = namespace
+}
+
+// attachIntents moves every intent attached to another of the given intents
+// to the other's Attached intents, and returns the intents left to schedule.
+func (manager *Manager) attachIntents(intents []*Intent) []*Intent {
+	if len(manager.attachments) == 0 {
+		return intents
+	}
+	byNamespace := map[string]*Intent{}
+	for _, intent := range intents {
+		byNamespace[intent.Namespace()] = intent
+	}
+	scheduled := make([]*Intent, 0, len(intents))
+	for _, intent := range intents {
+		owner := byNamespace[manager.attachments[intent.Namespace()]]
+		if owner != nil && owner != intent {
+			log.Logf(log.DebugHigh, "scheduling %v with %v", intent.Namespace(), owner.Namespace())
+			owner.Attached = append(owner.Attached, intent)
+			continue
+		}
+		scheduled = append(scheduled, intent)
+	}
+	return scheduled
+}
+
+// Pop returns the next available intent from the manager. If every intent
+// left is held back until others in progress finish, such as a view waiting
+// for its collection, it blocks until one is ready. If the manager is empty
+// or closed, it returns nil. Pop is thread safe; every intent it returns must
+// be passed to Finish, even if it fails, so that other callers waiting in Pop
+// are not blocked forever.
 func (manager *Manager) Pop() *Intent {
 	manager.priotitizerLock.Lock()
 	defer manager.priotitizerLock.Unlock()
 
-	intent := manager.prioritizer.Get()
-	return intent
+	for !manager.closed {
+		if intent := manager.prioritizer.Get(); intent != nil {
+			manager.active++
+			return intent
+		}
+		if manager.active == 0 || !isHolding(manager.prioritizer) {
+			// either there are no intents left, or nothing in progress
+			// can make one ready
+			return nil
+		}
+		manager.changed.Wait()
+	}
+	return nil
 }
 
 // Peek returns a copy of a stored intent from the manager without removing
@@ -215,6 +356,8 @@ func (manager *Manager) Finish(intent *Intent) {
 	manager.priotitizerLock.Lock()
 	defer manager.priotitizerLock.Unlock()
 	manager.prioritizer.Finish(intent)
+	manager.active--
+	manager.changed.Broadcast()
 }
 
 // Oplog returns the intent representing the oplog, which isn't
@@ -244,24 +387,92 @@ func (manager *Manager) AuthVersion() *Intent {
 	return manager.versionIntent
 }
 
+// ScheduleDatabase makes Finalize schedule the intents of the database
+// before all other intents if first is true, or after them if it is false.
+// Intents of a later group may start while those of an earlier group are
+// still in progress, so this orders when intents start rather than waiting
+// for them to finish. It has no effect on intents spilled to disk.
+func (manager *Manager) ScheduleDatabase(dbName string, first bool) {
+	if manager.databaseOrder == nil {
+		manager.databaseOrder = map[string]bool{}
+	}
+	manager.databaseOrder[dbName] = first
+}
+
+// newDatabaseOrderPrioritizer returns a prioritizer of the given type for
+// the intents of the databases scheduled first, then the other intents, then
+// those of the databases scheduled last.
+func (manager *Manager) newDatabaseOrderPrioritizer(pType PriorityType) IntentPrioritizer {
+	var first, middle, last []*Intent
+	for _, intent := range manager.intentsByDiscoveryOrder {
+		isFirst, ordered := manager.databaseOrder[intent.DB]
+		switch {
+		case !ordered:
+			middle = append(middle, intent)
+		case isFirst:
+			first = append(first, intent)
+		default:
+			last = append(last, intent)
+		}
+	}
+	phases := []*phase{}
+	for _, group := range [][]*Intent{first, middle, last} {
+		if len(group) > 0 {
+			phases = append(phases, newPhase(pType, group))
+		}
+	}
+	return newPhasedPrioritizer(phases...)
+}
+
 // Finalize processes the intents for prioritization. Currently only two
 // kinds of prioritizers are supported. No more "Put" operations may be done
 // after finalize is called.
+//
+// If intents were spilled to disk, each database is scheduled on its own, in
+// the order the databases were discovered.
 func (manager *Manager) Finalize(pType PriorityType) {
 	switch pType {
 	case Legacy:
 		log.Log(log.DebugHigh, "finalizing intent manager with legacy prioritizer")
-		manager.prioritizer = NewLegacyPrioritizer(manager.intentsByDiscoveryOrder)
 	case LongestTaskFirst:
 		log.Log(log.DebugHigh, "finalizing intent manager with longest task first prioritizer")
-		manager.prioritizer = NewLongestTaskFirstPrioritizer(manager.intentsByDiscoveryOrder)
 	case MultiDatabaseLTF:
 		log.Log(log.DebugHigh, "finalizing intent manager with multi-database longest task first prioritizer")
-		manager.prioritizer = NewMultiDatabaseLTFPrioritizer(manager.intentsByDiscoveryOrder)
 	default:
 		panic("cannot initialize IntentPrioritizer with unknown type")
 	}
+	manager.intentsByDiscoveryOrder = manager.attachIntents(manager.intentsByDiscoveryOrder)
+	if manager.spill != nil {
+		log.Logf(log.DebugLow, "scheduling %v intents spilled to disk one database at a time", manager.spill.count)
+		manager.prioritizer = manager.newSpilledPrioritizer(pType)
+	} else if len(manager.databaseOrder) > 0 {
+		log.Log(log.DebugHigh, "scheduling the intents of some databases before or after the others")
+		manager.prioritizer = manager.newDatabaseOrderPrioritizer(pType)
+	} else {
+		manager.prioritizer = newPrioritizer(pType, manager.intentsByDiscoveryOrder)
+	}
 	// release these for the garbage collector and to ensure code correctness
 	manager.intents = nil
 	manager.intentsByDiscoveryOrder = nil
 }
+
+// newPrioritizer returns a prioritizer of the given type for the intents,
+// holding back intents until the ones they depend on are finished.
+func newPrioritizer(pType PriorityType, intents []*Intent) IntentPrioritizer {
+	var prioritizer IntentPrioritizer
+	switch pType {
+	case Legacy:
+		prioritizer = NewLegacyPrioritizer(intents)
+	case LongestTaskFirst:
+		prioritizer = NewLongestTaskFirstPrioritizer(intents)
+	case MultiDatabaseLTF:
+		prioritizer = NewMultiDatabaseLTFPrioritizer(intents)
+	}
+	for _, intent := range intents {
+		if len(intent.DependsOn) > 0 {
+			log.Log(log.DebugHigh, "scheduling intents after the intents they depend on")
+			return newDependencyPrioritizer(prioritizer, intents)
+		}
+	}
+	return prioritizer
+}
@@ -17,6 +17,11 @@ const (
 // for restoration. It can know about which intents are in the
 // process of being restored through the "Finish" hook.
 //
+// Get returns nil when no intent is ready to start, which is not
+// necessarily the end: a prioritizer that holds intents back until others
+// finish says so with a holding method, and the Manager then calls Get
+// again after each Finish.
+//
 // Oplog entries and auth entries are not handled by the prioritizer,
 // as these are special cases handled by the regular mongorestore code.
 type IntentPrioritizer interface {
@@ -24,6 +29,19 @@ type IntentPrioritizer interface {
 	Finish(*Intent)
 }
 
+// holdingPrioritizer is implemented by prioritizers that may hold intents
+// back until others finish.
+type holdingPrioritizer interface {
+	// holding returns true if intents are being held back
+	holding() bool
+}
+
+// isHolding returns true if the prioritizer is holding intents back.
+func isHolding(prioritizer IntentPrioritizer) bool {
+	holder, ok := prioritizer.(holdingPrioritizer)
+	return ok && holder.holding()
+}
+
 //===== Legacy =====
 
 // legacyPrioritizer processes the intents in the order they were read off the
@@ -92,6 +110,13 @@ func (s BySize) Len() int           { return len(s) }
 func (s BySize) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 func (s BySize) Less(i, j int) bool { return s[i].Size > s[j].Size }
 
+// For sorting intents by the order their collections were dumped in
+type byCreationOrder []*Intent
+
+func (s byCreationOrder) Len() int           { return len(s) }
+func (s byCreationOrder) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byCreationOrder) Less(i, j int) bool { return s[i].CreationOrder < s[j].CreationOrder }
+
 //===== Multi Database Longest Task First =====
 
 // multiDatabaseLTF is designed to properly schedule intents with two constraints:
@@ -225,3 +250,150 @@ func (dbh *DBHeap) Pop() interface{} {
 	*dbh = old[0 : n-1]
 	return toPop
 }
+
+//===== Dependencies =====
+
+// dependencyPrioritizer wraps another prioritizer to hold back intents until
+// the intents they depend on are finished, so that a view is only created
+// once the collection it reads from exists. Dependencies are a soft
+// constraint: ones outside the set of intents are ignored, and if every
+// remaining intent is waiting while nothing is in progress, as with a cycle,
+// the longest waiting intent is released anyway.
+type dependencyPrioritizer struct {
+	inner   IntentPrioritizer
+	waiting []*Intent
+	// namespaces of intents that have not finished yet
+	unfinished map[string]bool
+	active     int
+}
+
+func newDependencyPrioritizer(inner IntentPrioritizer, intents []*Intent) *dependencyPrioritizer {
+	unfinished := map[string]bool{}
+	for _, intent := range intents {
+		unfinished[intent.Namespace()] = true
+	}
+	return &dependencyPrioritizer{inner: inner, unfinished: unfinished}
+}
+
+// ready returns true if none of the intent's dependencies are unfinished.
+func (dp *dependencyPrioritizer) ready(intent *Intent) bool {
+	for _, namespace := range intent.DependsOn {
+		if namespace != intent.Namespace() && dp.unfinished[namespace] {
+			return false
+		}
+	}
+	return true
+}
+
+// Get returns the first waiting intent whose dependencies are finished or,
+// failing that, the next ready intent from the wrapped prioritizer. It
+// returns nil when only waiting intents remain and others are in progress;
+// the Manager's Pop then waits for one of those to finish and calls it
+// again.
+func (dp *dependencyPrioritizer) Get() *Intent {
+	for i, intent := range dp.waiting {
+		if dp.ready(intent) {
+			dp.waiting = append(dp.waiting[:i], dp.waiting[i+1:]...)
+			dp.active++
+			return intent
+		}
+	}
+	for intent := dp.inner.Get(); intent != nil; intent = dp.inner.Get() {
+		if dp.ready(intent) {
+			dp.active++
+			return intent
+		}
+		dp.waiting = append(dp.waiting, intent)
+	}
+	if dp.active == 0 && len(dp.waiting) > 0 {
+		intent := dp.waiting[0]
+		dp.waiting = dp.waiting[1:]
+		dp.active++
+		return intent
+	}
+	return nil
+}
+
+func (dp *dependencyPrioritizer) holding() bool {
+	return len(dp.waiting) > 0 || isHolding(dp.inner)
+}
+
+func (dp *dependencyPrioritizer) Finish(intent *Intent) {
+	delete(dp.unfinished, intent.Namespace())
+	dp.active--
+	dp.inner.Finish(intent)
+}
+
+//===== Phased =====
+
+// phasedPrioritizer schedules intents in a series of phases, each a group
+// of intents with its own prioritizer. An intent of a later phase is only
+// returned when no earlier phase has one ready, but it may start while
+// intents of earlier phases are still in progress. Phases that have
+// returned all their intents are dropped, and if loadPhase is set, it is
+// called for another phase once none of the others has an intent ready.
+type phasedPrioritizer struct {
+	phases []*phase
+	// phases of the intents that are in progress, by namespace
+	active map[string]*phase
+	// loadPhase returns the next phase, or nil if there are no more
+	loadPhase func() *phase
+}
+
+// phase is the prioritizer of a group of intents and the number of them it
+// has yet to return.
+type phase struct {
+	prioritizer IntentPrioritizer
+	remaining   int
+}
+
+func newPhase(pType PriorityType, intents []*Intent) *phase {
+	return &phase{newPrioritizer(pType, intents), len(intents)}
+}
+
+func newPhasedPrioritizer(phases ...*phase) *phasedPrioritizer {
+	return &phasedPrioritizer{phases: phases, active: map[string]*phase{}}
+}
+
+// Get returns the next intent of the first phase that has one ready,
+// loading more phases as needed.
+func (pp *phasedPrioritizer) Get() *Intent {
+	for i := 0; ; i++ {
+		if i == len(pp.phases) {
+			if pp.loadPhase == nil {
+				return nil
+			}
+			next := pp.loadPhase()
+			if next == nil {
+				return nil
+			}
+			pp.phases = append(pp.phases, next)
+		}
+		current := pp.phases[i]
+		intent := current.prioritizer.Get()
+		if intent == nil {
+			continue
+		}
+		current.remaining--
+		if current.remaining == 0 {
+			pp.phases = append(pp.phases[:i], pp.phases[i+1:]...)
+		}
+		pp.active[intent.Namespace()] = current
+		return intent
+	}
+}
+
+// holding returns true if a phase has intents left, since Get only returns
+// nil when none of them are ready.
+func (pp *phasedPrioritizer) holding() bool {
+	return len(pp.phases) > 0
+}
+
+func (pp *phasedPrioritizer) Finish(intent *Intent) {
+	current := pp.active[intent.Namespace()]
+	if current == nil {
+		return
+	}
+	delete(pp.active, intent.Namespace())
+	current.prioritizer.Finish(intent)
+}
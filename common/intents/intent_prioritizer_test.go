@@ -5,8 +5,29 @@ import (
 	"github.com/mongodb/mongo-tools/common/testutil"
 	. "github.com/smartystreets/goconvey/convey"
 	"testing"
+	"time"
 )
 
+// popAsync calls Pop in another goroutine, returning a channel of its result.
+func popAsync(manager *Manager) <-chan *Intent {
+	popped := make(chan *Intent, 1)
+	go func() {
+		popped <- manager.Pop()
+	}()
+	return popped
+}
+
+// receiveWithin returns the intent received on popped within the timeout,
+// and whether Pop returned at all.
+func receiveWithin(popped <-chan *Intent, timeout time.Duration) (*Intent, bool) {
+	select {
+	case intent := <-popped:
+		return intent, true
+	case <-time.After(timeout):
+		return nil, false
+	}
+}
+
 func TestLegacyPrioritizer(t *testing.T) {
 
 	testutil.VerifyTestType(t, testutil.UnitTestType)
@@ -172,3 +193,155 @@ func TestSimulatedMultiDBJob(t *testing.T) {
 		})
 	})
 }
+
+func TestDependencyPrioritizer(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With views listed before the collections they depend on", t, func() {
+		testList := []*Intent{
+			&Intent{DB: "db", C: "view2", DependsOn: []string{"db.view1"}},
+			&Intent{DB: "db", C: "view1", DependsOn: []string{"db.coll", "db.other.missing"}},
+			&Intent{DB: "db", C: "coll"},
+		}
+		dependencies := newDependencyPrioritizer(NewLegacyPrioritizer(testList), testList)
+
+		Convey("each view should only be returned once its source is finished", func() {
+			it0 := dependencies.Get()
+			So(it0.C, ShouldEqual, "coll")
+			So(dependencies.Get(), ShouldBeNil)
+			dependencies.Finish(it0)
+
+			it1 := dependencies.Get()
+			So(it1.C, ShouldEqual, "view1")
+			So(dependencies.Get(), ShouldBeNil)
+			dependencies.Finish(it1)
+
+			it2 := dependencies.Get()
+			So(it2.C, ShouldEqual, "view2")
+			dependencies.Finish(it2)
+			So(dependencies.Get(), ShouldBeNil)
+		})
+	})
+
+	Convey("With views that depend on each other", t, func() {
+		testList := []*Intent{
+			&Intent{DB: "db", C: "a", DependsOn: []string{"db.b"}},
+			&Intent{DB: "db", C: "b", DependsOn: []string{"db.a"}},
+		}
+		dependencies := newDependencyPrioritizer(NewLegacyPrioritizer(testList), testList)
+
+		Convey("the cycle should be broken once nothing else is in progress", func() {
+			it0 := dependencies.Get()
+			So(it0.C, ShouldEqual, "a")
+			dependencies.Finish(it0)
+			it1 := dependencies.Get()
+			So(it1.C, ShouldEqual, "b")
+			dependencies.Finish(it1)
+			So(dependencies.Get(), ShouldBeNil)
+		})
+	})
+}
+
+func TestManagerWaitsForDependencies(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a manager of a view and the collection it depends on", t, func() {
+		manager := NewIntentManager()
+		manager.Put(&Intent{DB: "db", C: "view", DependsOn: []string{"db.coll"}})
+		manager.Put(&Intent{DB: "db", C: "coll"})
+		manager.Finalize(Legacy)
+		coll := manager.Pop()
+		So(coll.C, ShouldEqual, "coll")
+
+		Convey("Pop should wait for the collection to finish rather than end", func() {
+			popped := popAsync(manager)
+			_, returned := receiveWithin(popped, 50*time.Millisecond)
+			So(returned, ShouldBeFalse)
+
+			manager.Finish(coll)
+			view, returned := receiveWithin(popped, 5*time.Second)
+			So(returned, ShouldBeTrue)
+			So(view.C, ShouldEqual, "view")
+			manager.Finish(view)
+			So(manager.Pop(), ShouldBeNil)
+		})
+
+		Convey("Close should end a waiting Pop", func() {
+			popped := popAsync(manager)
+			_, returned := receiveWithin(popped, 50*time.Millisecond)
+			So(returned, ShouldBeFalse)
+
+			So(manager.Close(), ShouldBeNil)
+			intent, returned := receiveWithin(popped, 5*time.Second)
+			So(returned, ShouldBeTrue)
+			So(intent, ShouldBeNil)
+		})
+	})
+
+	Convey("With a manager of independent intents", t, func() {
+		manager := NewIntentManager()
+		manager.Put(&Intent{DB: "db", C: "a"})
+		manager.Finalize(Legacy)
+
+		Convey("Pop should not wait for unfinished intents once none are left", func() {
+			So(manager.Pop(), ShouldNotBeNil)
+			So(manager.Pop(), ShouldBeNil)
+		})
+	})
+}
+
+func TestScheduleDatabase(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With intents of several databases", t, func() {
+		manager := NewIntentManager()
+		manager.Put(&Intent{DB: "app", C: "a", Size: 30})
+		manager.Put(&Intent{DB: "admin", C: "a", Size: 10})
+		manager.Put(&Intent{DB: "logs", C: "a", Size: 20})
+		manager.Put(&Intent{DB: "app", C: "b", Size: 40})
+		manager.Put(&Intent{DB: "admin", C: "b", Size: 50})
+
+		popAll := func() []string {
+			names := []string{}
+			for intent := manager.Pop(); intent != nil; intent = manager.Pop() {
+				names = append(names, intent.Namespace())
+			}
+			return names
+		}
+
+		Convey("a database scheduled first should start before all others", func() {
+			manager.ScheduleDatabase("admin", true)
+			manager.Finalize(LongestTaskFirst)
+			So(popAll(), ShouldResemble, []string{"admin.b", "admin.a", "app.b", "app.a", "logs.a"})
+		})
+
+		Convey("a database scheduled last should start after all others", func() {
+			manager.ScheduleDatabase("admin", false)
+			manager.ScheduleDatabase("logs", true)
+			manager.Finalize(Legacy)
+			So(popAll(), ShouldResemble, []string{"logs.a", "app.a", "app.b", "admin.a", "admin.b"})
+		})
+
+		Convey("Pop should wait for a dependency in a phase before ending", func() {
+			manager.Put(&Intent{DB: "admin", C: "view", DependsOn: []string{"admin.b"}})
+			manager.ScheduleDatabase("admin", true)
+			manager.Finalize(LongestTaskFirst)
+			names := []string{}
+			for len(names) < 5 {
+				names = append(names, manager.Pop().Namespace())
+			}
+			So(names, ShouldResemble, []string{"admin.b", "admin.a", "app.b", "app.a", "logs.a"})
+
+			waiting := popAsync(manager)
+			_, returned := receiveWithin(waiting, 50*time.Millisecond)
+			So(returned, ShouldBeFalse)
+			manager.Finish(&Intent{DB: "admin", C: "b"})
+			view, returned := receiveWithin(waiting, 5*time.Second)
+			So(returned, ShouldBeTrue)
+			So(view.Namespace(), ShouldEqual, "admin.view")
+		})
+	})
+}
@@ -0,0 +1,278 @@
+package intents
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+)
+
+// intentSpill is a temporary file of BSON-encoded intents that no longer
+// fit in memory. Intents are spilled a whole database at a time, so each
+// database's intents are contiguous in the file.
+type intentSpill struct {
+	file   *os.File
+	writer *bufio.Writer
+	count  int
+
+	// databases with intents in the file
+	databases map[string]bool
+
+	// whether each database's intents should be put in their creation
+	// order when they are read back
+	orderByCreation bool
+}
+
+func newIntentSpill() (*intentSpill, error) {
+	file, err := ioutil.TempFile("", "mongo-tools-intents-")
+	if err != nil {
+		return nil, fmt.Errorf("error creating temporary file for intents: %v", err)
+	}
+	return &intentSpill{
+		file:      file,
+		writer:    bufio.NewWriter(file),
+		databases: map[string]bool{},
+	}, nil
+}
+
+func (spill *intentSpill) write(intent *Intent) error {
+	raw, err := bson.Marshal(intent)
+	if err != nil {
+		return fmt.Errorf("error encoding intent for %v: %v", intent.Namespace(), err)
+	}
+	if _, err = spill.writer.Write(raw); err != nil {
+		return fmt.Errorf("error writing intents to %v: %v", spill.file.Name(), err)
+	}
+	spill.databases[intent.DB] = true
+	spill.count++
+	return nil
+}
+
+// reader flushes the file and returns a source that decodes its intents
+// from the start. The source takes ownership of the file.
+func (spill *intentSpill) reader() (*db.DecodedBSONSource, error) {
+	if err := spill.writer.Flush(); err != nil {
+		return nil, fmt.Errorf("error writing intents to %v: %v", spill.file.Name(), err)
+	}
+	if _, err := spill.file.Seek(0, 0); err != nil {
+		return nil, fmt.Errorf("error reading intents from %v: %v", spill.file.Name(), err)
+	}
+	return db.NewDecodedBSONSource(db.NewBSONSource(spill.file)), nil
+}
+
+// rewrite calls fn with each intent in the file, in order, and replaces the
+// file with one holding the intents as fn left them.
+func (spill *intentSpill) rewrite(fn func(*Intent) error) error {
+	source, err := spill.reader()
+	if err != nil {
+		return err
+	}
+	old := spill.file
+	defer os.Remove(old.Name())
+	defer source.Close()
+
+	rewritten, err := newIntentSpill()
+	if err != nil {
+		return err
+	}
+	rewritten.orderByCreation = spill.orderByCreation
+	for intent := nextIntent(source); intent != nil; intent = nextIntent(source) {
+		if err = fn(intent); err == nil {
+			err = rewritten.write(intent)
+		}
+		if err != nil {
+			rewritten.remove()
+			return err
+		}
+	}
+	if err = source.Err(); err != nil {
+		rewritten.remove()
+		return fmt.Errorf("error reading intents from %v: %v", old.Name(), err)
+	}
+	*spill = *rewritten
+	return nil
+}
+
+// nextIntent decodes the next intent from the source, or returns nil at the
+// end of it or on an error.
+func nextIntent(source *db.DecodedBSONSource) *Intent {
+	intent := &Intent{}
+	if !source.Next(intent) {
+		return nil
+	}
+	if len(intent.DependsOn) == 0 {
+		intent.DependsOn = nil
+	}
+	return intent
+}
+
+func (spill *intentSpill) remove() error {
+	spill.file.Close()
+	return os.Remove(spill.file.Name())
+}
+
+// SetMaxIntentsInMemory bounds the number of intents the manager holds in
+// memory before it is finalized. Once more than max intents have been put,
+// the intents of every database but the one being put are written to a
+// temporary file, and after Finalize they are read back and scheduled one
+// database at a time. Intents can only be merged with ones still in memory,
+// so the intents of each database should be put together. A max of 0, the
+// default, keeps every intent in memory. It must be called before Put.
+func (manager *Manager) SetMaxIntentsInMemory(max int) {
+	manager.maxInMemory = max
+}
+
+// spillIntents writes the intents held in memory to the spill file and
+// releases them.
+func (manager *Manager) spillIntents() error {
+	if manager.spill == nil {
+		spill, err := newIntentSpill()
+		if err != nil {
+			return err
+		}
+		manager.spill = spill
+	}
+	for _, intent := range manager.intentsByDiscoveryOrder {
+		if err := manager.spill.write(intent); err != nil {
+			return err
+		}
+	}
+	log.Logf(log.DebugLow, "spilled %v intents to %v", manager.spill.count, manager.spill.file.Name())
+	manager.intents = map[string]*Intent{}
+	manager.intentsByDiscoveryOrder = []*Intent{}
+	return nil
+}
+
+// spillBefore spills the intents in memory if there are too many of them
+// and the given intent starts a new database. If they cannot be written,
+// spilling is turned off and the intents stay in memory.
+func (manager *Manager) spillBefore(intent *Intent) {
+	count := len(manager.intentsByDiscoveryOrder)
+	if manager.maxInMemory <= 0 || count < manager.maxInMemory ||
+		manager.intentsByDiscoveryOrder[count-1].DB == intent.DB {
+		return
+	}
+	if err := manager.spillIntents(); err != nil {
+		log.Logf(log.Always, "warning: keeping all intents in memory: %v", err)
+		manager.maxInMemory = 0
+	}
+}
+
+// ForEach calls fn with every intent, in the order they were discovered,
+// including intents spilled to disk, and keeps any changes fn makes to
+// them. It stops at the first error fn returns. It must be called before
+// Finalize.
+func (manager *Manager) ForEach(fn func(*Intent) error) error {
+	if manager.spill != nil {
+		if err := manager.spill.rewrite(fn); err != nil {
+			return err
+		}
+	}
+	for _, intent := range manager.intentsByDiscoveryOrder {
+		if err := fn(intent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SpillError returns the error, if any, that stopped intents from being
+// read back from disk. Intents after the error are not returned by Pop.
+func (manager *Manager) SpillError() error {
+	return manager.spillErr
+}
+
+// Close removes the file of spilled intents, if there is one. Pop returns
+// nil once the manager is closed, so that restore routines still running
+// stop instead of reading intents from the removed file.
+func (manager *Manager) Close() error {
+	manager.priotitizerLock.Lock()
+	defer manager.priotitizerLock.Unlock()
+	manager.closed = true
+	manager.changed.Broadcast()
+	if manager.spill == nil {
+		return nil
+	}
+	spill := manager.spill
+	manager.spill = nil
+	return spill.remove()
+}
+
+//===== Spilled =====
+
+// spilledIntents reads intents spilled to disk back one database at a time,
+// as the phases of a phasedPrioritizer, so that the intents in memory are
+// bounded by the size of the largest databases rather than the whole dump.
+// The next database is only read once the databases already read have no
+// intents ready to start. Each database is scheduled by its own prioritizer
+// of the requested type, and the intents that were still in memory at
+// Finalize come last.
+type spilledIntents struct {
+	manager  *Manager
+	pType    PriorityType
+	source   *db.DecodedBSONSource
+	next     *Intent
+	inMemory []*Intent
+}
+
+func (manager *Manager) newSpilledPrioritizer(pType PriorityType) *phasedPrioritizer {
+	spilled := &spilledIntents{
+		manager:  manager,
+		pType:    pType,
+		inMemory: manager.intentsByDiscoveryOrder,
+	}
+	if source, err := manager.spill.reader(); err != nil {
+		manager.spillErr = err
+	} else {
+		spilled.source = source
+	}
+	prioritizer := newPhasedPrioritizer()
+	prioritizer.loadPhase = spilled.loadPhase
+	return prioritizer
+}
+
+// readNext decodes the next intent from the file into spilled.next,
+// returning false at the end of the file or on an error.
+func (spilled *spilledIntents) readNext() bool {
+	if spilled.source == nil {
+		return false
+	}
+	if spilled.next = nextIntent(spilled.source); spilled.next != nil {
+		return true
+	}
+	if err := spilled.source.Err(); err != nil {
+		spilled.manager.spillErr = fmt.Errorf("error reading intents from disk: %v", err)
+	}
+	spilled.source.Close()
+	spilled.source = nil
+	return false
+}
+
+// loadPhase reads the intents of the next database from the file, or, at
+// the end of it, takes the intents that were in memory. It returns nil once
+// there are none left.
+func (spilled *spilledIntents) loadPhase() *phase {
+	if spilled.next == nil && !spilled.readNext() {
+		if len(spilled.inMemory) == 0 {
+			return nil
+		}
+		intents := spilled.inMemory
+		spilled.inMemory = nil
+		return newPhase(spilled.pType, intents)
+	}
+	intents := []*Intent{spilled.next}
+	spilled.next = nil
+	for spilled.readNext() && spilled.next.DB == intents[0].DB {
+		intents = append(intents, spilled.next)
+		spilled.next = nil
+	}
+	intents = spilled.manager.attachIntents(intents)
+	if spilled.manager.spill.orderByCreation {
+		orderByCreation(intents)
+	}
+	log.Logf(log.DebugHigh, "read %v intents of database %v from disk", len(intents), intents[0].DB)
+	return newPhase(spilled.pType, intents)
+}
@@ -1,9 +1,12 @@
 package intents
 
 import (
+	"fmt"
 	"github.com/mongodb/mongo-tools/common/testutil"
 	. "github.com/smartystreets/goconvey/convey"
+	"os"
 	"testing"
+	"time"
 )
 
 func TestIntentManager(t *testing.T) {
@@ -79,3 +82,202 @@ func TestIntentManager(t *testing.T) {
 		})
 	})
 }
+
+func TestOrderByCreation(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With intents discovered out of their creation order", t, func() {
+		manager := NewIntentManager()
+		manager.Put(&Intent{DB: "1", C: "a", CreationOrder: 3})
+		manager.Put(&Intent{DB: "2", C: "a", CreationOrder: 2})
+		manager.Put(&Intent{DB: "1", C: "b"})
+		manager.Put(&Intent{DB: "1", C: "c", CreationOrder: 1})
+		manager.Put(&Intent{DB: "2", C: "b", CreationOrder: 1})
+
+		Convey("each database's ordered intents should be sorted in place", func() {
+			manager.OrderByCreation()
+			names := []string{}
+			for _, intent := range manager.Intents() {
+				names = append(names, intent.Namespace())
+			}
+			So(names, ShouldResemble, []string{"1.c", "2.b", "1.b", "1.a", "2.a"})
+		})
+	})
+}
+
+func TestAttachedIntents(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With intents for a GridFS bucket and another collection", t, func() {
+		manager := NewIntentManager()
+		manager.Put(&Intent{DB: "test", C: "fs.chunks", BSONPath: "/chunks/"})
+		manager.Put(&Intent{DB: "test", C: "users", BSONPath: "/users/"})
+		manager.Put(&Intent{DB: "test", C: "fs.files", BSONPath: "/files/"})
+
+		Convey("an attached intent should be popped only as part of its intent", func() {
+			manager.Attach("test.fs.files", "test.fs.chunks")
+			So(len(manager.Intents()), ShouldEqual, 3)
+			manager.Finalize(Legacy)
+
+			i0 := manager.Pop()
+			So(i0.Namespace(), ShouldEqual, "test.users")
+			So(i0.Attached, ShouldBeNil)
+			i1 := manager.Pop()
+			So(i1.Namespace(), ShouldEqual, "test.fs.files")
+			So(len(i1.Attached), ShouldEqual, 1)
+			So(i1.Attached[0].BSONPath, ShouldEqual, "/chunks/")
+			So(manager.Pop(), ShouldBeNil)
+		})
+
+		Convey("an intent attached to a missing one should be scheduled on its own", func() {
+			manager.Attach("test.photos.files", "test.fs.chunks")
+			manager.Finalize(Legacy)
+			count := 0
+			for intent := manager.Pop(); intent != nil; intent = manager.Pop() {
+				So(intent.Attached, ShouldBeNil)
+				count++
+			}
+			So(count, ShouldEqual, 3)
+		})
+	})
+}
+
+func TestSpilledIntents(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With more intents than the manager may hold in memory", t, func() {
+		manager := NewIntentManager()
+		manager.SetMaxIntentsInMemory(2)
+		manager.Put(&Intent{DB: "1", C: "a", BSONPath: "/1a/"})
+		manager.Put(&Intent{DB: "1", C: "b", BSONPath: "/1b/", CreationOrder: 2})
+		manager.Put(&Intent{DB: "1", C: "c", BSONPath: "/1c/", CreationOrder: 1})
+		manager.Put(&Intent{DB: "1", C: "a", MetadataPath: "/1am/"})
+		manager.Put(&Intent{DB: "config", C: "a", BSONPath: "/2a/"})
+		manager.Put(&Intent{DB: "config", C: "b", BSONPath: "/2b/"})
+		manager.Put(&Intent{DB: "3", C: "a", BSONPath: "/3a/"})
+		Reset(func() { manager.Close() })
+
+		Convey("whole databases should be spilled to disk", func() {
+			So(manager.spill, ShouldNotBeNil)
+			So(manager.spill.count, ShouldEqual, 5)
+			So(len(manager.Intents()), ShouldEqual, 1)
+			So(manager.HasConfigDBIntent(), ShouldBeTrue)
+		})
+
+		Convey("ForEach should visit and keep changes to every intent", func() {
+			names := []string{}
+			So(manager.ForEach(func(intent *Intent) error {
+				names = append(names, intent.Namespace())
+				intent.Size = int64(len(names))
+				return nil
+			}), ShouldBeNil)
+			So(names, ShouldResemble, []string{"1.a", "1.b", "1.c", "config.a", "config.b", "3.a"})
+
+			manager.OrderByCreation()
+			manager.Finalize(Legacy)
+			popped := []*Intent{}
+			for intent := manager.Pop(); intent != nil; intent = manager.Pop() {
+				popped = append(popped, intent)
+				manager.Finish(intent)
+			}
+			So(manager.SpillError(), ShouldBeNil)
+			So(len(popped), ShouldEqual, 6)
+			So(*popped[0], ShouldResemble, Intent{DB: "1", C: "a", BSONPath: "/1a/", MetadataPath: "/1am/", Size: 1})
+			So(*popped[1], ShouldResemble, Intent{DB: "1", C: "c", BSONPath: "/1c/", Size: 3, CreationOrder: 1})
+			So(popped[2].Namespace(), ShouldEqual, "1.b")
+			So(popped[5].Namespace(), ShouldEqual, "3.a")
+		})
+
+		Convey("attached intents should be scheduled with their database", func() {
+			manager.Attach("1.a", "1.c")
+			manager.Attach("3.b", "3.a")
+			manager.Finalize(Legacy)
+			popped := []*Intent{}
+			for intent := manager.Pop(); intent != nil; intent = manager.Pop() {
+				popped = append(popped, intent)
+				manager.Finish(intent)
+			}
+			So(len(popped), ShouldEqual, 5)
+			So(popped[0].Namespace(), ShouldEqual, "1.a")
+			So(len(popped[0].Attached), ShouldEqual, 1)
+			So(popped[0].Attached[0].Namespace(), ShouldEqual, "1.c")
+			So(popped[4].Namespace(), ShouldEqual, "3.a")
+		})
+
+		Convey("an error from ForEach should be returned", func() {
+			err := manager.ForEach(func(intent *Intent) error {
+				return fmt.Errorf("stop at %v", intent.Namespace())
+			})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "stop at 1.a")
+		})
+
+		Convey("Close should remove the spill file", func() {
+			name := manager.spill.file.Name()
+			So(manager.Close(), ShouldBeNil)
+			_, err := os.Stat(name)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("Pop should wait for a dependency in a database read from disk", func() {
+			manager.Put(&Intent{DB: "3", C: "view", DependsOn: []string{"3.a"}})
+			manager.Finalize(Legacy)
+			popped := []*Intent{}
+			for len(popped) < 6 {
+				intent := manager.Pop()
+				So(intent, ShouldNotBeNil)
+				So(intent.Namespace(), ShouldNotEqual, "3.view")
+				popped = append(popped, intent)
+			}
+			So(popped[5].Namespace(), ShouldEqual, "3.a")
+
+			waiting := popAsync(manager)
+			_, returned := receiveWithin(waiting, 50*time.Millisecond)
+			So(returned, ShouldBeFalse)
+			for _, intent := range popped {
+				manager.Finish(intent)
+			}
+			view, returned := receiveWithin(waiting, 5*time.Second)
+			So(returned, ShouldBeTrue)
+			So(view.Namespace(), ShouldEqual, "3.view")
+		})
+
+		Convey("Pop should return nil once the manager is closed", func() {
+			manager.Finalize(Legacy)
+			So(manager.Pop(), ShouldNotBeNil)
+			So(manager.Close(), ShouldBeNil)
+			So(manager.Pop(), ShouldBeNil)
+		})
+	})
+}
+
+// BenchmarkSpilledIntents schedules a synthetic catalog of 500,000
+// collections in 5,000 databases with at most 10,000 intents in memory.
+func BenchmarkSpilledIntents(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		manager := NewIntentManager()
+		manager.SetMaxIntentsInMemory(10000)
+		for d := 0; d < 5000; d++ {
+			dbName := fmt.Sprintf("tenant%v", d)
+			for c := 0; c < 100; c++ {
+				manager.Put(&Intent{
+					DB:       dbName,
+					C:        fmt.Sprintf("collection%v", c),
+					BSONPath: fmt.Sprintf("/dump/%v/collection%v.bson", dbName, c),
+					Size:     int64(c * 1024),
+				})
+			}
+		}
+		manager.Finalize(MultiDatabaseLTF)
+		for intent := manager.Pop(); intent != nil; intent = manager.Pop() {
+			manager.Finish(intent)
+		}
+		if err := manager.SpillError(); err != nil {
+			b.Fatal(err)
+		}
+		manager.Close()
+	}
+}
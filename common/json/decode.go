@@ -107,6 +107,21 @@ func UnmarshalBsonD(data []byte) (bson.D, error) {
 	return d.unmarshalBsonD()
 }
 
+// UnmarshalOrderedBsonD is like UnmarshalBsonD, except that objects nested
+// in the document are decoded as bson.D as well, so that the key order of
+// every level is kept.
+func UnmarshalOrderedBsonD(data []byte) (bson.D, error) {
+	var d decodeState
+	err := checkValid(data, &d.scan)
+	if err != nil {
+		return nil, err
+	}
+
+	d.init(data)
+	d.ordered = true
+	return d.unmarshalBsonD()
+}
+
 // Unmarshaler is the interface implemented by objects
 // that can unmarshal a JSON description of themselves.
 // The input can be assumed to be a valid encoding of
@@ -269,6 +284,7 @@ type decodeState struct {
 	savedError error
 	tempstr    string // scratch space to avoid some allocations
 	useNumber  bool
+	ordered    bool // decode nested objects as bson.D instead of maps
 }
 
 // errPhase is used for errors that should not happen unless
@@ -975,6 +991,9 @@ func (d *decodeState) valueInterface() interface{} {
 	case scanBeginArray:
 		return d.arrayInterface()
 	case scanBeginObject:
+		if d.ordered {
+			return d.bsonDInterface()
+		}
 		return d.objectInterface()
 	case scanBeginLiteral:
 		return d.literalInterface()
@@ -42,3 +42,27 @@ func TestDecodeBsonD(t *testing.T) {
 		So(err, ShouldNotBeNil)
 	})
 }
+
+func TestUnmarshalOrderedBsonD(t *testing.T) {
+	Convey("When unmarshalling JSON with nested objects as an ordered bson.D", t, func() {
+		data := `{"b":{"z":1,"y":[{"q":1,"p":2}]},"a":ObjectId("0123456789abcdef01234567")}`
+		out, err := UnmarshalOrderedBsonD([]byte(data))
+		So(err, ShouldBeNil)
+
+		Convey("every level should keep its key order", func() {
+			So(out[0].Name, ShouldEqual, "b")
+			So(out[1].Name, ShouldEqual, "a")
+			nested, ok := out[0].Value.(bson.D)
+			So(ok, ShouldBeTrue)
+			So(nested[0].Name, ShouldEqual, "z")
+			So(nested[1].Name, ShouldEqual, "y")
+			inArray, ok := nested[1].Value.([]interface{})[0].(bson.D)
+			So(ok, ShouldBeTrue)
+			So(inArray, ShouldResemble, bson.D{{"q", 1.0}, {"p", 2.0}})
+		})
+
+		Convey("extended JSON literals should be decoded as usual", func() {
+			So(out[1].Value, ShouldEqual, ObjectId("0123456789abcdef01234567"))
+		})
+	})
+}
@@ -80,8 +80,9 @@ func (tl *ToolLogger) Log(minVerb int, msg string) {
 	}
 }
 
+// log writes a message, with any credentials in it redacted.
 func (tl *ToolLogger) log(msg string) {
-	fmt.Fprintf(tl.writer, "%v\t%v\n", time.Now().Format(tl.format), msg)
+	fmt.Fprintf(tl.writer, "%v\t%v\n", time.Now().Format(tl.format), Redact(msg))
 }
 
 func NewToolLogger(verbosity VerbosityLevel) *ToolLogger {
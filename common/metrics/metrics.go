@@ -0,0 +1,173 @@
+// Package metrics implements a minimal registry of counters and gauges that
+// can be exposed over HTTP in the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Kind is the Prometheus type of a metric.
+type Kind string
+
+// Supported metric kinds.
+const (
+	CounterKind Kind = "counter"
+	GaugeKind   Kind = "gauge"
+)
+
+// Value is a single metric sample that is safe for concurrent use.
+type Value struct {
+	v int64
+}
+
+// Add increments the value by n.
+func (value *Value) Add(n int64) {
+	atomic.AddInt64(&value.v, n)
+}
+
+// Set replaces the value with n.
+func (value *Value) Set(n int64) {
+	atomic.StoreInt64(&value.v, n)
+}
+
+// Get returns the current value.
+func (value *Value) Get() int64 {
+	return atomic.LoadInt64(&value.v)
+}
+
+type series struct {
+	labels string
+	value  *Value
+	fn     func() float64
+}
+
+type family struct {
+	name   string
+	help   string
+	kind   Kind
+	series map[string]*series
+}
+
+// Registry holds a set of named metrics. The zero value is not usable;
+// use NewRegistry instead.
+type Registry struct {
+	mutex    sync.Mutex
+	families map[string]*family
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{families: map[string]*family{}}
+}
+
+// Counter returns the counter with the given name and label pairs, creating
+// it if necessary. Labels are given as alternating names and values, e.g.
+//
+//	registry.Counter("docs_total", "Documents.", "namespace", "test.foo")
+func (registry *Registry) Counter(name, help string, labels ...string) *Value {
+	return registry.get(name, help, CounterKind, labels).value
+}
+
+// Gauge returns the gauge with the given name and label pairs, creating
+// it if necessary.
+func (registry *Registry) Gauge(name, help string, labels ...string) *Value {
+	return registry.get(name, help, GaugeKind, labels).value
+}
+
+// GaugeFunc registers a gauge whose value is computed by fn each time the
+// registry is written.
+func (registry *Registry) GaugeFunc(name, help string, fn func() float64) {
+	registry.get(name, help, GaugeKind, nil).fn = fn
+}
+
+func (registry *Registry) get(name, help string, kind Kind, labels []string) *series {
+	if len(labels)%2 != 0 {
+		panic(fmt.Sprintf("metric %v given an odd number of label arguments", name))
+	}
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	fam, ok := registry.families[name]
+	if !ok {
+		fam = &family{name: name, help: help, kind: kind, series: map[string]*series{}}
+		registry.families[name] = fam
+	} else if fam.kind != kind {
+		panic(fmt.Sprintf("metric %v registered as both %v and %v", name, fam.kind, kind))
+	}
+
+	key := formatLabels(labels)
+	s, ok := fam.series[key]
+	if !ok {
+		s = &series{labels: key, value: &Value{}}
+		fam.series[key] = s
+	}
+	return s
+}
+
+// formatLabels renders label pairs as {name="value",...}
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%v="%v"`, labels[i], escapeLabelValue(labels[i+1])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+// Write writes all metrics to w in the Prometheus text exposition format,
+// sorted by metric name and labels.
+func (registry *Registry) Write(w io.Writer) error {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	names := make([]string, 0, len(registry.families))
+	for name := range registry.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fam := registry.families[name]
+		_, err := fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v %v\n", fam.name, fam.help, fam.name, fam.kind)
+		if err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(fam.series))
+		for key := range fam.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := fam.series[key]
+			if s.fn != nil {
+				_, err = fmt.Fprintf(w, "%v%v %v\n", fam.name, s.labels, s.fn())
+			} else {
+				_, err = fmt.Fprintf(w, "%v%v %v\n", fam.name, s.labels, s.value.Get())
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ServeHTTP implements http.Handler, writing the registry's metrics.
+func (registry *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	registry.Write(w)
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a registry holding a few metrics", t, func() {
+		registry := NewRegistry()
+		registry.Counter("docs_total", "Documents.").Add(3)
+		registry.Counter("docs_total", "Documents.").Add(2)
+		registry.Counter("coll_docs_total", "Per collection.", "namespace", `a."b"`).Add(7)
+		registry.Gauge("workers", "Workers.").Set(4)
+		registry.GaugeFunc("duration_seconds", "Duration.", func() float64 { return 1.5 })
+
+		Convey("the text output should contain every metric in sorted order", func() {
+			out := &bytes.Buffer{}
+			So(registry.Write(out), ShouldBeNil)
+			So(out.String(), ShouldEqual,
+				"# HELP coll_docs_total Per collection.\n"+
+					"# TYPE coll_docs_total counter\n"+
+					`coll_docs_total{namespace="a.\"b\""} 7`+"\n"+
+					"# HELP docs_total Documents.\n"+
+					"# TYPE docs_total counter\n"+
+					"docs_total 5\n"+
+					"# HELP duration_seconds Duration.\n"+
+					"# TYPE duration_seconds gauge\n"+
+					"duration_seconds 1.5\n"+
+					"# HELP workers Workers.\n"+
+					"# TYPE workers gauge\n"+
+					"workers 4\n")
+		})
+
+		Convey("registering a name with a different kind should panic", func() {
+			So(func() { registry.Gauge("docs_total", "Documents.") }, ShouldPanic)
+		})
+
+		Convey("the metrics should be served over http until closed", func() {
+			server, err := Serve("127.0.0.1:0", registry)
+			So(err, ShouldBeNil)
+			resp, err := http.Get("http://" + server.Addr() + "/metrics")
+			So(err, ShouldBeNil)
+			body, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			So(err, ShouldBeNil)
+			So(string(body), ShouldContainSubstring, "docs_total 5")
+			So(server.Close(), ShouldBeNil)
+		})
+	})
+}
+
+func TestTransferMetricsTotals(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Transfer metrics should total each namespace", t, func() {
+		m := NewTransferMetrics(NewRegistry(), "tool", "moved")
+		m.AddDocuments("b.c", 2)
+		m.AddBytes("b.c", 20)
+		m.AddDocuments("a.c", 1)
+		m.AddError("a.c")
+		m.AddDocuments("b.c", 3)
+		So(m.Totals(), ShouldResemble, []NamespaceTotals{
+			{Namespace: "a.c", Documents: 1, Errors: 1},
+			{Namespace: "b.c", Documents: 5, Bytes: 20},
+		})
+	})
+
+	Convey("The metrics of a namespace should add to its totals and counters", t, func() {
+		registry := NewRegistry()
+		m := NewTransferMetrics(registry, "tool", "moved")
+		nsMetrics := m.Namespace("a.c")
+		nsMetrics.AddDocuments(2)
+		nsMetrics.AddBytes(20)
+		m.AddDocuments("a.c", 1)
+		So(m.Totals(), ShouldResemble, []NamespaceTotals{{Namespace: "a.c", Documents: 3, Bytes: 20}})
+		out := &bytes.Buffer{}
+		So(registry.Write(out), ShouldBeNil)
+		So(out.String(), ShouldContainSubstring, "tool_documents_total 3\n")
+		So(out.String(), ShouldContainSubstring, `tool_collection_bytes_total{namespace="a.c"} 20`)
+	})
+
+	Convey("Nil transfer metrics should have no totals", t, func() {
+		var m *TransferMetrics
+		So(m.Totals(), ShouldBeNil)
+		m.Namespace("a.c").AddDocuments(1)
+	})
+}
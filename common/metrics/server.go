@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"net"
+	"net/http"
+)
+
+// Server exposes a Registry over HTTP at /metrics.
+type Server struct {
+	listener net.Listener
+}
+
+// Serve starts serving the registry's metrics on addr (e.g. ":9000") in the
+// background. The returned Server must be closed when the tool finishes.
+func Serve(addr string, registry *Registry) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error listening for metrics on %v: %v", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", registry)
+	go func() {
+		// Serve always returns an error once the listener is closed
+		err := http.Serve(listener, mux)
+		log.Logf(log.DebugHigh, "metrics server stopped: %v", err)
+	}()
+	log.Logf(log.Info, "serving metrics on http://%v/metrics", listener.Addr())
+	return &Server{listener: listener}, nil
+}
+
+// Addr returns the address the server is listening on.
+func (server *Server) Addr() string {
+	return server.listener.Addr().String()
+}
+
+// Close stops the server from accepting new connections.
+func (server *Server) Close() error {
+	return server.listener.Close()
+}
@@ -0,0 +1,204 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// TransferMetrics is the standard set of metrics exported by tools that move
+// documents between a server and dump files. A nil *TransferMetrics is valid
+// and records nothing, so callers need not check whether metrics are enabled.
+type TransferMetrics struct {
+	registry      *Registry
+	prefix        string
+	verb          string
+	documents     *Value
+	bytes         *Value
+	errors        *Value
+	activeWorkers *Value
+
+	totalsMutex sync.RWMutex
+	totals      map[string]*namespaceTotals
+}
+
+// namespaceTotals are the running totals of a namespace, which are updated
+// atomically.
+type namespaceTotals struct {
+	documents Value
+	bytes     Value
+	errors    Value
+}
+
+// NamespaceTotals are the documents, bytes and errors recorded for a
+// namespace.
+type NamespaceTotals struct {
+	Namespace string `json:"namespace"`
+	Documents int64  `json:"documents"`
+	Bytes     int64  `json:"bytes"`
+	Errors    int64  `json:"errors"`
+}
+
+// NewTransferMetrics registers the transfer metrics in registry. Every metric
+// name is prefixed with prefix (usually the tool name), and verb describes what
+// happens to documents (e.g. "inserted" or "dumped") for the help text.
+func NewTransferMetrics(registry *Registry, prefix, verb string) *TransferMetrics {
+	start := time.Now()
+	registry.GaugeFunc(prefix+"_duration_seconds", "Seconds since the tool started.",
+		func() float64 { return time.Since(start).Seconds() })
+	return &TransferMetrics{
+		registry:      registry,
+		prefix:        prefix,
+		verb:          verb,
+		documents:     registry.Counter(prefix+"_documents_total", "Documents "+verb+"."),
+		bytes:         registry.Counter(prefix+"_bytes_total", "Bytes of BSON "+verb+"."),
+		errors:        registry.Counter(prefix+"_errors_total", "Errors encountered."),
+		activeWorkers: registry.Gauge(prefix+"_active_workers", "Workers currently processing a collection."),
+		totals:        map[string]*namespaceTotals{},
+	}
+}
+
+// totalsFor returns the running totals of the namespace ns, which are only
+// created, under the write lock, the first time it is seen.
+func (m *TransferMetrics) totalsFor(ns string) *namespaceTotals {
+	m.totalsMutex.RLock()
+	totals, ok := m.totals[ns]
+	m.totalsMutex.RUnlock()
+	if ok {
+		return totals
+	}
+	m.totalsMutex.Lock()
+	defer m.totalsMutex.Unlock()
+	if totals, ok = m.totals[ns]; !ok {
+		totals = &namespaceTotals{}
+		m.totals[ns] = totals
+	}
+	return totals
+}
+
+// Totals returns the totals recorded for each namespace, sorted by
+// namespace, or nil if m is nil.
+func (m *TransferMetrics) Totals() []NamespaceTotals {
+	if m == nil {
+		return nil
+	}
+	m.totalsMutex.RLock()
+	defer m.totalsMutex.RUnlock()
+	totals := make([]NamespaceTotals, 0, len(m.totals))
+	for ns, nsTotals := range m.totals {
+		totals = append(totals, NamespaceTotals{
+			Namespace: ns,
+			Documents: nsTotals.documents.Get(),
+			Bytes:     nsTotals.bytes.Get(),
+			Errors:    nsTotals.errors.Get(),
+		})
+	}
+	sort.Sort(byNamespace(totals))
+	return totals
+}
+
+// For sorting totals by namespace
+type byNamespace []NamespaceTotals
+
+func (s byNamespace) Len() int           { return len(s) }
+func (s byNamespace) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byNamespace) Less(i, j int) bool { return s[i].Namespace < s[j].Namespace }
+
+// NamespaceMetrics records the documents and bytes transferred for a single
+// namespace, with its counters looked up once rather than on every call. A
+// nil *NamespaceMetrics is valid and records nothing.
+type NamespaceMetrics struct {
+	m                *TransferMetrics
+	totals           *namespaceTotals
+	documents, bytes *Value
+}
+
+// Namespace returns the metrics of the namespace ns, or nil if m is nil.
+func (m *TransferMetrics) Namespace(ns string) *NamespaceMetrics {
+	if m == nil {
+		return nil
+	}
+	return &NamespaceMetrics{
+		m:      m,
+		totals: m.totalsFor(ns),
+		documents: m.registry.Counter(m.prefix+"_collection_documents_total",
+			"Documents "+m.verb+" per collection.", "namespace", ns),
+		bytes: m.registry.Counter(m.prefix+"_collection_bytes_total",
+			"Bytes of BSON "+m.verb+" per collection.", "namespace", ns),
+	}
+}
+
+// AddDocuments records n documents transferred.
+func (nm *NamespaceMetrics) AddDocuments(n int64) {
+	if nm == nil {
+		return
+	}
+	nm.m.documents.Add(n)
+	nm.totals.documents.Add(n)
+	nm.documents.Add(n)
+}
+
+// AddBytes records n bytes transferred.
+func (nm *NamespaceMetrics) AddBytes(n int64) {
+	if nm == nil {
+		return
+	}
+	nm.m.bytes.Add(n)
+	nm.totals.bytes.Add(n)
+	nm.bytes.Add(n)
+}
+
+// AddDocuments records n documents transferred for the namespace ns.
+func (m *TransferMetrics) AddDocuments(ns string, n int64) {
+	m.Namespace(ns).AddDocuments(n)
+}
+
+// AddBytes records n bytes transferred for the namespace ns.
+func (m *TransferMetrics) AddBytes(ns string, n int64) {
+	m.Namespace(ns).AddBytes(n)
+}
+
+// ExpectDocuments records the number of documents ns is expected to contain.
+func (m *TransferMetrics) ExpectDocuments(ns string, n int64) {
+	if m == nil {
+		return
+	}
+	m.registry.Gauge(m.prefix+"_collection_documents_expected",
+		"Documents expected per collection.", "namespace", ns).Set(n)
+}
+
+// ExpectBytes records the number of bytes ns is expected to contain.
+func (m *TransferMetrics) ExpectBytes(ns string, n int64) {
+	if m == nil {
+		return
+	}
+	m.registry.Gauge(m.prefix+"_collection_bytes_expected",
+		"Bytes of BSON expected per collection.", "namespace", ns).Set(n)
+}
+
+// AddError records an error encountered while processing ns.
+func (m *TransferMetrics) AddError(ns string) {
+	if m == nil {
+		return
+	}
+	m.errors.Add(1)
+	m.totalsFor(ns).errors.Add(1)
+	m.registry.Counter(m.prefix+"_collection_errors_total",
+		"Errors encountered per collection.", "namespace", ns).Add(1)
+}
+
+// WorkerStarted marks a worker as busy.
+func (m *TransferMetrics) WorkerStarted() {
+	if m == nil {
+		return
+	}
+	m.activeWorkers.Add(1)
+}
+
+// WorkerDone marks a worker as no longer busy.
+func (m *TransferMetrics) WorkerDone() {
+	if m == nil {
+		return
+	}
+	m.activeWorkers.Add(-1)
+}
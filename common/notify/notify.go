@@ -0,0 +1,118 @@
+// Package notify reports the outcome of a tool run to a webhook or command,
+// for wiring dumps and restores into monitoring.
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/metrics"
+	"github.com/mongodb/mongo-tools/common/util"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Statuses of a Summary.
+const (
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+)
+
+// webhookTimeout bounds how long a webhook may take to respond.
+const webhookTimeout = 30 * time.Second
+
+// Summary describes a finished run of a tool.
+type Summary struct {
+	Tool            string                    `json:"tool"`
+	Status          string                    `json:"status"`
+	Error           string                    `json:"error,omitempty"`
+	Start           time.Time                 `json:"start"`
+	End             time.Time                 `json:"end"`
+	DurationSeconds float64                   `json:"durationSeconds"`
+	Documents       int64                     `json:"documents"`
+	Bytes           int64                     `json:"bytes"`
+	Errors          int64                     `json:"errors"`
+	Namespaces      []metrics.NamespaceTotals `json:"namespaces"`
+}
+
+// NewSummary returns the summary of a run of tool that started at start,
+// ended now with the error err, if any, and recorded the given totals.
+// Credentials in the error are redacted as they are in log messages.
+func NewSummary(tool string, start time.Time, err error, totals []metrics.NamespaceTotals) Summary {
+	end := time.Now()
+	summary := Summary{
+		Tool:            tool,
+		Status:          StatusSuccess,
+		Start:           start,
+		End:             end,
+		DurationSeconds: end.Sub(start).Seconds(),
+		Namespaces:      totals,
+	}
+	if summary.Namespaces == nil {
+		summary.Namespaces = []metrics.NamespaceTotals{}
+	}
+	if err != nil {
+		summary.Status = StatusFailure
+		summary.Error = log.Redact(err.Error())
+	}
+	for _, nsTotals := range totals {
+		summary.Documents += nsTotals.Documents
+		summary.Bytes += nsTotals.Bytes
+		summary.Errors += nsTotals.Errors
+	}
+	return summary
+}
+
+// isWebhook returns true if target is an http or https URL rather than a
+// command.
+func isWebhook(target string) bool {
+	return strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://")
+}
+
+// Send delivers the summary as JSON to target: as the body of a POST
+// request if target is an http or https URL, and otherwise on the standard
+// input of target run as a command, split into a program and its arguments
+// as a shell would split it. The command's output goes to the tool's
+// standard error, since its standard output may be the dump itself.
+func Send(target string, summary Summary) error {
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("error encoding summary: %v", err)
+	}
+	if isWebhook(target) {
+		client := &http.Client{Timeout: webhookTimeout}
+		resp, err := client.Post(target, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("webhook responded with %v", resp.Status)
+		}
+		return nil
+	}
+
+	args, err := util.SplitCommand(target)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// Complete sends the summary to target, logging rather than returning any
+// error, so that a failed notification does not change the outcome of the
+// run it reports on.
+func Complete(target string, summary Summary) {
+	log.Logf(log.Info, "sending %v summary to --onComplete", summary.Status)
+	if err := Send(target, summary); err != nil {
+		log.Logf(log.Always, "warning: error sending --onComplete notification: %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package options
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jessevdk/go-flags"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configEnvVar matches the ${NAME} references to environment variables
+// that are replaced in the string values of a --config file.
+var configEnvVar = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// findConfigPath returns the value of --config in the command line
+// arguments, or "" if it is not given.
+func findConfigPath(args []string) (string, error) {
+	path := ""
+	for i, arg := range args {
+		switch {
+		case arg == "--":
+			return path, nil
+		case arg == "--config":
+			if i+1 == len(args) {
+				return "", fmt.Errorf("expected argument for flag `--config'")
+			}
+			path = args[i+1]
+		case strings.HasPrefix(arg, "--config="):
+			path = strings.TrimPrefix(arg, "--config=")
+		}
+	}
+	return path, nil
+}
+
+// findOption returns the option with the given long name from any group
+// of the parser, or nil if there is none.
+func findOption(groups []*flags.Group, longName string) *flags.Option {
+	return findOptionMatching(groups, func(option *flags.Option) bool {
+		return option.LongName == longName
+	})
+}
+
+// findShortOption returns the option with the given short name from any
+// group of the parser, or nil if there is none.
+func findShortOption(groups []*flags.Group, shortName rune) *flags.Option {
+	return findOptionMatching(groups, func(option *flags.Option) bool {
+		return option.ShortName == shortName
+	})
+}
+
+func findOptionMatching(groups []*flags.Group, match func(*flags.Option) bool) *flags.Option {
+	for _, group := range groups {
+		for _, option := range group.Options() {
+			if match(option) {
+				return option
+			}
+		}
+		if option := findOptionMatching(group.Groups(), match); option != nil {
+			return option
+		}
+	}
+	return nil
+}
+
+// isFlag reports whether option is a flag, which takes no argument.
+func isFlag(option *flags.Option) bool {
+	switch option.Value().(type) {
+	case bool, []bool:
+		return true
+	}
+	return false
+}
+
+// commandLineOptions returns the options given in the command line
+// arguments, and the arguments with each flag given as --name=true or
+// --name=false rewritten to the form the parser accepts: --name, or
+// nothing at all.
+func (o *ToolOptions) commandLineOptions(args []string) (map[*flags.Option]bool, []string, error) {
+	given := map[*flags.Option]bool{}
+	rewritten := make([]string, 0, len(args))
+	for i, arg := range args {
+		switch {
+		case arg == "--":
+			return given, append(rewritten, args[i:]...), nil
+		case strings.HasPrefix(arg, "--"):
+			name, value := arg[2:], ""
+			hasValue := false
+			if equals := strings.Index(name, "="); equals >= 0 {
+				name, value, hasValue = name[:equals], name[equals+1:], true
+			}
+			option := findOption(o.parser.Groups(), name)
+			if option != nil {
+				given[option] = true
+				if hasValue && isFlag(option) {
+					set, err := strconv.ParseBool(value)
+					if err != nil {
+						return nil, nil, fmt.Errorf("expected true or false for flag `--%v', not %v", name, value)
+					}
+					if set {
+						rewritten = append(rewritten, "--"+name)
+					}
+					continue
+				}
+			}
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			// short flags may be grouped, as in -vvv; the first option
+			// that is not a flag takes the rest of the argument
+			for _, shortName := range arg[1:] {
+				option := findShortOption(o.parser.Groups(), shortName)
+				if option == nil {
+					break
+				}
+				given[option] = true
+				if !isFlag(option) {
+					break
+				}
+			}
+		}
+		rewritten = append(rewritten, arg)
+	}
+	return given, rewritten, nil
+}
+
+// configArgs reads a --config file and returns the command line arguments
+// equivalent to it, leaving out the options in skip. The file is a JSON
+// document whose keys are the long names of the tool's options. A flag
+// such as --drop takes true or false, an option that may be repeated takes
+// an array, and ${NAME} in a string is replaced by the value of the
+// environment variable NAME.
+func (o *ToolOptions) configArgs(path string, skip map[*flags.Option]bool) ([]string, error) {
+	jsonBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %v", err)
+	}
+	config := map[string]interface{}{}
+	if err = json.Unmarshal(jsonBytes, &config); err != nil {
+		return nil, fmt.Errorf("error parsing config file %v: %v", path, err)
+	}
+
+	// sorted, so that errors and argument order do not vary between runs
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	args := []string{}
+	for _, name := range names {
+		option := findOption(o.parser.Groups(), name)
+		if option == nil || name == "config" {
+			return nil, fmt.Errorf("unknown option '%v' in config file %v", name, path)
+		}
+		if skip[option] {
+			continue
+		}
+		values, ok := config[name].([]interface{})
+		if !ok {
+			values = []interface{}{config[name]}
+		}
+		for _, value := range values {
+			arg, err := configArg(option, value)
+			if err != nil {
+				return nil, fmt.Errorf("option '%v' in config file %v: %v", name, path, err)
+			}
+			if arg != "" {
+				args = append(args, arg)
+			}
+		}
+	}
+	return args, nil
+}
+
+// configArg returns the command line argument that sets option to value,
+// or "" for a flag set to false.
+func configArg(option *flags.Option, value interface{}) (string, error) {
+	switch option.Value().(type) {
+	case bool, []bool:
+		set, ok := value.(bool)
+		if !ok {
+			return "", fmt.Errorf("expected true or false")
+		}
+		if !set {
+			return "", nil
+		}
+		return "--" + option.LongName, nil
+	}
+
+	switch typed := value.(type) {
+	case string:
+		expanded, err := expandConfigEnv(typed)
+		if err != nil {
+			return "", err
+		}
+		return "--" + option.LongName + "=" + expanded, nil
+	case float64:
+		return "--" + option.LongName + "=" + strconv.FormatFloat(typed, 'f', -1, 64), nil
+	case bool:
+		return "--" + option.LongName + "=" + strconv.FormatBool(typed), nil
+	}
+	return "", fmt.Errorf("expected a string, number or array, not %v", value)
+}
+
+// expandConfigEnv replaces each ${NAME} in value with the value of the
+// environment variable NAME, which must be set.
+func expandConfigEnv(value string) (string, error) {
+	var err error
+	expanded := configEnvVar.ReplaceAllStringFunc(value, func(reference string) string {
+		name := configEnvVar.FindStringSubmatch(reference)[1]
+		envValue, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %v is not set", name)
+		}
+		return envValue
+	})
+	return expanded, err
+}
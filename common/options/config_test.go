@@ -0,0 +1,95 @@
+package options
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+type configTestOptions struct {
+	Drop     bool     `long:"drop"`
+	Workers  int      `long:"numWorkers"`
+	Excluded []string `long:"exclude"`
+}
+
+func (*configTestOptions) Name() string {
+	return "config test"
+}
+
+func TestConfigFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "tool-config-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	os.Setenv("CONFIG_TEST_PASSWORD", "s3cret")
+	defer os.Unsetenv("CONFIG_TEST_PASSWORD")
+
+	writeConfig := func(config string) {
+		So(ioutil.WriteFile(file.Name(), []byte(config), 0644), ShouldBeNil)
+	}
+
+	Convey("With a tool's options and a config file", t, func() {
+		opts := New("test", "", EnabledOptions{Auth: true, Connection: true, Namespace: true})
+		extra := &configTestOptions{}
+		opts.AddOptions(extra)
+
+		Convey("values from the file should be used, with secrets from the environment", func() {
+			writeConfig(`{"host":"db1","password":"${CONFIG_TEST_PASSWORD}","drop":true,` +
+				`"numWorkers":4,"exclude":["a","b"],"verbose":true}`)
+			_, err := opts.ParseArgs([]string{"--config", file.Name()})
+			So(err, ShouldBeNil)
+			So(opts.Host, ShouldEqual, "db1")
+			So(opts.Password, ShouldEqual, "s3cret")
+			So(extra.Drop, ShouldBeTrue)
+			So(extra.Workers, ShouldEqual, 4)
+			So(extra.Excluded, ShouldResemble, []string{"a", "b"})
+			So(opts.Level(), ShouldEqual, 1)
+		})
+
+		Convey("command line options should take precedence", func() {
+			writeConfig(`{"host":"db1","numWorkers":4}`)
+			_, err := opts.ParseArgs([]string{"--host", "db2", "--config=" + file.Name()})
+			So(err, ShouldBeNil)
+			So(opts.Host, ShouldEqual, "db2")
+			So(extra.Workers, ShouldEqual, 4)
+		})
+
+		Convey("repeated options on the command line should replace the file's values", func() {
+			writeConfig(`{"exclude":["a","b"],"verbose":[true,true]}`)
+			_, err := opts.ParseArgs([]string{"--config", file.Name(), "--exclude", "c", "-v"})
+			So(err, ShouldBeNil)
+			So(extra.Excluded, ShouldResemble, []string{"c"})
+			So(opts.Level(), ShouldEqual, 1)
+		})
+
+		Convey("a flag set in the file can be turned off on the command line", func() {
+			writeConfig(`{"drop":true}`)
+			_, err := opts.ParseArgs([]string{"--config", file.Name(), "--drop=false"})
+			So(err, ShouldBeNil)
+			So(extra.Drop, ShouldBeFalse)
+
+			_, err = opts.ParseArgs([]string{"--drop=true"})
+			So(err, ShouldBeNil)
+			So(extra.Drop, ShouldBeTrue)
+
+			_, err = opts.ParseArgs([]string{"--drop=maybe"})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("unknown options should be rejected", func() {
+			writeConfig(`{"hots":"db1"}`)
+			_, err := opts.ParseArgs([]string{"--config", file.Name()})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "unknown option 'hots'")
+		})
+
+		Convey("unset environment variables should be rejected", func() {
+			writeConfig(`{"password":"${CONFIG_TEST_UNSET}"}`)
+			_, err := opts.ParseArgs([]string{"--config", file.Name()})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "CONFIG_TEST_UNSET is not set")
+		})
+	})
+}
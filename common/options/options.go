@@ -76,8 +76,9 @@ type Namespace struct {
 
 // Struct holding generic options
 type General struct {
-	Help    bool `long:"help" description:"print usage"`
-	Version bool `long:"version" description:"print the tool version and exit"`
+	Help       bool   `long:"help" description:"print usage"`
+	Version    bool   `long:"version" description:"print the tool version and exit"`
+	ConfigPath string `long:"config" value-name:"<filename>" description:"JSON file of option values keyed by their long names, e.g. {\"host\":\"db1\",\"drop\":true}; options given on the command line take precedence, and ${NAME} in a value is replaced by the environment variable NAME"`
 }
 
 // Struct holding verbosity-related options
@@ -264,7 +265,38 @@ func (o *ToolOptions) AddOptions(opts ExtraOptions) error {
 // Parse the command line args.  Returns any extra args not accounted for by
 // parsing, as well as an error if the parsing returns an error.
 func (o *ToolOptions) Parse() ([]string, error) {
-	return o.parser.Parse()
+	return o.ParseArgs(os.Args[1:])
+}
+
+// ParseArgs parses the given command line arguments. A flag may be given
+// as --name=true or --name=false. The values of a --config file are used
+// only for the options the arguments do not give, so that an option given
+// in both replaces the file's value rather than adding to it. The
+// passwords given are registered to be redacted from log messages.
+func (o *ToolOptions) ParseArgs(args []string) ([]string, error) {
+	configPath, err := findConfigPath(args)
+	if err != nil {
+		return nil, err
+	}
+	given, args, err := o.commandLineOptions(args)
+	if err != nil {
+		return nil, err
+	}
+	if configPath != "" {
+		configArgs, err := o.configArgs(configPath, given)
+		if err != nil {
+			return nil, err
+		}
+		args = append(configArgs, args...)
+	}
+	extraArgs, err := o.parser.ParseArgs(args)
+	if o.Auth != nil {
+		log.RedactSecret(o.Auth.Password)
+	}
+	if o.SSL != nil {
+		log.RedactSecret(o.SSL.SSLPEMKeyPassword)
+	}
+	return extraArgs, err
 }
 
 func parseHiddenOption(opts *HiddenOptions, option string, arg flags.SplitArgument, args []string) ([]string, error) {
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"github.com/mongodb/mongo-tools/common/text"
 	"io"
+	"os"
+	"strings"
 	"sync"
 	"time"
 )
@@ -20,6 +22,20 @@ type Manager struct {
 	bars     []*Bar
 	barsLock *sync.Mutex
 	stopChan chan struct{}
+
+	// lineMode writes all bars as a single plain line, for output that
+	// is not a terminal
+	lineMode bool
+}
+
+// IsTerminal returns true if f is attached to a terminal rather than
+// redirected to a file or pipe.
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
 }
 
 // NewProgressBarManager returns an initialized Manager with the given
@@ -32,6 +48,13 @@ func NewProgressBarManager(w io.Writer, waitTime time.Duration) *Manager {
 	}
 }
 
+// SetLineMode makes the manager write the progress of all its bars as one
+// plain line per interval instead of drawing the bars. This keeps redirected
+// output readable while still showing regular signs of activity.
+func (manager *Manager) SetLineMode(enabled bool) {
+	manager.lineMode = enabled
+}
+
 // Attach registers the given progress bar with the manager. Should be used as
 //  myManager.Attach(myBar)
 //  defer myManager.Detach(myBar)
@@ -77,10 +100,40 @@ func (manager *Manager) Detach(pb *Bar) {
 	manager.bars = updatedBars
 }
 
+// BarProgress is the progress of one of a manager's bars.
+type BarProgress struct {
+	Name    string
+	Current int64
+	Max     int64
+	IsBytes bool
+}
+
+// Progress returns the progress of each of the manager's bars, in insert
+// order. It allows progress to be reported other than by rendering the bars.
+func (manager *Manager) Progress() []BarProgress {
+	manager.barsLock.Lock()
+	defer manager.barsLock.Unlock()
+	progress := make([]BarProgress, 0, len(manager.bars))
+	for _, bar := range manager.bars {
+		max, current := bar.Watching.Progress()
+		progress = append(progress, BarProgress{
+			Name:    bar.Name,
+			Current: current,
+			Max:     max,
+			IsBytes: bar.IsBytes,
+		})
+	}
+	return progress
+}
+
 // helper to render all bars in order
 func (manager *Manager) renderAllBars() {
 	manager.barsLock.Lock()
 	defer manager.barsLock.Unlock()
+	if manager.lineMode {
+		manager.renderLine()
+		return
+	}
 	grid := &text.GridWriter{
 		ColumnPadding: GridPadding,
 	}
@@ -96,6 +149,19 @@ func (manager *Manager) renderAllBars() {
 	}
 }
 
+// renderLine writes a summary of all bars on a single line. The caller
+// must hold barsLock.
+func (manager *Manager) renderLine() {
+	if len(manager.bars) == 0 {
+		return
+	}
+	summaries := make([]string, 0, len(manager.bars))
+	for _, bar := range manager.bars {
+		summaries = append(summaries, bar.renderSummary())
+	}
+	fmt.Fprintf(manager.writer, "progress: %v", strings.Join(summaries, "; "))
+}
+
 // Start kicks of the timed batch writing of progress bars.
 func (manager *Manager) Start() {
 	if manager.writer == nil {
@@ -194,3 +194,31 @@ func (cw *CountWriter) Write(b []byte) (int, error) {
 	*cw++
 	return len(b), nil
 }
+
+func TestManagerLineMode(t *testing.T) {
+
+	Convey("With a progress.Manager in line mode", t, func() {
+		writeBuffer := &bytes.Buffer{}
+		manager := NewProgressBarManager(writeBuffer, time.Second)
+		manager.SetLineMode(true)
+
+		Convey("rendering with no bars should write nothing", func() {
+			manager.renderAllBars()
+			So(writeBuffer.Len(), ShouldEqual, 0)
+		})
+
+		Convey("rendering two bars", func() {
+			counted := NewCounter(10)
+			counted.Inc(5)
+			manager.Attach(&Bar{Name: "db.one", Watching: counted, BarLength: 10})
+			manager.Attach(&Bar{Name: "db.two", Watching: NewCounter(0), BarLength: 10})
+			manager.renderAllBars()
+
+			Convey("should summarize both on one line without drawing bars", func() {
+				written := writeBuffer.String()
+				So(written, ShouldEqual, "progress: db.one 5/10 (50.0%); db.two 0")
+				So(written, ShouldNotContainSubstring, BarLeft)
+			})
+		})
+	})
+}
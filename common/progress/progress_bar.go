@@ -151,6 +151,17 @@ func (pb *Bar) renderToWriter() {
 	)
 }
 
+// renderSummary returns the bar's name and progress without drawing it.
+func (pb *Bar) renderSummary() string {
+	maxCount, currentCount := pb.Watching.Progress()
+	maxStr, currentStr := pb.formatCounts()
+	if maxCount == 0 {
+		return fmt.Sprintf("%v %v", pb.Name, currentStr)
+	}
+	percent := float64(currentCount) / float64(maxCount)
+	return fmt.Sprintf("%v %s/%s (%2.1f%%)", pb.Name, currentStr, maxStr, percent*100)
+}
+
 func (pb *Bar) renderToGridRow(grid *text.GridWriter) {
 	maxCount, currentCount := pb.Watching.Progress()
 	maxStr, currentStr := pb.formatCounts()
@@ -5,5 +5,6 @@ const (
 	ExitClean      int = 0
 	ExitBadOptions int = 3
 	ExitKill       int = 4
+	ExitTruncated  int = 5
 	// Go reserves exit code 2 for its own use
 )
@@ -0,0 +1,128 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// pipeCommand creates an exec.Cmd from command, split by SplitCommand into a
+// program and its arguments, passing its stderr through.
+func pipeCommand(command string) (*exec.Cmd, error) {
+	args, err := SplitCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// pipeCmdWriter feeds everything written to it to a command's input.
+type pipeCmdWriter struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	// the result of waiting for the command, once it has exited
+	waited  bool
+	waitErr error
+}
+
+// NewPipeCmdWriter starts command, such as a compressor, with its output
+// going to out. Data written to the returned writer is passed to the
+// command's input. Closing the writer closes that input and waits for the
+// command to exit, returning an error if it did not succeed.
+func NewPipeCmdWriter(command string, out io.Writer) (io.WriteCloser, error) {
+	cmd, err := pipeCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = out
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &pipeCmdWriter{cmd: cmd, stdin: stdin}, nil
+}
+
+func (w *pipeCmdWriter) Write(p []byte) (int, error) {
+	n, err := w.stdin.Write(p)
+	if err != nil {
+		// the command most likely exited early; its exit status says why
+		if waitErr := w.wait(); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (w *pipeCmdWriter) Close() error {
+	w.stdin.Close()
+	return w.wait()
+}
+
+// wait waits for the command to exit, only once, and returns an error if
+// it failed.
+func (w *pipeCmdWriter) wait() error {
+	if !w.waited {
+		w.waited = true
+		if err := w.cmd.Wait(); err != nil {
+			w.waitErr = fmt.Errorf("command '%v' failed: %v", strings.Join(w.cmd.Args, " "), err)
+		}
+	}
+	return w.waitErr
+}
+
+// pipeCmdReader reads a command's output.
+type pipeCmdReader struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	done   bool
+}
+
+// NewPipeCmdReader starts command, such as a decompressor, with in as its
+// input, and returns a reader of its output. The reader returns an error
+// instead of io.EOF if the command does not exit successfully. Closing the
+// reader before its end stops the command.
+func NewPipeCmdReader(command string, in io.Reader) (io.ReadCloser, error) {
+	cmd, err := pipeCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdin = in
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &pipeCmdReader{cmd: cmd, stdout: stdout}, nil
+}
+
+func (r *pipeCmdReader) Read(p []byte) (int, error) {
+	n, err := r.stdout.Read(p)
+	if err == io.EOF && !r.done {
+		r.done = true
+		if waitErr := r.cmd.Wait(); waitErr != nil {
+			return n, fmt.Errorf("command '%v' failed: %v", strings.Join(r.cmd.Args, " "), waitErr)
+		}
+	}
+	return n, err
+}
+
+func (r *pipeCmdReader) Close() error {
+	if r.done {
+		return nil
+	}
+	r.done = true
+	r.stdout.Close()
+	r.cmd.Process.Kill()
+	r.cmd.Wait()
+	return nil
+}
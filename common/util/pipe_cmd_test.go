@@ -0,0 +1,70 @@
+package util
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestPipeCmd(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a command piping data through tr", t, func() {
+
+		Convey("a writer should pass its data through the command", func() {
+			out := &bytes.Buffer{}
+			writer, err := NewPipeCmdWriter("tr a-z A-Z", out)
+			So(err, ShouldBeNil)
+			_, err = writer.Write([]byte("some data"))
+			So(err, ShouldBeNil)
+			So(writer.Close(), ShouldBeNil)
+			So(out.String(), ShouldEqual, "SOME DATA")
+		})
+
+		Convey("a reader should return the command's output", func() {
+			reader, err := NewPipeCmdReader("tr a-z A-Z", strings.NewReader("some data"))
+			So(err, ShouldBeNil)
+			data, err := ioutil.ReadAll(reader)
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "SOME DATA")
+			So(reader.Close(), ShouldBeNil)
+		})
+	})
+
+	Convey("A command with quoted arguments should be split like a shell would split it", t, func() {
+		out := &bytes.Buffer{}
+		writer, err := NewPipeCmdWriter(`tr ' a' "_b"`, out)
+		So(err, ShouldBeNil)
+		_, err = writer.Write([]byte("a day"))
+		So(err, ShouldBeNil)
+		So(writer.Close(), ShouldBeNil)
+		So(out.String(), ShouldEqual, "b_dby")
+	})
+
+	Convey("With a command that fails", t, func() {
+
+		Convey("closing a writer should return its exit status", func() {
+			writer, err := NewPipeCmdWriter("false", &bytes.Buffer{})
+			So(err, ShouldBeNil)
+			writer.Write([]byte("some data"))
+			So(writer.Close(), ShouldNotBeNil)
+		})
+
+		Convey("a reader should return an error instead of the end of input", func() {
+			reader, err := NewPipeCmdReader("false", strings.NewReader("some data"))
+			So(err, ShouldBeNil)
+			_, err = ioutil.ReadAll(reader)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "command 'false' failed")
+		})
+	})
+
+	Convey("An empty command should be rejected", t, func() {
+		_, err := NewPipeCmdWriter(" ", &bytes.Buffer{})
+		So(err, ShouldNotBeNil)
+	})
+}
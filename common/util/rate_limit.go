@@ -0,0 +1,40 @@
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket limiting a flow of bytes to a steady rate.
+// Up to a second's worth of bytes may pass at once after the flow has been
+// idle. It is safe for concurrent use.
+type RateLimiter struct {
+	bytesPerSecond int64
+
+	mutex sync.Mutex
+	// the time at which all bytes passed so far are paid for
+	paidUntil time.Time
+}
+
+// NewRateLimiter returns a limiter allowing bytesPerSecond bytes per second.
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	return &RateLimiter{bytesPerSecond: bytesPerSecond}
+}
+
+// Wait blocks until n more bytes may pass under the limit.
+func (limiter *RateLimiter) Wait(n int) {
+	limiter.mutex.Lock()
+	now := time.Now()
+	// unused time beyond a second does not accumulate
+	if earliest := now.Add(-time.Second); limiter.paidUntil.Before(earliest) {
+		limiter.paidUntil = earliest
+	}
+	limiter.paidUntil = limiter.paidUntil.Add(
+		time.Duration(float64(n) / float64(limiter.bytesPerSecond) * float64(time.Second)))
+	wait := limiter.paidUntil.Sub(now)
+	limiter.mutex.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
@@ -0,0 +1,31 @@
+package util
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a limiter of 1000 bytes per second", t, func() {
+		limiter := NewRateLimiter(1000)
+
+		Convey("a second's worth of bytes should pass at once", func() {
+			start := time.Now()
+			limiter.Wait(600)
+			limiter.Wait(400)
+			So(time.Since(start), ShouldBeLessThan, 50*time.Millisecond)
+		})
+
+		Convey("bytes beyond that should wait for the rate", func() {
+			limiter.Wait(1000)
+			start := time.Now()
+			limiter.Wait(100)
+			So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 90*time.Millisecond)
+		})
+	})
+}
@@ -0,0 +1,148 @@
+package util
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Backoff describes randomized exponential delays between retries. It uses
+// the "full jitter" algorithm: the delay before each retry is chosen uniformly
+// between zero and min(MaxDelay, BaseDelay * 2^attempt), so that many workers
+// failing at the same moment spread out their retries.
+type Backoff struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// Budget, if not nil, bounds the time spent retrying, and is shared by
+	// every Retry that uses it.
+	Budget *RetryBudget
+}
+
+// Delay returns how long to wait before the given retry attempt, counting from zero.
+func (backoff Backoff) Delay(attempt int) time.Duration {
+	if backoff.BaseDelay <= 0 {
+		return 0
+	}
+	ceiling := backoff.MaxDelay
+	if attempt < 32 {
+		if exp := backoff.BaseDelay << uint(attempt); exp > 0 && exp < ceiling {
+			ceiling = exp
+		}
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// RetryBudget bounds the wall-clock time that an operation spends retrying
+// across all of its retry loops. Time during which at least one retry is in
+// progress, whether waiting on the backoff or calling the function again,
+// counts against the budget once, however many retries overlap. A nil
+// *RetryBudget is unlimited.
+type RetryBudget struct {
+	limit time.Duration
+
+	mutex    sync.Mutex
+	spent    time.Duration
+	retrying int
+	since    time.Time
+}
+
+// NewRetryBudget returns a budget allowing limit of time spent retrying.
+func NewRetryBudget(limit time.Duration) *RetryBudget {
+	return &RetryBudget{limit: limit}
+}
+
+// Remaining returns how much of the budget is left.
+func (budget *RetryBudget) Remaining() time.Duration {
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+	return budget.remaining()
+}
+
+// Spent reports whether the budget is used up, so that a retry would fail
+// with a RetryBudgetError. A nil *RetryBudget is never spent.
+func (budget *RetryBudget) Spent() bool {
+	return budget != nil && budget.Remaining() <= 0
+}
+
+// remaining returns how much of the budget is left. The mutex must be held.
+func (budget *RetryBudget) remaining() time.Duration {
+	spent := budget.spent
+	if budget.retrying > 0 {
+		spent += time.Since(budget.since)
+	}
+	return budget.limit - spent
+}
+
+// start records the beginning of a retry and returns how long it may wait
+// before calling the function again, or false if the budget is spent.
+func (budget *RetryBudget) start(delay time.Duration) (time.Duration, bool) {
+	if budget == nil {
+		return delay, true
+	}
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+	remaining := budget.remaining()
+	if remaining <= 0 {
+		return 0, false
+	}
+	if budget.retrying == 0 {
+		budget.since = time.Now()
+	}
+	budget.retrying++
+	if delay > remaining {
+		delay = remaining
+	}
+	return delay, true
+}
+
+// finish records the end of a retry.
+func (budget *RetryBudget) finish() {
+	if budget == nil {
+		return
+	}
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+	budget.retrying--
+	if budget.retrying == 0 {
+		budget.spent += time.Since(budget.since)
+	}
+}
+
+// RetryBudgetError is returned by Retry when an error could have been
+// retried but the backoff's budget is spent. Cause is the last error.
+type RetryBudgetError struct {
+	Limit time.Duration
+	Cause error
+}
+
+func (e RetryBudgetError) Error() string {
+	return fmt.Sprintf("retry budget exhausted after retrying for %v: %v", e.Limit, e.Cause)
+}
+
+func (e RetryBudgetError) Unwrap() error {
+	return e.Cause
+}
+
+// Retry calls fn until it succeeds, it returns an error for which shouldRetry
+// returns false, or it has been retried maxRetries times, sleeping for a
+// backoff delay before each retry. A negative maxRetries places no limit on
+// the number of retries. It returns fn's last error, or a RetryBudgetError if
+// the backoff's budget ran out first.
+func Retry(maxRetries int, backoff Backoff, shouldRetry func(error) bool, fn func() error) error {
+	err := fn()
+	for attempt := 0; err != nil && (maxRetries < 0 || attempt < maxRetries) && shouldRetry(err); attempt++ {
+		delay, ok := backoff.Budget.start(backoff.Delay(attempt))
+		if !ok {
+			return RetryBudgetError{backoff.Budget.limit, err}
+		}
+		time.Sleep(delay)
+		err = fn()
+		backoff.Budget.finish()
+	}
+	return err
+}
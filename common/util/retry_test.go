@@ -0,0 +1,130 @@
+package util
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a backoff policy", t, func() {
+		backoff := Backoff{BaseDelay: 10 * time.Millisecond, MaxDelay: 100 * time.Millisecond}
+
+		Convey("delays should stay below the exponential ceiling", func() {
+			for i := 0; i < 100; i++ {
+				So(backoff.Delay(0), ShouldBeLessThanOrEqualTo, 10*time.Millisecond)
+				So(backoff.Delay(2), ShouldBeLessThanOrEqualTo, 40*time.Millisecond)
+			}
+		})
+
+		Convey("delays should never exceed the maximum, even for many attempts", func() {
+			for _, attempt := range []int{4, 10, 40, 1000} {
+				So(backoff.Delay(attempt), ShouldBeLessThanOrEqualTo, 100*time.Millisecond)
+				So(backoff.Delay(attempt), ShouldBeGreaterThanOrEqualTo, 0)
+			}
+		})
+
+		Convey("a zero base delay should not wait at all", func() {
+			backoff.BaseDelay = 0
+			for _, attempt := range []int{0, 4, 40} {
+				So(backoff.Delay(attempt), ShouldEqual, 0)
+			}
+		})
+	})
+}
+
+func TestRetry(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When retrying a failing function", t, func() {
+		calls := 0
+		failing := func() error {
+			calls++
+			return fmt.Errorf("failure %v", calls)
+		}
+		always := func(error) bool { return true }
+
+		Convey("it should be called once plus the number of retries", func() {
+			err := Retry(3, Backoff{}, always, failing)
+			So(err.Error(), ShouldEqual, "failure 4")
+			So(calls, ShouldEqual, 4)
+		})
+
+		Convey("it should not be retried if the error is not retryable", func() {
+			err := Retry(3, Backoff{}, func(error) bool { return false }, failing)
+			So(err, ShouldNotBeNil)
+			So(calls, ShouldEqual, 1)
+		})
+
+		Convey("it should stop as soon as it succeeds", func() {
+			err := Retry(3, Backoff{}, always, func() error {
+				calls++
+				if calls < 2 {
+					return fmt.Errorf("failure")
+				}
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(calls, ShouldEqual, 2)
+		})
+	})
+}
+
+func TestRetryBudget(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When retrying with a budget", t, func() {
+		calls := 0
+		failing := func() error {
+			calls++
+			return fmt.Errorf("failure %v", calls)
+		}
+		always := func(error) bool { return true }
+		backoff := Backoff{
+			BaseDelay: 10 * time.Millisecond,
+			MaxDelay:  10 * time.Millisecond,
+			Budget:    NewRetryBudget(50 * time.Millisecond),
+		}
+
+		Convey("unlimited retries should stop once the budget is spent", func() {
+			start := time.Now()
+			err := Retry(-1, backoff, always, failing)
+			So(time.Since(start), ShouldBeLessThan, time.Second)
+			budgetErr, ok := err.(RetryBudgetError)
+			So(ok, ShouldBeTrue)
+			So(budgetErr.Cause.Error(), ShouldEqual, fmt.Sprintf("failure %v", calls))
+			So(err.Error(), ShouldStartWith, "retry budget exhausted after retrying for 50ms")
+			So(backoff.Budget.Remaining(), ShouldBeLessThanOrEqualTo, 0)
+			So(backoff.Budget.Spent(), ShouldBeTrue)
+		})
+
+		Convey("the budget should be shared between retry loops", func() {
+			Retry(-1, backoff, always, failing)
+			callsBefore := calls
+			err := Retry(3, backoff, always, failing)
+			So(err, ShouldHaveSameTypeAs, RetryBudgetError{})
+			So(calls, ShouldEqual, callsBefore+1)
+		})
+
+		Convey("time not spent retrying should not count", func() {
+			err := Retry(-1, backoff, always, func() error { return nil })
+			So(err, ShouldBeNil)
+			time.Sleep(60 * time.Millisecond)
+			So(backoff.Budget.Remaining(), ShouldEqual, 50*time.Millisecond)
+			So(backoff.Budget.Spent(), ShouldBeFalse)
+			So((*RetryBudget)(nil).Spent(), ShouldBeFalse)
+		})
+
+		Convey("a retry count should still apply", func() {
+			err := Retry(2, backoff, always, failing)
+			So(err.Error(), ShouldEqual, "failure 3")
+		})
+	})
+}
@@ -0,0 +1,80 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// SplitCommand splits a command line into a program and its arguments the
+// way a POSIX shell splits words, without running a shell: words are
+// separated by unquoted whitespace, single quotes preserve everything up to
+// the closing quote, double quotes preserve everything but a backslash
+// before one of $, `, ", \ or a newline, and a backslash outside quotes
+// escapes the character after it. Variables, globs, pipes and other shell
+// syntax are not interpreted.
+func SplitCommand(command string) ([]string, error) {
+	words := []string{}
+	word := &bytes.Buffer{}
+	inWord := false
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '\\':
+			if i+1 == len(command) {
+				return nil, fmt.Errorf("command ends with an unescaped backslash: %v", command)
+			}
+			i++
+			if command[i] != '\n' {
+				word.WriteByte(command[i])
+				inWord = true
+			}
+		case c == '\'':
+			end := strings.IndexByte(command[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote in command: %v", command)
+			}
+			word.WriteString(command[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			closed := false
+			for i++; i < len(command); i++ {
+				if command[i] == '"' {
+					closed = true
+					break
+				}
+				if command[i] == '\\' && i+1 < len(command) {
+					switch command[i+1] {
+					case '$', '`', '"', '\\':
+						i++
+					case '\n':
+						i++
+						continue
+					}
+				}
+				word.WriteByte(command[i])
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated double quote in command: %v", command)
+			}
+			inWord = true
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	return words, nil
+}
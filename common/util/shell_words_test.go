@@ -0,0 +1,61 @@
+package util
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When splitting a command line", t, func() {
+
+		Convey("words should be separated by whitespace", func() {
+			args, err := SplitCommand("  zstd\t-d   -q ")
+			So(err, ShouldBeNil)
+			So(args, ShouldResemble, []string{"zstd", "-d", "-q"})
+		})
+
+		Convey("quoted whitespace should stay in its word", func() {
+			args, err := SplitCommand(`/opt/my\ tools/notify --title 'Nightly backup' "--to=ops team"`)
+			So(err, ShouldBeNil)
+			So(args, ShouldResemble, []string{"/opt/my tools/notify", "--title", "Nightly backup", "--to=ops team"})
+		})
+
+		Convey("quotes should be joined with the rest of their word", func() {
+			args, err := SplitCommand(`a'b c'"d"e ''`)
+			So(err, ShouldBeNil)
+			So(args, ShouldResemble, []string{"ab cde", ""})
+		})
+
+		Convey("backslashes should only escape special characters in double quotes", func() {
+			args, err := SplitCommand(`"a \"b\" \$c \d" 'e \f'`)
+			So(err, ShouldBeNil)
+			So(args, ShouldResemble, []string{`a "b" $c \d`, `e \f`})
+		})
+
+		Convey("shell syntax should not be interpreted", func() {
+			args, err := SplitCommand("echo $HOME | cat")
+			So(err, ShouldBeNil)
+			So(args, ShouldResemble, []string{"echo", "$HOME", "|", "cat"})
+		})
+
+		Convey("an unterminated quote should be an error", func() {
+			_, err := SplitCommand(`notify 'oops`)
+			So(err, ShouldNotBeNil)
+			_, err = SplitCommand(`notify "oops`)
+			So(err, ShouldNotBeNil)
+			_, err = SplitCommand(`notify oops\`)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("an empty command should be an error", func() {
+			_, err := SplitCommand(" \t")
+			So(err, ShouldNotBeNil)
+			_, err = SplitCommand("")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
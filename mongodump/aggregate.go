@@ -0,0 +1,94 @@
+package mongodump
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/progress"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+)
+
+// parseAggregatePipeline parses an --aggregate pipeline: a JSON array of
+// stage documents, which may use extended JSON. Every document in the
+// result is a bson.D in the order it was written, since the order of keys
+// matters to stages such as $sort. Pipelines that write with $out or
+// $merge are rejected.
+func parseAggregatePipeline(pipelineJSON string) ([]interface{}, error) {
+	wrapped := []byte(`{"pipeline":` + pipelineJSON + `}`)
+
+	// extended JSON values are converted from a decoding with maps, and
+	// then put back in the key order of a decoding with bson.D
+	var asJSON map[string]interface{}
+	if err := json.Unmarshal(wrapped, &asJSON); err != nil {
+		return nil, fmt.Errorf("error parsing pipeline as json: %v", err)
+	}
+	converted, err := bsonutil.ConvertJSONValueToBSON(asJSON["pipeline"])
+	if err != nil {
+		return nil, fmt.Errorf("error converting pipeline to bson: %v", err)
+	}
+	ordered, err := json.UnmarshalOrderedBsonD(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing pipeline as json: %v", err)
+	}
+
+	stages, ok := converted.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("pipeline must be an array of stages")
+	}
+	orderedStages, _ := ordered[0].Value.([]interface{})
+	pipeline := bsonutil.OrderLike(stages, orderedStages).([]interface{})
+	for i, stage := range pipeline {
+		document, ok := stage.(bson.D)
+		if !ok || len(document) != 1 {
+			return nil, fmt.Errorf("stage %v of the pipeline must be a document with a single field", i+1)
+		}
+		// a dump must not write to the database it reads from
+		switch document[0].Name {
+		case "$out", "$merge":
+			return nil, fmt.Errorf("stage %v of the pipeline cannot be %v, since a dump only reads data",
+				i+1, document[0].Name)
+		}
+	}
+	return pipeline, nil
+}
+
+// aggregateCount returns the number of documents the pipeline will return,
+// using a $count stage. Servers before 3.4 have no $count, in which case
+// the count is unknown and 0 is returned.
+func aggregateCount(collection *mgo.Collection, pipeline []interface{}) int {
+	result := struct {
+		Count int `bson:"count"`
+	}{}
+	counting := append(append([]interface{}{}, pipeline...), bson.D{{"$count", "count"}})
+	err := collection.Pipe(counting).AllowDiskUse().One(&result)
+	if err != nil && err != mgo.ErrNotFound {
+		log.Logf(log.DebugLow, "unable to count the results of the pipeline: %v", err)
+	}
+	return result.Count
+}
+
+// dumpAggregateToWriter writes the results of the --aggregate pipeline, run
+// against the intent's collection, to the writer.
+func (dump *MongoDump) dumpAggregateToWriter(
+	session *mgo.Session, intent *intents.Intent, writer io.Writer) error {
+	collection := session.DB(intent.DB).C(intent.C)
+	total := aggregateCount(collection, dump.pipeline)
+	log.Logf(log.Info, "\taggregation returns %v documents", total)
+	dump.metrics.ExpectDocuments(intent.Namespace(), int64(total))
+
+	dumpProgressor := progress.NewCounter(int64(total))
+	bar := &progress.Bar{
+		Name:      intent.Namespace(),
+		Watching:  dumpProgressor,
+		BarLength: progressBarLength,
+	}
+	dump.progressManager.Attach(bar)
+	defer dump.progressManager.Detach(bar)
+
+	iter := collection.Pipe(dump.pipeline).AllowDiskUse().Iter()
+	return dump.dumpIterToWriter(iter, intent.Namespace(), writer, dumpProgressor)
+}
@@ -0,0 +1,54 @@
+package mongodump
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+	"time"
+)
+
+func TestParseAggregatePipeline(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a pipeline using extended JSON and a compound $sort", t, func() {
+		pipeline, err := parseAggregatePipeline(`[` +
+			`{$match:{created:{$gte:{"$date":"2016-01-01T00:00:00Z"}},n:{"$numberLong":"5"}}},` +
+			`{$sort:{z:1,a:-1,m:1}}]`)
+		So(err, ShouldBeNil)
+		So(len(pipeline), ShouldEqual, 2)
+
+		Convey("extended JSON values should be converted", func() {
+			match := pipeline[0].(bson.D)[0].Value.(bson.D)
+			So(match[0].Name, ShouldEqual, "created")
+			gte := match[0].Value.(bson.D)[0].Value
+			So(gte, ShouldHaveSameTypeAs, time.Time{})
+			So(gte.(time.Time).Year(), ShouldEqual, 2016)
+			So(match[1].Value, ShouldEqual, int64(5))
+		})
+
+		Convey("the keys of every document should stay in order", func() {
+			sort := pipeline[1].(bson.D)
+			So(sort[0].Name, ShouldEqual, "$sort")
+			So(sort[0].Value, ShouldResemble, bson.D{{"z", 1.0}, {"a", -1.0}, {"m", 1.0}})
+		})
+	})
+
+	Convey("Invalid pipelines should be rejected", t, func() {
+		_, err := parseAggregatePipeline(`{$match:{}}`)
+		So(err, ShouldNotBeNil)
+		_, err = parseAggregatePipeline(`[{$match:{}, $limit:1}]`)
+		So(err, ShouldNotBeNil)
+		_, err = parseAggregatePipeline(`[{$match:`)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Pipelines that write to a collection should be rejected", t, func() {
+		_, err := parseAggregatePipeline(`[{$match:{}}, {$out:"copy"}]`)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "$out")
+		_, err = parseAggregatePipeline(`[{$merge:{into:"copy"}}]`)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "$merge")
+	})
+}
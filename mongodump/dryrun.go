@@ -0,0 +1,101 @@
+package mongodump
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/text"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+)
+
+// dryRunRow describes one collection that a dump would write.
+type dryRunRow struct {
+	namespace string
+	documents int64
+	bytes     int64
+}
+
+// estimatedDumpSize returns the number of bytes the intent's collection
+// would take in the dump, based on its collStats data size. With
+// --sampleRate, the size is scaled to the sampled fraction. With --query or
+// --dumpWindow, it is the average document size times the intent's count
+// of matching documents.
+func (dump *MongoDump) estimatedDumpSize(session *mgo.Session, intent *intents.Intent) (int64, error) {
+	stats := bson.M{}
+	err := session.DB(intent.DB).Run(bson.D{{"collStats", intent.C}}, &stats)
+	if err != nil {
+		return 0, fmt.Errorf("error getting stats for %v: %v", intent.Namespace(), err)
+	}
+	size, err := util.ToInt(stats["size"])
+	if err != nil {
+		return 0, fmt.Errorf("error reading size of %v: %v", intent.Namespace(), err)
+	}
+	if len(dump.query) > 0 {
+		// the count is of the documents matching the filter, which are
+		// assumed to be of the collection's average size
+		if intent.Size == 0 {
+			return 0, nil
+		}
+		avgObjSize, err := util.ToInt(stats["avgObjSize"])
+		if err != nil {
+			return 0, fmt.Errorf("error reading average document size of %v: %v", intent.Namespace(), err)
+		}
+		return int64(avgObjSize) * intent.Size, nil
+	}
+	if dump.InputOptions.SampleRate > 0 {
+		return int64(float64(size) * dump.InputOptions.SampleRate), nil
+	}
+	return int64(size), nil
+}
+
+// printDryRun writes a table of the collections the dump would write, with
+// their document counts and estimated sizes, instead of dumping them. It
+// must be called before the intent manager is finalized.
+func (dump *MongoDump) printDryRun(out io.Writer) error {
+	session, err := dump.sessionProvider.GetSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	rows := []dryRunRow{}
+	for _, intent := range dump.manager.Intents() {
+		size, err := dump.estimatedDumpSize(session, intent)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, dryRunRow{intent.Namespace(), intent.Size, size})
+	}
+	writeDryRunGrid(rows, out)
+
+	if len(dump.query) > 0 {
+		log.Log(log.Always, "counts are of the documents matching --query or --dumpWindow, "+
+			"and sizes are estimated from the average document size of each collection")
+	}
+	if dump.OutputOptions.Oplog {
+		log.Log(log.Always, "oplog entries written during the dump would also be included")
+	}
+	log.Log(log.Always, "dry run: no files were written")
+	return nil
+}
+
+// writeDryRunGrid writes the rows as a table followed by their totals.
+func writeDryRunGrid(rows []dryRunRow, out io.Writer) {
+	grid := &text.GridWriter{ColumnPadding: 4}
+	grid.WriteCells("ns", "documents", "estimated size")
+	grid.EndRow()
+	var totalDocuments, totalBytes int64
+	for _, row := range rows {
+		grid.WriteCells(row.namespace, fmt.Sprintf("%v", row.documents), text.FormatByteAmount(row.bytes))
+		grid.EndRow()
+		totalDocuments += row.documents
+		totalBytes += row.bytes
+	}
+	grid.WriteCells(fmt.Sprintf("total (%v collections)", len(rows)),
+		fmt.Sprintf("%v", totalDocuments), text.FormatByteAmount(totalBytes))
+	grid.EndRow()
+	grid.Flush(out)
+}
@@ -0,0 +1,37 @@
+package mongodump
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+)
+
+func TestWriteDryRunGrid(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When writing a dry run table", t, func() {
+		out := &bytes.Buffer{}
+		writeDryRunGrid([]dryRunRow{
+			{"test.small", 10, 512},
+			{"test.large", 2000, 3 * 1024 * 1024},
+		}, out)
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+
+		Convey("each collection should get a row after the header", func() {
+			So(len(lines), ShouldEqual, 4)
+			So(lines[0], ShouldContainSubstring, "estimated size")
+			So(lines[1], ShouldContainSubstring, "test.small")
+			So(lines[1], ShouldContainSubstring, "512.0 B")
+			So(lines[2], ShouldContainSubstring, "test.large")
+			So(lines[2], ShouldContainSubstring, "3.0 MB")
+		})
+
+		Convey("the last row should hold the totals", func() {
+			So(lines[3], ShouldContainSubstring, "total (2 collections)")
+			So(lines[3], ShouldContainSubstring, "2010")
+		})
+	})
+}
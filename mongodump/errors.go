@@ -0,0 +1,18 @@
+package mongodump
+
+// CollectionDumpError is returned by Dump when dumping a collection fails,
+// so that programs using this package can tell which collection it was.
+// Its message is that of the underlying error, as mongodump has always
+// printed it.
+type CollectionDumpError struct {
+	Namespace string
+	Cause     error
+}
+
+func (e CollectionDumpError) Error() string {
+	return e.Cause.Error()
+}
+
+func (e CollectionDumpError) Unwrap() error {
+	return e.Cause
+}
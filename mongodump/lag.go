@@ -0,0 +1,147 @@
+package mongodump
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Replica set member states, as reported by replSetGetStatus.
+const (
+	memberStatePrimary   = 1
+	memberStateSecondary = 2
+)
+
+// replSetMember is a member of the result of replSetGetStatus.
+type replSetMember struct {
+	Name       string    `bson:"name"`
+	State      int       `bson:"state"`
+	StateStr   string    `bson:"stateStr"`
+	OptimeDate time.Time `bson:"optimeDate"`
+	Self       bool      `bson:"self"`
+}
+
+// replSetStatus is the result of replSetGetStatus.
+type replSetStatus struct {
+	Members []replSetMember `bson:"members"`
+}
+
+// member returns the member matching fn, or nil if there is none.
+func (status replSetStatus) member(fn func(replSetMember) bool) *replSetMember {
+	for i := range status.Members {
+		if fn(status.Members[i]) {
+			return &status.Members[i]
+		}
+	}
+	return nil
+}
+
+// replicationLag returns the member the status was read from and how far
+// its last applied operation is behind the primary's.
+func replicationLag(status replSetStatus) (replSetMember, time.Duration, error) {
+	self := status.member(func(member replSetMember) bool { return member.Self })
+	if self == nil {
+		return replSetMember{}, 0, fmt.Errorf("replSetGetStatus did not report the member it ran on")
+	}
+	primary := status.member(func(member replSetMember) bool { return member.State == memberStatePrimary })
+	if primary == nil {
+		return *self, 0, fmt.Errorf("the replica set has no primary to measure the lag of %v against", self.Name)
+	}
+	return *self, primary.OptimeDate.Sub(self.OptimeDate), nil
+}
+
+// freshSecondaries returns the names of the secondaries other than self
+// whose lag is at most maxLag, sorted.
+func freshSecondaries(status replSetStatus, maxLag time.Duration) []string {
+	primary := status.member(func(member replSetMember) bool { return member.State == memberStatePrimary })
+	if primary == nil {
+		return nil
+	}
+	names := []string{}
+	for _, member := range status.Members {
+		if member.State == memberStateSecondary && !member.Self &&
+			primary.OptimeDate.Sub(member.OptimeDate) <= maxLag {
+			names = append(names, member.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkLag returns an error if the member the status was read from is not
+// a secondary, or lags the primary by more than maxLag.
+func checkLag(status replSetStatus, maxLag time.Duration) error {
+	self, lag, err := replicationLag(status)
+	if err != nil {
+		return err
+	}
+	if self.State != memberStateSecondary {
+		return fmt.Errorf("--maxLagSeconds only applies when dumping from a secondary, "+
+			"but the dump reads from %v, which is %v", self.Name, self.StateStr)
+	}
+	log.Logf(log.Always, "reading from secondary %v, %v behind the primary", self.Name, lag)
+	if lag <= maxLag {
+		return nil
+	}
+	message := fmt.Sprintf("secondary %v is %v behind the primary, more than --maxLagSeconds %v",
+		self.Name, lag, maxLag.Seconds())
+	if fresh := freshSecondaries(status, maxLag); len(fresh) > 0 {
+		return fmt.Errorf("%v; try dumping from %v instead", message, strings.Join(fresh, " or "))
+	}
+	return fmt.Errorf("%v, and no other secondary is within it", message)
+}
+
+// checkReplicationLag implements --maxLagSeconds: it asks the node the dump
+// reads from for the status of its replica set, and returns an error if that
+// node is not a secondary or is too far behind the primary to take a fresh
+// enough dump from. Unless the dump already connects directly to one node,
+// each of its sessions could be sent to a different secondary, so the dump
+// is then pinned to the member that was checked.
+func (dump *MongoDump) checkReplicationLag() error {
+	session, err := dump.sessionProvider.GetSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	status := replSetStatus{}
+	if err = session.Run("replSetGetStatus", &status); err != nil {
+		return fmt.Errorf("error checking replication lag for --maxLagSeconds: %v", err)
+	}
+	maxLag := time.Duration(dump.InputOptions.MaxLagSeconds) * time.Second
+	if err = checkLag(status, maxLag); err != nil {
+		return err
+	}
+	if dump.ToolOptions.Direct {
+		return nil
+	}
+	self := status.member(func(member replSetMember) bool { return member.Self })
+	return dump.pinToMember(self.Name)
+}
+
+// pinToMember replaces the dump's session provider with one connected
+// directly to the replica set member with the given host and port, closing
+// the replaced one.
+func (dump *MongoDump) pinToMember(name string) error {
+	toolOptions := *dump.ToolOptions
+	connection := *toolOptions.Connection
+	connection.Host = name
+	connection.Port = ""
+	toolOptions.Connection = &connection
+	toolOptions.Direct = true
+	toolOptions.ReplicaSetName = ""
+	provider, err := db.NewSessionProvider(toolOptions)
+	if err != nil {
+		return fmt.Errorf("can't create session for %v: %v", name, err)
+	}
+	provider.SetFlags(db.Monotonic)
+	provider.SetMaxConnections(dump.OutputOptions.MaxConnections)
+	log.Logf(log.Info, "dumping only from %v, the secondary checked by --maxLagSeconds", name)
+	if dump.sessionProvider != nil {
+		dump.sessionProvider.Close()
+	}
+	dump.sessionProvider = provider
+	return nil
+}
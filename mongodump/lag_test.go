@@ -0,0 +1,87 @@
+package mongodump
+
+import (
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestCheckLag(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a replica set of a primary and two secondaries", t, func() {
+		now := time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC)
+		status := replSetStatus{Members: []replSetMember{
+			{Name: "a:27017", State: memberStatePrimary, StateStr: "PRIMARY", OptimeDate: now},
+			{Name: "b:27017", State: memberStateSecondary, StateStr: "SECONDARY", OptimeDate: now.Add(-5 * time.Second)},
+			{Name: "c:27017", State: memberStateSecondary, StateStr: "SECONDARY", OptimeDate: now.Add(-10 * time.Minute)},
+		}}
+
+		Convey("a secondary within the threshold should pass", func() {
+			status.Members[1].Self = true
+			So(checkLag(status, time.Minute), ShouldBeNil)
+		})
+
+		Convey("a lagging secondary should be refused, suggesting a fresh one", func() {
+			status.Members[2].Self = true
+			_, lag, err := replicationLag(status)
+			So(err, ShouldBeNil)
+			So(lag, ShouldEqual, 10*time.Minute)
+			err = checkLag(status, time.Minute)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "c:27017 is 10m0s behind")
+			So(err.Error(), ShouldContainSubstring, "try dumping from b:27017")
+		})
+
+		Convey("with no fresh secondary, no other node should be suggested", func() {
+			status.Members[2].Self = true
+			err := checkLag(status, time.Second)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "no other secondary")
+		})
+
+		Convey("reading from the primary should be an error", func() {
+			status.Members[0].Self = true
+			err := checkLag(status, time.Minute)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "only applies when dumping from a secondary")
+		})
+
+		Convey("without a primary the lag cannot be measured", func() {
+			status.Members[1].Self = true
+			status.Members[0].State = memberStateSecondary
+			status.Members[0].StateStr = "SECONDARY"
+			So(checkLag(status, time.Minute), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestPinToMember(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Pinning a dump to a member should connect to it directly", t, func() {
+		toolOptions := &options.ToolOptions{
+			Connection:     &options.Connection{Host: "rs0/a:27017,b:27017", Port: "27017"},
+			Auth:           &options.Auth{},
+			SSL:            &options.SSL{},
+			HiddenOptions:  &options.HiddenOptions{},
+			ReplicaSetName: "rs0",
+		}
+		replaced, err := db.NewSessionProvider(*toolOptions)
+		So(err, ShouldBeNil)
+		dump := &MongoDump{ToolOptions: toolOptions, OutputOptions: &OutputOptions{},
+			sessionProvider: replaced}
+		So(dump.pinToMember("b:27017"), ShouldBeNil)
+		So(dump.sessionProvider, ShouldNotBeNil)
+		So(dump.sessionProvider, ShouldNotEqual, replaced)
+		// the tool's own options are left as they were
+		So(toolOptions.Connection.Host, ShouldEqual, "rs0/a:27017,b:27017")
+		So(toolOptions.ReplicaSetName, ShouldEqual, "rs0")
+		So(toolOptions.Direct, ShouldBeFalse)
+	})
+}
@@ -0,0 +1,42 @@
+package mongodump
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"sync/atomic"
+)
+
+// checkDocumentSize logs a warning, when using --warnLargeDocs, if the raw
+// document is larger than --largeDocThreshold. Documents that close to the
+// server's 16MB limit may fail to be inserted again on restore.
+func (dump *MongoDump) checkDocumentSize(namespace string, doc []byte) {
+	if !dump.OutputOptions.WarnLargeDocs ||
+		len(doc) <= dump.OutputOptions.LargeDocThreshold*1024*1024 {
+		return
+	}
+	atomic.AddInt64(&dump.largeDocCount, 1)
+	log.Logf(log.Always, "warning: document with _id %v in %v is %v bytes and may fail to restore",
+		documentID(doc), namespace, len(doc))
+}
+
+// documentID returns the _id of a raw document as extended JSON, for logging.
+func documentID(doc []byte) string {
+	idDoc := struct {
+		ID interface{} `bson:"_id"`
+	}{}
+	if err := bson.Unmarshal(doc, &idDoc); err != nil || idDoc.ID == nil {
+		return "(unknown)"
+	}
+	extended, err := bsonutil.ConvertBSONValueToJSON(idDoc.ID)
+	if err != nil {
+		return fmt.Sprintf("%v", idDoc.ID)
+	}
+	out, err := json.Marshal(extended)
+	if err != nil {
+		return fmt.Sprintf("%v", idDoc.ID)
+	}
+	return string(out)
+}
@@ -0,0 +1,44 @@
+package mongodump
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"testing"
+)
+
+func TestCheckDocumentSize(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a mongodump using --warnLargeDocs and a 1MB threshold", t, func() {
+		md := &MongoDump{
+			OutputOptions: &OutputOptions{WarnLargeDocs: true, LargeDocThreshold: 1},
+		}
+		small, err := bson.Marshal(bson.M{"_id": 1, "s": "x"})
+		So(err, ShouldBeNil)
+		large, err := bson.Marshal(bson.M{"_id": "big", "s": strings.Repeat("x", 1024*1024)})
+		So(err, ShouldBeNil)
+
+		Convey("only documents over the threshold should be counted", func() {
+			md.checkDocumentSize("db.c", small)
+			md.checkDocumentSize("db.c", large)
+			md.checkDocumentSize("db.c", large)
+			So(md.largeDocCount, ShouldEqual, 2)
+		})
+
+		Convey("nothing should be counted without --warnLargeDocs", func() {
+			md.OutputOptions.WarnLargeDocs = false
+			md.checkDocumentSize("db.c", large)
+			So(md.largeDocCount, ShouldEqual, 0)
+		})
+
+		Convey("the _id should be reported as extended JSON", func() {
+			So(documentID(large), ShouldEqual, `"big"`)
+			oid := bson.ObjectIdHex("56d9d8c6fbd1bc0bc9d56d5c")
+			doc, err := bson.Marshal(bson.M{"_id": oid})
+			So(err, ShouldBeNil)
+			So(documentID(doc), ShouldEqual, `{"$oid":"56d9d8c6fbd1bc0bc9d56d5c"}`)
+		})
+	})
+}
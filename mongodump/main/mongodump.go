@@ -64,6 +64,10 @@ func main() {
 	}
 
 	err = dump.Dump()
+	if err == mongodump.ErrDumpTruncated {
+		log.Logf(log.Always, "%v", err)
+		os.Exit(util.ExitTruncated)
+	}
 	if err != nil {
 		log.Logf(log.Always, "Failed: %v", err)
 		os.Exit(util.ExitError)
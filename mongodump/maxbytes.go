@@ -0,0 +1,74 @@
+package mongodump
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// ErrDumpTruncated is returned by Dump when --maxDumpBytes stopped it before
+// every collection was dumped.
+var ErrDumpTruncated = errors.New("dump truncated: stopped after reaching --maxDumpBytes")
+
+// truncatedManifestName is the file, in the root of the dump directory, that
+// lists what a dump stopped by --maxDumpBytes did and did not include.
+const truncatedManifestName = "truncated.json"
+
+// truncatedManifest is the content of the truncatedManifestName file.
+type truncatedManifest struct {
+	MaxDumpBytes int64    `json:"maxDumpBytes"`
+	BytesWritten int64    `json:"bytesWritten"`
+	Completed    []string `json:"completed"`
+	Skipped      []string `json:"skipped"`
+}
+
+// addDumpedBytes adds to the running total of BSON bytes written.
+func (dump *MongoDump) addDumpedBytes(n int) {
+	atomic.AddInt64(&dump.dumpedBytes, int64(n))
+}
+
+// byteCapReached returns true once the bytes written reach --maxDumpBytes.
+func (dump *MongoDump) byteCapReached() bool {
+	return dump.OutputOptions.MaxDumpBytes > 0 &&
+		atomic.LoadInt64(&dump.dumpedBytes) >= dump.OutputOptions.MaxDumpBytes
+}
+
+// finishTruncatedDump logs the collections left out because of
+// --maxDumpBytes and, unless dumping to stdout, records them along with the
+// completed collections in a manifest in the dump directory.
+func (dump *MongoDump) finishTruncatedDump(completed, skipped []string) error {
+	written := atomic.LoadInt64(&dump.dumpedBytes)
+	log.Logf(log.Always, "reached --maxDumpBytes after writing %v bytes; "+
+		"skipped %v collection(s)", written, len(skipped))
+	for _, namespace := range skipped {
+		log.Logf(log.Info, "\tskipped %v", namespace)
+	}
+	if dump.useStdout {
+		return nil
+	}
+
+	manifest := truncatedManifest{
+		MaxDumpBytes: dump.OutputOptions.MaxDumpBytes,
+		BytesWritten: written,
+		Completed:    completed,
+		Skipped:      skipped,
+	}
+	jsonBytes, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("error creating %v: %v", truncatedManifestName, err)
+	}
+	if err = os.MkdirAll(dump.OutputOptions.Out, defaultPermissions); err != nil {
+		return fmt.Errorf("error creating folder `%v` for dump: %v", dump.OutputOptions.Out, err)
+	}
+	manifestPath := filepath.Join(dump.OutputOptions.Out, truncatedManifestName)
+	if err = ioutil.WriteFile(manifestPath, jsonBytes, 0644); err != nil {
+		return fmt.Errorf("error writing %v: %v", manifestPath, err)
+	}
+	log.Logf(log.Always, "wrote list of dumped and skipped collections to %v", manifestPath)
+	return nil
+}
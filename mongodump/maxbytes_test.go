@@ -0,0 +1,83 @@
+package mongodump
+
+import (
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMaxDumpBytes(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a mongodump using --maxDumpBytes 100", t, func() {
+		out, err := ioutil.TempDir("", "mongodump-maxbytes-")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(out)
+		md := &MongoDump{
+			OutputOptions: &OutputOptions{Out: out, MaxDumpBytes: 100},
+		}
+
+		Convey("the cap should only be reached once 100 bytes are written", func() {
+			md.addDumpedBytes(60)
+			So(md.byteCapReached(), ShouldBeFalse)
+			md.addDumpedBytes(40)
+			So(md.byteCapReached(), ShouldBeTrue)
+		})
+
+		Convey("the cap should never be reached without --maxDumpBytes", func() {
+			md.OutputOptions.MaxDumpBytes = 0
+			md.addDumpedBytes(1000)
+			So(md.byteCapReached(), ShouldBeFalse)
+		})
+
+		Convey("a truncated dump should list its collections in the manifest", func() {
+			md.addDumpedBytes(150)
+			So(md.finishTruncatedDump([]string{"a.b"}, []string{"a.c", "d.e"}), ShouldBeNil)
+
+			jsonBytes, err := ioutil.ReadFile(filepath.Join(out, truncatedManifestName))
+			So(err, ShouldBeNil)
+			manifest := truncatedManifest{}
+			So(json.Unmarshal(jsonBytes, &manifest), ShouldBeNil)
+			So(manifest.MaxDumpBytes, ShouldEqual, 100)
+			So(manifest.BytesWritten, ShouldEqual, 150)
+			So(manifest.Completed, ShouldResemble, []string{"a.b"})
+			So(manifest.Skipped, ShouldResemble, []string{"a.c", "d.e"})
+		})
+	})
+}
+
+func TestTruncatedDump(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.IntegrationTestType)
+	log.SetWriter(ioutil.Discard)
+
+	Convey("With a mongodump of a database using --maxDumpBytes and --resume", t, func() {
+		So(setUpMongoDumpTestData(), ShouldBeNil)
+		out, err := ioutil.TempDir("", "mongodump-truncated-")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(out)
+
+		md := simpleMongoDumpInstance()
+		md.OutputOptions.Out = out
+		md.OutputOptions.MaxDumpBytes = 1
+		md.OutputOptions.Resume = true
+		md.ToolOptions.HiddenOptions.MaxProcs = 1
+		So(md.Init(), ShouldBeNil)
+
+		Convey("the dump should finish before reporting the truncation", func() {
+			So(md.Dump(), ShouldEqual, ErrDumpTruncated)
+			_, err := os.Stat(filepath.Join(out, truncatedManifestName))
+			So(err, ShouldBeNil)
+			_, err = os.Stat(filepath.Join(out, checkpointName))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Reset(func() {
+			So(tearDownMongoDumpTestData(), ShouldBeNil)
+		})
+	})
+}
@@ -8,47 +8,97 @@ import (
 	"github.com/mongodb/mongo-tools/common/intents"
 	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	"io"
 )
 
-// Metadata holds information about a collection's options and indexes.
+// Metadata holds information about a collection's options, indexes, and,
+// for sharded collections, its shard key and whether that key is unique
+// and balancing is disabled. When dumping a shard directly, it records the
+// shard's name and, for sharded collections, the ranges of the chunks the
+// shard owns, which are empty rather than missing if it owns none, so that
+// orphaned documents can be told apart. CreationOrder is the collection's
+// position among the collections of its database.
 type Metadata struct {
-	Options interface{}   `json:"options,omitempty"`
-	Indexes []interface{} `json:"indexes"`
+	Options       interface{}      `json:"options,omitempty"`
+	Indexes       []interface{}    `json:"indexes"`
+	ShardKey      interface{}      `json:"shardKey,omitempty"`
+	ShardUnique   bool             `json:"shardKeyUnique,omitempty"`
+	NoBalance     bool             `json:"noBalance,omitempty"`
+	Shard         string           `json:"shard,omitempty"`
+	OwnedChunks   *[]interface{}   `json:"ownedChunks,omitempty"`
+	IDIndex       interface{}      `json:"idIndex,omitempty"`
+	CreationOrder int              `json:"creationOrder,omitempty"`
+	DateFormat    string           `json:"dateFormat,omitempty"`
+	Stats         *CollectionStats `json:"stats,omitempty"`
 }
 
+// CollectionStats holds the size of a collection as reported by collStats.
+// It is only recorded by --dumpMetadataOnly, whose metadata files stand in
+// for the data, and is ignored by mongorestore.
+type CollectionStats struct {
+	Count          int64 `bson:"count" json:"count"`
+	Size           int64 `bson:"size" json:"size"`
+	StorageSize    int64 `bson:"storageSize" json:"storageSize"`
+	IndexCount     int64 `bson:"nindexes" json:"nindexes"`
+	TotalIndexSize int64 `bson:"totalIndexSize" json:"totalIndexSize"`
+}
+
+// Values of --metadataDateFormat.
+const (
+	metadataDatesExtJSON = "extjson"
+	metadataDatesRFC3339 = "rfc3339"
+)
+
 // IndexDocumentFromDB is used internally to preserve key ordering.
 type IndexDocumentFromDB struct {
 	Options bson.M `bson:",inline"`
 	Key     bson.D `bson:"key"`
 }
 
-// dumpMetadataToWriter gets the metadata for a collection and writes it
-// in readable JSON format.
-func (dump *MongoDump) dumpMetadataToWriter(intent *intents.Intent, writer io.Writer) error {
-	// make a buffered writer for nicer disk i/o
-	w := bufio.NewWriter(writer)
+// IndexMetadata holds a collection's index definitions when they are
+// written apart from the rest of its metadata, with --dumpIndexesSeparately.
+// It has the same layout as the indexes field of Metadata, and the same
+// dateFormat.
+type IndexMetadata struct {
+	Indexes    []interface{} `json:"indexes"`
+	DateFormat string        `json:"dateFormat,omitempty"`
+}
 
+// dumpMetadataToWriter gets the metadata for a collection and writes it
+// in readable JSON format. If indexWriter is not nil, the collection's
+// indexes are written to it instead of being included in the metadata.
+func (dump *MongoDump) dumpMetadataToWriter(intent *intents.Intent, writer, indexWriter io.Writer) error {
 	nsID := fmt.Sprintf("%v.%v", intent.DB, intent.C)
 	meta := Metadata{
 		// We have to initialize Indexes to an empty slice, not nil, so that an empty
 		// array is marshalled into json instead of null. That is, {indexes:[]} is okay
 		// but {indexes:null} will cause assertions in our legacy C++ mongotools
-		Indexes: []interface{}{},
+		Indexes:       []interface{}{},
+		CreationOrder: intent.CreationOrder,
+		DateFormat:    dump.metadataDateFormat(),
 	}
 
 	// The collection options were already gathered while building the list of intents.
 	// We convert them to JSON so that they can be written to the metadata json file as text.
 	var err error
 	if intent.Options != nil {
-		if meta.Options, err = bsonutil.ConvertBSONValueToJSON(*intent.Options); err != nil {
+		if meta.Options, err = bsonutil.ConvertBSONValueToJSON(dump.metadataDates(*intent.Options)); err != nil {
 			return fmt.Errorf("error converting collection options to JSON: %v", err)
 		}
 	} else {
 		meta.Options = nil
 	}
 
+	// MongoDB 3.4 and later report the _id index spec with the collection,
+	// so that it can be recreated with the same collation
+	if intent.IDIndex != nil {
+		if meta.IDIndex, err = bsonutil.ConvertBSONValueToJSON(dump.metadataDates(*intent.IDIndex)); err != nil {
+			return fmt.Errorf("error converting _id index to JSON: %v", err)
+		}
+	}
+
 	// Second, we read the collection's index information by either calling
 	// listIndexes (pre-2.7 systems) or querying system.indexes.
 	// We keep a running list of all the indexes
@@ -70,7 +120,13 @@ func (dump *MongoDump) dumpMetadataToWriter(intent *intents.Intent, writer io.Wr
 
 	indexOpts := &bson.D{}
 	for indexesIter.Next(indexOpts) {
-		convertedIndex, err := bsonutil.ConvertBSONValueToJSON(*indexOpts)
+		if dump.OutputOptions.CheckIndexes {
+			name, _ := bsonutil.FindValueByKey("name", indexOpts)
+			for _, problem := range db.CheckIndexSpec(*indexOpts) {
+				log.Logf(log.Always, "warning: index %v on %v: %v", name, nsID, problem)
+			}
+		}
+		convertedIndex, err := bsonutil.ConvertBSONValueToJSON(dump.metadataDates(*indexOpts))
 		if err != nil {
 			return fmt.Errorf("error converting index (%#v): %v", convertedIndex, err)
 		}
@@ -81,18 +137,151 @@ func (dump *MongoDump) dumpMetadataToWriter(intent *intents.Intent, writer io.Wr
 		return fmt.Errorf("error getting indexes for collection `%v`: %v", nsID, err)
 	}
 
+	// When dumping through a mongos, record the shard key so that mongorestore
+	// can optionally re-shard the collection on restore.
+	if dump.isMongos {
+		sharding, err := getShardingInfo(session, nsID)
+		if err != nil {
+			return fmt.Errorf("error getting shard key for collection `%v`: %v", nsID, err)
+		}
+		if sharding != nil {
+			if err = meta.setSharding(nsID, sharding); err != nil {
+				return err
+			}
+		}
+	}
+
+	// When dumping a shard directly, record the chunk ranges it owns, so
+	// that mongorestore --filterOrphans can leave out orphaned documents.
+	if dump.shardName != "" {
+		shardKey, chunks, err := getOwnedChunks(session, nsID, dump.shardName)
+		if err == errNoCachedChunks {
+			return fmt.Errorf("shard %v has no chunks of sharded collection `%v` in its cached "+
+				"routing table, so its owned documents cannot be told from orphans; the table "+
+				"may not be loaded yet, which querying the collection through mongos fixes",
+				dump.shardName, nsID)
+		}
+		if err != nil {
+			log.Logf(log.Always, "warning: cannot read the chunk ranges of `%v` owned by shard %v: %v",
+				nsID, dump.shardName, err)
+		} else {
+			meta.Shard = dump.shardName
+			if shardKey != nil {
+				if meta.ShardKey, err = bsonutil.ConvertBSONValueToJSON(shardKey); err != nil {
+					return fmt.Errorf("error converting shard key to JSON: %v", err)
+				}
+				ownedChunks, err := ownedChunksToJSON(chunks)
+				if err != nil {
+					return err
+				}
+				meta.OwnedChunks = &ownedChunks
+				log.Logf(log.DebugLow, "\tshard %v owns %v chunk(s) of %v", dump.shardName, len(chunks), nsID)
+			}
+		}
+	}
+
+	// views have no stats of their own
+	if dump.OutputOptions.DumpMetadataOnly && !isView(intent) {
+		stats := &CollectionStats{}
+		if err = session.DB(intent.DB).Run(bson.D{{"collStats", intent.C}}, stats); err != nil {
+			log.Logf(log.Always, "warning: cannot get stats of collection `%v`: %v", nsID, err)
+		} else {
+			meta.Stats = stats
+			log.Logf(log.Info, "\t%v documents, %v bytes, %v indexes",
+				stats.Count, stats.Size, stats.IndexCount)
+		}
+	}
+
 	// Finally, we send the results to the writer as JSON bytes
-	jsonBytes, err := json.Marshal(meta)
-	if err != nil {
-		return fmt.Errorf("error marshalling metadata json for collection `%v`: %v", nsID, err)
+	if indexWriter != nil {
+		indexes := IndexMetadata{Indexes: meta.Indexes, DateFormat: meta.DateFormat}
+		meta.Indexes = []interface{}{}
+		if err = writeJSON(indexWriter, indexes); err != nil {
+			return fmt.Errorf("error writing indexes for collection `%v` to disk: %v", nsID, err)
+		}
 	}
-	_, err = w.Write(jsonBytes)
-	if err != nil {
+	if err = writeJSON(writer, meta); err != nil {
 		return fmt.Errorf("error writing metadata for collection `%v` to disk: %v", nsID, err)
 	}
-	err = w.Flush()
+	return nil
+}
+
+// isView returns true if the intent's collection options define a view.
+func isView(intent *intents.Intent) bool {
+	if intent.Options == nil {
+		return false
+	}
+	_, err := bsonutil.FindValueByKey("viewOn", intent.Options)
+	return err == nil
+}
+
+// metadataDateFormat returns the dateFormat recorded in metadata files:
+// "rfc3339" with --metadataDateFormat rfc3339, or "" for extended JSON.
+func (dump *MongoDump) metadataDateFormat() string {
+	if dump.OutputOptions.MetadataDateFormat == metadataDatesRFC3339 {
+		return metadataDatesRFC3339
+	}
+	return ""
+}
+
+// metadataDates returns the collection options or index spec with its dates
+// written as --metadataDateFormat asks: as RFC 3339 strings, or left as
+// dates to be written as extended JSON $date values.
+func (dump *MongoDump) metadataDates(value interface{}) interface{} {
+	if dump.metadataDateFormat() == metadataDatesRFC3339 {
+		return bsonutil.DatesToRFC3339(value)
+	}
+	return value
+}
+
+// writeJSON marshals value to JSON and writes it through a buffered writer.
+func writeJSON(writer io.Writer, value interface{}) error {
+	jsonBytes, err := json.Marshal(value)
 	if err != nil {
-		return fmt.Errorf("error writing metadata for collection `%v` to disk: %v", nsID, err)
+		return fmt.Errorf("error marshalling json: %v", err)
+	}
+	// make a buffered writer for nicer disk i/o
+	w := bufio.NewWriter(writer)
+	if _, err = w.Write(jsonBytes); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// shardingInfo is the entry of a sharded collection in config.collections.
+type shardingInfo struct {
+	Key       bson.D `bson:"key"`
+	Unique    bool   `bson:"unique"`
+	NoBalance bool   `bson:"noBalance"`
+}
+
+// setSharding records the sharding settings of a collection dumped through
+// mongos, warning that its dump may include orphaned documents.
+func (meta *Metadata) setSharding(nsID string, sharding *shardingInfo) error {
+	shardKey, err := bsonutil.ConvertBSONValueToJSON(sharding.Key)
+	if err != nil {
+		return fmt.Errorf("error converting shard key to JSON: %v", err)
 	}
+	meta.ShardKey = shardKey
+	meta.ShardUnique = sharding.Unique
+	meta.NoBalance = sharding.NoBalance
+	log.Logf(log.Info, "\t%v is sharded on %v", nsID, sharding.Key)
+	log.Logf(log.Always, "warning: %v is sharded; its dump and document count may include "+
+		"orphaned documents left on shards by interrupted chunk migrations", nsID)
 	return nil
 }
+
+// getShardingInfo returns the sharding settings of the given namespace from
+// the config database, or nil if the collection is not sharded.
+func getShardingInfo(session *mgo.Session, nsID string) (*shardingInfo, error) {
+	collInfo := &shardingInfo{}
+	err := session.DB("config").C("collections").Find(
+		bson.M{"_id": nsID, "dropped": bson.M{"$ne": true}}).One(collInfo)
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return collInfo, nil
+}
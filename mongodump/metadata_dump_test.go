@@ -0,0 +1,70 @@
+package mongodump
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestSetSharding(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With the metadata of a collection dumped through mongos", t, func() {
+		var buff bytes.Buffer
+		log.SetWriter(&buff)
+		meta := &Metadata{}
+
+		Convey("a unique shard key with balancing disabled should be recorded", func() {
+			So(meta.setSharding("test.c", &shardingInfo{
+				Key: bson.D{{"a", 1}}, Unique: true, NoBalance: true}), ShouldBeNil)
+			jsonBytes, err := json.Marshal(meta)
+			So(err, ShouldBeNil)
+			So(string(jsonBytes), ShouldContainSubstring, `"shardKey":{"a":`)
+			So(string(jsonBytes), ShouldContainSubstring, `"shardKeyUnique":true`)
+			So(string(jsonBytes), ShouldContainSubstring, `"noBalance":true`)
+		})
+
+		Convey("the default settings should be left out", func() {
+			So(meta.setSharding("test.c", &shardingInfo{Key: bson.D{{"a", "hashed"}}}), ShouldBeNil)
+			jsonBytes, err := json.Marshal(meta)
+			So(err, ShouldBeNil)
+			So(string(jsonBytes), ShouldNotContainSubstring, "shardKeyUnique")
+			So(string(jsonBytes), ShouldNotContainSubstring, "noBalance")
+		})
+
+		Convey("a warning about orphaned documents should be logged", func() {
+			So(meta.setSharding("test.c", &shardingInfo{Key: bson.D{{"a", 1}}}), ShouldBeNil)
+			So(buff.String(), ShouldContainSubstring, "warning: test.c is sharded")
+			So(buff.String(), ShouldContainSubstring, "orphaned documents")
+		})
+	})
+}
+
+func TestOwnedChunksMetadata(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With the metadata of a collection dumped from a shard", t, func() {
+		meta := &Metadata{Shard: "rs1", ShardKey: bson.M{"a": 1}}
+
+		Convey("owning no chunks should be recorded as an empty list", func() {
+			ownedChunks, err := ownedChunksToJSON(nil)
+			So(err, ShouldBeNil)
+			meta.OwnedChunks = &ownedChunks
+			jsonBytes, err := json.Marshal(meta)
+			So(err, ShouldBeNil)
+			So(string(jsonBytes), ShouldContainSubstring, `"ownedChunks":[]`)
+		})
+
+		Convey("unknown chunks should be left out", func() {
+			jsonBytes, err := json.Marshal(meta)
+			So(err, ShouldBeNil)
+			So(string(jsonBytes), ShouldNotContainSubstring, "ownedChunks")
+		})
+	})
+}
@@ -3,6 +3,7 @@ package mongodump
 
 import (
 	"bufio"
+	"compress/gzip"
 	"fmt"
 	"github.com/mongodb/mongo-tools/common/auth"
 	"github.com/mongodb/mongo-tools/common/bsonutil"
@@ -10,14 +11,18 @@ import (
 	"github.com/mongodb/mongo-tools/common/intents"
 	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/metrics"
+	"github.com/mongodb/mongo-tools/common/notify"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/progress"
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 )
 
@@ -41,11 +46,50 @@ type MongoDump struct {
 	manager         *intents.Manager
 	useStdout       bool
 	query           bson.M
+	pipeline        []interface{}
+	windowField     string
 	oplogCollection string
 	oplogStart      bson.MongoTimestamp
 	isMongos        bool
+	shardName       string
 	authVersion     int
 	progressManager *progress.Manager
+	metrics         *metrics.TransferMetrics
+
+	// databases left out of a full dump by --skipInaccessible
+	skippedDatabases []string
+
+	// number of collections assigned an output directory, used to
+	// take turns between --out and --extraOut
+	outputDirCount int
+
+	// number of documents found over --largeDocThreshold, updated atomically
+	largeDocCount int64
+
+	// BSON bytes written so far, checked against --maxDumpBytes and
+	// updated atomically
+	dumpedBytes int64
+
+	// namespaces dumped in full, written to the checkpoint file for --resume
+	checkpoint     []string
+	checkpointLock sync.Mutex
+
+	// time left for retrying reads across the whole dump, from
+	// --maxRetryTime; nil when reads are not retried
+	retryBudget *util.RetryBudget
+
+	// when Init was called, for the --onComplete summary
+	start time.Time
+}
+
+// notifyComplete sends the --onComplete summary of the dump, which ended
+// with the error err, if any.
+func (dump *MongoDump) notifyComplete(err error) {
+	if dump.OutputOptions.OnComplete == "" {
+		return
+	}
+	notify.Complete(dump.OutputOptions.OnComplete,
+		notify.NewSummary("mongodump", dump.start, err, dump.metrics.Totals()))
 }
 
 // ValidateOptions checks for any incompatible sets of options.
@@ -56,7 +100,8 @@ func (dump *MongoDump) ValidateOptions() error {
 	case dump.ToolOptions.Namespace.DB == "" && dump.ToolOptions.Namespace.Collection != "":
 		return fmt.Errorf("cannot dump a collection without a specified database")
 	case dump.InputOptions.Query != "" && dump.ToolOptions.Namespace.Collection == "":
-		return fmt.Errorf("cannot dump using a query without a specified collection")
+		return fmt.Errorf("cannot dump using a query without a specified collection, " +
+			"since one filter does not fit the different collections of a database")
 	case dump.OutputOptions.DumpDBUsersAndRoles && dump.ToolOptions.Namespace.DB == "":
 		return fmt.Errorf("must specify a database when running with dumpDbUsersAndRoles")
 	case dump.OutputOptions.DumpDBUsersAndRoles && dump.ToolOptions.Namespace.Collection != "":
@@ -73,25 +118,143 @@ func (dump *MongoDump) ValidateOptions() error {
 		return fmt.Errorf("--db is required when --excludeCollectionsWithPrefix is specified")
 	case dump.OutputOptions.Repair && dump.InputOptions.Query != "":
 		return fmt.Errorf("cannot run a query with --repair enabled")
+	case dump.OutputOptions.SkipInaccessible && dump.ToolOptions.Namespace.DB != "":
+		return fmt.Errorf("--skipInaccessible is only supported on full dumps")
+	case dump.OutputOptions.PipeCmd != "" && dump.OutputOptions.Out != "-":
+		return fmt.Errorf("--pipeCmd can only be used when dumping to stdout with --out -")
+	case dump.OutputOptions.Gzip && dump.OutputOptions.Out == "-":
+		return fmt.Errorf("cannot use --gzip when dumping to stdout; compress the output with --pipeCmd instead")
+	case dump.OutputOptions.Gzip && (dump.OutputOptions.DumpMetadataOnly || dump.OutputOptions.OplogOnly):
+		return fmt.Errorf("cannot use --gzip with --dumpMetadataOnly or --oplogOnly, which write no collection data")
+	case len(dump.OutputOptions.ExtraOut) > 0 && dump.OutputOptions.Out == "-":
+		return fmt.Errorf("cannot use --extraOut when dumping to stdout")
+	case dump.OutputOptions.WarnLargeDocs && dump.OutputOptions.LargeDocThreshold <= 0:
+		return fmt.Errorf("--largeDocThreshold must be a positive number of megabytes")
+	case dump.OutputOptions.MaxDumpBytes < 0:
+		return fmt.Errorf("--maxDumpBytes must be a positive number of bytes")
+	case dump.OutputOptions.MaxDumpBytes > 0 && dump.OutputOptions.Oplog:
+		return fmt.Errorf("cannot use --maxDumpBytes with --oplog, since a truncated dump " +
+			"cannot be a point-in-time snapshot")
+	case dump.OutputOptions.DumpMetadataOnly && (dump.OutputOptions.Oplog || dump.OutputOptions.OplogOnly ||
+		dump.OutputOptions.Repair || dump.OutputOptions.MaxDumpBytes > 0 || dump.OutputOptions.WarnLargeDocs):
+		return fmt.Errorf("cannot use --dumpMetadataOnly with --oplog, --oplogOnly, --repair, " +
+			"--maxDumpBytes or --warnLargeDocs")
+	case dump.OutputOptions.DumpMetadataOnly && (dump.InputOptions.Query != "" || dump.InputOptions.DumpWindow != "" ||
+		dump.InputOptions.SampleRate > 0 || dump.InputOptions.Aggregate != "" || dump.InputOptions.ReadBatchSize > 0):
+		return fmt.Errorf("cannot use --dumpMetadataOnly with --query, --dumpWindow, --sampleRate, " +
+			"--aggregate or --readBatchSize, which only affect documents")
+	case dump.OutputOptions.DumpMetadataOnly && dump.OutputOptions.Out == "-":
+		return fmt.Errorf("cannot use --dumpMetadataOnly when dumping to stdout")
+	case dump.OutputOptions.OplogOnly && dump.OutputOptions.OplogSince == "":
+		return fmt.Errorf("--oplogOnly requires --since, the timestamp the increment starts after")
+	case dump.OutputOptions.OplogSince != "" && !dump.OutputOptions.OplogOnly:
+		return fmt.Errorf("--since can only be used with --oplogOnly")
+	case dump.OutputOptions.OplogOnly && (dump.OutputOptions.Oplog || dump.OutputOptions.Repair ||
+		dump.OutputOptions.Resume || dump.OutputOptions.MaxDumpBytes > 0 || dump.OutputOptions.DryRun):
+		return fmt.Errorf("cannot use --oplogOnly with --oplog, --repair, --resume, --maxDumpBytes or --dryRun")
+	case dump.OutputOptions.OplogOnly && (dump.ToolOptions.Namespace.DB != "" ||
+		dump.InputOptions.Query != "" || dump.InputOptions.Aggregate != ""):
+		return fmt.Errorf("cannot use --oplogOnly with a database, collection, --query or --aggregate, " +
+			"since it dumps no collection data")
+	case dump.OutputOptions.OplogOnly && dump.OutputOptions.Out == "-":
+		return fmt.Errorf("cannot use --oplogOnly when dumping to stdout")
+	case dump.OutputOptions.MaxConnections < 0:
+		return fmt.Errorf("--maxConnections must be a positive number")
+	case dump.InputOptions.MaxLagSeconds < 0:
+		return fmt.Errorf("--maxLagSeconds must be a positive number of seconds")
+	case dump.InputOptions.MaxLagSeconds > 0 && dump.OutputOptions.Repair:
+		return fmt.Errorf("cannot use --maxLagSeconds with --repair enabled")
+	case dump.InputOptions.MaxRetryTime < 0:
+		return fmt.Errorf("--maxRetryTime must not be negative")
+	case dump.InputOptions.MaxRetryTime > 0 && dump.OutputOptions.Out == "-":
+		return fmt.Errorf("cannot use --maxRetryTime when dumping to stdout, " +
+			"since documents already written cannot be taken back to read them again")
+	case dump.InputOptions.ReadBatchSize < 0:
+		return fmt.Errorf("--readBatchSize must be a positive number of documents")
+	case dump.InputOptions.SampleRate < 0 || dump.InputOptions.SampleRate > 1:
+		return fmt.Errorf("--sampleRate must be between 0 and 1")
+	case dump.OutputOptions.Repair && dump.InputOptions.DumpWindow != "":
+		return fmt.Errorf("cannot use --dumpWindow with --repair enabled")
+	case dump.OutputOptions.Repair && dump.InputOptions.SampleRate > 0:
+		return fmt.Errorf("cannot use --sampleRate with --repair enabled")
+	case dump.InputOptions.Aggregate != "" && dump.ToolOptions.Namespace.Collection == "":
+		return fmt.Errorf("cannot dump using --aggregate without a specified collection")
+	case dump.InputOptions.Aggregate != "" && (dump.InputOptions.Query != "" ||
+		dump.InputOptions.DumpWindow != "" || dump.InputOptions.SampleRate > 0):
+		return fmt.Errorf("cannot use --aggregate with --query, --dumpWindow or --sampleRate; " +
+			"add $match or $sample stages to the pipeline instead")
+	case dump.InputOptions.Aggregate != "" && (dump.OutputOptions.Repair || dump.InputOptions.TableScan):
+		return fmt.Errorf("cannot use --aggregate with --repair or --forceTableScan")
+	case dump.OutputOptions.MetadataDateFormat != "" &&
+		dump.OutputOptions.MetadataDateFormat != metadataDatesExtJSON &&
+		dump.OutputOptions.MetadataDateFormat != metadataDatesRFC3339:
+		return fmt.Errorf("--metadataDateFormat must be either '%v' or '%v'",
+			metadataDatesExtJSON, metadataDatesRFC3339)
+	case dump.OutputOptions.Resume && dump.OutputOptions.Out == "-":
+		return fmt.Errorf("cannot use --resume when dumping to stdout")
+	case dump.OutputOptions.Resume && dump.OutputOptions.Oplog:
+		return fmt.Errorf("cannot use --resume with --oplog, since collections dumped " +
+			"before the interruption are not covered by the captured oplog")
+	case dump.OutputOptions.Resume && len(dump.OutputOptions.ExtraOut) > 0:
+		return fmt.Errorf("cannot use --resume with --extraOut")
+	case dump.OutputOptions.Resume && isOutTemplate(dump.OutputOptions.Out):
+		return fmt.Errorf("cannot use --resume with a templated --out, which names a new directory each run")
 	}
 	return nil
 }
 
+// parseQuery parses a --query filter, converting its extended JSON values.
+func parseQuery(query string) (bson.M, error) {
+	var asJSON interface{}
+	err := json.Unmarshal([]byte(query), &asJSON)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing query as json: %v", err)
+	}
+	convertedJSON, err := bsonutil.ConvertJSONValueToBSON(asJSON)
+	if err != nil {
+		return nil, fmt.Errorf("error converting query to bson: %v", err)
+	}
+	asMap, ok := convertedJSON.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("query is not a JSON object")
+	}
+	return bson.M(asMap), nil
+}
+
 // Init performs preliminary setup operations for MongoDump.
-func (dump *MongoDump) Init() error {
-	err := dump.ValidateOptions()
+func (dump *MongoDump) Init() (err error) {
+	dump.start = time.Now()
+	defer func() {
+		// Dump reports on runs that get that far
+		if err != nil {
+			dump.notifyComplete(err)
+		}
+	}()
+
+	err = dump.ValidateOptions()
 	if err != nil {
 		return fmt.Errorf("bad option: %v", err)
 	}
+	if dump.InputOptions.Query != "" {
+		// parsed before connecting, so that a bad filter fails fast
+		dump.query, err = parseQuery(dump.InputOptions.Query)
+		if err != nil {
+			return fmt.Errorf("bad option: --query: %v", err)
+		}
+	}
 	if dump.OutputOptions.Out == "-" {
 		dump.useStdout = true
 	}
+	if dump.InputOptions.MaxRetryTime > 0 {
+		dump.retryBudget = util.NewRetryBudget(dump.InputOptions.MaxRetryTime)
+	}
 	dump.sessionProvider, err = db.NewSessionProvider(*dump.ToolOptions)
 	if err != nil {
 		return fmt.Errorf("can't create session: %v", err)
 	}
 	// ensure we allow secondary reads
 	dump.sessionProvider.SetFlags(db.Monotonic)
+	dump.sessionProvider.SetMaxConnections(dump.OutputOptions.MaxConnections)
 	dump.isMongos, err = dump.sessionProvider.IsMongos()
 	if err != nil {
 		return err
@@ -100,31 +263,79 @@ func (dump *MongoDump) Init() error {
 	if dump.OutputOptions.Repair && dump.isMongos {
 		return fmt.Errorf("--repair flag cannot be used on a mongos")
 	}
+	if dump.OutputOptions.OplogOnly && dump.isMongos {
+		return fmt.Errorf("--oplogOnly cannot be used on a mongos; dump each shard's replica set instead")
+	}
+	if dump.InputOptions.MaxLagSeconds > 0 {
+		if dump.isMongos {
+			return fmt.Errorf("--maxLagSeconds cannot be used on a mongos, which chooses " +
+				"the shard members to read from itself")
+		}
+		if err = dump.checkReplicationLag(); err != nil {
+			return err
+		}
+	}
+	if !dump.useStdout && isOutTemplate(dump.OutputOptions.Out) {
+		values, err := dump.outTemplateValues(time.Now())
+		if err != nil {
+			return err
+		}
+		out, err := expandOutTemplate(dump.OutputOptions.Out, values)
+		if err != nil {
+			return fmt.Errorf("bad option: --out: %v", err)
+		}
+		log.Logf(log.Always, "writing dump to %v", out)
+		dump.OutputOptions.Out = out
+		for i, extraOut := range dump.OutputOptions.ExtraOut {
+			dump.OutputOptions.ExtraOut[i], err = expandOutTemplate(extraOut, values)
+			if err != nil {
+				return fmt.Errorf("bad option: --extraOut: %v", err)
+			}
+		}
+	}
+	if err = checkOutputDirs(dump.OutputOptions.Out, dump.OutputOptions.ExtraOut); err != nil {
+		return fmt.Errorf("bad option: %v", err)
+	}
+	if dump.InputOptions.ReadBatchSize > 0 {
+		log.Logf(log.Info, "reading documents in batches of %v", dump.InputOptions.ReadBatchSize)
+	} else {
+		log.Logf(log.DebugLow, "reading documents in batches of the server's default size")
+	}
 	dump.manager = intents.NewIntentManager()
 	dump.progressManager = progress.NewProgressBarManager(log.Writer(0), progressBarWaitTime)
 	return nil
 }
 
 // Dump handles some final options checking and executes MongoDump.
-func (dump *MongoDump) Dump() error {
-	var err error
-	if dump.InputOptions.Query != "" {
-		// parse JSON then convert extended JSON values
-		var asJSON interface{}
-		err = json.Unmarshal([]byte(dump.InputOptions.Query), &asJSON)
+func (dump *MongoDump) Dump() (err error) {
+	defer func() { dump.notifyComplete(err) }()
+
+	if dump.OutputOptions.TestConnection {
+		return dump.TestConnection(os.Stdout)
+	}
+
+	if dump.OutputOptions.OplogOnly {
+		return dump.dumpOplogOnly()
+	}
+
+	if dump.InputOptions.Aggregate != "" {
+		dump.pipeline, err = parseAggregatePipeline(dump.InputOptions.Aggregate)
 		if err != nil {
-			return fmt.Errorf("error parsing query as json: %v", err)
+			return err
 		}
-		convertedJSON, err := bsonutil.ConvertJSONValueToBSON(asJSON)
+	}
+
+	if dump.InputOptions.DumpWindow != "" {
+		var windowFilter bson.M
+		dump.windowField, windowFilter, err = parseDumpWindow(dump.InputOptions.DumpWindow)
 		if err != nil {
-			return fmt.Errorf("error converting query to bson: %v", err)
+			return err
 		}
-		asMap, ok := convertedJSON.(map[string]interface{})
-		if !ok {
-			// unlikely to be reached
-			return fmt.Errorf("query is not in proper format")
+		if len(dump.query) > 0 {
+			dump.query = bson.M{"$and": []bson.M{dump.query, windowFilter}}
+		} else {
+			dump.query = windowFilter
 		}
-		dump.query = bson.M(asMap)
 	}
 
 	if dump.OutputOptions.DumpDBUsersAndRoles {
@@ -140,6 +351,14 @@ func (dump *MongoDump) Dump() error {
 		}
 	}
 
+	if !dump.isMongos {
+		dump.shardName = dump.getShardName()
+		if dump.shardName != "" {
+			log.Logf(log.Always, "dumping directly from shard %v; its documents may include orphans, "+
+				"which mongorestore --filterOrphans can leave out", dump.shardName)
+		}
+	}
+
 	// switch on what kind of execution to do
 	switch {
 	case dump.ToolOptions.DB == "" && dump.ToolOptions.Collection == "":
@@ -153,6 +372,14 @@ func (dump *MongoDump) Dump() error {
 		return err
 	}
 
+	if dump.OutputOptions.Resume {
+		completed, err := dump.readCheckpoint()
+		if err != nil {
+			return err
+		}
+		dump.pruneCompletedIntents(completed)
+	}
+
 	// verify we can use repair cursors
 	if dump.OutputOptions.Repair {
 		log.Log(log.DebugLow, "verifying that the connected server supports repairCursor")
@@ -169,6 +396,13 @@ func (dump *MongoDump) Dump() error {
 		}
 	}
 
+	if dump.OutputOptions.DryRun {
+		if err = dump.printDryRun(os.Stdout); err != nil {
+			return err
+		}
+		return dump.skippedDatabasesError()
+	}
+
 	// If oplog capturing is enabled, we first check the most recent
 	// oplog entry and save its timestamp, this will let us later
 	// copy all oplog entries that occurred while dumping, creating
@@ -185,12 +419,29 @@ func (dump *MongoDump) Dump() error {
 		}
 	}
 
+	// the metrics also provide the totals of the --onComplete summary
+	if dump.OutputOptions.MetricsAddr != "" || dump.OutputOptions.OnComplete != "" {
+		registry := metrics.NewRegistry()
+		dump.metrics = metrics.NewTransferMetrics(registry, "mongodump", "dumped")
+		if dump.OutputOptions.MetricsAddr != "" {
+			server, err := metrics.Serve(dump.OutputOptions.MetricsAddr, registry)
+			if err != nil {
+				return err
+			}
+			defer server.Close()
+		}
+	}
+
 	// kick off the progress bar manager and begin dumping intents
 	dump.progressManager.Start()
 	defer dump.progressManager.Stop()
 
-	// dump all queued collections
-	if err := dump.DumpIntents(); err != nil {
+	// dump all queued collections; a dump truncated by --maxDumpBytes still
+	// finishes the steps below before reporting it
+	truncated := false
+	if err := dump.DumpIntents(); err == ErrDumpTruncated {
+		truncated = true
+	} else if err != nil {
 		return err
 	}
 
@@ -235,6 +486,9 @@ func (dump *MongoDump) Dump() error {
 			return fmt.Errorf("unable to check oplog for overflow: %v", err)
 		}
 		log.Logf(log.DebugHigh, "oplog entry %v still exists", dump.oplogStart)
+		if err = dump.writeOplogMetadata(db.OplogMetadata{}); err != nil {
+			return err
+		}
 	}
 
 	if dump.OutputOptions.DumpDBUsersAndRoles {
@@ -249,9 +503,21 @@ func (dump *MongoDump) Dump() error {
 		}
 	}
 
+	if dump.largeDocCount > 0 {
+		log.Logf(log.Always, "warning: dumped %v document(s) larger than %vMB that may fail to restore",
+			dump.largeDocCount, dump.OutputOptions.LargeDocThreshold)
+	}
+
+	if err = dump.removeCheckpoint(); err != nil {
+		return err
+	}
+
 	log.Logf(log.Info, "done")
 
-	return err
+	if truncated {
+		return ErrDumpTruncated
+	}
+	return dump.skippedDatabasesError()
 }
 
 // DumpIntents iterates through the previously-created intents and
@@ -272,6 +538,10 @@ func (dump *MongoDump) DumpIntents() error {
 
 	log.Logf(log.Info, "dumping with %v job threads", jobs)
 
+	// namespaces dumped in full, recorded when using --maxDumpBytes
+	var completed []string
+	var completedLock sync.Mutex
+
 	// start a goroutine for each job thread
 	for i := 0; i < jobs; i++ {
 		go func(id int) {
@@ -283,12 +553,31 @@ func (dump *MongoDump) DumpIntents() error {
 					resultChan <- nil
 					return
 				}
+				release := dump.sessionProvider.AcquireConnection()
+				dump.metrics.WorkerStarted()
 				err := dump.DumpIntent(intent)
+				dump.metrics.WorkerDone()
+				release()
+				dump.manager.Finish(intent)
 				if err != nil {
+					dump.metrics.AddError(intent.Namespace())
+					resultChan <- CollectionDumpError{intent.Namespace(), err}
+					return
+				}
+				if err = dump.recordCompleted(intent.Namespace()); err != nil {
 					resultChan <- err
 					return
 				}
-				dump.manager.Finish(intent)
+				if dump.OutputOptions.MaxDumpBytes > 0 {
+					completedLock.Lock()
+					completed = append(completed, intent.Namespace())
+					completedLock.Unlock()
+					if dump.byteCapReached() {
+						log.Logf(log.DebugHigh, "ending dump routine with id=%v, --maxDumpBytes reached", id)
+						resultChan <- nil
+						return
+					}
+				}
 			}
 		}(i)
 	}
@@ -300,6 +589,18 @@ func (dump *MongoDump) DumpIntents() error {
 		}
 	}
 
+	// anything left was not started because of --maxDumpBytes
+	skipped := []string{}
+	for intent := dump.manager.Pop(); intent != nil; intent = dump.manager.Pop() {
+		skipped = append(skipped, intent.Namespace())
+	}
+	if len(skipped) > 0 {
+		if err := dump.finishTruncatedDump(completed, skipped); err != nil {
+			return err
+		}
+		return ErrDumpTruncated
+	}
+
 	return nil
 }
 
@@ -316,6 +617,12 @@ func (dump *MongoDump) DumpIntent(intent *intents.Intent) error {
 	// duplicates the behavior of an exhaust cursor.
 	session.SetPrefetch(1.0)
 
+	if dump.windowField != "" {
+		if err = dump.checkDumpWindowField(session, intent); err != nil {
+			return err
+		}
+	}
+
 	var findQuery *mgo.Query
 	switch {
 	case len(dump.query) > 0:
@@ -327,38 +634,72 @@ func (dump *MongoDump) DumpIntent(intent *intents.Intent) error {
 		findQuery = session.DB(intent.DB).C(intent.C).Find(nil).Snapshot()
 
 	}
+	if dump.InputOptions.ReadBatchSize > 0 {
+		findQuery.Batch(dump.InputOptions.ReadBatchSize)
+	}
 
+	if dump.useStdout && dump.OutputOptions.PipeCmd != "" {
+		log.Logf(log.Always, "writing %v to stdout through '%v'", intent.Namespace(), dump.OutputOptions.PipeCmd)
+		pipe, err := util.NewPipeCmdWriter(dump.OutputOptions.PipeCmd, os.Stdout)
+		if err != nil {
+			return fmt.Errorf("error starting --pipeCmd: %v", err)
+		}
+		err = dump.dumpDataToWriter(session, findQuery, intent, pipe)
+		// always wait for the command, but report the first error
+		if closeErr := pipe.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
 	if dump.useStdout {
 		log.Logf(log.Always, "writing %v to stdout", intent.Namespace())
-		return dump.dumpQueryToWriter(findQuery, intent, os.Stdout)
+		return dump.dumpDataToWriter(session, findQuery, intent, os.Stdout)
 	}
 
-	dbFolder := filepath.Join(dump.OutputOptions.Out, intent.DB)
+	// the intent's path picks the output directory when using --extraOut
+	dbFolder := filepath.Dir(intent.BSONPath)
 	if err = os.MkdirAll(dbFolder, defaultPermissions); err != nil {
 		return fmt.Errorf("error creating folder `%v` for dump: %v", dbFolder, err)
 	}
-	outFilepath := filepath.Join(dbFolder, fmt.Sprintf("%v.bson", intent.C))
-	out, err := os.Create(outFilepath)
-	if err != nil {
-		return fmt.Errorf("error creating bson file `%v`: %v", outFilepath, err)
-	}
-	defer out.Close()
-
-	if !dump.OutputOptions.Repair {
-		log.Logf(log.Always, "writing %v to %v", intent.Namespace(), outFilepath)
-		if err = dump.dumpQueryToWriter(findQuery, intent, out); err != nil {
-			return err
-		}
+	// the file is named <collection>.bson, or <collection>.bson.gz with --gzip
+	outFilepath := intent.BSONPath
+	if dump.OutputOptions.DumpMetadataOnly {
+		log.Logf(log.DebugLow, "skipping documents of %v because of --dumpMetadataOnly", intent.Namespace())
 	} else {
-		// handle repairs as a special case, since we cannot count them
-		log.Logf(log.Always, "writing repair of %v to %v", intent.Namespace(), outFilepath)
-		repairIter := session.DB(intent.DB).C(intent.C).Repair()
-		repairCounter := progress.NewCounter(1) // this counter is ignored
-		if err := dump.dumpIterToWriter(repairIter, out, repairCounter); err != nil {
-			return fmt.Errorf("repair error: %v", err)
+		file, err := os.Create(outFilepath)
+		if err != nil {
+			return fmt.Errorf("error creating bson file `%v`: %v", outFilepath, err)
+		}
+		defer file.Close()
+
+		if !dump.OutputOptions.Repair {
+			log.Logf(log.Always, "writing %v to %v", intent.Namespace(), outFilepath)
+			if err = dump.dumpDataToFile(session, findQuery, intent, file); err != nil {
+				return err
+			}
+		} else {
+			// handle repairs as a special case, since we cannot count them
+			log.Logf(log.Always, "writing repair of %v to %v", intent.Namespace(), outFilepath)
+			repairIter := session.DB(intent.DB).C(intent.C).Repair()
+			repairCounter := progress.NewCounter(1) // this counter is ignored
+			var out io.Writer = file
+			var gzipOut *gzip.Writer
+			if dump.OutputOptions.Gzip {
+				gzipOut = gzip.NewWriter(file)
+				out = gzipOut
+			}
+			if err := dump.dumpIterToWriter(repairIter, intent.Namespace(), out, repairCounter); err != nil {
+				return fmt.Errorf("repair error: %v", err)
+			}
+			log.Logf(log.Always,
+				"\trepair cursor found %v documents in %v", repairCounter, intent.Namespace())
+			if gzipOut != nil {
+				// flushes the compressed data and writes the gzip footer
+				if err = gzipOut.Close(); err != nil {
+					return fmt.Errorf("error compressing bson file `%v`: %v", outFilepath, err)
+				}
+			}
 		}
-		log.Logf(log.Always,
-			"\trepair cursor found %v documents in %v", repairCounter, intent.Namespace())
 	}
 
 	// don't dump metatdata for SystemIndexes collection
@@ -373,8 +714,20 @@ func (dump *MongoDump) DumpIntent(intent *intents.Intent) error {
 	}
 	defer metaOut.Close()
 
+	var indexOut io.Writer
+	if dump.OutputOptions.DumpIndexesSeparately {
+		indexFilepath := filepath.Join(dbFolder, fmt.Sprintf("%v.indexes.json", intent.C))
+		indexFile, err := os.Create(indexFilepath)
+		if err != nil {
+			return fmt.Errorf("error creating indexes.json file `%v`: %v", indexFilepath, err)
+		}
+		defer indexFile.Close()
+		log.Logf(log.Always, "writing %v indexes to %v", intent.Namespace(), indexFilepath)
+		indexOut = indexFile
+	}
+
 	log.Logf(log.Always, "writing %v metadata to %v", intent.Namespace(), metadataFilepath)
-	if err = dump.dumpMetadataToWriter(intent, metaOut); err != nil {
+	if err = dump.dumpMetadataToWriter(intent, metaOut, indexOut); err != nil {
 		return err
 	}
 
@@ -382,6 +735,73 @@ func (dump *MongoDump) DumpIntent(intent *intents.Intent) error {
 	return nil
 }
 
+// dumpDataToWriter writes an intent's documents to the writer, either by running
+// findQuery or, with --sampleRate, by sampling the collection, or, with
+// --aggregate, by running the pipeline.
+func (dump *MongoDump) dumpDataToWriter(session *mgo.Session,
+	findQuery *mgo.Query, intent *intents.Intent, writer io.Writer) error {
+	if dump.pipeline != nil {
+		return dump.dumpAggregateToWriter(session, intent, writer)
+	}
+	if dump.InputOptions.SampleRate > 0 {
+		return dump.dumpSampleToWriter(session, intent, writer)
+	}
+	return dump.dumpQueryToWriter(findQuery, intent, writer)
+}
+
+// dumpSampleToWriter writes a random sample of an intent's documents, sized by
+// --sampleRate, to the writer.
+func (dump *MongoDump) dumpSampleToWriter(
+	session *mgo.Session, intent *intents.Intent, writer io.Writer) error {
+	collection := session.DB(intent.DB).C(intent.C)
+	// NewIntent sized the intent as the sample from the collection's count
+	size := int(intent.Size)
+	log.Logf(log.Info, "\tsampling about %v documents at rate %v", size, dump.InputOptions.SampleRate)
+
+	buildInfo, err := session.BuildInfo()
+	if err != nil {
+		return fmt.Errorf("error getting server version: %v", err)
+	}
+	var iter *mgo.Iter
+	if buildInfo.VersionAtLeast(3, 2) {
+		pipeline := []bson.M{}
+		if len(dump.query) > 0 {
+			pipeline = append(pipeline, bson.M{"$match": dump.query})
+		}
+		pipeline = append(pipeline, bson.M{"$sample": bson.M{"size": size}})
+		iter = collection.Pipe(pipeline).AllowDiskUse().Iter()
+	} else {
+		// $sample is not available before 3.2, so we filter each document
+		// randomly instead; the sample size is then only approximate
+		filter := bson.M{"$where": fmt.Sprintf("Math.random() < %v", dump.InputOptions.SampleRate)}
+		if len(dump.query) > 0 {
+			filter = bson.M{"$and": []bson.M{dump.query, filter}}
+		}
+		query := collection.Find(filter)
+		if dump.InputOptions.ReadBatchSize > 0 {
+			query.Batch(dump.InputOptions.ReadBatchSize)
+		}
+		iter = query.Iter()
+	}
+
+	dumpProgressor := progress.NewCounter(int64(size))
+	bar := &progress.Bar{
+		Name:      intent.Namespace(),
+		Watching:  dumpProgressor,
+		BarLength: progressBarLength,
+	}
+	dump.progressManager.Attach(bar)
+	defer dump.progressManager.Detach(bar)
+
+	return dump.dumpIterToWriter(iter, intent.Namespace(), writer, dumpProgressor)
+}
+
+// sampleSize returns the number of documents to sample from count documents
+// at the given rate.
+func sampleSize(count int, rate float64) int {
+	return int(math.Ceil(float64(count) * rate))
+}
+
 // dumpQueryToWriter takes an mgo Query, its intent, and a writer, performs the query,
 // and writes the raw bson results to the writer.
 func (dump *MongoDump) dumpQueryToWriter(
@@ -389,9 +809,10 @@ func (dump *MongoDump) dumpQueryToWriter(
 
 	total, err := query.Count()
 	if err != nil {
-		return fmt.Errorf("error reading from db: %v", err)
+		return readError{"error reading from db", err}
 	}
 	log.Logf(log.Info, "\t%v documents", total)
+	dump.metrics.ExpectDocuments(intent.Namespace(), int64(total))
 
 	dumpProgressor := progress.NewCounter(int64(total))
 	bar := &progress.Bar{
@@ -403,13 +824,13 @@ func (dump *MongoDump) dumpQueryToWriter(
 	defer dump.progressManager.Detach(bar)
 
 	iter := query.Iter()
-	return dump.dumpIterToWriter(iter, writer, dumpProgressor)
+	return dump.dumpIterToWriter(iter, intent.Namespace(), writer, dumpProgressor)
 }
 
-// dumpIterToWriter takes an mgo iterator, a writer, and a pointer to
-// a counter, and dumps the iterator's contents to the writer.
+// dumpIterToWriter takes an mgo iterator, the namespace it reads from, a writer,
+// and a pointer to a counter, and dumps the iterator's contents to the writer.
 func (dump *MongoDump) dumpIterToWriter(
-	iter *mgo.Iter, writer io.Writer, progressCount progress.Updateable) error {
+	iter *mgo.Iter, namespace string, writer io.Writer, progressCount progress.Updateable) error {
 
 	// We run the result iteration in its own goroutine,
 	// this allows disk i/o to not block reads from the db,
@@ -434,6 +855,7 @@ func (dump *MongoDump) dumpIterToWriter(
 
 	// wrap writer in buffer to reduce load on disk
 	w := bufio.NewWriterSize(writer, 32*1024)
+	nsMetrics := dump.metrics.Namespace(namespace)
 
 	// while there are still results in the database,
 	// grab results from the goroutine and write them to filesystem
@@ -441,7 +863,7 @@ func (dump *MongoDump) dumpIterToWriter(
 		buff, alive := <-buffChan
 		if !alive {
 			if iter.Err() != nil {
-				return fmt.Errorf("error reading collection: %v", iter.Err())
+				return readError{"error reading collection", iter.Err()}
 			}
 			break
 		}
@@ -449,7 +871,11 @@ func (dump *MongoDump) dumpIterToWriter(
 		if err != nil {
 			return fmt.Errorf("error writing to file: %v", err)
 		}
+		dump.checkDocumentSize(namespace, buff)
 		progressCount.Inc(1)
+		nsMetrics.AddDocuments(1)
+		nsMetrics.AddBytes(int64(len(buff)))
+		dump.addDumpedBytes(len(buff))
 	}
 
 	// flush all remaining disk writes then exit
@@ -259,6 +259,64 @@ func TestMongoDumpValidateOptions(t *testing.T) {
 			So(err.Error(), ShouldContainSubstring, "cannot dump using a query without a specified collection")
 		})
 
+		Convey("a query that is not a JSON object is rejected before connecting", func() {
+			md.ToolOptions.Namespace.Collection = "some_collection"
+			md.InputOptions.Query = "{_id:"
+
+			err := md.Init()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "bad option: --query")
+
+			md.InputOptions.Query = "[1, 2]"
+			err = md.Init()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "query is not a JSON object")
+		})
+
+		Convey("an oplog-only dump needs a timestamp to start after", func() {
+			md.OutputOptions.OplogOnly = true
+
+			err := md.Init()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--oplogOnly requires --since")
+
+			Convey("and cannot be limited to a database", func() {
+				md.OutputOptions.OplogSince = "1456833600:1"
+
+				err := md.Init()
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "it dumps no collection data")
+			})
+		})
+
+		Convey("a metadata-only dump cannot filter documents", func() {
+			md.ToolOptions.Namespace.Collection = "some_collection"
+			md.OutputOptions.DumpMetadataOnly = true
+			md.InputOptions.Query = "{_id:\"\"}"
+
+			err := md.Init()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "cannot use --dumpMetadataOnly with --query")
+		})
+
+		Convey("a dump to stdout cannot be compressed with --gzip", func() {
+			md.ToolOptions.Namespace.Collection = "some_collection"
+			md.OutputOptions.Out = "-"
+			md.OutputOptions.Gzip = true
+
+			err := md.Init()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "cannot use --gzip when dumping to stdout")
+		})
+
+		Convey("the read batch size cannot be negative", func() {
+			md.InputOptions.ReadBatchSize = -1
+
+			err := md.Init()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--readBatchSize must be a positive number")
+		})
+
 	})
 }
 
@@ -585,3 +643,83 @@ func TestMongoDumpMetaData(t *testing.T) {
 
 	})
 }
+
+func TestMongoDumpQueryCount(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.IntegrationTestType)
+	log.SetWriter(ioutil.Discard)
+
+	Convey("With a MongoDump instance dumping a collection with --query", t, func() {
+		err := setUpMongoDumpTestData()
+		So(err, ShouldBeNil)
+
+		md := simpleMongoDumpInstance()
+		md.ToolOptions.Namespace.Collection = testCollectionNames[2]
+		md.InputOptions.Query = "{age: {$lt: 5}}"
+		So(md.Init(), ShouldBeNil)
+
+		Convey("the intent's size should be the number of matching documents", func() {
+			session, err := getBareSession()
+			So(err, ShouldBeNil)
+			defer session.Close()
+			coll := session.DB(testDB).C(testCollectionNames[2])
+			total, err := coll.Count()
+			So(err, ShouldBeNil)
+			matching, err := coll.Find(bson.M{"age": bson.M{"$lt": 5}}).Count()
+			So(err, ShouldBeNil)
+			So(matching, ShouldEqual, 5)
+			So(total, ShouldBeGreaterThan, matching)
+
+			intent, err := md.NewIntent(testDB, testCollectionNames[2], false)
+			So(err, ShouldBeNil)
+			So(intent.Size, ShouldEqual, int64(matching))
+		})
+
+		Reset(func() {
+			So(tearDownMongoDumpTestData(), ShouldBeNil)
+		})
+	})
+}
+
+func TestMongoDumpMetadataOnly(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.IntegrationTestType)
+	log.SetWriter(ioutil.Discard)
+
+	Convey("With a MongoDump instance using --dumpMetadataOnly", t, func() {
+		err := setUpMongoDumpTestData()
+		So(err, ShouldBeNil)
+		out, err := ioutil.TempDir("", "mongodump-metadata-only-")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(out)
+
+		md := simpleMongoDumpInstance()
+		md.ToolOptions.Namespace.Collection = testCollectionNames[0]
+		md.OutputOptions.Out = out
+		md.OutputOptions.DumpMetadataOnly = true
+		So(md.Init(), ShouldBeNil)
+		So(md.Dump(), ShouldBeNil)
+		dumpDBDir := filepath.Join(out, testDB)
+
+		Convey("no .bson file should be written", func() {
+			So(fileDirExists(filepath.Join(dumpDBDir, testCollectionNames[0]+".bson")), ShouldBeFalse)
+		})
+
+		Convey("the metadata file should record the collection's stats", func() {
+			jsonBytes, err := ioutil.ReadFile(
+				filepath.Join(dumpDBDir, testCollectionNames[0]+".metadata.json"))
+			So(err, ShouldBeNil)
+			meta := struct {
+				Indexes []interface{}    `json:"indexes"`
+				Stats   *CollectionStats `json:"stats"`
+			}{}
+			So(json.Unmarshal(jsonBytes, &meta), ShouldBeNil)
+			So(len(meta.Indexes), ShouldBeGreaterThan, 0)
+			So(meta.Stats, ShouldNotBeNil)
+			So(meta.Stats.Count, ShouldEqual, 10)
+			So(meta.Stats.IndexCount, ShouldEqual, len(meta.Indexes))
+		})
+
+		Reset(func() {
+			So(tearDownMongoDumpTestData(), ShouldBeNil)
+		})
+	})
+}
@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2/bson"
 	"io"
+	"io/ioutil"
+	"path/filepath"
 )
 
 // determineOplogCollectionName uses a command to infer
@@ -67,9 +70,42 @@ func (dump *MongoDump) checkOplogTimestampExists(ts bson.MongoTimestamp) (bool,
 	return true, nil
 }
 
+// writeOplogMetadata writes oplog.metadata.json next to oplog.bson in the
+// dump directory, recording the collection and server version the oplog was
+// captured from, since its entry format differs between them, along with
+// any other fields already set in metadata.
+func (dump *MongoDump) writeOplogMetadata(metadata db.OplogMetadata) error {
+	session, err := dump.sessionProvider.GetSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	buildInfo, err := session.BuildInfo()
+	if err != nil {
+		return fmt.Errorf("error getting server version: %v", err)
+	}
+	metadata.Collection = dump.oplogCollection
+	metadata.ServerVersion = buildInfo.Version
+	jsonBytes, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("error encoding oplog metadata: %v", err)
+	}
+	path := filepath.Join(dump.OutputOptions.Out, "oplog.metadata.json")
+	if err = ioutil.WriteFile(path, jsonBytes, 0644); err != nil {
+		return fmt.Errorf("error writing oplog metadata to %v: %v", path, err)
+	}
+	return nil
+}
+
 // DumpOplogAfterTimestamp takes a timestamp and writer and dumps all oplog entries after
 // the given timestamp to the writer. Returns any errors that occur.
 func (dump *MongoDump) DumpOplogAfterTimestamp(ts bson.MongoTimestamp, out io.Writer) error {
+	return dump.dumpOplogEntries(bson.M{"ts": bson.M{"$gt": ts}}, out)
+}
+
+// dumpOplogEntries dumps the oplog entries matching the query, which must
+// select a range of ts, to the writer.
+func (dump *MongoDump) dumpOplogEntries(queryObj bson.M, out io.Writer) error {
 	session, err := dump.sessionProvider.GetSession()
 	if err != nil {
 		return err
@@ -77,7 +113,6 @@ func (dump *MongoDump) DumpOplogAfterTimestamp(ts bson.MongoTimestamp, out io.Wr
 	defer session.Close()
 	session.SetSocketTimeout(0)
 	session.SetPrefetch(1.0) // mimic exhaust cursor
-	queryObj := bson.M{"ts": bson.M{"$gt": ts}}
 	oplogQuery := session.DB("local").C(dump.oplogCollection).Find(queryObj).LogReplay()
 	return dump.dumpQueryToWriter(
 		oplogQuery, &intents.Intent{DB: "local", C: dump.oplogCollection}, out)
@@ -0,0 +1,88 @@
+package mongodump
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"os"
+	"path/filepath"
+)
+
+// oplogWindowQuery selects the oplog entries after since, up to and
+// including until.
+func oplogWindowQuery(since, until bson.MongoTimestamp) bson.M {
+	return bson.M{"ts": bson.M{"$gt": since, "$lte": until}}
+}
+
+// dumpOplogOnly implements --oplogOnly: it dumps the oplog entries after
+// --since, up to the most recent one when it starts, to oplog.bson, without
+// any collection data. The window is recorded in oplog.metadata.json, so
+// that the next increment can start where this one ends. If the oplog has
+// rolled over past --since, entries are missing between the increments and
+// the dump fails.
+func (dump *MongoDump) dumpOplogOnly() error {
+	since, err := db.ParseTimestampFlag(dump.OutputOptions.OplogSince)
+	if err != nil {
+		return fmt.Errorf("error parsing --since: %v", err)
+	}
+	if err = dump.determineOplogCollectionName(); err != nil {
+		return fmt.Errorf("error finding oplog: %v", err)
+	}
+	if dump.oplogCollection != "oplog.rs" {
+		return fmt.Errorf("--oplogOnly requires a replica set")
+	}
+	until, err := dump.getOplogStartTime()
+	if err != nil {
+		return fmt.Errorf("error getting most recent oplog entry: %v", err)
+	}
+	if until < since {
+		// nothing happened since; the next increment starts at the same point
+		until = since
+	}
+	if err = dump.checkOplogCoversSince(since); err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(dump.OutputOptions.Out, defaultPermissions); err != nil {
+		return fmt.Errorf("error creating folder `%v` for dump: %v", dump.OutputOptions.Out, err)
+	}
+	oplogFilepath := filepath.Join(dump.OutputOptions.Out, "oplog.bson")
+	oplogOut, err := os.Create(oplogFilepath)
+	if err != nil {
+		return fmt.Errorf("error creating bson file `%v`: %v", oplogFilepath, err)
+	}
+	defer oplogOut.Close()
+
+	log.Logf(log.Always, "writing oplog entries after %v up to %v to %v",
+		db.FormatTimestamp(since), db.FormatTimestamp(until), oplogFilepath)
+	dump.progressManager.Start()
+	err = dump.dumpOplogEntries(oplogWindowQuery(since, until), oplogOut)
+	dump.progressManager.Stop()
+	if err != nil {
+		return fmt.Errorf("error dumping oplog: %v", err)
+	}
+
+	// the entries may have rolled over while they were read
+	if err = dump.checkOplogCoversSince(since); err != nil {
+		return err
+	}
+	return dump.writeOplogMetadata(db.OplogMetadata{
+		Since: db.FormatTimestamp(since),
+		Until: db.FormatTimestamp(until),
+	})
+}
+
+// checkOplogCoversSince returns an error if the oldest entry of the oplog
+// is newer than since, meaning entries right after it are gone.
+func (dump *MongoDump) checkOplogCoversSince(since bson.MongoTimestamp) error {
+	exists, err := dump.checkOplogTimestampExists(since)
+	if err != nil {
+		return fmt.Errorf("unable to check oplog for overflow: %v", err)
+	}
+	if !exists {
+		return fmt.Errorf("oplog overflow: the oplog no longer holds the entries after --since %v; "+
+			"take a new full dump to start a new chain of increments", db.FormatTimestamp(since))
+	}
+	return nil
+}
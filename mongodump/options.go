@@ -1,5 +1,7 @@
 package mongodump
 
+import "time"
+
 var Usage = `<options>
 
 Export the content of a running server into .bson files.
@@ -10,8 +12,14 @@ See http://docs.mongodb.org/manual/reference/program/mongodump/ for more informa
 
 // InputOptions defines the set of options to use in retrieving data from the server.
 type InputOptions struct {
-	Query     string `long:"query" short:"q" description:"query filter, as a JSON string, e.g., '{x:{$gt:1}}'"`
-	TableScan bool   `long:"forceTableScan" description:"force a table scan"`
+	Query         string        `long:"query" short:"q" description:"query filter, as a JSON string, e.g., '{x:{$gt:1}}'"`
+	TableScan     bool          `long:"forceTableScan" description:"force a table scan"`
+	DumpWindow    string        `long:"dumpWindow" description:"only dump documents whose date field falls in a window, given as field:start:end with RFC 3339 or YYYY-MM-DD times (start inclusive, end exclusive, either may be omitted)"`
+	SampleRate    float64       `long:"sampleRate" description:"dump a random sample of roughly the given fraction (between 0 and 1) of each collection; uses $sample on MongoDB 3.2+, which can be expensive for large collections"`
+	MaxLagSeconds int           `long:"maxLagSeconds" description:"when dumping from a secondary, refuse to start if it is more than this many seconds behind the primary, as reported by replSetGetStatus; when connected to a replica set, the dump then reads only from that secondary (unchecked by default)" default:"0" default-mask:"-"`
+	ReadBatchSize int           `long:"readBatchSize" description:"number of documents the server returns per batch of the read cursor; larger batches save round trips over slow links, smaller ones bound memory use with large documents (server default by default)" default:"0" default-mask:"-"`
+	Aggregate     string        `long:"aggregate" description:"aggregation pipeline, as a JSON array of stages, whose results are dumped instead of the collection's documents, e.g., '[{$match:{x:1}},{$project:{x:1}}]'"`
+	MaxRetryTime  time.Duration `long:"maxRetryTime" value-name:"<duration>" description:"maximum wall-clock time, such as '5m', to spend retrying reads that fail with a connection error across the whole dump, after which it fails; a collection whose documents fail to read is read again from the start into an emptied file, so this cannot be used with --out - (no retries by default)"`
 }
 
 // Name returns a human-readable group name for input options.
@@ -21,12 +29,31 @@ func (_ *InputOptions) Name() string {
 
 // OutputOptions defines the set of options for writing dump data.
 type OutputOptions struct {
-	Out                        string   `long:"out" short:"o" description:"output directory, or '-' for stdout (defaults to 'dump')" default:"dump" default-mask:"-"`
+	Out                        string   `long:"out" short:"o" description:"output directory, or '-' for stdout; may contain the placeholders {host}, {port}, {replset} and {date:layout}, with a Go time layout such as 2006-01-02 (defaults to 'dump')" default:"dump" default-mask:"-"`
 	Repair                     bool     `long:"repair" description:"try to recover documents from damaged data files (not supported by all storage engines)"`
 	Oplog                      bool     `long:"oplog" description:"use oplog for taking a point-in-time snapshot"`
+	OplogOnly                  bool     `long:"oplogOnly" description:"dump only the oplog entries after --since, up to the most recent one, to oplog.bson, without any collection data; the window is recorded in oplog.metadata.json, and successive increments can be replayed over a full dump with mongorestore --oplogReplay (requires a replica set)"`
+	OplogSince                 string   `long:"since" value-name:"<seconds[:ordinal]>" description:"with --oplogOnly, the timestamp after which to dump oplog entries, such as the 'until' of the previous increment's oplog.metadata.json"`
+	DumpMetadataOnly           bool     `long:"dumpMetadataOnly" description:"write each collection's metadata file, with its options, indexes and collStats sizes, but none of its documents; such a dump can be restored with mongorestore --metadataOnly"`
 	DumpDBUsersAndRoles        bool     `long:"dumpDbUsersAndRoles" description:"dump user and role definitions for the specified database"`
 	ExcludedCollections        []string `long:"excludeCollection" description:"collection to exclude from the dump (may be specified multiple times to exclude additional collections)"`
 	ExcludedCollectionPrefixes []string `long:"excludeCollectionsWithPrefix" description:"exclude all collections from the dump that have the given prefix (may be specified multiple times to exclude additional prefixes)"`
+	MetricsAddr                string   `long:"metricsAddr" description:"serve Prometheus metrics over HTTP at the given address, e.g. ':9000' (disabled by default)"`
+	OnComplete                 string   `long:"onComplete" value-name:"<url-or-command>" description:"when the dump finishes or fails, send a JSON summary of its status, duration, errors and the documents and bytes of each namespace: POSTed to an http(s) URL, or otherwise on the standard input of the given command; a failed notification is logged and does not change the exit code"`
+	MaxConnections             int      `long:"maxConnections" description:"maximum number of dump workers that may hold a server connection at once (unlimited by default)" default:"0" default-mask:"-"`
+	CheckIndexes               bool     `long:"checkIndexes" description:"warn about dumped indexes that use deprecated features or that newer servers may refuse to build on restore"`
+	DumpIndexesSeparately      bool     `long:"dumpIndexesSeparately" description:"write each collection's index definitions to a separate <collection>.indexes.json file instead of its metadata file"`
+	MetadataDateFormat         string   `long:"metadataDateFormat" description:"how dates in collection options and index specs, such as partialFilterExpression, are written to metadata files, either 'extjson' for extended JSON $date values or 'rfc3339' for plain strings like '2020-01-02T03:04:05.000Z' (extjson by default)" default:"extjson" default-mask:"-"`
+	DryRun                     bool     `long:"dryRun" description:"list the collections that would be dumped, with their document counts and estimated sizes, without writing any files"`
+	SkipInaccessible           bool     `long:"skipInaccessible" description:"when dumping all databases, skip any whose collections cannot be listed, e.g. for lack of permissions, and dump the rest; the dump still exits with an error naming the skipped databases"`
+	ExtraOut                   []string `long:"extraOut" description:"additional output directory, such as one on another disk; collections are written to --out and each --extraOut in turn (may be specified multiple times; restore by passing each one to mongorestore with --extraDir)"`
+	WarnLargeDocs              bool     `long:"warnLargeDocs" description:"log the namespace and _id of each dumped document larger than --largeDocThreshold, since documents near the 16MB limit may fail to restore"`
+	LargeDocThreshold          int      `long:"largeDocThreshold" description:"size in megabytes above which --warnLargeDocs warns about a document (15 by default)" default:"15" default-mask:"-"`
+	Gzip                       bool     `long:"gzip" description:"compress the .bson file of each collection with gzip, writing <collection>.bson.gz, which mongorestore decompresses as it reads it; metadata files are not compressed"`
+	PipeCmd                    string   `long:"pipeCmd" description:"command to pass the output through when dumping to stdout with --out -, such as a compressor like 'zstd -19', split into arguments as a shell would split it; it reads the dump on stdin and its stdout becomes mongodump's"`
+	TestConnection             bool     `long:"testConnection" description:"connect, check that the authenticated user has the privileges this dump needs, print a report and exit without dumping"`
+	MaxDumpBytes               int64    `long:"maxDumpBytes" value-name:"<bytes>" description:"stop once this many bytes of documents have been written, after the collections in progress finish; the dump is listed in truncated.json and mongodump exits with code 5 (unlimited by default)" default:"0" default-mask:"-"`
+	Resume                     bool     `long:"resume" description:"record the collections dumped so far in resume.json in --out, and continue an interrupted dump that was also run with --resume and the same options into the same directory, skipping the collections it completed; collections that were in progress are dumped again"`
 }
 
 // Name returns a human-readable group name for output options.
@@ -0,0 +1,129 @@
+package mongodump
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/util"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// defaultOutDateLayout is used for a {date} placeholder without a layout.
+const defaultOutDateLayout = "2006-01-02T15-04-05"
+
+// outPlaceholder matches an --out placeholder such as {host} or
+// {date:2006-01-02}, capturing its name and optional argument.
+var outPlaceholder = regexp.MustCompile(`\{([a-z]+)(?::([^{}]*))?\}`)
+
+// outTemplateValues holds the values substituted into an --out template.
+type outTemplateValues struct {
+	host    string
+	port    string
+	replSet string
+	now     time.Time
+}
+
+// isOutTemplate returns true if out contains placeholders to expand.
+func isOutTemplate(out string) bool {
+	return strings.ContainsAny(out, "{}")
+}
+
+// expandOutTemplate substitutes values into the placeholders of an --out
+// template. It supports {host}, {port}, {replset} and {date:layout}, where
+// layout is a Go time layout. It fails on unknown or malformed placeholders,
+// on placeholders with no value, and if the result is not a usable path.
+func expandOutTemplate(template string, values outTemplateValues) (string, error) {
+	var expandErr error
+	expanded := outPlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		match := outPlaceholder.FindStringSubmatch(placeholder)
+		name, arg := match[1], match[2]
+		var value string
+		switch name {
+		case "host":
+			value = values.host
+		case "port":
+			value = values.port
+		case "replset":
+			value = values.replSet
+			if value == "" && expandErr == nil {
+				expandErr = fmt.Errorf("{replset} requires a connection to a replica set")
+			}
+		case "date":
+			if arg == "" {
+				arg = defaultOutDateLayout
+			}
+			value = values.now.Format(arg)
+		default:
+			if expandErr == nil {
+				expandErr = fmt.Errorf("unknown placeholder %v", placeholder)
+			}
+		}
+		if arg != "" && name != "date" && expandErr == nil {
+			expandErr = fmt.Errorf("placeholder {%v} does not take an argument", name)
+		}
+		if value == "" && expandErr == nil {
+			expandErr = fmt.Errorf("placeholder %v has no value", placeholder)
+		}
+		return value
+	})
+	if expandErr != nil {
+		return "", expandErr
+	}
+	if strings.ContainsAny(expanded, "{}") {
+		return "", fmt.Errorf("unmatched brace in '%v'", template)
+	}
+	if expanded == "" || expanded == "-" || strings.ContainsRune(expanded, 0) {
+		return "", fmt.Errorf("'%v' does not expand to a usable path", template)
+	}
+	return expanded, nil
+}
+
+// checkOutputDirs returns an error if any two of the output directories
+// given by --out and --extraOut are the same.
+func checkOutputDirs(out string, extraOut []string) error {
+	seen := map[string]bool{filepath.Clean(out): true}
+	for _, dir := range extraOut {
+		if dir == "" || dir == "-" {
+			return fmt.Errorf("--extraOut must be a directory")
+		}
+		if seen[filepath.Clean(dir)] {
+			return fmt.Errorf("output directory %v is given more than once", dir)
+		}
+		seen[filepath.Clean(dir)] = true
+	}
+	return nil
+}
+
+// outTemplateValues gathers the values for an --out template from the
+// connection options and, for {replset}, the connected server.
+func (dump *MongoDump) outTemplateValues(now time.Time) (outTemplateValues, error) {
+	addrs, setName := util.ParseConnectionString(dump.ToolOptions.Connection.Host)
+	values := outTemplateValues{
+		host:    addrs[0],
+		port:    dump.ToolOptions.Connection.Port,
+		replSet: setName,
+		now:     now,
+	}
+	if host, port, err := net.SplitHostPort(values.host); err == nil {
+		values.host = host
+		if values.port == "" {
+			values.port = port
+		}
+	}
+	if values.host == "" {
+		values.host = util.DefaultHost
+	}
+	if values.port == "" {
+		values.port = util.DefaultPort
+	}
+	if values.replSet == "" && strings.Contains(dump.OutputOptions.Out, "{replset}") {
+		var err error
+		values.replSet, err = dump.sessionProvider.ReplicaSetName()
+		if err != nil {
+			return values, fmt.Errorf("error getting replica set name: %v", err)
+		}
+	}
+	return values, nil
+}
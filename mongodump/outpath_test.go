@@ -0,0 +1,98 @@
+package mongodump
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExpandOutTemplate(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	values := outTemplateValues{
+		host:    "db1.example.com",
+		port:    "27018",
+		replSet: "rs0",
+		now:     time.Date(2016, time.March, 7, 13, 45, 10, 0, time.UTC),
+	}
+
+	Convey("When expanding --out templates", t, func() {
+
+		Convey("paths without placeholders should be unchanged", func() {
+			So(isOutTemplate("dump"), ShouldBeFalse)
+			out, err := expandOutTemplate("/backups/dump", values)
+			So(err, ShouldBeNil)
+			So(out, ShouldEqual, "/backups/dump")
+		})
+
+		Convey("all placeholders should be substituted", func() {
+			So(isOutTemplate("/backups/{host}"), ShouldBeTrue)
+			out, err := expandOutTemplate("/backups/{replset}/{host}-{port}/{date:2006-01-02}", values)
+			So(err, ShouldBeNil)
+			So(out, ShouldEqual, "/backups/rs0/db1.example.com-27018/2016-03-07")
+		})
+
+		Convey("{date} without a layout should use the default layout", func() {
+			out, err := expandOutTemplate("dump-{date}", values)
+			So(err, ShouldBeNil)
+			So(out, ShouldEqual, "dump-2016-03-07T13-45-10")
+		})
+
+		Convey("unknown placeholders should be rejected", func() {
+			_, err := expandOutTemplate("/backups/{hostname}", values)
+			So(err, ShouldNotBeNil)
+			_, err = expandOutTemplate("/backups/{host:x}", values)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("unmatched braces should be rejected", func() {
+			_, err := expandOutTemplate("/backups/{host", values)
+			So(err, ShouldNotBeNil)
+			_, err = expandOutTemplate("/backups/host}", values)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("{replset} should fail when not connected to a replica set", func() {
+			standalone := values
+			standalone.replSet = ""
+			_, err := expandOutTemplate("/backups/{replset}", standalone)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("templates that expand to stdout or nothing should be rejected", func() {
+			_, err := expandOutTemplate("{date:-}", values)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestOutputDirs(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a mongodump writing to --out and two --extraOut directories", t, func() {
+		md := &MongoDump{
+			OutputOptions: &OutputOptions{
+				Out:      "dump",
+				ExtraOut: []string{"/disk2/dump", "/disk3/dump"},
+			},
+		}
+
+		Convey("collections should take turns between the directories", func() {
+			So(md.outputPath("db", "a"), ShouldEqual, filepath.Join("dump", "db", "a"))
+			So(md.outputPath("db", "b"), ShouldEqual, filepath.Join("/disk2/dump", "db", "b"))
+			So(md.outputPath("db", "c"), ShouldEqual, filepath.Join("/disk3/dump", "db", "c"))
+			So(md.outputPath("db", "d"), ShouldEqual, filepath.Join("dump", "db", "d"))
+		})
+
+		Convey("distinct directories should be accepted", func() {
+			So(checkOutputDirs(md.OutputOptions.Out, md.OutputOptions.ExtraOut), ShouldBeNil)
+		})
+
+		Convey("repeated directories should be rejected", func() {
+			So(checkOutputDirs("dump", []string{"other", "./dump"}), ShouldNotBeNil)
+			So(checkOutputDirs("dump", []string{"other", "other/"}), ShouldNotBeNil)
+		})
+	})
+}
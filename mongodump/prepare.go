@@ -15,6 +15,7 @@ import (
 type collectionInfo struct {
 	Name    string  `bson:"name"`
 	Options *bson.D `bson:"options"`
+	IDIndex *bson.D `bson:"idIndex"`
 }
 
 // shouldSkipCollection returns true when a collection name is excluded
@@ -34,17 +35,29 @@ func (dump *MongoDump) shouldSkipCollection(colName string) bool {
 }
 
 // outputPath creates a path for the collection to be written to (sans file extension).
+// With --extraOut, each call takes the next of the output directories in turn,
+// so that successive collections are written to different disks.
 func (dump *MongoDump) outputPath(dbName, colName string) string {
-	return filepath.Join(dump.OutputOptions.Out, dbName, colName)
+	outDir := dump.OutputOptions.Out
+	if len(dump.OutputOptions.ExtraOut) > 0 {
+		outDirs := append([]string{outDir}, dump.OutputOptions.ExtraOut...)
+		outDir = outDirs[dump.outputDirCount%len(outDirs)]
+		dump.outputDirCount++
+	}
+	return filepath.Join(outDir, dbName, colName)
 }
 
 // NewIntent creates a bare intent without populating the options.
 func (dump *MongoDump) NewIntent(dbName, collName string, stdout bool) (*intents.Intent, error) {
+	path := dump.outputPath(dbName, collName)
 	intent := &intents.Intent{
 		DB:           dbName,
 		C:            collName,
-		BSONPath:     dump.outputPath(dbName, collName) + ".bson",
-		MetadataPath: dump.outputPath(dbName, collName) + ".metadata.json",
+		BSONPath:     path + ".bson",
+		MetadataPath: path + ".metadata.json",
+	}
+	if dump.OutputOptions.Gzip {
+		intent.BSONPath += ".gz"
 	}
 
 	// add stdout flags if we're using stdout
@@ -53,18 +66,22 @@ func (dump *MongoDump) NewIntent(dbName, collName string, stdout bool) (*intents
 		intent.MetadataPath = "-"
 	}
 
-	// get a document count for scheduling purposes
+	// get a document count for scheduling purposes, of only the documents
+	// matching --query and --dumpWindow if given
 	session, err := dump.sessionProvider.GetSession()
 	if err != nil {
 		return nil, err
 	}
 	defer session.Close()
 
-	count, err := session.DB(dbName).C(collName).Count()
+	count, err := session.DB(dbName).C(collName).Find(dump.query).Count()
 	if err != nil {
 		return nil, fmt.Errorf("error counting %v: %v", intent.Namespace(), err)
 	}
 	intent.Size = int64(count)
+	if dump.InputOptions.SampleRate > 0 {
+		intent.Size = int64(sampleSize(count, dump.InputOptions.SampleRate))
+	}
 
 	return intent, nil
 }
@@ -103,6 +120,11 @@ func (dump *MongoDump) CreateCollectionIntent(dbName, colName string) error {
 				return fmt.Errorf("Failed to parse collection options as bson.D")
 			}
 		}
+		if idIndex, _ := bsonutil.FindValueByKey("idIndex", opts); idIndex != nil {
+			if idIndexD, ok := idIndex.(bson.D); ok {
+				intent.IDIndex = &idIndexD
+			}
+		}
 	}
 
 	dump.manager.Put(intent)
@@ -111,7 +133,7 @@ func (dump *MongoDump) CreateCollectionIntent(dbName, colName string) error {
 	return nil
 }
 
-func (dump *MongoDump) createIntentFromOptions(dbName string, ci *collectionInfo) error {
+func (dump *MongoDump) createIntentFromOptions(dbName string, ci *collectionInfo, order int) error {
 	if dump.shouldSkipCollection(ci.Name) {
 		log.Logf(log.DebugLow, "skipping dump of %v.%v, it is excluded", dbName, ci.Name)
 		return nil
@@ -121,6 +143,8 @@ func (dump *MongoDump) createIntentFromOptions(dbName string, ci *collectionInfo
 		return err
 	}
 	intent.Options = ci.Options
+	intent.IDIndex = ci.IDIndex
+	intent.CreationOrder = order
 	dump.manager.Put(intent)
 	log.Logf(log.DebugLow, "enqueued collection '%v'", intent.Namespace())
 	return nil
@@ -130,10 +154,12 @@ func (dump *MongoDump) createIntentFromOptions(dbName string, ci *collectionInfo
 // and builds dump intents for each collection.
 func (dump *MongoDump) CreateIntentsForDatabase(dbName string) error {
 	// we must ensure folders for empty databases are still created, for legacy purposes
-	dbFolder := filepath.Join(dump.OutputOptions.Out, dbName)
-	err := os.MkdirAll(dbFolder, defaultPermissions)
-	if err != nil {
-		return fmt.Errorf("error creating directory `%v`: %v", dbFolder, err)
+	if !dump.OutputOptions.DryRun {
+		dbFolder := filepath.Join(dump.OutputOptions.Out, dbName)
+		err := os.MkdirAll(dbFolder, defaultPermissions)
+		if err != nil {
+			return fmt.Errorf("error creating directory `%v`: %v", dbFolder, err)
+		}
 	}
 
 	session, err := dump.sessionProvider.GetSession()
@@ -144,9 +170,12 @@ func (dump *MongoDump) CreateIntentsForDatabase(dbName string) error {
 
 	colsIter, fullName, err := db.GetCollections(session.DB(dbName), "")
 	if err != nil {
-		return fmt.Errorf("error getting collections for database `%v`: %v", dbName, err)
+		return listCollectionsError{dbName, err}
 	}
 
+	// listCollections returns the collections of a database in a stable
+	// order, which restores can follow
+	order := 0
 	collInfo := &collectionInfo{}
 	for colsIter.Next(collInfo) {
 		// Skip over indexes since they are also listed in system.namespaces in 2.6 or earlier
@@ -163,12 +192,27 @@ func (dump *MongoDump) CreateIntentsForDatabase(dbName string) error {
 				return fmt.Errorf("namespace '%v' format is invalid - expected to start with '%v'", collInfo.Name, namespacePrefix)
 			}
 		}
-		err := dump.createIntentFromOptions(dbName, collInfo)
+		order++
+		err := dump.createIntentFromOptions(dbName, collInfo, order)
 		if err != nil {
 			return err
 		}
 	}
-	return colsIter.Err()
+	if err := colsIter.Err(); err != nil {
+		return listCollectionsError{dbName, err}
+	}
+	return nil
+}
+
+// listCollectionsError is returned when the collections of a database
+// cannot be listed, such as when the user lacks permission to read it.
+type listCollectionsError struct {
+	dbName string
+	err    error
+}
+
+func (e listCollectionsError) Error() string {
+	return fmt.Sprintf("error getting collections for database `%v`: %v", e.dbName, e.err)
 }
 
 // CreateAllIntents iterates through all dbs and collections and builds
@@ -184,9 +228,29 @@ func (dump *MongoDump) CreateAllIntents() error {
 			// local can only be explicitly dumped
 			continue
 		}
-		if err := dump.CreateIntentsForDatabase(dbName); err != nil {
+		err := dump.CreateIntentsForDatabase(dbName)
+		if _, ok := err.(listCollectionsError); ok && dump.OutputOptions.SkipInaccessible {
+			log.Logf(log.Always, "skipping database %v: %v", dbName, err)
+			dump.skippedDatabases = append(dump.skippedDatabases, dbName)
+			if !dump.OutputOptions.DryRun {
+				// only removes the folder created above if it is still empty
+				os.Remove(filepath.Join(dump.OutputOptions.Out, dbName))
+			}
+			continue
+		}
+		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// skippedDatabasesError returns an error naming the databases skipped by
+// --skipInaccessible, or nil if none were.
+func (dump *MongoDump) skippedDatabasesError() error {
+	if len(dump.skippedDatabases) == 0 {
+		return nil
+	}
+	return fmt.Errorf("dump is incomplete: skipped %v database(s) that could not be read: %v",
+		len(dump.skippedDatabases), strings.Join(dump.skippedDatabases, ", "))
+}
@@ -49,3 +49,24 @@ func TestSkipCollection(t *testing.T) {
 	})
 
 }
+
+func TestSkippedDatabasesError(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a mongodump using --skipInaccessible", t, func() {
+		md := &MongoDump{OutputOptions: &OutputOptions{SkipInaccessible: true}}
+
+		Convey("no error should be returned if no databases were skipped", func() {
+			So(md.skippedDatabasesError(), ShouldBeNil)
+		})
+
+		Convey("the error should name every skipped database", func() {
+			md.skippedDatabases = []string{"tenant1", "tenant7"}
+			err := md.skippedDatabasesError()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "2 database(s)")
+			So(err.Error(), ShouldContainSubstring, "tenant1, tenant7")
+		})
+	})
+}
@@ -0,0 +1,187 @@
+package mongodump
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// checkpointName is the file, in the root of the dump directory, that a
+// dump run with --resume writes to list the collections dumped so far, so
+// that it can be continued with --resume if it is interrupted. It is
+// removed once the dump completes.
+const checkpointName = "resume.json"
+
+// dumpCheckpoint is the content of the checkpointName file.
+type dumpCheckpoint struct {
+	Options   checkpointOptions `json:"options"`
+	Completed []string          `json:"completed"`
+}
+
+// checkpointOptions are the options that decide which collections and
+// documents are dumped, and how they are written. A dump can only be
+// resumed with the same ones, since the collections it completed would
+// otherwise not match those it dumps. Fields are named after the options.
+type checkpointOptions struct {
+	DB                           string   `json:"db"`
+	Collection                   string   `json:"collection"`
+	Query                        string   `json:"query"`
+	DumpWindow                   string   `json:"dumpWindow"`
+	SampleRate                   float64  `json:"sampleRate"`
+	Aggregate                    string   `json:"aggregate"`
+	Repair                       bool     `json:"repair"`
+	DumpMetadataOnly             bool     `json:"dumpMetadataOnly"`
+	DumpDBUsersAndRoles          bool     `json:"dumpDbUsersAndRoles"`
+	ExcludeCollection            []string `json:"excludeCollection"`
+	ExcludeCollectionsWithPrefix []string `json:"excludeCollectionsWithPrefix"`
+	DumpIndexesSeparately        bool     `json:"dumpIndexesSeparately"`
+	MetadataDateFormat           string   `json:"metadataDateFormat"`
+	Gzip                         bool     `json:"gzip"`
+}
+
+// checkpointOptions returns the options of the dump to record in, and
+// compare with, its checkpoint.
+func (dump *MongoDump) checkpointOptions() checkpointOptions {
+	return checkpointOptions{
+		DB:                           dump.ToolOptions.DB,
+		Collection:                   dump.ToolOptions.Collection,
+		Query:                        dump.InputOptions.Query,
+		DumpWindow:                   dump.InputOptions.DumpWindow,
+		SampleRate:                   dump.InputOptions.SampleRate,
+		Aggregate:                    dump.InputOptions.Aggregate,
+		Repair:                       dump.OutputOptions.Repair,
+		DumpMetadataOnly:             dump.OutputOptions.DumpMetadataOnly,
+		DumpDBUsersAndRoles:          dump.OutputOptions.DumpDBUsersAndRoles,
+		ExcludeCollection:            dump.OutputOptions.ExcludedCollections,
+		ExcludeCollectionsWithPrefix: dump.OutputOptions.ExcludedCollectionPrefixes,
+		DumpIndexesSeparately:        dump.OutputOptions.DumpIndexesSeparately,
+		MetadataDateFormat:           dump.OutputOptions.MetadataDateFormat,
+		Gzip:                         dump.OutputOptions.Gzip,
+	}
+}
+
+// differences returns the names of the options that differ between the
+// recorded options and current ones, as --option flags.
+func (recorded checkpointOptions) differences(current checkpointOptions) []string {
+	recordedValue, currentValue := reflect.ValueOf(recorded), reflect.ValueOf(current)
+	names := []string{}
+	for i := 0; i < recordedValue.NumField(); i++ {
+		field := recordedValue.Type().Field(i)
+		if !reflect.DeepEqual(emptyAsNil(recordedValue.Field(i).Interface()),
+			emptyAsNil(currentValue.Field(i).Interface())) {
+			names = append(names, "--"+field.Tag.Get("json"))
+		}
+	}
+	return names
+}
+
+// emptyAsNil returns nil for an empty slice, which a checkpoint decodes as
+// nil whether it was written as nil or empty.
+func emptyAsNil(value interface{}) interface{} {
+	if slice, ok := value.([]string); ok && len(slice) == 0 {
+		return nil
+	}
+	return value
+}
+
+// checkpointPath returns the path of the checkpoint file of the dump.
+func (dump *MongoDump) checkpointPath() string {
+	return filepath.Join(dump.OutputOptions.Out, checkpointName)
+}
+
+// readCheckpoint returns the collections completed by the interrupted dump
+// being resumed. A dump directory without a checkpoint has nothing to skip.
+// It is an error to resume a dump with different options than it was
+// started with.
+func (dump *MongoDump) readCheckpoint() ([]string, error) {
+	jsonBytes, err := ioutil.ReadFile(dump.checkpointPath())
+	if os.IsNotExist(err) {
+		log.Logf(log.Always, "no %v in %v, so every collection will be dumped",
+			checkpointName, dump.OutputOptions.Out)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %v: %v", dump.checkpointPath(), err)
+	}
+	checkpoint := dumpCheckpoint{}
+	if err = json.Unmarshal(jsonBytes, &checkpoint); err != nil {
+		return nil, fmt.Errorf("error parsing %v: %v", dump.checkpointPath(), err)
+	}
+	if differences := checkpoint.Options.differences(dump.checkpointOptions()); len(differences) > 0 {
+		return nil, fmt.Errorf("cannot resume the dump in %v with different options than it was started "+
+			"with; %v must be the same, or the dump started again in another directory",
+			dump.OutputOptions.Out, strings.Join(differences, ", "))
+	}
+	return checkpoint.Completed, nil
+}
+
+// pruneCompletedIntents removes the intents of collections that the
+// resumed dump already completed. It must be called before the intent
+// manager is finalized. Collections that were in progress are dumped again
+// from the start.
+func (dump *MongoDump) pruneCompletedIntents(completed []string) {
+	remaining := intents.NewIntentManager()
+	skipped := 0
+	for _, intent := range dump.manager.Intents() {
+		if util.StringSliceContains(completed, intent.Namespace()) {
+			log.Logf(log.Info, "skipping %v, already dumped", intent.Namespace())
+			skipped++
+			continue
+		}
+		remaining.Put(intent)
+	}
+	log.Logf(log.Always, "resuming dump: skipping %v collection(s) already dumped", skipped)
+	dump.manager = remaining
+	dump.checkpoint = append([]string{}, completed...)
+}
+
+// recordCompleted adds the namespace to the checkpoint of a dump run with
+// --resume and rewrites the checkpoint file. The file is replaced by a
+// rename, so that an interruption never leaves it half written.
+func (dump *MongoDump) recordCompleted(namespace string) error {
+	if !dump.OutputOptions.Resume {
+		return nil
+	}
+	dump.checkpointLock.Lock()
+	defer dump.checkpointLock.Unlock()
+	dump.checkpoint = append(dump.checkpoint, namespace)
+
+	jsonBytes, err := json.Marshal(dumpCheckpoint{
+		Options:   dump.checkpointOptions(),
+		Completed: dump.checkpoint,
+	})
+	if err != nil {
+		return fmt.Errorf("error creating %v: %v", checkpointName, err)
+	}
+	if err = os.MkdirAll(dump.OutputOptions.Out, defaultPermissions); err != nil {
+		return fmt.Errorf("error creating folder `%v` for dump: %v", dump.OutputOptions.Out, err)
+	}
+	path := dump.checkpointPath()
+	if err = ioutil.WriteFile(path+".tmp", jsonBytes, 0644); err != nil {
+		return fmt.Errorf("error writing %v: %v", path, err)
+	}
+	if err = os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("error writing %v: %v", path, err)
+	}
+	return nil
+}
+
+// removeCheckpoint removes the checkpoint file once a dump run with
+// --resume is complete.
+func (dump *MongoDump) removeCheckpoint() error {
+	if !dump.OutputOptions.Resume {
+		return nil
+	}
+	err := os.Remove(dump.checkpointPath())
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing %v: %v", dump.checkpointPath(), err)
+	}
+	return nil
+}
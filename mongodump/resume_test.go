@@ -0,0 +1,94 @@
+package mongodump
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResume(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	out, err := ioutil.TempDir("", "mongodump-resume-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(out)
+
+	// newDump returns a dump of the database app into out, with --resume
+	// if resume is set
+	newDump := func(resume bool) *MongoDump {
+		return &MongoDump{
+			ToolOptions:  &options.ToolOptions{Namespace: &options.Namespace{DB: "app"}},
+			InputOptions: &InputOptions{Query: "{x:1}"},
+			OutputOptions: &OutputOptions{
+				Out:                 out,
+				Resume:              resume,
+				ExcludedCollections: []string{"logs"},
+				MetadataDateFormat:  "extjson",
+			},
+			manager: intents.NewIntentManager(),
+		}
+	}
+
+	Convey("With a dump directory", t, func() {
+		os.Remove(filepath.Join(out, checkpointName))
+		md := newDump(true)
+
+		Convey("a directory without a checkpoint has nothing completed", func() {
+			completed, err := md.readCheckpoint()
+			So(err, ShouldBeNil)
+			So(completed, ShouldBeEmpty)
+		})
+
+		Convey("completed collections are read back and skipped", func() {
+			So(md.recordCompleted("a.b"), ShouldBeNil)
+			So(md.recordCompleted("a.c"), ShouldBeNil)
+
+			resumed := newDump(true)
+			completed, err := resumed.readCheckpoint()
+			So(err, ShouldBeNil)
+			So(completed, ShouldResemble, []string{"a.b", "a.c"})
+
+			for _, c := range []string{"b", "c", "d"} {
+				resumed.manager.Put(&intents.Intent{DB: "a", C: c})
+			}
+			resumed.pruneCompletedIntents(completed)
+			remaining := resumed.manager.Intents()
+			So(len(remaining), ShouldEqual, 1)
+			So(remaining[0].Namespace(), ShouldEqual, "a.d")
+
+			Convey("and the checkpoint keeps them as the dump continues", func() {
+				So(resumed.recordCompleted("a.d"), ShouldBeNil)
+				completed, err := resumed.readCheckpoint()
+				So(err, ShouldBeNil)
+				So(completed, ShouldResemble, []string{"a.b", "a.c", "a.d"})
+
+				So(resumed.removeCheckpoint(), ShouldBeNil)
+				_, err = os.Stat(resumed.checkpointPath())
+				So(os.IsNotExist(err), ShouldBeTrue)
+			})
+
+			Convey("but not by a dump with different options", func() {
+				changed := newDump(true)
+				changed.InputOptions.Query = "{x:2}"
+				changed.OutputOptions.ExcludedCollections = nil
+				_, err := changed.readCheckpoint()
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "--query, --excludeCollection must be the same")
+			})
+		})
+
+		Convey("a dump without --resume should not write a checkpoint", func() {
+			plain := newDump(false)
+			So(plain.recordCompleted("a.b"), ShouldBeNil)
+			_, err := os.Stat(plain.checkpointPath())
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+	})
+}
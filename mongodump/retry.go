@@ -0,0 +1,95 @@
+package mongodump
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+	"io"
+	"os"
+	"time"
+)
+
+// The randomized exponential backoff between retries of reads, the same as
+// mongorestore's default one between retries of writes.
+const (
+	retryBaseDelay = 100 * time.Millisecond
+	retryMaxDelay  = 10 * time.Second
+)
+
+// readError is an error reading from the server, as opposed to writing the
+// dump, so that a connection error among them can be retried.
+type readError struct {
+	context string
+	cause   error
+}
+
+func (e readError) Error() string {
+	return fmt.Sprintf("%v: %v", e.context, e.cause)
+}
+
+// retry runs fn, retrying it within --maxRetryTime if it fails with a
+// connection error while reading from the server. The session is refreshed
+// before each retry so that it reconnects, possibly to a newly elected
+// primary. Without --maxRetryTime, fn is run once.
+func (dump *MongoDump) retry(session *mgo.Session, operation string, fn func() error) error {
+	if dump.retryBudget == nil {
+		return fn()
+	}
+	backoff := util.Backoff{
+		BaseDelay: retryBaseDelay,
+		MaxDelay:  retryMaxDelay,
+		Budget:    dump.retryBudget,
+	}
+	return util.Retry(-1, backoff, func(err error) bool {
+		readErr, ok := err.(readError)
+		if !ok || !db.IsConnectionError(readErr.cause) {
+			return false
+		}
+		if dump.retryBudget.Spent() {
+			// Retry fails with the spent budget without retrying
+			return true
+		}
+		log.Logf(log.Always, "retrying %v after connection error: %v", operation, readErr.cause)
+		session.Refresh()
+		return true
+	}, fn)
+}
+
+// dumpDataToFile writes an intent's documents to file, compressed with
+// --gzip. If reading them fails with a connection error, the file is emptied
+// and the collection read again from the start, within --maxRetryTime.
+func (dump *MongoDump) dumpDataToFile(session *mgo.Session,
+	findQuery *mgo.Query, intent *intents.Intent, file *os.File) error {
+	attempts := 0
+	return dump.retry(session, "read of "+intent.Namespace(), func() error {
+		if attempts++; attempts > 1 {
+			if _, err := file.Seek(0, os.SEEK_SET); err != nil {
+				return fmt.Errorf("error rewinding bson file `%v`: %v", file.Name(), err)
+			}
+			if err := file.Truncate(0); err != nil {
+				return fmt.Errorf("error truncating bson file `%v`: %v", file.Name(), err)
+			}
+		}
+
+		var out io.Writer = file
+		var gzipOut *gzip.Writer
+		if dump.OutputOptions.Gzip {
+			gzipOut = gzip.NewWriter(file)
+			out = gzipOut
+		}
+		if err := dump.dumpDataToWriter(session, findQuery, intent, out); err != nil {
+			return err
+		}
+		if gzipOut != nil {
+			// flushes the compressed data and writes the gzip footer
+			if err := gzipOut.Close(); err != nil {
+				return fmt.Errorf("error compressing bson file `%v`: %v", file.Name(), err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,57 @@
+package mongodump
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	"github.com/mongodb/mongo-tools/common/util"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"testing"
+)
+
+func TestRetryReads(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When reading with retries", t, func() {
+		dump := &MongoDump{}
+		calls := 0
+		failWith := func(err error) func() error {
+			return func() error {
+				calls++
+				return err
+			}
+		}
+
+		Convey("without --maxRetryTime a read should be tried once", func() {
+			err := dump.retry(nil, "test", failWith(readError{"error reading collection", io.EOF}))
+			So(err.Error(), ShouldEqual, "error reading collection: EOF")
+			So(calls, ShouldEqual, 1)
+		})
+
+		Convey("with a budget", func() {
+			dump.retryBudget = util.NewRetryBudget(0)
+
+			Convey("errors that are not connection errors should not be retried", func() {
+				err := dump.retry(nil, "test", failWith(readError{"error reading collection", fmt.Errorf("bad")}))
+				So(err, ShouldHaveSameTypeAs, readError{})
+				So(calls, ShouldEqual, 1)
+			})
+
+			Convey("errors writing the dump should not be retried", func() {
+				err := dump.retry(nil, "test", failWith(io.EOF))
+				So(err, ShouldEqual, io.EOF)
+				So(calls, ShouldEqual, 1)
+			})
+
+			Convey("a connection error should fail with the spent budget without touching the session", func() {
+				// a nil session would panic if it were refreshed
+				err := dump.retry(nil, "test", failWith(readError{"error reading collection", io.EOF}))
+				budgetErr, ok := err.(util.RetryBudgetError)
+				So(ok, ShouldBeTrue)
+				So(budgetErr.Cause, ShouldHaveSameTypeAs, readError{})
+				So(calls, ShouldEqual, 1)
+			})
+		})
+	})
+}
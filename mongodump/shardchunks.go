@@ -0,0 +1,96 @@
+package mongodump
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// chunkRange is a chunk of a sharded collection, from its min shard key
+// value, inclusive, to its max, exclusive.
+type chunkRange struct {
+	Min bson.D `bson:"_id"`
+	Max bson.D `bson:"max"`
+}
+
+// getShardName returns the name of the shard the connected mongod belongs
+// to, from the shardIdentity document that MongoDB 3.4 and later keep on
+// each shard, or "" if it is not a shard or the name cannot be read.
+func (dump *MongoDump) getShardName() string {
+	session, err := dump.sessionProvider.GetSession()
+	if err != nil {
+		log.Logf(log.DebugLow, "cannot tell whether the server is a shard: %v", err)
+		return ""
+	}
+	defer session.Close()
+	identity := struct {
+		ShardName string `bson:"shardName"`
+	}{}
+	err = session.DB("admin").C("system.version").Find(bson.M{"_id": "shardIdentity"}).One(&identity)
+	if err != nil {
+		if err != mgo.ErrNotFound {
+			log.Logf(log.DebugLow, "cannot tell whether the server is a shard: %v", err)
+		}
+		return ""
+	}
+	return identity.ShardName
+}
+
+// errNoCachedChunks is returned by getOwnedChunks when the shard has not
+// cached any chunk of a sharded collection, so it cannot tell which of them
+// it owns.
+var errNoCachedChunks = errors.New("no chunks of the collection are in the shard's cached routing table")
+
+// getOwnedChunks returns the shard key of the namespace and the ranges of
+// the chunks of it that the shard owns, sorted, or a nil key if the
+// collection is not sharded. A shard may own no chunks at all, such as
+// after its chunks were migrated away. They are read from the routing table
+// that MongoDB 3.6 and later cache on each shard in the config database,
+// which is refreshed when the shard learns of a change, so a migration that
+// was committed just before the dump may not be reflected yet.
+func getOwnedChunks(session *mgo.Session, nsID, shard string) (bson.D, []chunkRange, error) {
+	collInfo := struct {
+		Key bson.D `bson:"key"`
+	}{}
+	err := session.DB("config").C("cache.collections").Find(
+		bson.M{"_id": nsID, "dropped": bson.M{"$ne": true}}).One(&collInfo)
+	if err == mgo.ErrNotFound {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	chunks := []chunkRange{}
+	cachedChunks := session.DB("config").C("cache.chunks." + nsID)
+	if err = cachedChunks.Find(bson.M{"shard": shard}).Sort("_id").All(&chunks); err != nil {
+		return nil, nil, err
+	}
+	if len(chunks) == 0 {
+		// owning nothing looks the same as not having loaded the
+		// routing table, which holds every chunk of the collection
+		total, err := cachedChunks.Count()
+		if err != nil {
+			return nil, nil, err
+		}
+		if total == 0 {
+			return nil, nil, errNoCachedChunks
+		}
+	}
+	return collInfo.Key, chunks, nil
+}
+
+// ownedChunksToJSON converts chunk ranges to the JSON form of metadata files.
+func ownedChunksToJSON(chunks []chunkRange) ([]interface{}, error) {
+	converted := make([]interface{}, 0, len(chunks))
+	for _, chunk := range chunks {
+		value, err := bsonutil.ConvertBSONValueToJSON(bson.D{{"min", chunk.Min}, {"max", chunk.Max}})
+		if err != nil {
+			return nil, fmt.Errorf("error converting chunk range to JSON: %v", err)
+		}
+		converted = append(converted, value)
+	}
+	return converted, nil
+}
@@ -0,0 +1,66 @@
+package mongodump
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/auth"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"io"
+)
+
+// requiredActions returns the actions that the dump described by the
+// options needs to perform.
+func (dump *MongoDump) requiredActions() []auth.RequiredAction {
+	dbName, collection := dump.ToolOptions.DB, dump.ToolOptions.Collection
+	data := auth.Resource{DB: dbName, Collection: collection}
+	required := []auth.RequiredAction{}
+	if dbName == "" {
+		cluster := auth.Resource{Cluster: true}
+		required = append(required,
+			auth.RequiredAction{Action: "listDatabases", Resource: cluster, Reason: "listing databases"})
+	}
+	if collection == "" {
+		database := auth.Resource{DB: dbName}
+		required = append(required,
+			auth.RequiredAction{Action: "listCollections", Resource: database, Reason: "listing collections"})
+	}
+	required = append(required,
+		auth.RequiredAction{Action: "find", Resource: data, Reason: "reading documents"},
+		auth.RequiredAction{Action: "listIndexes", Resource: data, Reason: "reading index definitions"})
+	if dbName == "" || dbName == "admin" || dump.OutputOptions.DumpDBUsersAndRoles {
+		users := auth.Resource{DB: "admin", Collection: "system.users"}
+		roles := auth.Resource{DB: "admin", Collection: "system.roles"}
+		required = append(required,
+			auth.RequiredAction{Action: "find", Resource: users, Reason: "dumping users"},
+			auth.RequiredAction{Action: "find", Resource: roles, Reason: "dumping roles"})
+	}
+	if dump.OutputOptions.Oplog {
+		oplog := auth.Resource{DB: "local", Collection: "oplog.rs"}
+		required = append(required,
+			auth.RequiredAction{Action: "find", Resource: oplog, Reason: "capturing the oplog with --oplog"})
+	}
+	return required
+}
+
+// TestConnection writes a report to out on the connected server and on
+// whether the authenticated user can perform the dump, without dumping
+// anything. It returns an error if any required privilege is missing.
+func (dump *MongoDump) TestConnection(out io.Writer) error {
+	nodeType, err := dump.sessionProvider.GetNodeType()
+	if err != nil {
+		return fmt.Errorf("error connecting: %v", err)
+	}
+	fmt.Fprintln(out, log.Redact(fmt.Sprintf("connected to %v (%v)",
+		util.CreateConnectionAddrs(dump.ToolOptions.Host, dump.ToolOptions.Port), nodeType)))
+
+	status, err := auth.GetConnectionStatus(dump.sessionProvider)
+	if err != nil {
+		return err
+	}
+	missing := auth.WriteConnectionReport(out, status, dump.requiredActions())
+	if len(missing) > 0 {
+		return fmt.Errorf("the authenticated user is missing %v privilege(s) needed for this dump", len(missing))
+	}
+	fmt.Fprintln(out, "connection test passed")
+	return nil
+}
@@ -0,0 +1,127 @@
+package mongodump
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"time"
+)
+
+// time formats accepted for the bounds of --dumpWindow
+var dumpWindowTimeFormats = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// parseDumpWindowTime parses a single bound of --dumpWindow. An empty bound
+// returns a zero time, meaning the window is open on that side.
+func parseDumpWindowTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, format := range dumpWindowTimeFormats {
+		if t, err := time.Parse(format, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse '%v' as a time", value)
+}
+
+// parseDumpWindow parses a --dumpWindow value of the form field:start:end into
+// the field name and a query filter selecting documents whose field falls
+// within [start, end). Since times may themselves contain colons, every colon
+// after the field name is tried as the separator between start and end.
+func parseDumpWindow(window string) (string, bson.M, error) {
+	parts := strings.SplitN(window, ":", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", nil, fmt.Errorf("--dumpWindow must be of the form field:start:end")
+	}
+	field, bounds := parts[0], parts[1]
+
+	for i := 0; i < len(bounds); i++ {
+		if bounds[i] != ':' {
+			continue
+		}
+		start, err := parseDumpWindowTime(bounds[:i])
+		if err != nil {
+			continue
+		}
+		end, err := parseDumpWindowTime(bounds[i+1:])
+		if err != nil {
+			continue
+		}
+		if start.IsZero() && end.IsZero() {
+			return "", nil, fmt.Errorf("--dumpWindow needs a start time, an end time, or both")
+		}
+		if !start.IsZero() && !end.IsZero() && !start.Before(end) {
+			return "", nil, fmt.Errorf("--dumpWindow start time must be before its end time")
+		}
+		condition := bson.M{}
+		if !start.IsZero() {
+			condition["$gte"] = start
+		}
+		if !end.IsZero() {
+			condition["$lt"] = end
+		}
+		return field, bson.M{field: condition}, nil
+	}
+	return "", nil, fmt.Errorf("cannot parse start and end times in --dumpWindow '%v'", window)
+}
+
+// checkDumpWindowField warns if the --dumpWindow field is missing from a
+// sample document of the intent's collection, or is not the leading field of
+// any index, which means the window query will scan the whole collection.
+func (dump *MongoDump) checkDumpWindowField(session *mgo.Session, intent *intents.Intent) error {
+	collection := session.DB(intent.DB).C(intent.C)
+
+	sample := bson.M{}
+	err := collection.Find(nil).One(&sample)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error sampling %v: %v", intent.Namespace(), err)
+	}
+	if !hasDottedField(sample, dump.windowField) {
+		log.Logf(log.Always, "warning: a sample document from %v has no '%v' field for --dumpWindow",
+			intent.Namespace(), dump.windowField)
+	}
+
+	indexesIter, err := db.GetIndexes(collection)
+	if err != nil {
+		return err
+	}
+	index := struct {
+		Key bson.D `bson:"key"`
+	}{}
+	for indexesIter.Next(&index) {
+		if len(index.Key) > 0 && index.Key[0].Name == dump.windowField {
+			return indexesIter.Close()
+		}
+	}
+	if err = indexesIter.Close(); err != nil {
+		return fmt.Errorf("error getting indexes for %v: %v", intent.Namespace(), err)
+	}
+	log.Logf(log.Always, "warning: no index on '%v' in %v; --dumpWindow will scan the whole collection",
+		dump.windowField, intent.Namespace())
+	return nil
+}
+
+// hasDottedField returns true if the document contains the given dotted field path.
+func hasDottedField(doc bson.M, path string) bool {
+	parts := strings.SplitN(path, ".", 2)
+	value, ok := doc[parts[0]]
+	if !ok {
+		return false
+	}
+	if len(parts) == 1 {
+		return true
+	}
+	subdoc, ok := value.(bson.M)
+	return ok && hasDottedField(subdoc, parts[1])
+}
@@ -0,0 +1,57 @@
+package mongodump
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+	"time"
+)
+
+func TestParseDumpWindow(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When parsing --dumpWindow values", t, func() {
+		start := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+		end := time.Date(2015, 6, 2, 12, 30, 0, 0, time.UTC)
+
+		Convey("RFC 3339 bounds containing colons should be split correctly", func() {
+			field, filter, err := parseDumpWindow("createdAt:2015-06-01T00:00:00Z:2015-06-02T12:30:00Z")
+			So(err, ShouldBeNil)
+			So(field, ShouldEqual, "createdAt")
+			So(filter, ShouldResemble, bson.M{"createdAt": bson.M{"$gte": start, "$lt": end}})
+		})
+
+		Convey("either bound may be omitted", func() {
+			_, filter, err := parseDumpWindow("meta.ts:2015-06-01:")
+			So(err, ShouldBeNil)
+			So(filter, ShouldResemble, bson.M{"meta.ts": bson.M{"$gte": start}})
+
+			_, filter, err = parseDumpWindow("ts::2015-06-02T12:30:00Z")
+			So(err, ShouldBeNil)
+			So(filter, ShouldResemble, bson.M{"ts": bson.M{"$lt": end}})
+		})
+
+		Convey("invalid windows should be rejected", func() {
+			for _, window := range []string{
+				"ts",
+				":2015-06-01:2015-06-02",
+				"ts::",
+				"ts:yesterday:today",
+				"ts:2015-06-02:2015-06-01",
+			} {
+				_, _, err := parseDumpWindow(window)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+
+	Convey("Dotted fields should be found in sample documents", t, func() {
+		doc := bson.M{"ts": 1, "meta": bson.M{"created": 2}}
+		So(hasDottedField(doc, "ts"), ShouldBeTrue)
+		So(hasDottedField(doc, "meta.created"), ShouldBeTrue)
+		So(hasDottedField(doc, "meta.updated"), ShouldBeFalse)
+		So(hasDottedField(doc, "ts.x"), ShouldBeFalse)
+	})
+}
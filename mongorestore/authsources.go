@@ -0,0 +1,122 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/options"
+	"gopkg.in/mgo.v2"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sort"
+)
+
+// authSource is the entry for one database in an --authSourcesFile.
+type authSource struct {
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	Source    string `json:"authenticationDatabase"`
+	Mechanism string `json:"authenticationMechanism"`
+}
+
+// parseAuthSources parses the contents of an --authSourcesFile: a JSON
+// document mapping the name of each database to the credentials used for
+// it. The authentication database of each defaults to the database itself,
+// and may only be used by one entry. The credentials are returned in order
+// of database name.
+func parseAuthSources(jsonBytes []byte) ([]string, []options.Auth, error) {
+	sources := map[string]authSource{}
+	if err := json.Unmarshal(jsonBytes, &sources); err != nil {
+		return nil, nil, err
+	}
+	dbNames := make([]string, 0, len(sources))
+	for dbName := range sources {
+		dbNames = append(dbNames, dbName)
+	}
+	sort.Strings(dbNames)
+
+	credentials := make([]options.Auth, 0, len(dbNames))
+	// the database each authentication database is used for
+	usedSources := map[string]string{}
+	for _, dbName := range dbNames {
+		source := sources[dbName]
+		if source.Username == "" {
+			return nil, nil, fmt.Errorf("no username for database %v", dbName)
+		}
+		if source.Source == "" {
+			source.Source = dbName
+		}
+		if other, ok := usedSources[source.Source]; ok {
+			return nil, nil, fmt.Errorf("databases %v and %v both authenticate on %v; "+
+				"each authentication database may only be listed once", other, dbName, source.Source)
+		}
+		usedSources[source.Source] = dbName
+		credential := options.Auth{
+			Username:  source.Username,
+			Password:  source.Password,
+			Source:    source.Source,
+			Mechanism: source.Mechanism,
+		}
+		if credential.ShouldAskForPassword() {
+			return nil, nil, fmt.Errorf("no password for database %v", dbName)
+		}
+		credentials = append(credentials, credential)
+	}
+	return dbNames, credentials, nil
+}
+
+// loginAuthSources reads the --authSourcesFile and connects with each set of
+// credentials in it on a session provider of its own, which is used for
+// everything written to its database, so that a bad one fails the restore
+// before anything is written. The passwords are redacted from the log.
+func (restore *MongoRestore) loginAuthSources(path string) error {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("error reading --authSourcesFile: %v", err)
+	}
+	if runtime.GOOS != "windows" && fileInfo.Mode().Perm()&0077 != 0 {
+		log.Logf(log.Always, "warning: --authSourcesFile %v holds passwords but can be read by "+
+			"other users; restrict it with 'chmod 600'", path)
+	}
+	jsonBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading --authSourcesFile: %v", err)
+	}
+	dbNames, credentials, err := parseAuthSources(jsonBytes)
+	if err != nil {
+		return fmt.Errorf("error parsing --authSourcesFile %v: %v", path, err)
+	}
+	restore.authSourceProviders = map[string]*db.SessionProvider{}
+	for i := range credentials {
+		log.RedactSecret(credentials[i].Password)
+		toolOptions := *restore.ToolOptions
+		toolOptions.Auth = &credentials[i]
+		provider, err := db.NewSessionProvider(toolOptions)
+		if err == nil {
+			var session *mgo.Session
+			if session, err = provider.GetSession(); err == nil {
+				session.Close()
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("error authenticating as %v on %v for database %v: %v",
+				credentials[i].Username, credentials[i].Source, dbNames[i], err)
+		}
+		log.Logf(log.Info, "authenticated as %v on %v for database %v",
+			credentials[i].Username, credentials[i].Source, dbNames[i])
+		restore.authSourceProviders[dbNames[i]] = provider
+	}
+	return nil
+}
+
+// sessionProviderFor returns the session provider authenticated for the
+// given database by the --authSourcesFile, or the tool's own if it has no
+// entry there.
+func (restore *MongoRestore) sessionProviderFor(dbName string) *db.SessionProvider {
+	if provider, ok := restore.authSourceProviders[dbName]; ok {
+		return provider
+	}
+	return restore.SessionProvider
+}
@@ -0,0 +1,62 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestParseAuthSources(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When parsing an --authSourcesFile", t, func() {
+
+		Convey("credentials should be returned in order of database", func() {
+			dbNames, credentials, err := parseAuthSources([]byte(`{
+				"tenantB": {"username": "b", "password": "pb", "authenticationDatabase": "admin"},
+				"tenantA": {"username": "a", "password": "pa", "authenticationMechanism": "SCRAM-SHA-1"}
+			}`))
+			So(err, ShouldBeNil)
+			So(dbNames, ShouldResemble, []string{"tenantA", "tenantB"})
+			So(credentials[0].Username, ShouldEqual, "a")
+			So(credentials[0].Source, ShouldEqual, "tenantA")
+			So(credentials[0].Mechanism, ShouldEqual, "SCRAM-SHA-1")
+			So(credentials[1].Source, ShouldEqual, "admin")
+			So(credentials[1].Password, ShouldEqual, "pb")
+		})
+
+		Convey("an entry without a username should be rejected", func() {
+			_, _, err := parseAuthSources([]byte(`{"tenantA": {"password": "pa"}}`))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("an authentication database used by two entries should be rejected", func() {
+			_, _, err := parseAuthSources([]byte(`{
+				"tenantA": {"username": "a", "password": "pa", "authenticationDatabase": "admin"},
+				"tenantB": {"username": "b", "password": "pb", "authenticationDatabase": "admin"}
+			}`))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "admin")
+
+			_, _, err = parseAuthSources([]byte(`{
+				"tenantA": {"username": "a", "password": "pa"},
+				"tenantB": {"username": "b", "password": "pb", "authenticationDatabase": "tenantA"}
+			}`))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("an entry without a password should be rejected unless its mechanism needs none", func() {
+			_, _, err := parseAuthSources([]byte(`{"tenantA": {"username": "a"}}`))
+			So(err, ShouldNotBeNil)
+			_, _, err = parseAuthSources([]byte(`{"tenantA": {"username": "CN=a", ` +
+				`"authenticationDatabase": "$external", "authenticationMechanism": "MONGODB-X509"}}`))
+			So(err, ShouldBeNil)
+		})
+
+		Convey("invalid JSON should be rejected", func() {
+			_, _, err := parseAuthSources([]byte(`{"tenantA": `))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
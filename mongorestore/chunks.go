@@ -0,0 +1,141 @@
+package mongorestore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// bsonChunk is a range of whole documents in a BSON file, from the byte
+// offset start up to end.
+type bsonChunk struct {
+	start, end int64
+}
+
+// scanChunks reads the document sizes of a BSON file, skipping over the
+// documents themselves, and splits the file into ranges of whole documents
+// of at least chunkSize bytes each, apart from the last. It also returns
+// the number of documents.
+func scanChunks(file io.ReadSeeker, chunkSize int64) ([]bsonChunk, int64, error) {
+	if _, err := file.Seek(0, os.SEEK_SET); err != nil {
+		return nil, 0, err
+	}
+	chunks := []bsonChunk{}
+	var start, offset, count int64
+	header := make([]byte, 4)
+	for {
+		_, err := io.ReadFull(file, header)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("error reading document #%v: %v", count+1, err)
+		}
+		size := int64(binary.LittleEndian.Uint32(header))
+		if size < 5 || size > db.MaxBSONSize {
+			return nil, 0, fmt.Errorf("invalid BSONSize: %v bytes", size)
+		}
+		if _, err = file.Seek(size-4, os.SEEK_CUR); err != nil {
+			return nil, 0, fmt.Errorf("error reading document #%v: %v", count+1, err)
+		}
+		count++
+		offset += size
+		if offset-start >= chunkSize {
+			chunks = append(chunks, bsonChunk{start, offset})
+			start = offset
+		}
+	}
+	if offset > start {
+		chunks = append(chunks, bsonChunk{start, offset})
+	}
+	if _, err := file.Seek(0, os.SEEK_SET); err != nil {
+		return nil, 0, err
+	}
+	return chunks, count, nil
+}
+
+// collectionChunks returns the ranges of source that --collectionChunkSize
+// splits the intent's documents into, or nil if they should be read as a
+// single stream: when there is only one insertion worker, when insertion
+// order must be kept, or when source is not a plain file that can be read
+// at any offset, such as stdin, JSON or --streamingInput. It also returns
+// the number of documents if the file was scanned for them, or 0.
+func (restore *MongoRestore) collectionChunks(intent *intents.Intent,
+	source io.ReadCloser) ([]bsonChunk, int64, error) {
+	if restore.collectionChunkSize == 0 || restore.OutputOptions.NumInsertionWorkers < 2 ||
+		restore.OutputOptions.MaintainInsertionOrder {
+		return nil, 0, nil
+	}
+	file, ok := source.(*os.File)
+	if !ok {
+		log.Logf(log.DebugLow, "\treading %v as a single stream, because it cannot be read at an offset",
+			intent.BSONPath)
+		return nil, 0, nil
+	}
+	chunks, count, err := scanChunks(file, restore.collectionChunkSize)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error scanning %v for --collectionChunkSize: %v", intent.BSONPath, err)
+	}
+	if len(chunks) < 2 {
+		return nil, count, nil
+	}
+	log.Logf(log.Info, "\treading %v in %v chunks in parallel", intent.BSONPath, len(chunks))
+	return chunks, count, nil
+}
+
+// RestoreCollectionChunks inserts the documents of the given ranges of a
+// BSON file into the database, with each insertion worker reading its own
+// ranges from the file at once.
+func (restore *MongoRestore) RestoreCollectionChunks(dbName, colName string,
+	file io.ReaderAt, chunks []bsonChunk, fileSize, expectedCount int64) error {
+
+	feed := func(docChan chan<- bson.Raw, doneChan <-chan struct{}, limiter *util.RateLimiter) error {
+		return feedChunks(file, chunks, restore.OutputOptions.NumInsertionWorkers, docChan, doneChan, limiter)
+	}
+	return restore.insertDocuments(dbName, colName, feed, fileSize, expectedCount)
+}
+
+// feedChunks sends the documents of each range of file to docChan, reading
+// up to readers ranges at once, and returns the first error reading them.
+func feedChunks(file io.ReaderAt, chunks []bsonChunk, readers int,
+	docChan chan<- bson.Raw, doneChan <-chan struct{}, limiter *util.RateLimiter) error {
+
+	chunkChan := make(chan bsonChunk, len(chunks))
+	for _, chunk := range chunks {
+		chunkChan <- chunk
+	}
+	close(chunkChan)
+
+	var errMutex sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range chunkChan {
+				section := io.NewSectionReader(file, chunk.start, chunk.end-chunk.start)
+				bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(ioutil.NopCloser(section)))
+				err := feedDocuments(bsonSource, docChan, doneChan, limiter)
+				if err != nil {
+					errMutex.Lock()
+					if firstErr == nil {
+						firstErr = fmt.Errorf("error reading bytes %v to %v: %v", chunk.start, chunk.end, err)
+					}
+					errMutex.Unlock()
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
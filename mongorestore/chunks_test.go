@@ -0,0 +1,205 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// writeBSONFile writes count documents with sequential _ids and a filler
+// string of the given length to a new file in dir.
+func writeBSONFile(dir string, count, filler int) (string, error) {
+	path := filepath.Join(dir, "c.bson")
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	for i := 0; i < count; i++ {
+		raw, err := bson.Marshal(bson.D{{"_id", i}, {"s", strings.Repeat("x", filler)}})
+		if err != nil {
+			return "", err
+		}
+		if _, err = file.Write(raw); err != nil {
+			return "", err
+		}
+	}
+	return path, nil
+}
+
+// drainChunks feeds the chunks of the file to a channel and returns the
+// documents received.
+func drainChunks(file *os.File, chunks []bsonChunk, readers int) ([]bson.Raw, error) {
+	docChan := make(chan bson.Raw)
+	doneChan := make(chan struct{})
+	var feedErr error
+	go func() {
+		defer close(docChan)
+		feedErr = feedChunks(file, chunks, readers, docChan, doneChan, nil)
+	}()
+	docs := []bson.Raw{}
+	for doc := range docChan {
+		docs = append(docs, doc)
+	}
+	return docs, feedErr
+}
+
+func TestCollectionChunks(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	dir, err := ioutil.TempDir("", "mongorestore-chunks-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// each document is 100 bytes
+	path, err := writeBSONFile(dir, 10, 78)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("With a file of ten 100-byte documents", t, func() {
+		file, err := os.Open(path)
+		So(err, ShouldBeNil)
+		Reset(func() { file.Close() })
+
+		Convey("chunks should end at the first document boundary past the chunk size", func() {
+			chunks, count, err := scanChunks(file, 250)
+			So(err, ShouldBeNil)
+			So(chunks, ShouldResemble, []bsonChunk{{0, 300}, {300, 600}, {600, 900}, {900, 1000}})
+			So(count, ShouldEqual, 10)
+
+			chunks, count, err = scanChunks(file, 2000)
+			So(err, ShouldBeNil)
+			So(chunks, ShouldResemble, []bsonChunk{{0, 1000}})
+			So(count, ShouldEqual, 10)
+		})
+
+		Convey("every document should be fed exactly once", func() {
+			chunks, _, err := scanChunks(file, 150)
+			So(err, ShouldBeNil)
+			docs, err := drainChunks(file, chunks, 3)
+			So(err, ShouldBeNil)
+			So(len(docs), ShouldEqual, 10)
+			seen := map[int]bool{}
+			for _, raw := range docs {
+				doc := bson.M{}
+				So(bson.Unmarshal(raw.Data, &doc), ShouldBeNil)
+				seen[doc["_id"].(int)] = true
+			}
+			So(len(seen), ShouldEqual, 10)
+		})
+
+		Convey("a chunk that does not end on a document boundary should be an error", func() {
+			_, err := drainChunks(file, []bsonChunk{{0, 150}}, 2)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("the chunks should only be used for files with several insertion workers", func() {
+			restore := &MongoRestore{
+				OutputOptions:       &OutputOptions{NumInsertionWorkers: 4},
+				collectionChunkSize: 250,
+			}
+			intent := &intents.Intent{DB: "test", C: "c", BSONPath: path}
+			chunks, count, err := restore.collectionChunks(intent, file)
+			So(err, ShouldBeNil)
+			So(len(chunks), ShouldEqual, 4)
+			So(count, ShouldEqual, 10)
+
+			chunks, count, err = restore.collectionChunks(intent, ioutil.NopCloser(bytes.NewReader(nil)))
+			So(err, ShouldBeNil)
+			So(chunks, ShouldBeNil)
+			So(count, ShouldEqual, 0)
+
+			restore.OutputOptions.MaintainInsertionOrder = true
+			chunks, count, err = restore.collectionChunks(intent, file)
+			So(err, ShouldBeNil)
+			So(chunks, ShouldBeNil)
+			So(count, ShouldEqual, 0)
+		})
+	})
+}
+
+// benchmarkFeed feeds a generated 256MB collection to four workers that
+// decode each document, reading it in chunks of the given size, or as a
+// single stream if chunkSize is 0. Set MONGORESTORE_BENCH_DOCS to a larger
+// number of 1KB documents to try a multi-GB collection.
+func benchmarkFeed(b *testing.B, chunkSize int64) {
+	count := 256 * 1024
+	if docs, err := strconv.Atoi(os.Getenv("MONGORESTORE_BENCH_DOCS")); err == nil {
+		count = docs
+	}
+	dir, err := ioutil.TempDir("", "mongorestore-chunks-")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path, err := writeBSONFile(dir, count, 1000)
+	if err != nil {
+		b.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		b.Fatal(err)
+	}
+	chunks := []bsonChunk{{0, info.Size()}}
+	if chunkSize > 0 {
+		if chunks, _, err = scanChunks(file, chunkSize); err != nil {
+			b.Fatal(err)
+		}
+	}
+	const workers = 4
+	b.SetBytes(info.Size())
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		docChan := make(chan bson.Raw, insertBufferFactor)
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for doc := range docChan {
+					bson.Unmarshal(doc.Data, &bson.D{})
+				}
+			}()
+		}
+		if chunkSize > 0 {
+			err = feedChunks(file, chunks, workers, docChan, nil, nil)
+		} else {
+			bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(
+				ioutil.NopCloser(io.NewSectionReader(file, 0, info.Size()))))
+			err = feedDocuments(bsonSource, docChan, nil, nil)
+		}
+		close(docChan)
+		wg.Wait()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFeedSingleStream(b *testing.B) {
+	benchmarkFeed(b, 0)
+}
+
+func BenchmarkFeedChunks(b *testing.B) {
+	benchmarkFeed(b, 16*1024*1024)
+}
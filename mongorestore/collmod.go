@@ -0,0 +1,99 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// collModOption is a collection option that --applyCollMod sets with the
+// collMod command, which applies it to existing collections too, rather
+// than when the collection is created.
+type collModOption struct {
+	name string
+	// the server version from which collMod accepts the option
+	major, minor int
+}
+
+var collModOptions = []collModOption{
+	{"validator", 3, 2},
+	{"validationLevel", 3, 2},
+	{"validationAction", 3, 2},
+	{"recordPreImages", 5, 0},
+	{"expireAfterSeconds", 5, 0},
+	{"changeStreamPreAndPostImages", 6, 0},
+}
+
+// splitCollModOptions separates the options that --applyCollMod sets with
+// collMod from those given to the create command.
+func splitCollModOptions(options bson.D) (create bson.D, collMod bson.D) {
+	if options == nil {
+		return nil, nil
+	}
+	create = bson.D{}
+	for _, option := range options {
+		if findCollModOption(option.Name) != nil {
+			collMod = append(collMod, option)
+		} else {
+			create = append(create, option)
+		}
+	}
+	return create, collMod
+}
+
+// findCollModOption returns the collMod option of the given name, or nil.
+func findCollModOption(name string) *collModOption {
+	for i := range collModOptions {
+		if collModOptions[i].name == name {
+			return &collModOptions[i]
+		}
+	}
+	return nil
+}
+
+// ApplyCollMod sets the given options on the intent's collection with the
+// collMod command. Options that the server is too old to accept are logged
+// and skipped.
+func (restore *MongoRestore) ApplyCollMod(intent *intents.Intent, options bson.D) error {
+	session, err := restore.sessionProviderFor(intent.DB).GetSession()
+	if err != nil {
+		return fmt.Errorf("error establishing connection: %v", err)
+	}
+	defer session.Close()
+
+	buildInfo, err := session.BuildInfo()
+	if err != nil {
+		return fmt.Errorf("error getting server version: %v", err)
+	}
+	command := bson.D{{"collMod", intent.C}}
+	for _, option := range options {
+		required := findCollModOption(option.Name)
+		if !buildInfo.VersionAtLeast(required.major, required.minor) {
+			log.Logf(log.Always, "not setting %v on %v: collMod requires server version %v.%v or later",
+				option.Name, intent.Namespace(), required.major, required.minor)
+			continue
+		}
+		command = append(command, option)
+	}
+	if len(command) == 1 {
+		return nil
+	}
+
+	log.Logf(log.Info, "setting options of %v with collMod", intent.Namespace())
+	jsonCommand, err := bsonutil.ConvertBSONValueToJSON(command)
+	if err != nil {
+		return err
+	}
+	res := bson.M{}
+	err = session.DB(intent.DB).Run(jsonCommand, &res)
+	if err != nil {
+		return fmt.Errorf("error running collMod command: %v", err)
+	}
+	if util.IsFalsy(res["ok"]) {
+		return fmt.Errorf("collMod command: %v", res["errmsg"])
+	}
+	return nil
+}
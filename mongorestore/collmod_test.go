@@ -0,0 +1,44 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestSplitCollModOptions(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With the options of a dumped collection", t, func() {
+
+		Convey("options collMod can set should be split from the create options", func() {
+			options := bson.D{
+				{"capped", true},
+				{"validator", bson.D{{"a", bson.D{{"$exists", true}}}}},
+				{"size", 4096},
+				{"changeStreamPreAndPostImages", bson.D{{"enabled", true}}},
+			}
+			create, collMod := splitCollModOptions(options)
+			So(create, ShouldResemble, bson.D{{"capped", true}, {"size", 4096}})
+			So(collMod, ShouldResemble, bson.D{
+				{"validator", bson.D{{"a", bson.D{{"$exists", true}}}}},
+				{"changeStreamPreAndPostImages", bson.D{{"enabled", true}}},
+			})
+		})
+
+		Convey("the collection should still be created when all options are set with collMod", func() {
+			create, collMod := splitCollModOptions(bson.D{{"validationLevel", "moderate"}})
+			So(create, ShouldNotBeNil)
+			So(create, ShouldBeEmpty)
+			So(len(collMod), ShouldEqual, 1)
+		})
+
+		Convey("missing options should stay missing", func() {
+			create, collMod := splitCollModOptions(nil)
+			So(create, ShouldBeNil)
+			So(collMod, ShouldBeNil)
+		})
+	})
+}
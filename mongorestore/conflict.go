@@ -0,0 +1,111 @@
+package mongorestore
+
+import (
+	"fmt"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// Policies for --onConflict.
+const (
+	conflictDumpWins   = "dumpWins"
+	conflictTargetWins = "targetWins"
+	conflictNewerWins  = "newerWins"
+)
+
+// conflictPolicy decides, with --mergeDocuments, what happens to a document
+// of the dump whose _id the target collection already has.
+type conflictPolicy struct {
+	mode string
+	// the field compared by newerWins, possibly a dotted path
+	field string
+}
+
+// parseConflictPolicy parses an --onConflict value: dumpWins, targetWins or
+// newerWins:<field>. An empty value is dumpWins.
+func parseConflictPolicy(value string) (conflictPolicy, error) {
+	mode, field := value, ""
+	if i := strings.Index(value, ":"); i >= 0 {
+		mode, field = value[:i], value[i+1:]
+	}
+	switch mode {
+	case "", conflictDumpWins:
+		mode = conflictDumpWins
+	case conflictTargetWins:
+	case conflictNewerWins:
+		if field == "" {
+			return conflictPolicy{}, fmt.Errorf("newerWins needs the field to compare, as newerWins:<field>")
+		}
+		if strings.HasPrefix(field, "$") || strings.HasPrefix(field, ".") || strings.HasSuffix(field, ".") {
+			return conflictPolicy{}, fmt.Errorf("invalid field name '%v'", field)
+		}
+		return conflictPolicy{mode, field}, nil
+	default:
+		return conflictPolicy{}, fmt.Errorf("unknown policy '%v'; must be %v, %v or %v:<field>",
+			value, conflictDumpWins, conflictTargetWins, conflictNewerWins)
+	}
+	if field != "" {
+		return conflictPolicy{}, fmt.Errorf("%v does not take a field", mode)
+	}
+	return conflictPolicy{mode: mode}, nil
+}
+
+// lookupField returns the value at the dotted path in the document, and
+// whether it was found.
+func lookupField(doc bson.D, path string) (interface{}, bool) {
+	name, rest := path, ""
+	if i := strings.Index(path, "."); i >= 0 {
+		name, rest = path[:i], path[i+1:]
+	}
+	for _, elem := range doc {
+		if elem.Name != name {
+			continue
+		}
+		if rest == "" {
+			return elem.Value, true
+		}
+		if subdoc, ok := elem.Value.(bson.D); ok {
+			return lookupField(subdoc, rest)
+		}
+		return nil, false
+	}
+	return nil, false
+}
+
+// conflictUpdate returns the selector and update that merge the raw
+// document into the target under the policy. dumpWins sets the document's
+// fields on the target document. targetWins only inserts the document if
+// the target has none with its _id, leaving an existing one unchanged.
+// newerWins sets the fields only if the target document's field is less
+// than the dump document's, or missing; the server compares values of the
+// same type only, so a target field of another type is never older. A dump
+// document without the field is not known to be newer, so it is only
+// inserted if the target has none with its _id, as with targetWins, and
+// missingField is returned. With newerWins, an upsert whose selector does
+// not match an existing document fails with a duplicate key error on the
+// _id index, meaning the target is newer.
+func (policy conflictPolicy) conflictUpdate(data []byte) (selector bson.D, update bson.D, missingField bool, err error) {
+	id, update, err := mergeUpdate(data)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	selector = bson.D{{"_id", id}}
+	switch policy.mode {
+	case conflictTargetWins:
+		update = bson.D{{"$setOnInsert", update[0].Value}}
+	case conflictNewerWins:
+		doc := bson.D{}
+		if err = bson.Unmarshal(data, &doc); err != nil {
+			return nil, nil, false, fmt.Errorf("error decoding document to merge: %v", err)
+		}
+		value, ok := lookupField(doc, policy.field)
+		if !ok {
+			return selector, bson.D{{"$setOnInsert", update[0].Value}}, true, nil
+		}
+		selector = append(selector, bson.DocElem{"$or", []bson.D{
+			{{policy.field, bson.D{{"$lt", value}}}},
+			{{policy.field, bson.D{{"$exists", false}}}},
+		}})
+	}
+	return selector, update, false, nil
+}
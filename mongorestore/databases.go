@@ -0,0 +1,62 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"sort"
+	"strings"
+)
+
+// missingTargetDatabases returns the sorted names of the databases that
+// intents restore into but that are not among the existing databases.
+func missingTargetDatabases(intentDatabases, existing []string) []string {
+	missing := []string{}
+	for _, dbName := range intentDatabases {
+		if !util.StringSliceContains(existing, dbName) && !util.StringSliceContains(missing, dbName) {
+			missing = append(missing, dbName)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// checkTargetDatabases applies --requireExistingDatabases and
+// --createDatabases to the databases of the intents, grouped by database.
+// A database only exists once it has a collection, so with --createDatabases
+// the collections of a missing database are created with the create
+// command instead of implicitly by their first insert. It must be called
+// before the intent manager is finalized.
+func (restore *MongoRestore) checkTargetDatabases() error {
+	if !restore.OutputOptions.RequireDatabases && !restore.OutputOptions.CreateDatabases {
+		return nil
+	}
+	existing, err := restore.SessionProvider.DatabaseNames()
+	if err != nil {
+		return fmt.Errorf("error listing databases: %v", err)
+	}
+	intentDatabases := []string{}
+	err = restore.manager.ForEach(func(intent *intents.Intent) error {
+		intentDatabases = append(intentDatabases, intent.DB)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	missing := missingTargetDatabases(intentDatabases, existing)
+	if len(missing) == 0 {
+		return nil
+	}
+
+	if restore.OutputOptions.RequireDatabases {
+		return fmt.Errorf("--requireExistingDatabases is set, but %v database(s) do not exist on the target: %v",
+			len(missing), strings.Join(missing, ", "))
+	}
+	restore.createdDatabases = map[string]bool{}
+	for _, dbName := range missing {
+		log.Logf(log.Always, "database %v does not exist; its collections will be created explicitly", dbName)
+		restore.createdDatabases[dbName] = true
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestMissingTargetDatabases(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With intents in several databases", t, func() {
+		intentDatabases := []string{"sales", "hr", "sales", "archive", "hr"}
+
+		Convey("each missing database is listed once, in order", func() {
+			missing := missingTargetDatabases(intentDatabases, []string{"admin", "hr", "local"})
+			So(missing, ShouldResemble, []string{"archive", "sales"})
+		})
+
+		Convey("nothing is missing when every database exists", func() {
+			missing := missingTargetDatabases(intentDatabases, []string{"archive", "hr", "sales"})
+			So(missing, ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,258 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/progress"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// documentKey returns the encoded _id of a raw document.
+func documentKey(doc []byte) (string, error) {
+	idDoc := struct {
+		ID bson.Raw `bson:"_id"`
+	}{}
+	if err := bson.Unmarshal(doc, &idDoc); err != nil {
+		return "", err
+	}
+	if idDoc.ID.Kind == 0 {
+		return "", fmt.Errorf("document has no _id")
+	}
+	return string(append([]byte{idDoc.ID.Kind}, idDoc.ID.Data...)), nil
+}
+
+// keyToID decodes an encoded _id back into its value.
+func keyToID(key string) (interface{}, error) {
+	var id interface{}
+	raw := bson.Raw{Kind: key[0], Data: []byte(key[1:])}
+	if err := raw.Unmarshal(&id); err != nil {
+		return nil, fmt.Errorf("error decoding _id: %v", err)
+	}
+	return id, nil
+}
+
+// basePath returns the path of the file in the --diffAgainst directory
+// that corresponds to the given dump file.
+func (restore *MongoRestore) basePath(path string) (string, error) {
+	return restore.counterpartPath(path, restore.InputOptions.DiffAgainst)
+}
+
+// counterpartPath returns the path of the file in another dump directory
+// that corresponds to the given dump file, which must be within the main
+// directory or one of the --extraDir directories.
+func (restore *MongoRestore) counterpartPath(path, otherDir string) (string, error) {
+	dirs := append([]string{restore.TargetDirectory}, restore.InputOptions.ExtraDirs...)
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(dir, path)
+		if err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.Join(otherDir, rel), nil
+		}
+	}
+	return "", fmt.Errorf("%v is not within the restore directories", path)
+}
+
+// sortBaseFile sorts the documents of the --diffAgainst counterpart of the
+// intent's BSON file by _id. A collection missing from the base dump gives
+// an empty stream, so that all of its documents are restored.
+func (restore *MongoRestore) sortBaseFile(intent *intents.Intent) (diffStream, error) {
+	path, err := restore.basePath(intent.BSONPath)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		log.Logf(log.Info, "\tno base file %v, so all documents are new", path)
+		return emptyDiffStream{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var source io.ReadCloser = file
+	if isGzipped(path) {
+		if source, err = newGzipDumpFile(file); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("error decompressing base file %v: %v", path, err)
+		}
+	}
+	if _, fileType := GetInfoFromFilename(path); fileType == JSONFileType {
+		source = newJSONToBSONReader(source)
+	}
+	bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(source))
+	defer bsonSource.Close()
+	log.Logf(log.Info, "\tsorting base file %v", path)
+	sorter := newDiffSorter(false)
+	defer sorter.close()
+	doc := bson.Raw{}
+	for bsonSource.Next(&doc) {
+		if err = sorter.add(doc.Data); err != nil {
+			return nil, fmt.Errorf("error reading base file %v: %v", path, err)
+		}
+	}
+	if err = bsonSource.Err(); err != nil {
+		return nil, fmt.Errorf("error reading base file %v: %v", path, err)
+	}
+	return sorter.sorted()
+}
+
+// joinDiff walks the base and current streams, both sorted by key, together.
+// It calls changed with each record of current that is missing from base or
+// has a different hash, along with whether base has it, and removed with
+// each record of base missing from current. It returns the number of
+// records that are the same in both.
+func joinDiff(base, current diffStream, changed func(record *diffRecord, inBase bool) error,
+	removed func(record *diffRecord) error) (int, error) {
+
+	unchanged := 0
+	baseRecord, err := base.next()
+	if err != nil {
+		return 0, err
+	}
+	currentRecord, err := current.next()
+	if err != nil {
+		return 0, err
+	}
+	for baseRecord != nil || currentRecord != nil {
+		switch {
+		case baseRecord == nil || (currentRecord != nil && currentRecord.key < baseRecord.key):
+			err = changed(currentRecord, false)
+			if err == nil {
+				currentRecord, err = current.next()
+			}
+		case currentRecord == nil || baseRecord.key < currentRecord.key:
+			err = removed(baseRecord)
+			if err == nil {
+				baseRecord, err = base.next()
+			}
+		default:
+			if baseRecord.hash == currentRecord.hash {
+				unchanged++
+			} else {
+				err = changed(currentRecord, true)
+			}
+			if err == nil {
+				baseRecord, err = base.next()
+			}
+			if err == nil {
+				currentRecord, err = current.next()
+			}
+		}
+		if err != nil {
+			return unchanged, err
+		}
+	}
+	return unchanged, nil
+}
+
+// RestoreCollectionDiff applies the difference between the intent's base
+// dump and bsonSource to the collection, which must already hold the base
+// dump's documents. Documents that are new or changed are upserted by _id,
+// documents missing from bsonSource are removed, and unchanged documents are
+// not sent to the server at all. Both files are sorted by _id, on disk if
+// they do not fit in memory, and then compared in one pass, and the writes
+// are sent in batches.
+func (restore *MongoRestore) RestoreCollectionDiff(intent *intents.Intent,
+	bsonSource *db.DecodedBSONSource, fileSize int64) error {
+
+	base, err := restore.sortBaseFile(intent)
+	if err != nil {
+		return err
+	}
+	defer base.close()
+
+	session, err := restore.sessionProviderFor(intent.DB).GetSession()
+	if err != nil {
+		return fmt.Errorf("error establishing connection: %v", err)
+	}
+	namespace := intent.Namespace()
+	session.SetSafe(restore.safetyFor(namespace))
+	session.SetSocketTimeout(0)
+	defer session.Close()
+	collection := session.DB(intent.DB).C(intent.C)
+
+	watchProgressor := restore.newBytesProgressor(namespace, fileSize)
+	bar := &progress.Bar{
+		Name:      namespace,
+		Watching:  watchProgressor,
+		BarLength: progressBarLength,
+		IsBytes:   true,
+	}
+	restore.progressManager.Attach(bar)
+	defer restore.progressManager.Detach(bar)
+
+	sorter := newDiffSorter(true)
+	defer sorter.close()
+	doc := bson.Raw{}
+	for bsonSource.Next(&doc) {
+		watchProgressor.Inc(int64(len(doc.Data)))
+		if err = sorter.add(doc.Data); err != nil {
+			return err
+		}
+	}
+	if err = bsonSource.Err(); err != nil {
+		return fmt.Errorf("reading bson input: %v", err)
+	}
+	current, err := sorter.sorted()
+	if err != nil {
+		return err
+	}
+	defer current.close()
+
+	bulk := db.NewBufferedBulkUpdater(collection, restore.ToolOptions.BulkBufferSize, false)
+	bulk.SetRetryPolicy(restore.retryLimit(), restore.retryBackoff())
+	remove := func(key string) error {
+		id, err := keyToID(key)
+		if err != nil {
+			return err
+		}
+		if err = bulk.Remove(bson.D{{"_id", id}}); err != nil {
+			return fmt.Errorf("error removing documents: %v", err)
+		}
+		return nil
+	}
+
+	var upserted, removed int
+	unchanged, err := joinDiff(base, current,
+		func(record *diffRecord, inBase bool) error {
+			transformed, err := restore.applyTransforms(record.doc)
+			if err != nil {
+				return err
+			}
+			if transformed == nil {
+				// dropped by a transform, so it is removed if the base had it
+				if !inBase {
+					return nil
+				}
+				removed++
+				return remove(record.key)
+			}
+			id, err := keyToID(record.key)
+			if err != nil {
+				return err
+			}
+			if err = bulk.Upsert(bson.D{{"_id", id}}, bson.Raw{Kind: 0x03, Data: transformed}); err != nil {
+				return fmt.Errorf("error upserting documents: %v", err)
+			}
+			upserted++
+			return nil
+		},
+		func(record *diffRecord) error {
+			removed++
+			return remove(record.key)
+		})
+	if err == nil {
+		err = bulk.Flush()
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Logf(log.Always, "applied diff to %v: %v document(s) upserted, %v removed, %v unchanged",
+		namespace, upserted, removed, unchanged)
+	return nil
+}
@@ -0,0 +1,197 @@
+package mongorestore
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// streamRecords reads every record of a diff stream.
+func streamRecords(stream diffStream) []*diffRecord {
+	records := []*diffRecord{}
+	for {
+		record, err := stream.next()
+		So(err, ShouldBeNil)
+		if record == nil {
+			return records
+		}
+		records = append(records, record)
+	}
+}
+
+func TestDiffAgainstBase(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With documents from a base dump", t, func() {
+		docs := []bson.D{
+			{{"_id", 1}, {"a", "x"}},
+			{{"_id", "one"}, {"a", "y"}},
+			{{"_id", bson.ObjectIdHex("56d9d8c6fbd1bc0bc9d56d5c")}, {"a", "z"}},
+		}
+		raw := []byte{}
+		for _, doc := range docs {
+			data, err := bson.Marshal(doc)
+			So(err, ShouldBeNil)
+			raw = append(raw, data...)
+		}
+
+		Convey("each _id should survive encoding as a key", func() {
+			for _, doc := range docs {
+				data, err := bson.Marshal(doc)
+				So(err, ShouldBeNil)
+				key, err := documentKey(data)
+				So(err, ShouldBeNil)
+				id, err := keyToID(key)
+				So(err, ShouldBeNil)
+				So(id, ShouldEqual, doc[0].Value)
+			}
+		})
+
+		Convey("equal _id values of different types should have different keys", func() {
+			intDoc, _ := bson.Marshal(bson.D{{"_id", 1}})
+			stringDoc, _ := bson.Marshal(bson.D{{"_id", "1"}})
+			intKey, _ := documentKey(intDoc)
+			stringKey, _ := documentKey(stringDoc)
+			So(intKey, ShouldNotEqual, stringKey)
+		})
+
+		Convey("documents without an _id should be rejected", func() {
+			data, _ := bson.Marshal(bson.D{{"a", 1}})
+			_, err := documentKey(data)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("the sorted records should hash every document by _id", func() {
+			source := db.NewDecodedBSONSource(db.NewBSONSource(ioutil.NopCloser(bytes.NewReader(raw))))
+			sorter := newDiffSorter(false)
+			doc := bson.Raw{}
+			for source.Next(&doc) {
+				So(sorter.add(doc.Data), ShouldBeNil)
+			}
+			stream, err := sorter.sorted()
+			So(err, ShouldBeNil)
+			defer stream.close()
+			records := streamRecords(stream)
+			So(len(records), ShouldEqual, 3)
+
+			data, _ := bson.Marshal(docs[1])
+			key, _ := documentKey(data)
+			for _, record := range records {
+				if record.key == key {
+					So(record.hash, ShouldEqual, sha1.Sum(data))
+					changed, _ := bson.Marshal(bson.D{{"_id", "one"}, {"a", "changed"}})
+					So(record.hash, ShouldNotEqual, sha1.Sum(changed))
+				}
+				So(record.doc, ShouldBeNil)
+			}
+		})
+	})
+
+	Convey("With more documents than fit in one sorted run", t, func() {
+		sorter := newDiffSorter(true)
+		sorter.runBytes = 1000
+		for _, i := range rand.Perm(500) {
+			data, err := bson.Marshal(bson.D{{"_id", fmt.Sprintf("%05d", i)}, {"n", i}})
+			So(err, ShouldBeNil)
+			So(sorter.add(data), ShouldBeNil)
+		}
+		So(len(sorter.runs), ShouldBeGreaterThan, 10)
+		dir := sorter.dir
+
+		Convey("the runs should be merged in order of _id", func() {
+			stream, err := sorter.sorted()
+			So(err, ShouldBeNil)
+			records := streamRecords(stream)
+			So(len(records), ShouldEqual, 500)
+			for i, record := range records {
+				doc := struct {
+					ID string `bson:"_id"`
+					N  int    `bson:"n"`
+				}{}
+				So(bson.Unmarshal(record.doc, &doc), ShouldBeNil)
+				So(doc.N, ShouldEqual, i)
+				So(record.hash, ShouldEqual, sha1.Sum(record.doc))
+			}
+
+			Convey("and removed once the stream is closed", func() {
+				So(sorter.close(), ShouldBeNil)
+				_, err := os.Stat(dir)
+				So(err, ShouldBeNil)
+				So(stream.close(), ShouldBeNil)
+				_, err = os.Stat(dir)
+				So(os.IsNotExist(err), ShouldBeTrue)
+			})
+		})
+
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+	})
+
+	Convey("With a base and a current dump sorted by _id", t, func() {
+		record := func(key, content string) *diffRecord {
+			return &diffRecord{key: key, hash: sha1.Sum([]byte(content))}
+		}
+		base := &memoryDiffStream{records: []*diffRecord{
+			record("a", "1"), record("b", "1"), record("d", "1"), record("e", "1"),
+		}}
+		current := &memoryDiffStream{records: []*diffRecord{
+			record("b", "1"), record("c", "1"), record("d", "2"), record("f", "1"),
+		}}
+
+		Convey("joining them should find new, changed and removed documents", func() {
+			changed, removed := []string{}, []string{}
+			unchanged, err := joinDiff(base, current,
+				func(record *diffRecord, inBase bool) error {
+					changed = append(changed, fmt.Sprintf("%v:%v", record.key, inBase))
+					return nil
+				},
+				func(record *diffRecord) error {
+					removed = append(removed, record.key)
+					return nil
+				})
+			So(err, ShouldBeNil)
+			So(unchanged, ShouldEqual, 1)
+			So(changed, ShouldResemble, []string{"c:false", "d:true", "f:false"})
+			So(removed, ShouldResemble, []string{"a", "e"})
+		})
+
+		Convey("an error should stop the join", func() {
+			_, err := joinDiff(base, current,
+				func(record *diffRecord, inBase bool) error { return nil },
+				func(record *diffRecord) error { return fmt.Errorf("stop at %v", record.key) })
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "stop at a")
+		})
+	})
+
+	Convey("With a restore of dump/ diffed against base/", t, func() {
+		restore := &MongoRestore{
+			TargetDirectory: "dump",
+			InputOptions:    &InputOptions{DiffAgainst: "base", ExtraDirs: []string{"/disk2/dump"}},
+		}
+
+		Convey("files should map to the same place in the base directory", func() {
+			path, err := restore.basePath(filepath.Join("dump", "db", "c.bson"))
+			So(err, ShouldBeNil)
+			So(path, ShouldEqual, filepath.Join("base", "db", "c.bson"))
+			path, err = restore.basePath(filepath.Join("/disk2/dump", "db", "d.bson"))
+			So(err, ShouldBeNil)
+			So(path, ShouldEqual, filepath.Join("base", "db", "d.bson"))
+		})
+
+		Convey("files outside the restore directories should be rejected", func() {
+			_, err := restore.basePath(filepath.Join("elsewhere", "c.bson"))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
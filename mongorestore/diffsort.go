@@ -0,0 +1,301 @@
+package mongorestore
+
+import (
+	"bufio"
+	"container/heap"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// diffRunBytes bounds the memory used to sort the documents of a file by
+// _id for --diffAgainst: records are sorted this many bytes at a time, and
+// each sorted run is written to a temporary file to be merged with the
+// others.
+const diffRunBytes = 64 * 1024 * 1024
+
+// diffRecord is a document of a file being diffed, identified by its
+// encoded _id and a hash of its contents.
+type diffRecord struct {
+	key  string
+	hash [sha1.Size]byte
+	// the whole document, only kept for the dump being restored
+	doc []byte
+}
+
+func (record *diffRecord) size() int {
+	return len(record.key) + len(record.hash) + len(record.doc) + 64
+}
+
+type byDiffKey []*diffRecord
+
+func (records byDiffKey) Len() int           { return len(records) }
+func (records byDiffKey) Swap(i, j int)      { records[i], records[j] = records[j], records[i] }
+func (records byDiffKey) Less(i, j int) bool { return records[i].key < records[j].key }
+
+// diffStream returns records in order of their keys.
+type diffStream interface {
+	// next returns the next record, or nil at the end of the stream.
+	next() (*diffRecord, error)
+	close() error
+}
+
+// diffSorter sorts the documents of a file by encoded _id, with an external
+// merge sort once they take more than runBytes of memory.
+type diffSorter struct {
+	keepDocs bool
+	runBytes int
+
+	records []*diffRecord
+	bytes   int
+	// temporary directory of the sorted runs, created for the first one
+	dir  string
+	runs []string
+}
+
+func newDiffSorter(keepDocs bool) *diffSorter {
+	return &diffSorter{keepDocs: keepDocs, runBytes: diffRunBytes}
+}
+
+// add records a raw document. The document is copied if it is kept.
+func (sorter *diffSorter) add(doc []byte) error {
+	key, err := documentKey(doc)
+	if err != nil {
+		return err
+	}
+	record := &diffRecord{key: key, hash: sha1.Sum(doc)}
+	if sorter.keepDocs {
+		record.doc = append([]byte(nil), doc...)
+	}
+	sorter.records = append(sorter.records, record)
+	sorter.bytes += record.size()
+	if sorter.bytes >= sorter.runBytes {
+		return sorter.writeRun()
+	}
+	return nil
+}
+
+// writeRun sorts the records in memory and writes them to a new run file.
+func (sorter *diffSorter) writeRun() error {
+	if sorter.dir == "" {
+		dir, err := ioutil.TempDir("", "mongorestore-diff-")
+		if err != nil {
+			return fmt.Errorf("error creating temporary directory to sort documents: %v", err)
+		}
+		sorter.dir = dir
+	}
+	sort.Stable(byDiffKey(sorter.records))
+	path := filepath.Join(sorter.dir, fmt.Sprintf("run%v", len(sorter.runs)))
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error writing sorted documents: %v", err)
+	}
+	writer := bufio.NewWriter(file)
+	for _, record := range sorter.records {
+		if err = writeDiffRecord(writer, record); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing sorted documents to %v: %v", path, err)
+	}
+	sorter.runs = append(sorter.runs, path)
+	sorter.records = nil
+	sorter.bytes = 0
+	return nil
+}
+
+// sorted returns a stream of all the records added, sorted by key. Nothing
+// may be added after it is called.
+func (sorter *diffSorter) sorted() (diffStream, error) {
+	if len(sorter.runs) == 0 {
+		sort.Stable(byDiffKey(sorter.records))
+		return &memoryDiffStream{records: sorter.records}, nil
+	}
+	if len(sorter.records) > 0 {
+		if err := sorter.writeRun(); err != nil {
+			return nil, err
+		}
+	}
+	merged := &mergedDiffStream{dir: sorter.dir}
+	for _, path := range sorter.runs {
+		run, err := openDiffRun(path)
+		if err == nil {
+			err = merged.push(run)
+		}
+		if err != nil {
+			merged.close()
+			return nil, err
+		}
+	}
+	// the stream now owns the runs
+	sorter.dir = ""
+	return merged, nil
+}
+
+// close removes the sorted runs, unless a stream of them was returned by
+// sorted, which removes them when it is closed.
+func (sorter *diffSorter) close() error {
+	if sorter.dir == "" {
+		return nil
+	}
+	return os.RemoveAll(sorter.dir)
+}
+
+// writeDiffRecord writes a record of a run: the length of its key, the key,
+// the hash, the length of the document and the document.
+func writeDiffRecord(writer *bufio.Writer, record *diffRecord) error {
+	lengthBuf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(lengthBuf, uint64(len(record.key)))
+	writer.Write(lengthBuf[:n])
+	writer.WriteString(record.key)
+	writer.Write(record.hash[:])
+	n = binary.PutUvarint(lengthBuf, uint64(len(record.doc)))
+	writer.Write(lengthBuf[:n])
+	_, err := writer.Write(record.doc)
+	return err
+}
+
+// diffRun reads back the records of a run file.
+type diffRun struct {
+	file    *os.File
+	reader  *bufio.Reader
+	current *diffRecord
+}
+
+func openDiffRun(path string) (*diffRun, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading sorted documents: %v", err)
+	}
+	return &diffRun{file: file, reader: bufio.NewReader(file)}, nil
+}
+
+// advance reads the run's next record into current, which is nil at the
+// end of the run.
+func (run *diffRun) advance() error {
+	run.current = nil
+	keyLength, err := binary.ReadUvarint(run.reader)
+	if err == io.EOF {
+		return nil
+	}
+	record := &diffRecord{}
+	key := make([]byte, keyLength)
+	if err == nil {
+		_, err = io.ReadFull(run.reader, key)
+	}
+	if err == nil {
+		_, err = io.ReadFull(run.reader, record.hash[:])
+	}
+	var docLength uint64
+	if err == nil {
+		docLength, err = binary.ReadUvarint(run.reader)
+	}
+	if err == nil && docLength > 0 {
+		record.doc = make([]byte, docLength)
+		_, err = io.ReadFull(run.reader, record.doc)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading sorted documents from %v: %v", run.file.Name(), err)
+	}
+	record.key = string(key)
+	run.current = record
+	return nil
+}
+
+// memoryDiffStream is a stream of records that fit in memory.
+type memoryDiffStream struct {
+	records []*diffRecord
+}
+
+func (stream *memoryDiffStream) next() (*diffRecord, error) {
+	if len(stream.records) == 0 {
+		return nil, nil
+	}
+	record := stream.records[0]
+	stream.records = stream.records[1:]
+	return record, nil
+}
+
+func (stream *memoryDiffStream) close() error {
+	stream.records = nil
+	return nil
+}
+
+// mergedDiffStream merges sorted runs, as a heap of the runs ordered by
+// their current records. Closing it removes the runs' directory.
+type mergedDiffStream struct {
+	dir  string
+	runs []*diffRun
+}
+
+func (stream *mergedDiffStream) Len() int { return len(stream.runs) }
+func (stream *mergedDiffStream) Less(i, j int) bool {
+	return stream.runs[i].current.key < stream.runs[j].current.key
+}
+func (stream *mergedDiffStream) Swap(i, j int) {
+	stream.runs[i], stream.runs[j] = stream.runs[j], stream.runs[i]
+}
+func (stream *mergedDiffStream) Push(x interface{}) { stream.runs = append(stream.runs, x.(*diffRun)) }
+func (stream *mergedDiffStream) Pop() interface{} {
+	last := stream.runs[len(stream.runs)-1]
+	stream.runs = stream.runs[:len(stream.runs)-1]
+	return last
+}
+
+// push reads the first record of the run and adds it to the heap, unless
+// the run is empty.
+func (stream *mergedDiffStream) push(run *diffRun) error {
+	if err := run.advance(); err != nil {
+		run.file.Close()
+		return err
+	}
+	if run.current == nil {
+		return run.file.Close()
+	}
+	heap.Push(stream, run)
+	return nil
+}
+
+func (stream *mergedDiffStream) next() (*diffRecord, error) {
+	if len(stream.runs) == 0 {
+		return nil, nil
+	}
+	run := stream.runs[0]
+	record := run.current
+	if err := run.advance(); err != nil {
+		return nil, err
+	}
+	if run.current == nil {
+		heap.Pop(stream)
+		run.file.Close()
+	} else {
+		heap.Fix(stream, 0)
+	}
+	return record, nil
+}
+
+func (stream *mergedDiffStream) close() error {
+	for _, run := range stream.runs {
+		run.file.Close()
+	}
+	stream.runs = nil
+	return os.RemoveAll(stream.dir)
+}
+
+// emptyDiffStream is the stream of a file that does not exist.
+type emptyDiffStream struct{}
+
+func (emptyDiffStream) next() (*diffRecord, error) { return nil, nil }
+func (emptyDiffStream) close() error               { return nil }
@@ -0,0 +1,154 @@
+package mongorestore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// checkServerBeforeDrop implements --checkServerBeforeDrop by checking
+// every existing collection that --drop would drop with checkBeforeDrop. It
+// runs before any intent is restored, so that a refusal leaves the target
+// as it was.
+func (restore *MongoRestore) checkServerBeforeDrop() error {
+	if !restore.OutputOptions.CheckServerBeforeDrop || restore.OutputOptions.AssumeEmptyTarget {
+		return nil
+	}
+	return restore.manager.ForEach(func(intent *intents.Intent) error {
+		// system collections are not dropped
+		if strings.HasPrefix(intent.C, "system.") {
+			return nil
+		}
+		exists, err := restore.CollectionExists(intent)
+		if err != nil {
+			return fmt.Errorf("error reading database: %v", err)
+		}
+		if !exists {
+			return nil
+		}
+		return restore.checkBeforeDrop(intent)
+	})
+}
+
+// checkBeforeDrop counts the documents of a collection on the server and in
+// the dump, and returns an error if the server has more than
+// --dropCheckFactor times as many, as when an old or partial dump is
+// restored over current data by mistake. With --force the difference is
+// only logged.
+func (restore *MongoRestore) checkBeforeDrop(intent *intents.Intent) error {
+	if intent.BSONPath == "" {
+		return nil
+	}
+	if restore.useStdin {
+		if restore.OutputOptions.Force {
+			log.Logf(log.Always, "warning: cannot count the documents of %v read from stdin, "+
+				"dropping it without --checkServerBeforeDrop because of --force", intent.Namespace())
+			return nil
+		}
+		return fmt.Errorf("cannot check %v before dropping it, because documents read from stdin "+
+			"cannot be counted in advance; use --force to drop it anyway", intent.Namespace())
+	}
+
+	dumpCount, err := restore.countDumpDocuments(intent.BSONPath)
+	if err != nil {
+		return fmt.Errorf("error counting documents in %v: %v", intent.BSONPath, err)
+	}
+	session, err := restore.sessionProviderFor(intent.DB).GetSession()
+	if err != nil {
+		return fmt.Errorf("error establishing connection: %v", err)
+	}
+	defer session.Close()
+	serverCount, err := session.DB(intent.DB).C(intent.C).Count()
+	if err != nil {
+		return fmt.Errorf("error counting documents in %v: %v", intent.Namespace(), err)
+	}
+	log.Logf(log.DebugLow, "%v has %v documents on the server and %v in the dump",
+		intent.Namespace(), serverCount, dumpCount)
+
+	if !dropWouldShrink(serverCount, dumpCount, restore.OutputOptions.DropCheckFactor) {
+		return nil
+	}
+	message := fmt.Sprintf("%v has %v documents on the server, more than %v times the %v in %v",
+		intent.Namespace(), serverCount, restore.OutputOptions.DropCheckFactor, dumpCount, intent.BSONPath)
+	if restore.OutputOptions.Force {
+		log.Logf(log.Always, "warning: %v; dropping it anyway because of --force", message)
+		return nil
+	}
+	return fmt.Errorf("refusing to drop %v: %v; check that the dump is the one you meant to restore, "+
+		"or use --force to drop it anyway", intent.Namespace(), message)
+}
+
+// dropWouldShrink returns true if replacing serverCount documents with
+// dumpCount documents would shrink the collection by more than factor.
+func dropWouldShrink(serverCount, dumpCount int, factor float64) bool {
+	return float64(serverCount) > factor*float64(dumpCount)
+}
+
+// countDumpDocuments returns the number of documents in a .bson file, or in
+// a .json file once converted, without decoding them.
+func (restore *MongoRestore) countDumpDocuments(path string) (int, error) {
+	source, err := restore.openDumpFile(path)
+	if err != nil {
+		return 0, err
+	}
+	if _, fileType := GetInfoFromFilename(path); fileType == JSONFileType {
+		source = newJSONToBSONReader(source)
+	}
+	defer source.Close()
+	return countBSONDocuments(source)
+}
+
+// countBSONDocuments returns the number of documents in a BSON stream. The
+// documents are skipped over with Seek if the source supports it. Since a
+// seek past the end of a file succeeds, each one is checked against the
+// file's size, so that a truncated last document is an error.
+func countBSONDocuments(source io.Reader) (int, error) {
+	seeker, canSeek := source.(io.Seeker)
+	var end int64
+	if canSeek {
+		start, err := seeker.Seek(0, os.SEEK_CUR)
+		if err == nil {
+			end, err = seeker.Seek(0, os.SEEK_END)
+		}
+		if err == nil {
+			_, err = seeker.Seek(start, os.SEEK_SET)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error finding the size of the file: %v", err)
+		}
+	}
+	count := 0
+	header := make([]byte, 4)
+	for {
+		_, err := io.ReadFull(source, header)
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error reading document #%v: %v", count+1, err)
+		}
+		size := int64(binary.LittleEndian.Uint32(header))
+		if size < 5 || size > db.MaxBSONSize {
+			return 0, fmt.Errorf("invalid BSONSize: %v bytes", size)
+		}
+		if canSeek {
+			var offset int64
+			offset, err = seeker.Seek(size-4, os.SEEK_CUR)
+			if err == nil && offset > end {
+				err = io.ErrUnexpectedEOF
+			}
+		} else {
+			_, err = io.CopyN(ioutil.Discard, source, size-4)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error reading document #%v: %v", count+1, err)
+		}
+		count++
+	}
+}
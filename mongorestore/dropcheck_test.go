@@ -0,0 +1,145 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	commonOpts "github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDropWouldShrink(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("A server collection much larger than the dump should be protected", t, func() {
+		So(dropWouldShrink(1000, 10, 10), ShouldBeTrue)
+		So(dropWouldShrink(1, 0, 10), ShouldBeTrue)
+	})
+
+	Convey("A server collection within the factor of the dump should not be", t, func() {
+		So(dropWouldShrink(100, 10, 10), ShouldBeFalse)
+		So(dropWouldShrink(0, 0, 10), ShouldBeFalse)
+		So(dropWouldShrink(15, 10, 1.5), ShouldBeFalse)
+	})
+}
+
+func TestCountDumpDocuments(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	restore := &MongoRestore{InputOptions: &InputOptions{}}
+
+	Convey("Documents should be counted in BSON and JSON files", t, func() {
+		count, err := restore.countDumpDocuments("testdata/auth_version_3.bson")
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 1)
+		count, err = restore.countDumpDocuments("testdata/mixeddirs/db1/c1.json")
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 2)
+		count, err = restore.countDumpDocuments("testdata/mixeddirs/db1/c1.bson")
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 0)
+	})
+
+	Convey("A missing file should be an error", t, func() {
+		_, err := restore.countDumpDocuments("testdata/mixeddirs/db1/missing.bson")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("A file whose last document is cut short should be an error", t, func() {
+		dir, err := ioutil.TempDir("", "mongorestore-dropcheck-")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		data := []byte{}
+		for i := 1; i <= 2; i++ {
+			raw, err := bson.Marshal(bson.D{{"_id", i}})
+			So(err, ShouldBeNil)
+			data = append(data, raw...)
+		}
+		path := filepath.Join(dir, "c.bson")
+		So(ioutil.WriteFile(path, data[:len(data)-3], 0644), ShouldBeNil)
+
+		_, err = restore.countDumpDocuments(path)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "error reading document #2")
+
+		So(ioutil.WriteFile(path, data, 0644), ShouldBeNil)
+		count, err := restore.countDumpDocuments(path)
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 2)
+	})
+}
+
+const DropCheckDB = "restore_drop_check"
+
+func TestCheckServerBeforeDrop(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.IntegrationTestType)
+
+	Convey("With a test mongorestore checking collections before dropping them", t, func() {
+		ssl := testutil.GetSSLOptions()
+		auth := testutil.GetAuthOptions()
+		toolOptions := &commonOpts.ToolOptions{
+			Connection: &commonOpts.Connection{
+				Host: "localhost",
+				Port: db.DefaultTestPort,
+			},
+			Auth:          &auth,
+			SSL:           &ssl,
+			HiddenOptions: &commonOpts.HiddenOptions{},
+		}
+		sessionProvider, err := db.NewSessionProvider(*toolOptions)
+		So(err, ShouldBeNil)
+		restore := &MongoRestore{
+			ToolOptions:  toolOptions,
+			InputOptions: &InputOptions{},
+			OutputOptions: &OutputOptions{
+				Drop:                  true,
+				CheckServerBeforeDrop: true,
+				DropCheckFactor:       10,
+			},
+			SessionProvider: sessionProvider,
+			manager:         intents.NewIntentManager(),
+		}
+		session, err := sessionProvider.GetSession()
+		So(err, ShouldBeNil)
+		session.DB(DropCheckDB).DropDatabase()
+		So(session.DB(DropCheckDB).C("small").Insert(bson.M{"_id": 1}), ShouldBeNil)
+		for i := 0; i < 50; i++ {
+			So(session.DB(DropCheckDB).C("large").Insert(bson.M{"_id": i}), ShouldBeNil)
+		}
+		// each dump holds one document
+		for _, collection := range []string{"small", "missing", "large"} {
+			restore.manager.Put(&intents.Intent{
+				DB:       DropCheckDB,
+				C:        collection,
+				BSONPath: "testdata/auth_version_3.bson",
+			})
+		}
+
+		Convey("every collection should be checked before any is dropped", func() {
+			err := restore.checkServerBeforeDrop()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, DropCheckDB+".large")
+			count, err := session.DB(DropCheckDB).C("small").Count()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+		})
+
+		Convey("--force should let the collections be dropped", func() {
+			restore.OutputOptions.Force = true
+			So(restore.checkServerBeforeDrop(), ShouldBeNil)
+		})
+
+		Reset(func() {
+			session.DB(DropCheckDB).DropDatabase()
+			session.Close()
+		})
+	})
+}
@@ -0,0 +1,50 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"strings"
+)
+
+// noteDataFile records the data file of the intent under the namespace it
+// is restored to. Only the first data file found for a namespace would be
+// restored, so any other is recorded as a duplicate, to be reported by
+// duplicateDataFilesError once the dump has been scanned.
+func (restore *MongoRestore) noteDataFile(intent *intents.Intent) {
+	if intent.BSONPath == "" || intent.BSONPath == "-" {
+		return
+	}
+	if restore.dataFilePaths == nil {
+		restore.dataFilePaths = map[string]string{}
+	}
+	namespace := intent.Namespace()
+	first, ok := restore.dataFilePaths[namespace]
+	if !ok {
+		restore.dataFilePaths[namespace] = intent.BSONPath
+		return
+	}
+	if first != intent.BSONPath {
+		restore.duplicateDataFiles = append(restore.duplicateDataFiles,
+			fmt.Sprintf("%v and %v would both be restored to %v", first, intent.BSONPath, namespace))
+	}
+}
+
+// duplicateDataFilesError returns an error listing the namespaces that more
+// than one data file in the dump would be restored to. With
+// --allowDuplicateIntents, it only warns, and the first file found for
+// each namespace is restored.
+func (restore *MongoRestore) duplicateDataFilesError() error {
+	if len(restore.duplicateDataFiles) == 0 {
+		return nil
+	}
+	if restore.InputOptions.AllowDuplicateIntents {
+		for _, duplicate := range restore.duplicateDataFiles {
+			log.Logf(log.Always, "warning: %v; only the first is restored", duplicate)
+		}
+		return nil
+	}
+	return fmt.Errorf("%v collection(s) have more than one data file in the dump "+
+		"(use --allowDuplicateIntents to restore only the first of each): %v",
+		len(restore.duplicateDataFiles), strings.Join(restore.duplicateDataFiles, "; "))
+}
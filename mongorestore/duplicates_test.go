@@ -0,0 +1,49 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	commonOpts "github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestDuplicateDataFiles(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a test MongoRestore", t, func() {
+		restore := &MongoRestore{
+			manager:      intents.NewCategorizingIntentManager(),
+			InputOptions: &InputOptions{},
+			ToolOptions:  &commonOpts.ToolOptions{Namespace: &commonOpts.Namespace{}},
+		}
+
+		Convey("scanning a directory once finds no duplicates", func() {
+			So(restore.CreateIntentsForDB("db1", "testdata/testdirs/db1"), ShouldBeNil)
+			So(restore.duplicateDataFilesError(), ShouldBeNil)
+		})
+
+		Convey("the same collection in two directories is reported", func() {
+			So(restore.CreateIntentsForDB("db1", "testdata/testdirs/db1"), ShouldBeNil)
+			So(restore.CreateIntentsForDB("db1", "testdata/testdirs/db2"), ShouldBeNil)
+			err := restore.duplicateDataFilesError()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "testdata/testdirs/db2/c1.bin")
+			So(err.Error(), ShouldContainSubstring, "db1.c1")
+
+			Convey("unless --allowDuplicateIntents is set", func() {
+				restore.InputOptions.AllowDuplicateIntents = true
+				So(restore.duplicateDataFilesError(), ShouldBeNil)
+			})
+		})
+
+		Convey("a raw system collection restored over a dumped one is reported", func() {
+			restore.rawSystemCollections = map[string]string{"admin.system.users": "db1.c1"}
+			So(restore.putRawSystemCollection(
+				&intents.Intent{DB: "admin", C: "system.users", BSONPath: "users.bson"}), ShouldBeTrue)
+			So(restore.CreateIntentsForDB("db1", "testdata/testdirs/db1"), ShouldBeNil)
+			So(restore.duplicateDataFilesError(), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,84 @@
+package mongorestore
+
+import (
+	"fmt"
+)
+
+// The error types below are returned by Restore, so that programs using
+// this package can tell failures apart without matching on messages. Each
+// keeps the message mongorestore has always printed, and Unwrap returns the
+// underlying error.
+
+// RestoreError is returned when restoring data fails after the dump has
+// been scanned. The cause is a CollectionRestoreError when the failure was
+// in a single collection.
+type RestoreError struct {
+	Cause error
+}
+
+func (e RestoreError) Error() string {
+	return fmt.Sprintf("restore error: %v", e.Cause)
+}
+
+func (e RestoreError) Unwrap() error {
+	return e.Cause
+}
+
+// CollectionRestoreError is returned when restoring a collection fails.
+type CollectionRestoreError struct {
+	Namespace string
+	Cause     error
+}
+
+func (e CollectionRestoreError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Namespace, e.Cause)
+}
+
+func (e CollectionRestoreError) Unwrap() error {
+	return e.Cause
+}
+
+// IntentScanError is returned when the dump directory cannot be scanned
+// for collections to restore.
+type IntentScanError struct {
+	Cause error
+}
+
+func (e IntentScanError) Error() string {
+	return fmt.Sprintf("error scanning filesystem: %v", e.Cause)
+}
+
+func (e IntentScanError) Unwrap() error {
+	return e.Cause
+}
+
+// AuthVersionError is returned when the auth schema versions of the dump
+// and the server cannot be read, or cannot be restored to one another.
+// Context describes the step that failed.
+type AuthVersionError struct {
+	Context string
+	Cause   error
+}
+
+func (e AuthVersionError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Context, e.Cause)
+}
+
+func (e AuthVersionError) Unwrap() error {
+	return e.Cause
+}
+
+// WriteConcernError is returned when --writeConcern or
+// --collectionWriteConcern cannot be used. Context names the option.
+type WriteConcernError struct {
+	Context string
+	Cause   error
+}
+
+func (e WriteConcernError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Context, e.Cause)
+}
+
+func (e WriteConcernError) Unwrap() error {
+	return e.Cause
+}
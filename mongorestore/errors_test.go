@@ -0,0 +1,37 @@
+package mongorestore
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestErrorTypes(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a collection that failed to restore", t, func() {
+		cause := fmt.Errorf("duplicate key")
+		err := error(RestoreError{CollectionRestoreError{"db.c", cause}})
+
+		Convey("the message should be the one mongorestore has always printed", func() {
+			So(err.Error(), ShouldEqual, "restore error: db.c: duplicate key")
+		})
+
+		Convey("the namespace and cause should be available to callers", func() {
+			var collectionErr CollectionRestoreError
+			So(errors.As(err, &collectionErr), ShouldBeTrue)
+			So(collectionErr.Namespace, ShouldEqual, "db.c")
+			So(errors.Is(err, cause), ShouldBeTrue)
+		})
+	})
+
+	Convey("Errors with a context should keep it as the message prefix", t, func() {
+		err := AuthVersionError{"error getting auth version of server", fmt.Errorf("unauthorized")}
+		So(err.Error(), ShouldEqual, "error getting auth version of server: unauthorized")
+		So(IntentScanError{fmt.Errorf("no such file")}.Error(), ShouldEqual,
+			"error scanning filesystem: no such file")
+	})
+}
@@ -0,0 +1,56 @@
+package mongorestore
+
+// EventHandler receives notifications about the lifecycle of a restore. It
+// allows applications embedding mongorestore to drive their own progress
+// reporting without scraping logs. Handlers may be called concurrently from
+// multiple restore goroutines.
+type EventHandler interface {
+	// OnCollectionStart is called before any documents are inserted into ns.
+	// expectedCount is the number of documents in the collection's BSON
+	// file if it is known without reading the file an extra time, as when
+	// --collectionChunkSize has split it, or 0 otherwise; the documents are
+	// counted as they are read, for OnCollectionDone.
+	OnCollectionStart(ns string, expectedCount int64)
+
+	// OnBatchInserted is called after each bulk insert of n documents
+	// into ns succeeds.
+	OnBatchInserted(ns string, n int)
+
+	// OnCollectionDone is called once the insertion of ns's documents ends,
+	// whether or not it succeeded, with the number of documents in batches
+	// that succeeded and failed. A failure is also reported to OnError. No
+	// OnBatchInserted for ns follows it.
+	OnCollectionDone(ns string, inserted, failed int64)
+
+	// OnIndexBuilt is called after the named index is created on ns.
+	OnIndexBuilt(ns, indexName string)
+
+	// OnError is called for errors encountered while restoring ns, including
+	// insertion errors that are logged but do not stop the restore.
+	OnError(ns string, err error)
+}
+
+// NopEventHandler is an EventHandler that ignores all events. It is used when
+// MongoRestore.Events is unset, and can be embedded by handlers that only
+// care about a subset of events.
+type NopEventHandler struct{}
+
+var _ EventHandler = NopEventHandler{}
+
+func (NopEventHandler) OnCollectionStart(string, int64)       {}
+func (NopEventHandler) OnBatchInserted(string, int)           {}
+func (NopEventHandler) OnCollectionDone(string, int64, int64) {}
+func (NopEventHandler) OnIndexBuilt(string, string)           {}
+func (NopEventHandler) OnError(string, error)                 {}
+
+// events returns the configured EventHandler, or a no-op handler if none is
+// set, wrapped by the progress stream if there is one.
+func (restore *MongoRestore) events() EventHandler {
+	if restore.progressStream != nil {
+		return restore.progressStream
+	}
+	if restore.Events == nil {
+		return NopEventHandler{}
+	}
+	return restore.Events
+}
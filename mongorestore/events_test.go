@@ -0,0 +1,117 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/db"
+	commonOpts "github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+// eventLog is an EventHandler that records the events it receives.
+type eventLog struct {
+	sync.Mutex
+	starts   map[string]int64
+	done     map[string][2]int64
+	errors   map[string]int
+	inserted int
+}
+
+func newEventLog() *eventLog {
+	return &eventLog{starts: map[string]int64{}, done: map[string][2]int64{}, errors: map[string]int{}}
+}
+
+func (events *eventLog) OnCollectionStart(ns string, expectedCount int64) {
+	events.Lock()
+	defer events.Unlock()
+	events.starts[ns] = expectedCount
+}
+
+func (events *eventLog) OnBatchInserted(ns string, n int) {
+	events.Lock()
+	defer events.Unlock()
+	events.inserted += n
+}
+
+func (events *eventLog) OnCollectionDone(ns string, inserted, failed int64) {
+	events.Lock()
+	defer events.Unlock()
+	events.done[ns] = [2]int64{inserted, failed}
+}
+
+func (events *eventLog) OnIndexBuilt(ns, indexName string) {}
+
+func (events *eventLog) OnError(ns string, err error) {
+	events.Lock()
+	defer events.Unlock()
+	events.errors[ns]++
+}
+
+const EventsDB = "restore_events"
+
+func TestRestoreEvents(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.IntegrationTestType)
+
+	Convey("With a test mongorestore reporting events", t, func() {
+		ssl := testutil.GetSSLOptions()
+		auth := testutil.GetAuthOptions()
+		toolOptions := &commonOpts.ToolOptions{
+			Connection: &commonOpts.Connection{
+				Host: "localhost",
+				Port: db.DefaultTestPort,
+			},
+			Auth:          &auth,
+			SSL:           &ssl,
+			HiddenOptions: &commonOpts.HiddenOptions{},
+		}
+		sessionProvider, err := db.NewSessionProvider(*toolOptions)
+		So(err, ShouldBeNil)
+		events := newEventLog()
+		restore := &MongoRestore{
+			ToolOptions:     toolOptions,
+			InputOptions:    &InputOptions{},
+			OutputOptions:   &OutputOptions{NumInsertionWorkers: 1},
+			SessionProvider: sessionProvider,
+			Events:          events,
+			progressManager: progress.NewProgressBarManager(ioutil.Discard, time.Second),
+		}
+		session, err := sessionProvider.GetSession()
+		So(err, ShouldBeNil)
+		session.DB(EventsDB).DropDatabase()
+
+		Convey("a restored collection should report its document count", func() {
+			data := &bytes.Buffer{}
+			for i := 1; i <= 3; i++ {
+				raw, err := bson.Marshal(bson.D{{"_id", i}})
+				So(err, ShouldBeNil)
+				data.Write(raw)
+			}
+			source := db.NewDecodedBSONSource(db.NewBSONSource(ioutil.NopCloser(data)))
+			So(restore.restoreDocuments(EventsDB, "c", source, int64(data.Len()), 3), ShouldBeNil)
+			So(events.starts[EventsDB+".c"], ShouldEqual, 3)
+			So(events.done[EventsDB+".c"], ShouldResemble, [2]int64{3, 0})
+		})
+
+		Convey("a failed restore should still report that the collection is done", func() {
+			// a document size larger than the data that follows it
+			data := bytes.NewBuffer([]byte{0x40, 0, 0, 0, 0x0a})
+			source := db.NewDecodedBSONSource(db.NewBSONSource(ioutil.NopCloser(data)))
+			So(restore.RestoreCollectionToDB(EventsDB, "broken", source, 5), ShouldNotBeNil)
+			_, started := events.starts[EventsDB+".broken"]
+			So(started, ShouldBeTrue)
+			So(events.done[EventsDB+".broken"], ShouldResemble, [2]int64{0, 0})
+		})
+
+		Reset(func() {
+			session.DB(EventsDB).DropDatabase()
+			session.Close()
+		})
+	})
+}
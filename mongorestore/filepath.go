@@ -19,6 +19,8 @@ const (
 	UnknownFileType FileType = iota
 	BSONFileType
 	MetadataFileType
+	JSONFileType
+	IndexesFileType
 )
 
 // GetInfoFromFilename pulls the base collection name and FileType from a given file.
@@ -30,6 +32,10 @@ func GetInfoFromFilename(filename string) (string, FileType) {
 		// "x.metadata.json" is a valid collection name
 		baseName := strings.TrimSuffix(baseFileName, ".metadata.json")
 		return baseName, MetadataFileType
+	case strings.HasSuffix(baseFileName, ".indexes.json"):
+		// index definitions written by mongodump --dumpIndexesSeparately
+		baseName := strings.TrimSuffix(baseFileName, ".indexes.json")
+		return baseName, IndexesFileType
 	case strings.HasSuffix(baseFileName, ".bin"):
 		// .bin supported for legacy reasons
 		baseName := strings.TrimSuffix(baseFileName, ".bin")
@@ -37,6 +43,14 @@ func GetInfoFromFilename(filename string) (string, FileType) {
 	case strings.HasSuffix(baseFileName, ".bson"):
 		baseName := strings.TrimSuffix(baseFileName, ".bson")
 		return baseName, BSONFileType
+	case strings.HasSuffix(baseFileName, ".bson.gz"):
+		// compressed with gzip, as written by mongodump --gzip
+		baseName := strings.TrimSuffix(baseFileName, ".bson.gz")
+		return baseName, BSONFileType
+	case strings.HasSuffix(baseFileName, ".json"):
+		// extended JSON, as written by mongoexport
+		baseName := strings.TrimSuffix(baseFileName, ".json")
+		return baseName, JSONFileType
 	default:
 		return "", UnknownFileType
 	}
@@ -53,6 +67,11 @@ func (restore *MongoRestore) CreateAllIntents(dumpDir string) error {
 	}
 	for _, entry := range entries {
 		if entry.IsDir() {
+			if restore.configServerMode && entry.Name() != "config" {
+				log.Logf(log.Always, "skipping database %v, only the config database is restored with --configsvr",
+					entry.Name())
+				continue
+			}
 			if err = util.ValidateDBName(entry.Name()); err != nil {
 				return fmt.Errorf("invalid database name '%v': %v", entry.Name(), err)
 			}
@@ -71,6 +90,8 @@ func (restore *MongoRestore) CreateAllIntents(dumpDir string) error {
 					BSONPath: filepath.Join(dumpDir, entry.Name()),
 					Size:     entry.Size(),
 				})
+			} else if entry.Name() == "oplog.metadata.json" {
+				restore.oplogMetadataPath = filepath.Join(dumpDir, entry.Name())
 			} else {
 				log.Logf(log.Always, `don't know what to do with file "%v", skipping...`,
 					filepath.Join(dumpDir, entry.Name()))
@@ -93,6 +114,8 @@ func (restore *MongoRestore) CreateIntentsForDB(db, dir string) error {
 		return fmt.Errorf("error reading db folder %v: %v", db, err)
 	}
 	usesMetadataFiles := hasMetadataFiles(entries)
+	jsonInput := restore.InputOptions != nil && restore.InputOptions.JSONInput
+	bsonCollections, jsonCollections := dataFileCollections(entries, jsonInput)
 	for _, entry := range entries {
 		if entry.IsDir() {
 			log.Logf(log.Always, `don't know what to do with subdirectory "%v", skipping...`,
@@ -101,6 +124,14 @@ func (restore *MongoRestore) CreateIntentsForDB(db, dir string) error {
 			collection, fileType := GetInfoFromFilename(entry.Name())
 			switch fileType {
 			case BSONFileType:
+				if restore.putRawSystemCollection(&intents.Intent{
+					DB:       db,
+					C:        collection,
+					Size:     entry.Size(),
+					BSONPath: filepath.Join(dir, entry.Name()),
+				}) {
+					continue
+				}
 				// Dumps of a single database (i.e. with the -d flag) may contain special
 				// db-specific collections that start with a "$" (for example, $admin.system.users
 				// holds the users for a database that was dumped with --dumpDbUsersAndRoles enabled).
@@ -111,6 +142,12 @@ func (restore *MongoRestore) CreateIntentsForDB(db, dir string) error {
 						"not restoring special collection %v.%v", db, collection)
 					continue
 				}
+				if jsonCollections[collection] && restore.preferredFormat() == "json" {
+					log.Logf(log.Always, "warning: both .bson and .json files found for %v.%v; "+
+						"ignoring %v because --preferFormat is json",
+						db, collection, filepath.Join(dir, entry.Name()))
+					continue
+				}
 				// TOOLS-717: disallow restoring to the system.profile collection.
 				// Server versions >= 3.0.3 disallow user inserts to system.profile so
 				// it would likely fail anyway.
@@ -133,16 +170,72 @@ func (restore *MongoRestore) CreateIntentsForDB(db, dir string) error {
 					BSONPath: filepath.Join(dir, entry.Name()),
 				}
 				log.Logf(log.Info, "found collection %v bson to restore", intent.Namespace())
-				restore.manager.Put(intent)
+				if err = restore.putIntent(intent); err != nil {
+					return err
+				}
+			case JSONFileType:
+				if !jsonCollections[collection] {
+					log.Logf(log.Always, `don't know what to do with file "%v", skipping `+
+						`(use --jsonInput to restore .json files as collection data)...`,
+						filepath.Join(dir, entry.Name()))
+					continue
+				}
+				// users, roles, and other special collections are only restored from BSON
+				if strings.HasPrefix(collection, "$") || strings.HasPrefix(collection, "system.") {
+					log.Logf(log.DebugLow,
+						"not restoring special collection %v.%v from json", db, collection)
+					continue
+				}
+				if bsonCollections[collection] && restore.preferredFormat() == "bson" {
+					log.Logf(log.Always, "warning: both .bson and .json files found for %v.%v; "+
+						"ignoring %v (use --preferFormat json to restore it instead)",
+						db, collection, filepath.Join(dir, entry.Name()))
+					continue
+				}
+				// the JSON file is converted to BSON as it is read, so it
+				// takes the place of the collection's BSON file
+				intent := &intents.Intent{
+					DB:       db,
+					C:        collection,
+					Size:     entry.Size(),
+					BSONPath: filepath.Join(dir, entry.Name()),
+				}
+				log.Logf(log.Info, "found collection %v json to restore", intent.Namespace())
+				if err = restore.putIntent(intent); err != nil {
+					return err
+				}
 			case MetadataFileType:
 				usesMetadataFiles = true
+				if restore.putRawSystemCollection(&intents.Intent{
+					DB:           db,
+					C:            collection,
+					MetadataPath: filepath.Join(dir, entry.Name()),
+				}) {
+					continue
+				}
 				intent := &intents.Intent{
 					DB:           db,
 					C:            collection,
 					MetadataPath: filepath.Join(dir, entry.Name()),
 				}
 				log.Logf(log.Info, "found collection %v metadata to restore", intent.Namespace())
-				restore.manager.Put(intent)
+				if !bsonCollections[collection] && !jsonCollections[collection] {
+					log.Logf(log.DebugLow, "collection %v has no data file, so it will be created empty",
+						intent.Namespace())
+				}
+				if err = restore.putIntent(intent); err != nil {
+					return err
+				}
+			case IndexesFileType:
+				intent := &intents.Intent{
+					DB:          db,
+					C:           collection,
+					IndexesPath: filepath.Join(dir, entry.Name()),
+				}
+				log.Logf(log.Info, "found collection %v indexes to restore", intent.Namespace())
+				if err = restore.putIntent(intent); err != nil {
+					return err
+				}
 			default:
 				log.Logf(log.Always, `don't know what to do with file "%v", skipping...`,
 					filepath.Join(dir, entry.Name()))
@@ -162,6 +255,80 @@ func hasMetadataFiles(files []os.FileInfo) bool {
 	return false
 }
 
+// putRawSystemCollection puts the intent into the manager under its
+// --rawSystemCollections target namespace, so that it is restored as a plain
+// collection instead of going through the special handling for system
+// collections. Returns false if the intent's collection is not mapped.
+func (restore *MongoRestore) putRawSystemCollection(intent *intents.Intent) bool {
+	target, ok := restore.rawSystemCollections[intent.Namespace()]
+	if !ok {
+		return false
+	}
+	log.Logf(log.Always, "WARNING: restoring system collection %v into plain collection %v",
+		intent.Namespace(), target)
+	restore.recordNamespace(intent.Namespace(), target)
+	// the target was validated when the options were parsed
+	intent.DB, intent.C, _ = splitNamespace(target)
+	restore.noteDataFile(intent)
+	restore.manager.Put(intent)
+	return true
+}
+
+// putIntent adds a collection's intent to the manager, first applying any
+// --nsRewriteFile mappings to its namespace.
+func (restore *MongoRestore) putIntent(intent *intents.Intent) error {
+	source := intent.Namespace()
+	if restore.nsRewrites != nil {
+		if err := restore.rewriteNamespace(intent); err != nil {
+			return err
+		}
+	}
+	restore.recordNamespace(source, intent.Namespace())
+	restore.noteDataFile(intent)
+	restore.manager.Put(intent)
+	return nil
+}
+
+// helper for finding which collections have .bson and .json data files
+// in a list of FileInfo. A .json file is only data with --jsonInput or when
+// its collection has a .metadata.json file; otherwise it may be anything
+// else that happens to be in the directory.
+func dataFileCollections(files []os.FileInfo, jsonInput bool) (map[string]bool, map[string]bool) {
+	bsonCollections, jsonCollections := map[string]bool{}, map[string]bool{}
+	metadataCollections := map[string]bool{}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		collection, fileType := GetInfoFromFilename(file.Name())
+		switch fileType {
+		case BSONFileType:
+			bsonCollections[collection] = true
+		case JSONFileType:
+			jsonCollections[collection] = true
+		case MetadataFileType:
+			metadataCollections[collection] = true
+		}
+	}
+	if !jsonInput {
+		for collection := range jsonCollections {
+			if !metadataCollections[collection] {
+				delete(jsonCollections, collection)
+			}
+		}
+	}
+	return bsonCollections, jsonCollections
+}
+
+// preferredFormat returns the data file format to restore when a collection
+// has both .bson and .json files.
+func (restore *MongoRestore) preferredFormat() string {
+	if restore.InputOptions == nil || restore.InputOptions.PreferFormat == "" {
+		return "bson"
+	}
+	return restore.InputOptions.PreferFormat
+}
+
 // CreateIntentForCollection builds an intent for the given database and collection name
 // along with a path to a .bson collection file. It searches the file's parent directory
 // for a matching metadata file.
@@ -180,8 +347,7 @@ func (restore *MongoRestore) CreateIntentForCollection(db, collection, fullpath
 			C:        collection,
 			BSONPath: "-",
 		}
-		restore.manager.Put(intent)
-		return nil
+		return restore.putIntent(intent)
 	}
 
 	// first make sure the bson file exists and is valid
@@ -193,9 +359,15 @@ func (restore *MongoRestore) CreateIntentForCollection(db, collection, fullpath
 		return fmt.Errorf("file %v is a directory, not a bson file", fullpath)
 	}
 
+	// the file's name only matters for finding its metadata; the namespace
+	// given is used whatever the file is called
 	baseName, fileType := GetInfoFromFilename(file.Name())
-	if fileType != BSONFileType {
-		return fmt.Errorf("file %v does not have .bson extension", fullpath)
+	if fileType != BSONFileType && fileType != JSONFileType {
+		return fmt.Errorf("file %v does not have a .bson, .bson.gz or .json extension", fullpath)
+	}
+	if baseName != collection {
+		log.Logf(log.Info, "restoring %v to %v.%v, ignoring the collection name in the file name",
+			fullpath, db, collection)
 	}
 
 	// then create its intent
@@ -213,16 +385,20 @@ func (restore *MongoRestore) CreateIntentForCollection(db, collection, fullpath
 		// try and carry on if we can
 		log.Logf(log.Info, "error attempting to locate metadata for file: %v", err)
 		log.Log(log.Info, "restoring collection without metadata")
-		restore.manager.Put(intent)
-		return nil
+		return restore.putIntent(intent)
 	}
 	metadataName := baseName + ".metadata.json"
+	indexesName := baseName + ".indexes.json"
 	for _, entry := range entries {
-		if entry.Name() == metadataName {
+		switch entry.Name() {
+		case metadataName:
 			metadataPath := filepath.Join(filepath.Dir(fullpath), metadataName)
 			log.Logf(log.Info, "found metadata for collection at %v", metadataPath)
 			intent.MetadataPath = metadataPath
-			break
+		case indexesName:
+			indexesPath := filepath.Join(filepath.Dir(fullpath), indexesName)
+			log.Logf(log.Info, "found indexes for collection at %v", indexesPath)
+			intent.IndexesPath = indexesPath
 		}
 	}
 
@@ -230,9 +406,7 @@ func (restore *MongoRestore) CreateIntentForCollection(db, collection, fullpath
 		log.Log(log.Info, "restoring collection without metadata")
 	}
 
-	restore.manager.Put(intent)
-
-	return nil
+	return restore.putIntent(intent)
 }
 
 // small helper that checks if the file pointed to is not a directory.
@@ -253,13 +427,19 @@ func isBSON(path string) bool {
 // As an example, when the user passes 'dump/mydb/col.bson', this method
 // will infer that 'mydb' is the database and 'col' is the collection name.
 func (restore *MongoRestore) handleBSONInsteadOfDirectory(path string) error {
+	// an explicit --db and --collection always decide the namespace
+	if restore.ToolOptions.DB != "" && restore.ToolOptions.Collection != "" {
+		log.Logf(log.DebugLow, "restoring file to %v.%v as given by --db and --collection",
+			restore.ToolOptions.DB, restore.ToolOptions.Collection)
+		return nil
+	}
 	// we know we have been given a non-directory, so we should handle it
 	// like a bson file and infer as much as we can
 	if restore.ToolOptions.Collection == "" {
 		// if the user did not set -c, use the file name for the collection
 		newCollectionName, fileType := GetInfoFromFilename(path)
 		if fileType != BSONFileType {
-			return fmt.Errorf("file %v does not have .bson extension", path)
+			return fmt.Errorf("file %v does not have a .bson or .bson.gz extension", path)
 		}
 		restore.ToolOptions.Collection = newCollectionName
 		log.Logf(log.DebugLow, "inferred collection '%v' from file", restore.ToolOptions.Collection)
@@ -9,6 +9,8 @@ import (
 	"github.com/mongodb/mongo-tools/common/testutil"
 	"github.com/mongodb/mongo-tools/common/util"
 	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
 	"strings"
 	"testing"
 )
@@ -254,6 +256,37 @@ func TestCreateIntentsForCollection(t *testing.T) {
 			})
 		})
 
+		Convey("running CreateIntentForCollection on a file named for another collection", func() {
+			err := mr.CreateIntentForCollection(
+				"otherDB", "renamed", util.ToUniversalPath("testdata/testdirs/db1/c1.bson"))
+			So(err, ShouldBeNil)
+			mr.manager.Finalize(intents.Legacy)
+
+			Convey("the given namespace should be used with the file's own metadata", func() {
+				i0 := mr.manager.Pop()
+				So(i0, ShouldNotBeNil)
+				So(i0.Namespace(), ShouldEqual, "otherDB.renamed")
+				So(i0.BSONPath, ShouldEqual, util.ToUniversalPath("testdata/testdirs/db1/c1.bson"))
+				So(i0.MetadataPath, ShouldEqual, util.ToUniversalPath("testdata/testdirs/db1/c1.metadata.json"))
+				So(mr.manager.Pop(), ShouldBeNil)
+				So(strings.Contains(buff.String(), "ignoring the collection name"), ShouldBeTrue)
+			})
+		})
+
+		Convey("running CreateIntentForCollection on an extended JSON file", func() {
+			err := mr.CreateIntentForCollection(
+				"otherDB", "renamed", util.ToUniversalPath("testdata/mixeddirs/db1/c2.json"))
+			So(err, ShouldBeNil)
+			mr.manager.Finalize(intents.Legacy)
+
+			Convey("should create one intent for the given namespace", func() {
+				i0 := mr.manager.Pop()
+				So(i0, ShouldNotBeNil)
+				So(i0.Namespace(), ShouldEqual, "otherDB.renamed")
+				So(i0.BSONPath, ShouldEqual, util.ToUniversalPath("testdata/mixeddirs/db1/c2.json"))
+			})
+		})
+
 		Convey("running CreateIntentForCollection on a non-existent file", func() {
 			err := mr.CreateIntentForCollection(
 				"myDB", "myC", "aaaaaaaaaaaaaa.bson")
@@ -276,10 +309,172 @@ func TestCreateIntentsForCollection(t *testing.T) {
 			err := mr.CreateIntentForCollection(
 				"myDB", "myC", "testdata/testdirs/db1/c1.metadata.json")
 
-			Convey("should fail", func() {
+			Convey("should fail, naming the extensions accepted", func() {
 				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, ".bson, .bson.gz or .json extension")
+			})
+		})
+
+	})
+}
+
+func TestCreateIntentsForMixedFormats(t *testing.T) {
+	// This tests creates intents based on the test file tree:
+	//   mixeddirs/db1
+	//   mixeddirs/db1/c1.bson
+	//   mixeddirs/db1/c1.json
+	//   mixeddirs/db1/c2.json
+	//   mixeddirs/db1/c2.metadata.json
+
+	var mr *MongoRestore
+	var buff bytes.Buffer
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a test MongoRestore", t, func() {
+		mr = &MongoRestore{
+			manager:      intents.NewCategorizingIntentManager(),
+			InputOptions: &InputOptions{},
+			ToolOptions:  &commonOpts.ToolOptions{Namespace: &commonOpts.Namespace{}},
+		}
+		buff.Reset()
+		log.SetWriter(&buff)
+
+		Convey("without --jsonInput only .json files with metadata should be data", func() {
+			So(mr.CreateIntentsForDB("db1", "testdata/mixeddirs/db1"), ShouldBeNil)
+			mr.manager.Finalize(intents.Legacy)
+
+			i0 := mr.manager.Pop()
+			So(i0.C, ShouldEqual, "c1")
+			So(strings.HasSuffix(i0.BSONPath, "c1.bson"), ShouldBeTrue)
+			i1 := mr.manager.Pop()
+			So(i1.C, ShouldEqual, "c2")
+			So(strings.HasSuffix(i1.BSONPath, "c2.json"), ShouldBeTrue)
+			So(strings.HasSuffix(i1.MetadataPath, "c2.metadata.json"), ShouldBeTrue)
+			So(mr.manager.Pop(), ShouldBeNil)
+
+			So(buff.String(), ShouldContainSubstring,
+				`don't know what to do with file "testdata/mixeddirs/db1/c1.json"`)
+			So(buff.String(), ShouldNotContainSubstring, "both .bson and .json files")
+		})
+
+		Convey("by default the .bson file should win a collision", func() {
+			mr.InputOptions.JSONInput = true
+			So(mr.CreateIntentsForDB("db1", "testdata/mixeddirs/db1"), ShouldBeNil)
+			mr.manager.Finalize(intents.Legacy)
+
+			i0 := mr.manager.Pop()
+			So(i0.C, ShouldEqual, "c1")
+			So(strings.HasSuffix(i0.BSONPath, "c1.bson"), ShouldBeTrue)
+			i1 := mr.manager.Pop()
+			So(i1.C, ShouldEqual, "c2")
+			So(strings.HasSuffix(i1.BSONPath, "c2.json"), ShouldBeTrue)
+			So(mr.manager.Pop(), ShouldBeNil)
+
+			So(buff.String(), ShouldContainSubstring, "ignoring testdata/mixeddirs/db1/c1.json")
+		})
+
+		Convey("with --preferFormat json the .json file should win a collision", func() {
+			mr.InputOptions.JSONInput = true
+			mr.InputOptions.PreferFormat = "json"
+			So(mr.CreateIntentsForDB("db1", "testdata/mixeddirs/db1"), ShouldBeNil)
+			mr.manager.Finalize(intents.Legacy)
+
+			i0 := mr.manager.Pop()
+			So(i0.C, ShouldEqual, "c1")
+			So(strings.HasSuffix(i0.BSONPath, "c1.json"), ShouldBeTrue)
+			i1 := mr.manager.Pop()
+			So(i1.C, ShouldEqual, "c2")
+			So(mr.manager.Pop(), ShouldBeNil)
+
+			So(buff.String(), ShouldContainSubstring, "ignoring testdata/mixeddirs/db1/c1.bson")
+		})
+	})
+}
+
+func TestCreateIntentsForSeparateIndexes(t *testing.T) {
+	// This tests creates intents based on the test file tree:
+	//   indexfiles/db1
+	//   indexfiles/db1/c1.bson
+	//   indexfiles/db1/c1.metadata.json
+	//   indexfiles/db1/c1.indexes.json
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a test MongoRestore", t, func() {
+		mr := &MongoRestore{
+			manager:      intents.NewCategorizingIntentManager(),
+			InputOptions: &InputOptions{},
+			ToolOptions:  &commonOpts.ToolOptions{Namespace: &commonOpts.Namespace{}},
+		}
+
+		Convey("a .indexes.json file should be merged into the collection's intent", func() {
+			So(mr.CreateIntentsForDB("db1", "testdata/indexfiles/db1"), ShouldBeNil)
+			mr.manager.Finalize(intents.Legacy)
+
+			i0 := mr.manager.Pop()
+			So(i0.C, ShouldEqual, "c1")
+			So(strings.HasSuffix(i0.BSONPath, "c1.bson"), ShouldBeTrue)
+			So(strings.HasSuffix(i0.MetadataPath, "c1.metadata.json"), ShouldBeTrue)
+			So(strings.HasSuffix(i0.IndexesPath, "c1.indexes.json"), ShouldBeTrue)
+			So(mr.manager.Pop(), ShouldBeNil)
+
+			Convey("and its indexes should replace those of the same name", func() {
+				metadata, err := ioutil.ReadFile(i0.MetadataPath)
+				So(err, ShouldBeNil)
+				_, metadataIndexes, err := mr.MetadataFromJSON(metadata)
+				So(err, ShouldBeNil)
+				separateIndexes, err := mr.IndexesFromJSON(i0.IndexesPath)
+				So(err, ShouldBeNil)
+
+				indexes := replaceIndexes(metadataIndexes, separateIndexes)
+				So(len(indexes), ShouldEqual, 3)
+				So(indexes[0].Options["name"], ShouldEqual, "_id_")
+				So(indexes[1].Options["name"], ShouldEqual, "a_1")
+				So(indexes[1].Key, ShouldResemble, bson.D{{"a", float64(-1)}})
+				So(indexes[2].Options["name"], ShouldEqual, "b_1")
 			})
 		})
+	})
+}
+
+func TestCreateIntentsForEmptyCollections(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
 
+	Convey("With a test MongoRestore", t, func() {
+		mr := &MongoRestore{
+			manager:      intents.NewCategorizingIntentManager(),
+			InputOptions: &InputOptions{},
+			ToolOptions:  &commonOpts.ToolOptions{Namespace: &commonOpts.Namespace{}},
+		}
+
+		Convey("collections dumped empty should have intents that create them", func() {
+			So(mr.CreateIntentsForDB("db1", "testdata/emptycollections/db1"), ShouldBeNil)
+			mr.manager.Finalize(intents.Legacy)
+
+			i0 := mr.manager.Pop()
+			So(i0.C, ShouldEqual, "emptybson")
+			So(i0.BSONPath, ShouldNotEqual, "")
+			So(mr.hasNoDocuments(i0), ShouldBeTrue)
+			i1 := mr.manager.Pop()
+			So(i1.C, ShouldEqual, "metadataonly")
+			So(i1.BSONPath, ShouldEqual, "")
+			So(mr.hasNoDocuments(i1), ShouldBeTrue)
+			i2 := mr.manager.Pop()
+			So(i2.C, ShouldEqual, "noindexes")
+			So(mr.hasNoDocuments(i2), ShouldBeTrue)
+			So(mr.manager.Pop(), ShouldBeNil)
+		})
+
+		Convey("collections with documents should not be created up front", func() {
+			So(mr.hasNoDocuments(&intents.Intent{DB: "db1", C: "c1", BSONPath: "c1.bson", Size: 100}), ShouldBeFalse)
+			So(mr.hasNoDocuments(&intents.Intent{DB: "db1", C: "c1", IndexesPath: "c1.indexes.json"}), ShouldBeFalse)
+		})
+
+		Convey("a collection read from stdin should not count as empty", func() {
+			mr.useStdin = true
+			So(mr.hasNoDocuments(&intents.Intent{DB: "db1", C: "c1", BSONPath: "-"}), ShouldBeFalse)
+		})
 	})
 }
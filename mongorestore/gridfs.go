@@ -0,0 +1,114 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// GridFS stores each bucket in a pair of collections with these suffixes.
+const (
+	gridFSFilesSuffix  = ".files"
+	gridFSChunksSuffix = ".chunks"
+)
+
+// gridFSBucketPrefix returns the bucket namespace (e.g. "test.fs") and true if
+// the intent's collection is named like one half of a GridFS bucket.
+func gridFSBucketPrefix(intent *intents.Intent) (string, bool) {
+	for _, suffix := range []string{gridFSFilesSuffix, gridFSChunksSuffix} {
+		if strings.HasSuffix(intent.C, suffix) && len(intent.C) > len(suffix) {
+			return intent.DB + "." + strings.TrimSuffix(intent.C, suffix), true
+		}
+	}
+	return "", false
+}
+
+// findGridFSBuckets records every GridFS bucket whose files and chunks
+// collections are both being restored, attaching the chunks intent to the
+// files intent so that the two are restored together, and warns about
+// buckets with only one half present. It must be called before the intent
+// manager is finalized.
+func (restore *MongoRestore) findGridFSBuckets() error {
+	halves := map[string][]string{}
+	err := restore.manager.ForEach(func(intent *intents.Intent) error {
+		if intent.BSONPath == "" {
+			return nil
+		}
+		if bucket, ok := gridFSBucketPrefix(intent); ok {
+			halves[bucket] = append(halves[bucket], intent.C)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	restore.gridFSBuckets = map[string]bool{}
+	for bucket, collections := range halves {
+		if len(collections) == 2 {
+			log.Logf(log.DebugLow, "found GridFS bucket %v", bucket)
+			restore.gridFSBuckets[bucket] = true
+			restore.manager.Attach(bucket+gridFSFilesSuffix, bucket+gridFSChunksSuffix)
+			continue
+		}
+		missing := bucket + gridFSChunksSuffix
+		if strings.HasSuffix(collections[0], gridFSChunksSuffix) {
+			missing = bucket + gridFSFilesSuffix
+		}
+		log.Logf(log.Always, "warning: restoring %v.%v without %v; "+
+			"if this is a GridFS bucket, its files will not be readable",
+			strings.SplitN(bucket, ".", 2)[0], collections[0], missing)
+	}
+	return nil
+}
+
+// gridFSIndexes returns the indexes GridFS requires on the given intent's
+// collection, or nil if the collection is not part of a GridFS bucket.
+func (restore *MongoRestore) gridFSIndexes(intent *intents.Intent) []IndexDocument {
+	bucket, ok := gridFSBucketPrefix(intent)
+	if !ok || !restore.gridFSBuckets[bucket] {
+		return nil
+	}
+	if strings.HasSuffix(intent.C, gridFSChunksSuffix) {
+		return []IndexDocument{{
+			Options: bson.M{"name": "files_id_1_n_1", "unique": true},
+			Key:     bson.D{{"files_id", 1}, {"n", 1}},
+		}}
+	}
+	return []IndexDocument{{
+		Options: bson.M{"name": "filename_1_uploadDate_1"},
+		Key:     bson.D{{"filename", 1}, {"uploadDate", 1}},
+	}}
+}
+
+// addMissingIndexes appends each of the required indexes whose key fields are
+// not already covered by an index in indexes.
+func addMissingIndexes(indexes, required []IndexDocument) []IndexDocument {
+	for _, requiredIndex := range required {
+		found := false
+		for _, index := range indexes {
+			if sameKeyFields(index.Key, requiredIndex.Key) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			indexes = append(indexes, requiredIndex)
+		}
+	}
+	return indexes
+}
+
+// sameKeyFields returns true if both index keys cover the same fields in the same order.
+func sameKeyFields(a, b bson.D) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name {
+			return false
+		}
+	}
+	return true
+}
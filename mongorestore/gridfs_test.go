@@ -0,0 +1,65 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestGridFSBuckets(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With intents for a complete and an incomplete GridFS bucket", t, func() {
+		var buff bytes.Buffer
+		log.SetWriter(&buff)
+
+		restore := &MongoRestore{manager: intents.NewIntentManager()}
+		for _, c := range []string{"fs.files", "fs.chunks", "photos.files", "users"} {
+			restore.manager.Put(&intents.Intent{DB: "test", C: c, BSONPath: c + ".bson"})
+		}
+		restore.findGridFSBuckets()
+
+		Convey("only the complete bucket should be recognized", func() {
+			So(restore.gridFSBuckets, ShouldResemble, map[string]bool{"test.fs": true})
+			So(buff.String(), ShouldContainSubstring, "test.photos.files without test.photos.chunks")
+		})
+
+		Convey("the halves of the complete bucket should be scheduled together", func() {
+			restore.manager.Finalize(intents.Legacy)
+			popped := map[string]*intents.Intent{}
+			for intent := restore.manager.Pop(); intent != nil; intent = restore.manager.Pop() {
+				popped[intent.Namespace()] = intent
+			}
+			So(len(popped), ShouldEqual, 3)
+			So(len(popped["test.fs.files"].Attached), ShouldEqual, 1)
+			So(popped["test.fs.files"].Attached[0].Namespace(), ShouldEqual, "test.fs.chunks")
+			So(popped["test.photos.files"].Attached, ShouldBeNil)
+		})
+
+		Convey("the chunks collection should require a unique files_id/n index", func() {
+			required := restore.gridFSIndexes(&intents.Intent{DB: "test", C: "fs.chunks"})
+			So(len(required), ShouldEqual, 1)
+			So(required[0].Key, ShouldResemble, bson.D{{"files_id", 1}, {"n", 1}})
+			So(required[0].Options["unique"], ShouldEqual, true)
+
+			Convey("which should not be added again if the dump already has it", func() {
+				existing := []IndexDocument{{
+					Options: bson.M{"name": "files_id_1_n_1", "unique": true},
+					Key:     bson.D{{"files_id", float64(1)}, {"n", float64(1)}},
+				}}
+				So(len(addMissingIndexes(existing, required)), ShouldEqual, 1)
+				So(len(addMissingIndexes(nil, required)), ShouldEqual, 1)
+			})
+		})
+
+		Convey("collections outside a complete bucket should require no indexes", func() {
+			So(restore.gridFSIndexes(&intents.Intent{DB: "test", C: "photos.files"}), ShouldBeNil)
+			So(restore.gridFSIndexes(&intents.Intent{DB: "test", C: "users"}), ShouldBeNil)
+		})
+	})
+}
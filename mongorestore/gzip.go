@@ -0,0 +1,137 @@
+package mongorestore
+
+import (
+	"compress/gzip"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/progress"
+	"io"
+	"strings"
+	"sync/atomic"
+)
+
+// isGzipped returns true if the data file at path is compressed with gzip,
+// as the files written by mongodump --gzip are.
+func isGzipped(path string) bool {
+	return strings.HasSuffix(path, ".gz")
+}
+
+// maxEmptyGzipSize is the size above which a file compressed with gzip
+// cannot be empty: an empty stream, as mongodump --gzip writes it, takes 20
+// bytes, and the rest allows for a header naming the file.
+const maxEmptyGzipSize = 64
+
+// isEmptyDumpFile returns true if the intent's data file holds no
+// documents. The size of a file compressed with gzip is never 0, so a small
+// one is empty if it decompresses to nothing; one that cannot be read is not
+// counted as empty, leaving the error to its restore.
+func (restore *MongoRestore) isEmptyDumpFile(intent *intents.Intent) bool {
+	if intent.Size == 0 || !isGzipped(intent.BSONPath) || intent.Size > maxEmptyGzipSize {
+		return intent.Size == 0
+	}
+	source, err := restore.openDumpFile(intent.BSONPath)
+	if err != nil {
+		return false
+	}
+	defer source.Close()
+	_, err = source.Read(make([]byte, 1))
+	return err == io.EOF
+}
+
+// gzipDumpFile decompresses a data file of the dump as it is read. The size
+// of the decompressed data is not known until it has all been read, so the
+// progress of restoring the file is measured in compressed bytes instead.
+type gzipDumpFile struct {
+	*gzip.Reader
+	file io.ReadCloser
+	// compressed bytes read from file, updated atomically
+	compressedRead int64
+}
+
+func newGzipDumpFile(file io.ReadCloser) (*gzipDumpFile, error) {
+	dumpFile := &gzipDumpFile{file: file}
+	reader, err := gzip.NewReader(compressedReader{dumpFile})
+	if err != nil {
+		return nil, err
+	}
+	dumpFile.Reader = reader
+	return dumpFile, nil
+}
+
+// compressedBytesRead returns the number of bytes read from the compressed
+// file. The decompressor reads ahead, so it may be slightly more than those
+// of the documents decompressed so far.
+func (dumpFile *gzipDumpFile) compressedBytesRead() int64 {
+	return atomic.LoadInt64(&dumpFile.compressedRead)
+}
+
+func (dumpFile *gzipDumpFile) Close() error {
+	err := dumpFile.Reader.Close()
+	if closeErr := dumpFile.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// compressedReader reads the compressed file of a gzipDumpFile, counting
+// the bytes read.
+type compressedReader struct {
+	dumpFile *gzipDumpFile
+}
+
+func (reader compressedReader) Read(p []byte) (int, error) {
+	n, err := reader.dumpFile.file.Read(p)
+	atomic.AddInt64(&reader.dumpFile.compressedRead, int64(n))
+	return n, err
+}
+
+// bytesProgressor tracks the bytes of a data file restored.
+type bytesProgressor interface {
+	progress.Progressor
+	Inc(amount int64)
+}
+
+// gzipProgressor is the progressor of a compressed data file, out of its
+// compressed size. It ignores the decompressed sizes of the documents it is
+// incremented by, reporting the compressed bytes read of the file instead.
+type gzipProgressor struct {
+	max      int64
+	dumpFile *gzipDumpFile
+}
+
+func (progressor *gzipProgressor) Progress() (int64, int64) {
+	return progressor.max, progressor.dumpFile.compressedBytesRead()
+}
+
+func (progressor *gzipProgressor) Inc(amount int64) {}
+
+// newBytesProgressor returns the progressor of the restore of a namespace's
+// data file of the given size.
+func (restore *MongoRestore) newBytesProgressor(namespace string, size int64) bytesProgressor {
+	if dumpFile := restore.gzipFileFor(namespace); dumpFile != nil {
+		return &gzipProgressor{size, dumpFile}
+	}
+	return progress.NewCounter(size)
+}
+
+// setGzipFile records the compressed data file of a namespace being
+// restored, or, if nil, forgets it.
+func (restore *MongoRestore) setGzipFile(namespace string, dumpFile *gzipDumpFile) {
+	restore.gzipFilesMutex.Lock()
+	defer restore.gzipFilesMutex.Unlock()
+	if dumpFile == nil {
+		delete(restore.gzipFiles, namespace)
+		return
+	}
+	if restore.gzipFiles == nil {
+		restore.gzipFiles = map[string]*gzipDumpFile{}
+	}
+	restore.gzipFiles[namespace] = dumpFile
+}
+
+// gzipFileFor returns the compressed data file of a namespace being
+// restored, or nil if its data file is not compressed.
+func (restore *MongoRestore) gzipFileFor(namespace string) *gzipDumpFile {
+	restore.gzipFilesMutex.Lock()
+	defer restore.gzipFilesMutex.Unlock()
+	return restore.gzipFiles[namespace]
+}
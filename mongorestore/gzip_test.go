@@ -0,0 +1,187 @@
+package mongorestore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	commonOpts "github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	"github.com/mongodb/mongo-tools/mongodump"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGzipDumpFiles(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	dir, err := ioutil.TempDir("", "mongorestore-gzip-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "c.bson.gz")
+	compressed := &bytes.Buffer{}
+	writer := gzip.NewWriter(compressed)
+	for i := 1; i <= 100; i++ {
+		raw, err := bson.Marshal(bson.D{{"_id", i}, {"padding", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer.Write(raw)
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(path, compressed.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	size := int64(compressed.Len())
+
+	Convey("With a dump written by mongodump --gzip", t, func() {
+		restore := &MongoRestore{InputOptions: &InputOptions{}}
+
+		Convey("a .bson.gz file should be recognized as a collection's BSON file", func() {
+			collection, fileType := GetInfoFromFilename(path)
+			So(collection, ShouldEqual, "c")
+			So(fileType, ShouldEqual, BSONFileType)
+		})
+
+		Convey("its documents should be decompressed as they are read", func() {
+			source, err := restore.openDumpFile(path)
+			So(err, ShouldBeNil)
+			dumpFile, ok := source.(*gzipDumpFile)
+			So(ok, ShouldBeTrue)
+			bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(source))
+			defer bsonSource.Close()
+
+			ids := []int{}
+			doc := struct {
+				ID int `bson:"_id"`
+			}{}
+			for bsonSource.Next(&doc) {
+				ids = append(ids, doc.ID)
+			}
+			So(bsonSource.Err(), ShouldBeNil)
+			So(len(ids), ShouldEqual, 100)
+			So(ids[99], ShouldEqual, 100)
+			So(dumpFile.compressedBytesRead(), ShouldEqual, size)
+		})
+
+		Convey("its progress should be measured in compressed bytes", func() {
+			source, err := restore.openDumpFile(path)
+			So(err, ShouldBeNil)
+			defer source.Close()
+			restore.setGzipFile("db.c", source.(*gzipDumpFile))
+
+			progressor := restore.newBytesProgressor("db.c", size)
+			_, before := progressor.Progress()
+			progressor.Inc(1000)
+			_, current := progressor.Progress()
+			So(current, ShouldEqual, before)
+			_, err = ioutil.ReadAll(source)
+			So(err, ShouldBeNil)
+			max, current := progressor.Progress()
+			So(max, ShouldEqual, size)
+			So(current, ShouldEqual, size)
+
+			restore.setGzipFile("db.c", nil)
+			progressor = restore.newBytesProgressor("db.c", size)
+			progressor.Inc(1000)
+			_, current = progressor.Progress()
+			So(current, ShouldEqual, 1000)
+		})
+
+		Convey("a file that is not compressed should be an error", func() {
+			plainPath := filepath.Join(dir, "plain.bson.gz")
+			So(ioutil.WriteFile(plainPath, []byte("not gzip"), 0644), ShouldBeNil)
+			_, err := restore.openDumpFile(plainPath)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "error decompressing")
+		})
+
+		Convey("a file that decompresses to nothing should have no documents", func() {
+			emptyPath := filepath.Join(dir, "empty.bson.gz")
+			empty := &bytes.Buffer{}
+			So(gzip.NewWriter(empty).Close(), ShouldBeNil)
+			So(ioutil.WriteFile(emptyPath, empty.Bytes(), 0644), ShouldBeNil)
+			intent := &intents.Intent{DB: "db", C: "empty", BSONPath: emptyPath, Size: int64(empty.Len())}
+			So(intent.Size, ShouldBeGreaterThan, 0)
+			So(restore.hasNoDocuments(intent), ShouldBeTrue)
+
+			intent = &intents.Intent{DB: "db", C: "c", BSONPath: path, Size: size}
+			So(restore.hasNoDocuments(intent), ShouldBeFalse)
+		})
+	})
+}
+
+func TestGzipDumpRoundTrip(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.IntegrationTestType)
+	log.SetWriter(ioutil.Discard)
+
+	Convey("With a collection dumped by mongodump --gzip", t, func() {
+		ssl := testutil.GetSSLOptions()
+		auth := testutil.GetAuthOptions()
+		toolOptions := &commonOpts.ToolOptions{
+			Connection: &commonOpts.Connection{
+				Host: "localhost",
+				Port: db.DefaultTestPort,
+			},
+			Namespace:     &commonOpts.Namespace{DB: "restore_gzip", Collection: "c"},
+			Auth:          &auth,
+			SSL:           &ssl,
+			HiddenOptions: &commonOpts.HiddenOptions{},
+			Verbosity:     &commonOpts.Verbosity{},
+		}
+		sessionProvider, err := db.NewSessionProvider(*toolOptions)
+		So(err, ShouldBeNil)
+		session, err := sessionProvider.GetSession()
+		So(err, ShouldBeNil)
+		coll := session.DB("restore_gzip").C("c")
+		coll.DropCollection()
+		for i := 1; i <= 10; i++ {
+			So(coll.Insert(bson.D{{"_id", i}}), ShouldBeNil)
+		}
+
+		dir, err := ioutil.TempDir("", "mongorestore-gzip-dump-")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		dump := &mongodump.MongoDump{
+			ToolOptions:   toolOptions,
+			InputOptions:  &mongodump.InputOptions{},
+			OutputOptions: &mongodump.OutputOptions{Out: dir, Gzip: true},
+		}
+		So(dump.Init(), ShouldBeNil)
+		So(dump.Dump(), ShouldBeNil)
+
+		Convey("its .bson.gz file should be read back by openDumpFile", func() {
+			restore := &MongoRestore{InputOptions: &InputOptions{}}
+			source, err := restore.openDumpFile(filepath.Join(dir, "restore_gzip", "c.bson.gz"))
+			So(err, ShouldBeNil)
+			_, ok := source.(*gzipDumpFile)
+			So(ok, ShouldBeTrue)
+			bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(source))
+			defer bsonSource.Close()
+
+			ids := []int{}
+			doc := bson.M{}
+			for bsonSource.Next(&doc) {
+				ids = append(ids, doc["_id"].(int))
+			}
+			So(bsonSource.Err(), ShouldBeNil)
+			So(len(ids), ShouldEqual, 10)
+		})
+
+		Reset(func() {
+			session.DB("restore_gzip").DropDatabase()
+			session.Close()
+		})
+	})
+}
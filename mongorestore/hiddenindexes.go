@@ -0,0 +1,35 @@
+package mongorestore
+
+import (
+	"fmt"
+)
+
+// hideIndexes implements --restoreIndexesHidden: it marks every index other
+// than _id as hidden, so that the query planner ignores it until it is
+// unhidden with collMod. The _id index cannot be hidden.
+func hideIndexes(indexes []IndexDocument) {
+	for _, index := range indexes {
+		if !isIDIndex(index) {
+			index.Options["hidden"] = true
+		}
+	}
+}
+
+// checkHiddenIndexSupport returns an error if the connected server is too
+// old to build hidden indexes, which were added in MongoDB 4.4.
+func (restore *MongoRestore) checkHiddenIndexSupport() error {
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return fmt.Errorf("error establishing connection: %v", err)
+	}
+	defer session.Close()
+	buildInfo, err := session.BuildInfo()
+	if err != nil {
+		return fmt.Errorf("error getting server version: %v", err)
+	}
+	if !buildInfo.VersionAtLeast(4, 4) {
+		return fmt.Errorf("--restoreIndexesHidden requires server version 4.4 or later, "+
+			"but the connected server is %v", buildInfo.Version)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestHideIndexes(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With the indexes of a dump restored with --restoreIndexesHidden", t, func() {
+		indexes := []IndexDocument{
+			{Options: bson.M{"name": "_id_"}, Key: bson.D{{"_id", 1}}},
+			{Options: bson.M{"name": "a_1"}, Key: bson.D{{"a", 1}}},
+			{Options: bson.M{"name": "b_1", "unique": true}, Key: bson.D{{"b", 1}}},
+		}
+		hideIndexes(indexes)
+
+		Convey("every index but _id should be hidden", func() {
+			_, hidden := indexes[0].Options["hidden"]
+			So(hidden, ShouldBeFalse)
+			So(indexes[1].Options["hidden"], ShouldEqual, true)
+			So(indexes[2].Options["hidden"], ShouldEqual, true)
+			So(indexes[2].Options["unique"], ShouldEqual, true)
+		})
+
+		Convey("the hidden flag should be part of the createIndexes specs", func() {
+			raw, err := bson.Marshal(bson.D{{"createIndexes", "c"}, {"indexes", indexes}})
+			So(err, ShouldBeNil)
+			command := struct {
+				Indexes []bson.M `bson:"indexes"`
+			}{}
+			So(bson.Unmarshal(raw, &command), ShouldBeNil)
+			So(len(command.Indexes), ShouldEqual, 3)
+			So(command.Indexes[0]["hidden"], ShouldBeNil)
+			So(command.Indexes[1]["hidden"], ShouldEqual, true)
+		})
+	})
+}
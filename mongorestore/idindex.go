@@ -0,0 +1,66 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// indexDocumentFromSpec splits an index spec, such as the idIndex of a
+// metadata file, into its key and options.
+func indexDocumentFromSpec(spec bson.D) IndexDocument {
+	index := IndexDocument{Options: bson.M{}}
+	for _, elem := range spec {
+		if elem.Name == "key" {
+			if key, ok := elem.Value.(bson.D); ok {
+				index.Key = key
+				continue
+			}
+		}
+		index.Options[elem.Name] = elem.Value
+	}
+	return index
+}
+
+// idIndexDifferences describes each way in which the existing collection's
+// _id index differs from the dumped one, or returns nil if the collection
+// has no _id index to compare.
+func idIndexDifferences(dumped bson.D, existing []IndexDocument, compareVersion bool) []string {
+	for _, index := range existing {
+		if isIDIndex(index) {
+			return indexDifferences(indexDocumentFromSpec(dumped), index, compareVersion)
+		}
+	}
+	return nil
+}
+
+// checkIDIndex compares the _id index of the intent's existing collection
+// with the dumped one. The server never changes the _id index of an
+// existing collection, so documents restored into it keep the target's _id
+// semantics, such as its collation, which may not be the source's. A
+// difference is logged, or returned as an error with --strictIdIndex.
+func (restore *MongoRestore) checkIDIndex(intent *intents.Intent, idIndex bson.D) error {
+	session, err := restore.sessionProviderFor(intent.DB).GetSession()
+	if err != nil {
+		return fmt.Errorf("error establishing connection: %v", err)
+	}
+	defer session.Close()
+
+	existing, err := listIndexes(session, intent)
+	if err != nil {
+		return err
+	}
+	differences := idIndexDifferences(idIndex, existing, restore.OutputOptions.KeepIndexVersion)
+	if len(differences) == 0 {
+		return nil
+	}
+	message := fmt.Sprintf("the _id index of existing collection %v differs from the dump's, "+
+		"and cannot be changed by the restore: %v", intent.Namespace(), strings.Join(differences, "; "))
+	if restore.OutputOptions.StrictIDIndex {
+		return fmt.Errorf("%v; drop the collection or restore with --drop", message)
+	}
+	log.Logf(log.Always, "warning: %v", message)
+	return nil
+}
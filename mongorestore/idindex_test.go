@@ -0,0 +1,49 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestIDIndexDifferences(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a dumped _id index with a collation", t, func() {
+		dumped := bson.D{
+			{"v", 2},
+			{"key", bson.D{{"_id", 1}}},
+			{"name", "_id_"},
+			{"ns", "test.c"},
+			{"collation", bson.D{{"locale", "fr"}, {"strength", 2}}},
+		}
+
+		Convey("an existing _id index with the same collation should match", func() {
+			existing := []IndexDocument{
+				{Key: bson.D{{"_id", 1}}, Options: bson.M{"name": "_id_", "v": 2,
+					"collation": bson.M{"strength": 2, "locale": "fr"}}},
+				{Key: bson.D{{"a", 1}}, Options: bson.M{"name": "a_1", "v": 2}},
+			}
+			So(idIndexDifferences(dumped, existing, true), ShouldBeEmpty)
+		})
+
+		Convey("an existing _id index without the collation should be reported", func() {
+			existing := []IndexDocument{
+				{Key: bson.D{{"_id", 1}}, Options: bson.M{"name": "_id_", "v": 1}},
+			}
+			differences := idIndexDifferences(dumped, existing, false)
+			So(len(differences), ShouldEqual, 1)
+			So(differences[0], ShouldStartWith, "collation [{locale fr} {strength 2}], found <nil>")
+
+			Convey("along with its version if it is compared", func() {
+				So(len(idIndexDifferences(dumped, existing, true)), ShouldEqual, 2)
+			})
+		})
+
+		Convey("a collection without an _id index should not be compared", func() {
+			So(idIndexDifferences(dumped, nil, false), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,67 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"strings"
+	"time"
+)
+
+// startIndexHeartbeat logs every interval that the given indexes are still
+// being built on the intent's collection, and pings the server over a
+// session of its own so that idle connections are not dropped by the
+// network while the build runs. Pings run in the background, so a ping that
+// does not return delays neither the messages nor the end of the build; no
+// new ping is sent while one is in flight. It returns a function that stops
+// the heartbeat and waits for its messages to end.
+func (restore *MongoRestore) startIndexHeartbeat(intent *intents.Intent,
+	names []string, interval time.Duration) (stop func()) {
+
+	stopChan := make(chan struct{})
+	doneChan := make(chan struct{})
+	go func() {
+		defer close(doneChan)
+		start := time.Now()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		// holds a value while a ping is in flight
+		pinging := make(chan struct{}, 1)
+		for {
+			select {
+			case <-stopChan:
+				return
+			case <-ticker.C:
+			}
+			log.Logf(log.Always, "still building index(es) %v on %v (elapsed %v)",
+				strings.Join(names, ", "), intent.Namespace(), time.Since(start).Truncate(time.Second))
+			select {
+			case pinging <- struct{}{}:
+				go func() {
+					defer func() { <-pinging }()
+					restore.pingDuringIndexBuild(intent)
+				}()
+			default:
+				log.Logf(log.Info, "heartbeat ping during index build on %v has not returned yet",
+					intent.Namespace())
+			}
+		}
+	}()
+	return func() {
+		close(stopChan)
+		<-doneChan
+	}
+}
+
+// pingDuringIndexBuild pings the server over a new session, logging rather
+// than returning any error.
+func (restore *MongoRestore) pingDuringIndexBuild(intent *intents.Intent) {
+	session, err := restore.sessionProviderFor(intent.DB).GetSession()
+	if err != nil {
+		log.Logf(log.Info, "heartbeat ping during index build on %v failed: %v", intent.Namespace(), err)
+		return
+	}
+	defer session.Close()
+	if err = session.Ping(); err != nil {
+		log.Logf(log.Info, "heartbeat ping during index build on %v failed: %v", intent.Namespace(), err)
+	}
+}
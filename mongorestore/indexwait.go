@@ -0,0 +1,112 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"time"
+)
+
+// indexBuildFilter matches currentOp entries for index builds running on the
+// intent's collection. Depending on the server version, a build is reported
+// either with an "Index Build" progress message on the collection namespace
+// or as a createIndexes command on the database's $cmd namespace.
+func indexBuildFilter(intent *intents.Intent) bson.M {
+	return bson.M{
+		"$or": []bson.M{
+			{"ns": intent.Namespace(), "msg": bson.RegEx{Pattern: "^Index Build"}},
+			{"command.createIndexes": intent.C, "ns": bson.M{"$in": []string{intent.Namespace(), intent.DB + ".$cmd"}}},
+			{"query.createIndexes": intent.C, "ns": bson.M{"$in": []string{intent.Namespace(), intent.DB + ".$cmd"}}},
+		},
+	}
+}
+
+// indexBuildsInProgress returns the number of index builds the server reports
+// as running on the intent's collection.
+func indexBuildsInProgress(session *mgo.Session, intent *intents.Intent) (int, error) {
+	result := struct {
+		InProg []bson.Raw `bson:"inprog"`
+	}{}
+	command := bson.D{{"currentOp", 1}}
+	for key, value := range indexBuildFilter(intent) {
+		command = append(command, bson.DocElem{key, value})
+	}
+	err := session.DB("admin").Run(command, &result)
+	if err != nil && strings.Contains(err.Error(), "no such cmd") {
+		// servers older than 3.2 only expose currentOp as a pseudo-collection
+		err = session.DB("admin").C("$cmd.sys.inprog").Find(indexBuildFilter(intent)).One(&result)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error running currentOp: %v", err)
+	}
+	return len(result.InProg), nil
+}
+
+// missingIndexes returns the names in expected that are not among the
+// given indexes.
+func missingIndexes(expected []string, found []mgo.Index) []string {
+	present := map[string]bool{}
+	for _, index := range found {
+		present[index.Name] = true
+	}
+	missing := []string{}
+	for _, name := range expected {
+		if !present[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// WaitForIndexBuilds polls the server until every index in indexes is listed
+// on the intent's collection and no index builds remain in progress on it,
+// or until --indexWaitTimeout elapses.
+func (restore *MongoRestore) WaitForIndexBuilds(intent *intents.Intent, indexes []IndexDocument) error {
+	session, err := restore.sessionProviderFor(intent.DB).GetSession()
+	if err != nil {
+		return fmt.Errorf("error establishing connection: %v", err)
+	}
+	defer session.Close()
+
+	names := make([]string, 0, len(indexes))
+	for _, index := range indexes {
+		names = append(names, fmt.Sprintf("%v", index.Options["name"]))
+	}
+
+	interval := time.Duration(restore.OutputOptions.IndexPollInterval) * time.Millisecond
+	var deadline time.Time
+	if restore.OutputOptions.IndexWaitTimeout > 0 {
+		deadline = time.Now().Add(time.Duration(restore.OutputOptions.IndexWaitTimeout) * time.Second)
+	}
+
+	for {
+		found, err := session.DB(intent.DB).C(intent.C).Indexes()
+		if err != nil {
+			return fmt.Errorf("error listing indexes: %v", err)
+		}
+		missing := missingIndexes(names, found)
+		building := 0
+		if len(missing) == 0 {
+			building, err = indexBuildsInProgress(session, intent)
+			if err != nil {
+				return err
+			}
+			if building == 0 {
+				return nil
+			}
+		}
+
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			if len(missing) > 0 {
+				return fmt.Errorf("timed out waiting for indexes %v to appear", missing)
+			}
+			return fmt.Errorf("timed out waiting for %v index build(s) to finish", building)
+		}
+		log.Logf(log.DebugLow, "waiting for index builds on %v (%v missing, %v in progress)",
+			intent.Namespace(), len(missing), building)
+		time.Sleep(interval)
+	}
+}
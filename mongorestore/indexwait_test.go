@@ -0,0 +1,25 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2"
+	"testing"
+)
+
+func TestMissingIndexes(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When checking which restored indexes the server lists", t, func() {
+		found := []mgo.Index{{Name: "_id_"}, {Name: "a_1"}}
+
+		Convey("indexes that are listed should not be reported", func() {
+			So(missingIndexes([]string{"a_1", "_id_"}, found), ShouldBeEmpty)
+		})
+
+		Convey("indexes that are not listed yet should be reported", func() {
+			So(missingIndexes([]string{"a_1", "b_1", "c_1"}, found), ShouldResemble, []string{"b_1", "c_1"})
+		})
+	})
+}
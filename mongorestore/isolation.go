@@ -0,0 +1,137 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/text"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// databaseStatus is the outcome of restoring the collections of one
+// database with --perDatabaseIsolation.
+type databaseStatus struct {
+	db         string
+	restored   int
+	failed     int
+	skipped    int
+	errors     []string
+	start, end time.Time
+}
+
+func (status *databaseStatus) ok() bool {
+	return status.failed == 0
+}
+
+// databaseIsolation implements --perDatabaseIsolation: it treats each
+// database as an independent job, so that a collection that fails to
+// restore only stops the rest of its own database. The collections of the
+// other databases are still restored, in parallel as usual.
+type databaseIsolation struct {
+	sync.Mutex
+	statuses map[string]*databaseStatus
+}
+
+func newDatabaseIsolation() *databaseIsolation {
+	return &databaseIsolation{statuses: map[string]*databaseStatus{}}
+}
+
+func (isolation *databaseIsolation) status(db string) *databaseStatus {
+	status, ok := isolation.statuses[db]
+	if !ok {
+		status = &databaseStatus{db: db, start: time.Now()}
+		isolation.statuses[db] = status
+	}
+	return status
+}
+
+// begin returns false if the intent should be skipped, because an earlier
+// collection of its database failed.
+func (isolation *databaseIsolation) begin(intent *intents.Intent) bool {
+	isolation.Lock()
+	defer isolation.Unlock()
+	status := isolation.status(intent.DB)
+	if !status.ok() {
+		status.skipped++
+		return false
+	}
+	return true
+}
+
+// end records the outcome of restoring the intent.
+func (isolation *databaseIsolation) end(intent *intents.Intent, err error) {
+	isolation.Lock()
+	defer isolation.Unlock()
+	status := isolation.status(intent.DB)
+	status.end = time.Now()
+	if err != nil {
+		status.failed++
+		status.errors = append(status.errors, fmt.Sprintf("%v: %v", intent.Namespace(), err))
+	} else {
+		status.restored++
+	}
+}
+
+// sortedStatuses returns the status of each database, ordered by name.
+func (isolation *databaseIsolation) sortedStatuses() []*databaseStatus {
+	isolation.Lock()
+	defer isolation.Unlock()
+	names := make([]string, 0, len(isolation.statuses))
+	for name := range isolation.statuses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	statuses := make([]*databaseStatus, 0, len(names))
+	for _, name := range names {
+		statuses = append(statuses, isolation.statuses[name])
+	}
+	return statuses
+}
+
+// writeTable writes a table of the status of each database to out,
+// followed by the errors of those that failed.
+func (isolation *databaseIsolation) writeTable(out io.Writer) {
+	statuses := isolation.sortedStatuses()
+	grid := &text.GridWriter{ColumnPadding: 4}
+	grid.WriteCells("database", "status", "restored", "failed", "skipped", "duration")
+	grid.EndRow()
+	for _, status := range statuses {
+		result := "ok"
+		if !status.ok() {
+			result = "failed"
+		}
+		var seconds float64
+		if !status.end.IsZero() {
+			seconds = status.end.Sub(status.start).Seconds()
+		}
+		grid.WriteCells(status.db, result, fmt.Sprintf("%v", status.restored),
+			fmt.Sprintf("%v", status.failed), fmt.Sprintf("%v", status.skipped),
+			fmt.Sprintf("%.1fs", seconds))
+		grid.EndRow()
+	}
+	grid.Flush(out)
+	for _, status := range statuses {
+		for _, message := range status.errors {
+			fmt.Fprintf(out, "error restoring %v\n", log.Redact(message))
+		}
+	}
+}
+
+// err returns an error naming the databases that failed, or nil if they
+// all succeeded.
+func (isolation *databaseIsolation) err() error {
+	failed := []string{}
+	for _, status := range isolation.sortedStatuses() {
+		if !status.ok() {
+			failed = append(failed, status.db)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%v database(s) failed to restore: %v", len(failed), strings.Join(failed, ", "))
+}
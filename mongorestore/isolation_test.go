@@ -0,0 +1,56 @@
+package mongorestore
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+)
+
+func TestDatabaseIsolation(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --perDatabaseIsolation", t, func() {
+		isolation := newDatabaseIsolation()
+		a1 := &intents.Intent{DB: "tenantA", C: "c1"}
+		a2 := &intents.Intent{DB: "tenantA", C: "c2"}
+		b1 := &intents.Intent{DB: "tenantB", C: "c1"}
+		b2 := &intents.Intent{DB: "tenantB", C: "c2"}
+
+		So(isolation.begin(a1), ShouldBeTrue)
+		isolation.end(a1, fmt.Errorf("insert error"))
+		So(isolation.begin(b1), ShouldBeTrue)
+		isolation.end(b1, nil)
+
+		Convey("a failure should only skip the rest of its database", func() {
+			So(isolation.begin(a2), ShouldBeFalse)
+			So(isolation.begin(b2), ShouldBeTrue)
+			isolation.end(b2, nil)
+
+			err := isolation.err()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "1 database(s) failed to restore: tenantA")
+
+			Convey("and the status table should show each database", func() {
+				out := &bytes.Buffer{}
+				isolation.writeTable(out)
+				lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+				So(len(lines), ShouldEqual, 4)
+				So(strings.Fields(lines[1])[:5], ShouldResemble, []string{"tenantA", "failed", "0", "1", "1"})
+				So(strings.Fields(lines[2])[:5], ShouldResemble, []string{"tenantB", "ok", "2", "0", "0"})
+				So(lines[3], ShouldEqual, "error restoring tenantA.c1: insert error")
+			})
+		})
+
+		Convey("databases that all succeed should give no error", func() {
+			ok := newDatabaseIsolation()
+			So(ok.begin(b1), ShouldBeTrue)
+			ok.end(b1, nil)
+			So(ok.err(), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,133 @@
+package mongorestore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/json"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"os"
+)
+
+// jsonToBSONReader converts a stream of extended JSON documents, as written by
+// mongoexport, into a stream of raw BSON documents so it can be fed through
+// the regular BSON restore path.
+type jsonToBSONReader struct {
+	source io.ReadCloser
+	pipe   *io.PipeReader
+}
+
+// newJSONToBSONReader starts converting the JSON in source in the background.
+// Closing the returned reader closes source.
+func newJSONToBSONReader(source io.ReadCloser) io.ReadCloser {
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		decoder := json.NewDecoder(source)
+		for numProcessed := 1; ; numProcessed++ {
+			rawBytes, err := decoder.ScanObject()
+			if err == io.EOF {
+				pipeWriter.Close()
+				return
+			}
+			if err == nil {
+				rawBytes, err = jsonDocumentToBSON(rawBytes)
+			}
+			if err != nil {
+				pipeWriter.CloseWithError(
+					fmt.Errorf("error processing JSON document #%v: %v", numProcessed, err))
+				return
+			}
+			if _, err = pipeWriter.Write(rawBytes); err != nil {
+				// the reader was closed
+				return
+			}
+		}
+	}()
+	return &jsonToBSONReader{source: source, pipe: pipeReader}
+}
+
+// jsonDocumentToBSON converts a single extended JSON document to raw BSON,
+// keeping the order of the fields of the document and of every document
+// nested in it.
+func jsonDocumentToBSON(jsonBytes []byte) ([]byte, error) {
+	document, err := json.UnmarshalBsonD(jsonBytes)
+	if err != nil {
+		return nil, err
+	}
+	document, err = bsonutil.GetExtendedBsonD(document)
+	if err != nil {
+		return nil, err
+	}
+	ordered, err := json.UnmarshalOrderedBsonD(jsonBytes)
+	if err != nil {
+		return nil, err
+	}
+	return bson.Marshal(bsonutil.OrderLike(document, ordered))
+}
+
+func (reader *jsonToBSONReader) Read(p []byte) (int, error) {
+	return reader.pipe.Read(p)
+}
+
+func (reader *jsonToBSONReader) Close() error {
+	reader.pipe.Close()
+	return reader.source.Close()
+}
+
+// jsonSniffLength is the number of bytes at the start of a data file that
+// are looked at to tell JSON from BSON.
+const jsonSniffLength = 64
+
+// bufferedReadCloser reads through a bufio.Reader wrapping a source, and
+// closes the source.
+type bufferedReadCloser struct {
+	*bufio.Reader
+	io.Closer
+}
+
+// checkNotJSON returns a reader with the contents of source, or an error if
+// source looks like JSON, such as a file from mongoexport, rather than BSON.
+// Only the first few bytes are read to tell, so that the mistake is reported
+// before anything is restored instead of as a corrupt BSON document.
+func checkNotJSON(source io.ReadCloser, path string) (io.ReadCloser, error) {
+	// files are checked in place, so that readers after this one can still
+	// tell that they are files
+	file, isFile := source.(*os.File)
+	var header []byte
+	var buffered *bufio.Reader
+	if isFile {
+		header = make([]byte, jsonSniffLength)
+		n, _ := file.ReadAt(header, 0)
+		header = header[:n]
+	} else {
+		buffered = bufio.NewReader(source)
+		header, _ = buffered.Peek(jsonSniffLength)
+	}
+	if looksLikeJSON(header) {
+		source.Close()
+		return nil, fmt.Errorf("%v looks like JSON, such as a mongoexport file, rather than BSON; "+
+			"use mongoimport instead, or give it a .json extension to restore it as extended JSON", path)
+	}
+	if isFile {
+		return file, nil
+	}
+	return &bufferedReadCloser{buffered, source}, nil
+}
+
+// looksLikeJSON returns true if the start of a data file is not a valid
+// BSON document size but, after any whitespace, starts a JSON document or
+// array.
+func looksLikeJSON(header []byte) bool {
+	if len(header) >= 4 {
+		size := int32(binary.LittleEndian.Uint32(header))
+		if size >= 5 && size <= db.MaxBSONSize+16*1024 {
+			return false
+		}
+	}
+	trimmed := bytes.TrimLeft(header, " \t\r\n")
+	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+}
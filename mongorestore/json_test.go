@@ -0,0 +1,97 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestJSONToBSONReader(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a stream of extended JSON documents", t, func() {
+		input := `{"_id":1,"n":{"$numberLong":"5"}}` + "\n" + `{"_id":2,"s":"x"}` + "\n"
+
+		Convey("each document should be decoded as BSON", func() {
+			reader := newJSONToBSONReader(ioutil.NopCloser(strings.NewReader(input)))
+			source := db.NewDecodedBSONSource(db.NewBSONSource(reader))
+			defer source.Close()
+
+			doc := bson.D{}
+			So(source.Next(&doc), ShouldBeTrue)
+			So(doc, ShouldResemble, bson.D{{"_id", float64(1)}, {"n", int64(5)}})
+			doc = bson.D{}
+			So(source.Next(&doc), ShouldBeTrue)
+			So(doc, ShouldResemble, bson.D{{"_id", float64(2)}, {"s", "x"}})
+			So(source.Next(&doc), ShouldBeFalse)
+			So(source.Err(), ShouldBeNil)
+		})
+	})
+
+	Convey("The field order of nested documents should be kept", t, func() {
+		input := `{"_id":{"z":1,"a":{"$oid":"5a1b2c3d4e5f6a7b8c9d0e1f"}},` +
+			`"list":[{"y":1,"b":{"c":2,"a":{"$numberLong":"3"}}}]}`
+		reader := newJSONToBSONReader(ioutil.NopCloser(strings.NewReader(input)))
+		source := db.NewDecodedBSONSource(db.NewBSONSource(reader))
+		defer source.Close()
+
+		doc := bson.D{}
+		So(source.Next(&doc), ShouldBeTrue)
+		So(doc, ShouldResemble, bson.D{
+			{"_id", bson.D{{"z", float64(1)}, {"a", bson.ObjectIdHex("5a1b2c3d4e5f6a7b8c9d0e1f")}}},
+			{"list", []interface{}{
+				bson.D{{"y", float64(1)}, {"b", bson.D{{"c", float64(2)}, {"a", int64(3)}}}},
+			}},
+		})
+	})
+
+	Convey("With invalid JSON the error should be surfaced", t, func() {
+		reader := newJSONToBSONReader(ioutil.NopCloser(strings.NewReader(`{"_id":`)))
+		source := db.NewDecodedBSONSource(db.NewBSONSource(reader))
+		defer source.Close()
+
+		So(source.Next(&bson.D{}), ShouldBeFalse)
+		So(source.Err(), ShouldNotBeNil)
+	})
+}
+
+func TestCheckNotJSON(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("A mongoexport file named as BSON should be rejected", t, func() {
+		file, err := os.Open("testdata/exportedjson/c1.bson")
+		So(err, ShouldBeNil)
+		_, err = checkNotJSON(file, "testdata/exportedjson/c1.bson")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "use mongoimport")
+	})
+
+	Convey("JSON arrays and leading whitespace should be recognized", t, func() {
+		So(looksLikeJSON([]byte(`[{"_id":1}]`)), ShouldBeTrue)
+		So(looksLikeJSON([]byte("  \n\t{\"a\":1}")), ShouldBeTrue)
+	})
+
+	Convey("BSON should be read unchanged", t, func() {
+		for _, doc := range []bson.D{{{"a", 1}}, {{"_id", strings.Repeat("{", 100)}}} {
+			raw, err := bson.Marshal(doc)
+			So(err, ShouldBeNil)
+			reader, err := checkNotJSON(ioutil.NopCloser(bytes.NewReader(raw)), "test.bson")
+			So(err, ShouldBeNil)
+			read, err := ioutil.ReadAll(reader)
+			So(err, ShouldBeNil)
+			So(read, ShouldResemble, raw)
+		}
+	})
+
+	Convey("An empty file should be left to the BSON reader", t, func() {
+		So(looksLikeJSON([]byte{}), ShouldBeFalse)
+	})
+}
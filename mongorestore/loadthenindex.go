@@ -0,0 +1,88 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// isIDIndex returns true if the index is the _id index, which
+// --loadThenIndex never drops. The server always names it _id_; other
+// indexes on _id, such as one with a different collation, are secondary.
+func isIDIndex(index IndexDocument) bool {
+	return index.Options["name"] == "_id_"
+}
+
+// secondaryIndexes returns the indexes other than the _id index.
+func secondaryIndexes(indexes []IndexDocument) []IndexDocument {
+	secondary := []IndexDocument{}
+	for _, index := range indexes {
+		if !isIDIndex(index) {
+			secondary = append(secondary, index)
+		}
+	}
+	return secondary
+}
+
+// dropSecondaryIndexes drops the indexes other than _id from the intent's
+// existing collection before its documents are loaded, and returns those
+// that were dropped so that they can be rebuilt afterward. If dropping one
+// fails, the indexes dropped before it are returned with the error.
+func (restore *MongoRestore) dropSecondaryIndexes(intent *intents.Intent) ([]IndexDocument, error) {
+	session, err := restore.sessionProviderFor(intent.DB).GetSession()
+	if err != nil {
+		return nil, fmt.Errorf("error establishing connection: %v", err)
+	}
+	session.SetSocketTimeout(0)
+	defer session.Close()
+
+	existing, err := listIndexes(session, intent)
+	if err != nil {
+		return nil, err
+	}
+	dropped := []IndexDocument{}
+	for _, index := range secondaryIndexes(existing) {
+		name := fmt.Sprintf("%v", index.Options["name"])
+		res := bson.M{}
+		err = session.DB(intent.DB).Run(bson.D{{"dropIndexes", intent.C}, {"index", name}}, &res)
+		if err == nil && util.IsFalsy(res["ok"]) {
+			err = fmt.Errorf("%v", res["errmsg"])
+		}
+		if err != nil {
+			return dropped, fmt.Errorf("error dropping index %v: %v", name, err)
+		}
+		dropped = append(dropped, index)
+	}
+	if len(dropped) > 0 {
+		log.Logf(log.Always, "dropped %v existing index(es) of %v to rebuild after loading its documents",
+			len(dropped), intent.Namespace())
+	}
+	return dropped, nil
+}
+
+// rebuildDroppedIndexes rebuilds the indexes dropped by --loadThenIndex
+// after the restore of the intent failed with cause. It returns cause, or
+// an error naming both failures if the indexes cannot be rebuilt. A timeout
+// of the intent is returned as it is, so that RestoreIntents recognizes
+// it, and a failure to rebuild is only logged.
+func (restore *MongoRestore) rebuildDroppedIndexes(intent *intents.Intent,
+	dropped []IndexDocument, cause error) error {
+
+	if len(dropped) == 0 {
+		return cause
+	}
+	log.Logf(log.Always, "rebuilding the %v index(es) dropped from %v, since its restore failed",
+		len(dropped), intent.Namespace())
+	err := restore.CreateIndexes(intent, dropped)
+	if err == nil {
+		return cause
+	}
+	if _, ok := cause.(intentTimeoutError); ok {
+		log.Logf(log.Always, "error: failed to rebuild the indexes dropped from %v by --loadThenIndex: %v",
+			intent.Namespace(), err)
+		return cause
+	}
+	return fmt.Errorf("%v; also failed to rebuild the indexes dropped by --loadThenIndex: %v", cause, err)
+}
@@ -0,0 +1,34 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestSecondaryIndexes(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With the indexes of an existing collection", t, func() {
+		indexes := []IndexDocument{
+			{Options: bson.M{"name": "_id_"}, Key: bson.D{{"_id", 1}}},
+			{Options: bson.M{"name": "a_1"}, Key: bson.D{{"a", 1}}},
+			{Options: bson.M{"name": "_id_hashed"}, Key: bson.D{{"_id", "hashed"}}},
+			{Options: bson.M{"name": "_id_1_b_1"}, Key: bson.D{{"_id", 1}, {"b", 1}}},
+		}
+
+		Convey("every index but _id should be dropped", func() {
+			secondary := secondaryIndexes(indexes)
+			So(len(secondary), ShouldEqual, 3)
+			for _, index := range secondary {
+				So(index.Options["name"], ShouldNotEqual, "_id_")
+			}
+		})
+
+		Convey("an index on _id with another name should be a secondary index", func() {
+			So(isIDIndex(IndexDocument{Options: bson.M{"name": "primary"}, Key: bson.D{{"_id", 1}}}), ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,158 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"sync/atomic"
+)
+
+// mergeUpdate returns the _id of a raw document and the update that sets
+// each of its other top-level fields on the document with that _id, leaving
+// the target's other fields as they are. Subdocuments are set whole rather
+// than flattened into dotted paths, so a field removed from a subdocument
+// is removed on the target too.
+func mergeUpdate(data []byte) (interface{}, bson.D, error) {
+	doc := bson.D{}
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("error decoding document to merge: %v", err)
+	}
+	var id interface{}
+	hasID := false
+	fields := bson.D{}
+	for _, elem := range doc {
+		switch {
+		case elem.Name == "_id":
+			id, hasID = elem.Value, true
+		case strings.Contains(elem.Name, ".") || strings.HasPrefix(elem.Name, "$"):
+			// $set would read such a name as a path or an operator
+			return nil, nil, fmt.Errorf("cannot merge field '%v': field names "+
+				"containing '.' or starting with '$' cannot be set with an update", elem.Name)
+		default:
+			fields = append(fields, elem)
+		}
+	}
+	if !hasID {
+		return nil, nil, fmt.Errorf("cannot merge a document without an _id")
+	}
+	if len(fields) == 0 {
+		// an empty $set is an error; setting the _id to itself is a no-op
+		fields = bson.D{{"_id", id}}
+	}
+	return id, bson.D{{"$set", fields}}, nil
+}
+
+// mergeWrites applies the documents of a collection, with
+// --mergeDocuments, as updates by _id that set the documents' fields,
+// keeping any other fields the target documents have. Documents missing
+// from the collection are inserted. Documents the target already has are
+// merged or kept according to the --onConflict policy.
+type mergeWrites struct {
+	restore   *MongoRestore
+	namespace string
+	policy    conflictPolicy
+	// counts of documents, updated atomically by the insertion workers
+	merged, inserted, kept, missingField int64
+}
+
+func newMergeWrites(restore *MongoRestore, namespace string) *mergeWrites {
+	return &mergeWrites{restore: restore, namespace: namespace, policy: restore.conflictPolicy}
+}
+
+// newWriter returns a writer that sends the updates with a
+// BufferedBulkUpdater. With newerWins, an update of a document the target
+// has a newer copy of fails with a duplicate key error on the _id index,
+// which is expected, so its batches are unordered to go on past such errors.
+func (writes *mergeWrites) newWriter(collection *mgo.Collection,
+	flushed func(docCount int, err error)) documentWriter {
+	restore := writes.restore
+	newerWins := writes.policy.mode == conflictNewerWins
+	bulk := db.NewBufferedBulkUpdater(collection, restore.ToolOptions.BulkBufferSize,
+		newerWins || !restore.OutputOptions.StopOnError)
+	bulk.SetRetryPolicy(restore.retryLimit(), restore.retryBackoff())
+	if restore.batchByteLimit > 0 {
+		bulk.SetByteLimit(restore.batchByteLimit)
+	}
+	if newerWins {
+		bulk.SetWriteErrorFilter(func(writeErr db.BulkWriteError) bool {
+			return writeErr.IsDupID()
+		})
+	}
+	writer := &mergeWriter{writes: writes, bulk: bulk}
+	bulk.SetFlushCallback(func(result *db.BulkWriteResult, err error) {
+		writes.count(result, writer.insertOnly[:result.Count])
+		writer.insertOnly = writer.insertOnly[result.Count:]
+		flushed(result.Count, err)
+	})
+	return writer
+}
+
+// count adds up the documents of a batch by what happened to them.
+// insertOnly holds, for each operation of the batch, whether it only sets
+// the document's fields on insert, which keeps a matched target document.
+func (writes *mergeWrites) count(result *db.BulkWriteResult, insertOnly []bool) {
+	skipped := map[int]bool{}
+	for _, upserted := range result.Upserted {
+		skipped[upserted.Index] = true
+	}
+	atomic.AddInt64(&writes.inserted, int64(len(result.Upserted)))
+	for _, writeErr := range result.WriteErrors {
+		skipped[writeErr.Index] = true
+		if writes.policy.mode == conflictNewerWins && writeErr.IsDupID() {
+			// the target's document is at least as new
+			atomic.AddInt64(&writes.kept, 1)
+		}
+	}
+	// the other operations matched a document, up to the number the server
+	// reports, since an ordered batch stops at its first error
+	matched := result.N - len(result.Upserted)
+	for i := 0; i < len(insertOnly) && matched > 0; i++ {
+		if skipped[i] {
+			continue
+		}
+		matched--
+		if insertOnly[i] {
+			atomic.AddInt64(&writes.kept, 1)
+		} else {
+			atomic.AddInt64(&writes.merged, 1)
+		}
+	}
+}
+
+func (writes *mergeWrites) done() {
+	if writes.missingField > 0 {
+		log.Logf(log.Always, "warning: %v document(s) of %v have no %v field to compare, "+
+			"so they were only inserted where the target had no document with their _id",
+			writes.missingField, writes.namespace, writes.policy.field)
+	}
+	log.Logf(log.Always, "merged into %v: %v document(s) updated, %v inserted, %v kept",
+		writes.namespace, writes.merged, writes.inserted, writes.kept)
+}
+
+type mergeWriter struct {
+	writes *mergeWrites
+	bulk   *db.BufferedBulkUpdater
+	// whether each queued update only sets fields on insert
+	insertOnly []bool
+}
+
+// Write queues the update that merges the document into the target.
+func (writer *mergeWriter) Write(doc []byte) error {
+	selector, update, missingField, err := writer.writes.policy.conflictUpdate(doc)
+	if err != nil {
+		return err
+	}
+	if missingField {
+		atomic.AddInt64(&writer.writes.missingField, 1)
+	}
+	// queued before Upsert, which may first send the updates already queued
+	writer.insertOnly = append(writer.insertOnly, update[0].Name == "$setOnInsert")
+	return writer.bulk.Upsert(selector, update)
+}
+
+func (writer *mergeWriter) Flush() error {
+	return writer.bulk.Flush()
+}
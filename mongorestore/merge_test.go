@@ -0,0 +1,256 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/db"
+	commonOpts "github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestMergeUpdate(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("A document should become a $set of its fields by _id", t, func() {
+		data, err := bson.Marshal(bson.D{
+			{"name", "x"},
+			{"_id", 7},
+			{"address", bson.D{{"city", "Oslo"}, {"zip", "0150"}}},
+		})
+		So(err, ShouldBeNil)
+		id, update, err := mergeUpdate(data)
+		So(err, ShouldBeNil)
+		So(id, ShouldEqual, 7)
+		So(update, ShouldResemble, bson.D{{"$set", bson.D{
+			{"name", "x"},
+			{"address", bson.D{{"city", "Oslo"}, {"zip", "0150"}}},
+		}}})
+	})
+
+	Convey("A document with only an _id should still give a valid update", t, func() {
+		data, _ := bson.Marshal(bson.D{{"_id", "a"}})
+		_, update, err := mergeUpdate(data)
+		So(err, ShouldBeNil)
+		So(update, ShouldResemble, bson.D{{"$set", bson.D{{"_id", "a"}}}})
+	})
+
+	Convey("Documents that cannot be merged should be rejected", t, func() {
+		data, _ := bson.Marshal(bson.D{{"name", "x"}})
+		_, _, err := mergeUpdate(data)
+		So(err, ShouldNotBeNil)
+
+		data, _ = bson.Marshal(bson.D{{"_id", 1}, {"a.b", 2}})
+		_, _, err = mergeUpdate(data)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestConflictPolicy(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When parsing --onConflict values", t, func() {
+		Convey("the policies should be recognized", func() {
+			policy, err := parseConflictPolicy("")
+			So(err, ShouldBeNil)
+			So(policy, ShouldResemble, conflictPolicy{mode: conflictDumpWins})
+			policy, err = parseConflictPolicy("targetWins")
+			So(err, ShouldBeNil)
+			So(policy, ShouldResemble, conflictPolicy{mode: conflictTargetWins})
+			policy, err = parseConflictPolicy("newerWins:meta.updatedAt")
+			So(err, ShouldBeNil)
+			So(policy, ShouldResemble, conflictPolicy{conflictNewerWins, "meta.updatedAt"})
+		})
+
+		Convey("bad values should be rejected", func() {
+			for _, value := range []string{"newest", "newerWins", "newerWins:", "newerWins:$ts", "dumpWins:ts"} {
+				_, err := parseConflictPolicy(value)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+
+	Convey("With a document to merge", t, func() {
+		// decoded dates are in local time
+		updated := time.Unix(1462060800, 0)
+		data, err := bson.Marshal(bson.D{
+			{"_id", 7},
+			{"name", "x"},
+			{"meta", bson.D{{"updatedAt", updated}}},
+		})
+		So(err, ShouldBeNil)
+		fields := bson.D{{"name", "x"}, {"meta", bson.D{{"updatedAt", updated}}}}
+
+		Convey("dumpWins should set its fields by _id", func() {
+			selector, update, missingField, err := conflictPolicy{mode: conflictDumpWins}.conflictUpdate(data)
+			So(err, ShouldBeNil)
+			So(missingField, ShouldBeFalse)
+			So(selector, ShouldResemble, bson.D{{"_id", 7}})
+			So(update, ShouldResemble, bson.D{{"$set", fields}})
+		})
+
+		Convey("targetWins should only set its fields on insert", func() {
+			_, update, _, err := conflictPolicy{mode: conflictTargetWins}.conflictUpdate(data)
+			So(err, ShouldBeNil)
+			So(update, ShouldResemble, bson.D{{"$setOnInsert", fields}})
+		})
+
+		Convey("newerWins should only match older target documents", func() {
+			selector, update, missingField, err := conflictPolicy{conflictNewerWins, "meta.updatedAt"}.conflictUpdate(data)
+			So(err, ShouldBeNil)
+			So(missingField, ShouldBeFalse)
+			So(update, ShouldResemble, bson.D{{"$set", fields}})
+			So(selector, ShouldResemble, bson.D{{"_id", 7}, {"$or", []bson.D{
+				{{"meta.updatedAt", bson.D{{"$lt", updated}}}},
+				{{"meta.updatedAt", bson.D{{"$exists", false}}}},
+			}}})
+		})
+
+		Convey("newerWins should only insert documents without the field", func() {
+			selector, update, missingField, err := conflictPolicy{conflictNewerWins, "updatedAt"}.conflictUpdate(data)
+			So(err, ShouldBeNil)
+			So(missingField, ShouldBeTrue)
+			So(selector, ShouldResemble, bson.D{{"_id", 7}})
+			So(update, ShouldResemble, bson.D{{"$setOnInsert", fields}})
+		})
+	})
+}
+
+func TestMergeWritesCount(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("The documents of a batch should be counted by what happened to them", t, func() {
+		// the reply to an update command of 4 upserts
+		reply, err := bson.Marshal(bson.M{
+			"n":        3,
+			"upserted": []bson.M{{"index": 1, "_id": 2}},
+			"writeErrors": []bson.M{{"index": 3, "code": 11000,
+				"errmsg": "E11000 duplicate key error collection: test.c index: _id_ dup key: { : 4 }"}},
+		})
+		So(err, ShouldBeNil)
+		result := &db.BulkWriteResult{}
+		So(bson.Unmarshal(reply, result), ShouldBeNil)
+		result.Count = 4
+
+		Convey("with dumpWins, matched documents should be merged", func() {
+			writes := &mergeWrites{policy: conflictPolicy{mode: conflictDumpWins}}
+			writes.count(result, []bool{false, false, false, false})
+			So(writes.merged, ShouldEqual, 2)
+			So(writes.inserted, ShouldEqual, 1)
+			So(writes.kept, ShouldEqual, 0)
+		})
+
+		Convey("with targetWins, matched documents should be kept", func() {
+			writes := &mergeWrites{policy: conflictPolicy{mode: conflictTargetWins}}
+			writes.count(result, []bool{true, true, true, true})
+			So(writes.merged, ShouldEqual, 0)
+			So(writes.kept, ShouldEqual, 2)
+		})
+
+		Convey("with newerWins, duplicate keys should be kept", func() {
+			writes := &mergeWrites{policy: conflictPolicy{conflictNewerWins, "ts"}}
+			writes.count(result, []bool{false, false, false, false})
+			So(writes.merged, ShouldEqual, 2)
+			So(writes.inserted, ShouldEqual, 1)
+			So(writes.kept, ShouldEqual, 1)
+		})
+
+		Convey("with newerWins, matched documents without the field should be kept", func() {
+			writes := &mergeWrites{policy: conflictPolicy{conflictNewerWins, "ts"}}
+			writes.count(result, []bool{false, false, true, false})
+			So(writes.merged, ShouldEqual, 1)
+			So(writes.inserted, ShouldEqual, 1)
+			So(writes.kept, ShouldEqual, 2)
+		})
+
+		Convey("with newerWins, duplicate keys in other indexes should not be kept", func() {
+			result.WriteErrors[0].ErrMsg = "E11000 duplicate key error collection: test.c index: email_1 dup key: { : \"a\" }"
+			writes := &mergeWrites{policy: conflictPolicy{conflictNewerWins, "ts"}}
+			writes.count(result, []bool{false, false, false, false})
+			So(writes.kept, ShouldEqual, 0)
+			So(result.WriteErrors[0].IsDupID(), ShouldBeFalse)
+		})
+
+		Convey("operations after the error of an ordered batch should not be counted", func() {
+			// the reply to an ordered batch that stopped at its second operation
+			result := &db.BulkWriteResult{Count: 4, N: 1,
+				WriteErrors: []db.BulkWriteError{{Index: 1, Code: 11000, ErrMsg: "E11000 duplicate key error"}}}
+			writes := &mergeWrites{policy: conflictPolicy{mode: conflictDumpWins}}
+			writes.count(result, []bool{false, false, false, false})
+			So(writes.merged, ShouldEqual, 1)
+		})
+	})
+}
+
+const MergeDB = "restore_merge"
+
+func TestRestoreMergeDocuments(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.IntegrationTestType)
+
+	Convey("With a test mongorestore merging documents", t, func() {
+		ssl := testutil.GetSSLOptions()
+		auth := testutil.GetAuthOptions()
+		toolOptions := &commonOpts.ToolOptions{
+			Connection: &commonOpts.Connection{
+				Host: "localhost",
+				Port: db.DefaultTestPort,
+			},
+			Auth:          &auth,
+			SSL:           &ssl,
+			HiddenOptions: &commonOpts.HiddenOptions{},
+		}
+		sessionProvider, err := db.NewSessionProvider(*toolOptions)
+		So(err, ShouldBeNil)
+		events := newEventLog()
+		restore := &MongoRestore{
+			ToolOptions:     toolOptions,
+			InputOptions:    &InputOptions{},
+			OutputOptions:   &OutputOptions{NumInsertionWorkers: 2, MergeDocuments: true},
+			SessionProvider: sessionProvider,
+			Events:          events,
+			progressManager: progress.NewProgressBarManager(ioutil.Discard, time.Second),
+		}
+		session, err := sessionProvider.GetSession()
+		So(err, ShouldBeNil)
+		collection := session.DB(MergeDB).C("c")
+		collection.DropCollection()
+		So(collection.Insert(bson.M{"_id": 1, "a": 1, "kept": true}), ShouldBeNil)
+
+		data := &bytes.Buffer{}
+		for _, doc := range []bson.D{{{"_id", 1}, {"a", 2}}, {{"_id", 2}, {"a", 3}}} {
+			raw, err := bson.Marshal(doc)
+			So(err, ShouldBeNil)
+			data.Write(raw)
+		}
+		source := db.NewDecodedBSONSource(db.NewBSONSource(ioutil.NopCloser(data)))
+
+		Convey("the documents should be merged through the insertion workers", func() {
+			So(restore.restoreDocuments(MergeDB, "c", source, int64(data.Len()), 2), ShouldBeNil)
+			docs := []bson.M{}
+			So(collection.Find(nil).Sort("_id").All(&docs), ShouldBeNil)
+			So(docs, ShouldResemble, []bson.M{{"_id": 1, "a": 2, "kept": true}, {"_id": 2, "a": 3}})
+			So(events.done[MergeDB+".c"], ShouldResemble, [2]int64{2, 0})
+		})
+
+		Convey("with newerWins, documents without the field should only be inserted", func() {
+			restore.conflictPolicy = conflictPolicy{conflictNewerWins, "ts"}
+			So(restore.restoreDocuments(MergeDB, "c", source, int64(data.Len()), 2), ShouldBeNil)
+			docs := []bson.M{}
+			So(collection.Find(nil).Sort("_id").All(&docs), ShouldBeNil)
+			So(docs, ShouldResemble, []bson.M{{"_id": 1, "a": 1, "kept": true}, {"_id": 2, "a": 3}})
+		})
+
+		Reset(func() {
+			session.DB(MergeDB).DropDatabase()
+			session.Close()
+		})
+	})
+}
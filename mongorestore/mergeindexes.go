@@ -0,0 +1,66 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// otherDumpIndexes reads the indexes of the intent's collection from the
+// --mergeIndexesFrom directory: those in its metadata file, replaced by any
+// of the same name in an indexes file from --dumpIndexesSeparately. A
+// collection missing from that dump has no indexes.
+func (restore *MongoRestore) otherDumpIndexes(intent *intents.Intent) ([]IndexDocument, error) {
+	path := intent.MetadataPath
+	if path == "" {
+		path = intent.BSONPath
+	}
+	if path == "" {
+		path = intent.IndexesPath
+	}
+	name, _ := GetInfoFromFilename(path)
+	otherPath, err := restore.counterpartPath(path, restore.InputOptions.MergeIndexesFrom)
+	if err != nil {
+		return nil, err
+	}
+	otherDir := filepath.Dir(otherPath)
+
+	indexes := []IndexDocument{}
+	for _, fileName := range []string{name + ".metadata.json", name + ".indexes.json"} {
+		indexesPath := filepath.Join(otherDir, fileName)
+		if _, err := os.Stat(indexesPath); os.IsNotExist(err) {
+			continue
+		}
+		fileIndexes, err := restore.IndexesFromJSON(indexesPath)
+		if err != nil {
+			return nil, fmt.Errorf("error reading indexes from %v: %v", indexesPath, err)
+		}
+		log.Logf(log.DebugLow, "read %v indexes for %v from %v", len(fileIndexes), intent.Namespace(), indexesPath)
+		indexes = replaceIndexes(indexes, fileIndexes)
+	}
+	return indexes, nil
+}
+
+// mergeIndexesFrom returns the union of the given indexes and those of the
+// same collection in the --mergeIndexesFrom directory. Indexes are matched
+// by name, and the given indexes win when both dumps have one.
+func (restore *MongoRestore) mergeIndexesFrom(intent *intents.Intent, indexes []IndexDocument) ([]IndexDocument, error) {
+	otherIndexes, err := restore.otherDumpIndexes(intent)
+	if err != nil {
+		return nil, err
+	}
+	merged := replaceIndexes(otherIndexes, indexes)
+	if len(merged) > len(indexes) {
+		names := make([]string, 0, len(merged))
+		for _, index := range merged {
+			names = append(names, fmt.Sprintf("%v", index.Options["name"]))
+		}
+		log.Logf(log.Always, "added %v index(es) for %v from %v; building %v",
+			len(merged)-len(indexes), intent.Namespace(), restore.InputOptions.MergeIndexesFrom,
+			strings.Join(names, ", "))
+	}
+	return merged, nil
+}
@@ -0,0 +1,70 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMergeIndexesFrom(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	current, err := ioutil.TempDir("", "mongorestore-current-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(current)
+	older, err := ioutil.TempDir("", "mongorestore-older-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(older)
+
+	Convey("With a dump and an older dump that had more indexes", t, func() {
+		So(os.MkdirAll(filepath.Join(current, "db"), 0755), ShouldBeNil)
+		So(os.MkdirAll(filepath.Join(older, "db"), 0755), ShouldBeNil)
+
+		So(ioutil.WriteFile(filepath.Join(older, "db", "c.metadata.json"), []byte(`{"indexes":[`+
+			`{"v":1,"key":{"a":1},"name":"a_1","ns":"db.c","sparse":true},`+
+			`{"v":1,"key":{"b":1},"name":"b_1","ns":"db.c"}]}`), 0644), ShouldBeNil)
+		currentMetadata := filepath.Join(current, "db", "c.metadata.json")
+		So(ioutil.WriteFile(currentMetadata, []byte(`{"indexes":[`+
+			`{"v":1,"key":{"a":1},"name":"a_1","ns":"db.c"}]}`), 0644), ShouldBeNil)
+
+		restore := &MongoRestore{
+			TargetDirectory: current,
+			InputOptions:    &InputOptions{MergeIndexesFrom: older},
+		}
+		intent := &intents.Intent{
+			DB:           "db",
+			C:            "c",
+			BSONPath:     filepath.Join(current, "db", "c.bson"),
+			MetadataPath: currentMetadata,
+		}
+
+		Convey("the indexes should be merged by name, preferring the restored dump", func() {
+			indexes, err := restore.IndexesFromJSON(currentMetadata)
+			So(err, ShouldBeNil)
+			merged, err := restore.mergeIndexesFrom(intent, indexes)
+			So(err, ShouldBeNil)
+			So(len(merged), ShouldEqual, 2)
+			So(merged[0].Options["name"], ShouldEqual, "b_1")
+			So(merged[1].Options["name"], ShouldEqual, "a_1")
+			So(merged[1].Options["sparse"], ShouldBeNil)
+		})
+
+		Convey("a collection missing from the other dump should keep its indexes", func() {
+			intent.C = "d"
+			intent.MetadataPath = filepath.Join(current, "db", "d.metadata.json")
+			intent.BSONPath = filepath.Join(current, "db", "d.bson")
+			merged, err := restore.mergeIndexesFrom(intent, []IndexDocument{})
+			So(err, ShouldBeNil)
+			So(len(merged), ShouldEqual, 0)
+		})
+	})
+}
@@ -10,8 +10,9 @@ import (
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
-	"os"
+	"io/ioutil"
 	"strings"
+	"time"
 )
 
 // Specially treated restore collection types.
@@ -28,12 +29,33 @@ type authVersionPair struct {
 	Server int
 }
 
-// Metadata holds information about a collection's options and indexes.
+// Metadata holds information about a collection's options, indexes, _id
+// index spec and, for sharded collections, its shard key and whether
+// balancing is disabled.
 type Metadata struct {
-	Options bson.D          `json:"options,omitempty"`
-	Indexes []IndexDocument `json:"indexes"`
+	Options   bson.D          `json:"options,omitempty"`
+	Indexes   []IndexDocument `json:"indexes"`
+	ShardKey  bson.D          `json:"shardKey,omitempty"`
+	NoBalance bool            `json:"noBalance,omitempty"`
+	IDIndex   bson.D          `json:"idIndex,omitempty"`
+
+	// the collection's position in its database when it was dumped
+	CreationOrder int `json:"creationOrder,omitempty"`
+
+	// "rfc3339" if dates were written as plain strings, by mongodump
+	// --metadataDateFormat rfc3339
+	DateFormat string `json:"dateFormat,omitempty"`
+
+	// when dumped directly from a shard, its name and the ranges of the
+	// collection's chunks it owned, for --filterOrphans
+	Shard       string       `json:"shard,omitempty"`
+	OwnedChunks []ownedChunk `json:"ownedChunks,omitempty"`
 }
 
+// metadataDatesRFC3339 is the dateFormat of metadata files whose dates are
+// plain RFC 3339 strings.
+const metadataDatesRFC3339 = "rfc3339"
+
 // this struct is used to read in the options of a set of indexes
 type metaDataMapIndex struct {
 	Indexes []bson.M `json:"indexes"`
@@ -67,9 +89,33 @@ func (restore *MongoRestore) MetadataFromJSON(jsonBytes []byte) (bson.D, []Index
 	if err != nil {
 		return nil, nil, fmt.Errorf("error unmarshalling metadata as map: %v", err)
 	}
+	// the maps lose the order of keys in documents such as a
+	// partialFilterExpression, so it is taken from an ordered decoding
+	ordered, err := json.UnmarshalOrderedBsonD(jsonBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error unmarshalling metadata: %v", err)
+	}
+	orderedIndexes, _ := bsonutil.FindValueByKey("indexes", &ordered)
+	orderedIndexList, _ := orderedIndexes.([]interface{})
 	for i := range meta.Indexes {
 		// remove "key" and "v" from the map versions
 		delete(metaAsMap.Indexes[i], "key")
+
+		// parse the values of the index options, so that extended json in
+		// fields like partialFilterExpression (dates, longs, NaN, Infinity)
+		// is restored as the BSON values it was dumped from
+		var orderedIndex bson.D
+		if i < len(orderedIndexList) {
+			orderedIndex, _ = orderedIndexList[i].(bson.D)
+		}
+		for name, value := range metaAsMap.Indexes[i] {
+			parsed, err := bsonutil.ParseJSONValue(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("extended json in index option '%v': %v", name, err)
+			}
+			orderedValue, _ := bsonutil.FindValueByKey(name, &orderedIndex)
+			metaAsMap.Indexes[i][name] = bsonutil.OrderLike(parsed, orderedValue)
+		}
 		meta.Indexes[i].Options = metaAsMap.Indexes[i]
 
 		// parse the values of the index keys, so we can support extended json
@@ -87,14 +133,134 @@ func (restore *MongoRestore) MetadataFromJSON(jsonBytes []byte) (bson.D, []Index
 		return nil, nil, fmt.Errorf("extended json in 'options': %v", err)
 	}
 
+	if meta.DateFormat == metadataDatesRFC3339 {
+		if meta.Options != nil {
+			meta.Options = bsonutil.DatesFromRFC3339(meta.Options).(bson.D)
+		}
+		for i := range meta.Indexes {
+			meta.Indexes[i].Options = bsonutil.DatesFromRFC3339(meta.Indexes[i].Options).(bson.M)
+		}
+	}
+
 	return meta.Options, meta.Indexes, nil
 }
 
+// ShardingInfo is how a collection dumped through mongos was sharded.
+type ShardingInfo struct {
+	Key       bson.D
+	NoBalance bool
+}
+
+// ShardingFromJSON takes a slice of JSON bytes from a metadata file and
+// returns the sharding settings recorded in it, or nil if the collection
+// was not sharded.
+func (restore *MongoRestore) ShardingFromJSON(jsonBytes []byte) (*ShardingInfo, error) {
+	if len(jsonBytes) == 0 {
+		return nil, nil
+	}
+
+	meta := &Metadata{}
+	err := json.Unmarshal(jsonBytes, meta)
+	if err != nil {
+		return nil, err
+	}
+	if len(meta.ShardKey) == 0 {
+		return nil, nil
+	}
+
+	shardKey, err := bsonutil.GetExtendedBsonD(meta.ShardKey)
+	if err != nil {
+		return nil, fmt.Errorf("extended json in 'shardKey': %v", err)
+	}
+	return &ShardingInfo{Key: shardKey, NoBalance: meta.NoBalance}, nil
+}
+
+// IDIndexFromJSON takes a slice of JSON bytes from a metadata file and returns
+// the _id index spec recorded in it, or nil if there is none.
+func (restore *MongoRestore) IDIndexFromJSON(jsonBytes []byte) (bson.D, error) {
+	if len(jsonBytes) == 0 {
+		return nil, nil
+	}
+
+	meta := &Metadata{}
+	err := json.Unmarshal(jsonBytes, meta)
+	if err != nil {
+		return nil, err
+	}
+	if len(meta.IDIndex) == 0 {
+		return nil, nil
+	}
+
+	idIndex, err := bsonutil.GetExtendedBsonD(meta.IDIndex)
+	if err != nil {
+		return nil, fmt.Errorf("extended json in 'idIndex': %v", err)
+	}
+	if meta.DateFormat == metadataDatesRFC3339 {
+		idIndex = bsonutil.DatesFromRFC3339(idIndex).(bson.D)
+	}
+	return idIndex, nil
+}
+
+// withIDIndex returns the create options with an idIndex option, so that
+// the collection's _id index is built from the dumped spec. This is only
+// done for an _id index with a collation: the server builds any other _id
+// index the same way by itself, and servers before 3.4 reject idIndex.
+func withIDIndex(options, idIndex bson.D, namespace string, keepIndexVersion bool) bson.D {
+	if _, err := bsonutil.FindValueByKey("collation", &idIndex); err != nil {
+		return options
+	}
+	spec := bson.D{}
+	for _, elem := range idIndex {
+		if elem.Name == "ns" || (elem.Name == "v" && !keepIndexVersion) {
+			continue
+		}
+		spec = append(spec, elem)
+	}
+	spec = append(spec, bson.DocElem{"ns", namespace})
+
+	// the _id index is created explicitly, so autoIndexId no longer applies
+	withSpec := bson.D{}
+	for _, option := range options {
+		if option.Name != "autoIndexId" && option.Name != "idIndex" {
+			withSpec = append(withSpec, option)
+		}
+	}
+	return append(withSpec, bson.DocElem{"idIndex", spec})
+}
+
+// IndexesFromJSON reads index definitions from a .indexes.json file written
+// by mongodump --dumpIndexesSeparately. The file has the same layout as the
+// indexes field of a metadata file.
+func (restore *MongoRestore) IndexesFromJSON(indexesFile string) ([]IndexDocument, error) {
+	jsonBytes, err := ioutil.ReadFile(indexesFile)
+	if err != nil {
+		return nil, err
+	}
+	_, indexes, err := restore.MetadataFromJSON(jsonBytes)
+	return indexes, err
+}
+
+// replaceIndexes returns indexes with each index in replacements added to
+// it, replacing any index of the same name.
+func replaceIndexes(indexes, replacements []IndexDocument) []IndexDocument {
+	replaced := map[interface{}]bool{}
+	for _, index := range replacements {
+		replaced[index.Options["name"]] = true
+	}
+	merged := []IndexDocument{}
+	for _, index := range indexes {
+		if !replaced[index.Options["name"]] {
+			merged = append(merged, index)
+		}
+	}
+	return append(merged, replacements...)
+}
+
 // IndexesFromBSON extracts index information from BSON files.
 func (restore *MongoRestore) IndexesFromBSON(intent *intents.Intent, bsonFile string) ([]IndexDocument, error) {
 	log.Logf(log.DebugLow, "scanning %v for indexes on %v collections", bsonFile, intent.C)
 
-	rawFile, err := os.Open(bsonFile)
+	rawFile, err := restore.openDumpFile(bsonFile)
 	if err != nil {
 		return nil, fmt.Errorf("error reading index bson file %v: %v", bsonFile, err)
 	}
@@ -141,7 +307,7 @@ func (restore *MongoRestore) CollectionExists(intent *intents.Intent) (bool, err
 	if restore.knownCollections[intent.DB] == nil {
 		// if the database name isn't in the cache, grab collection
 		// names from the server
-		session, err := restore.SessionProvider.GetSession()
+		session, err := restore.sessionProviderFor(intent.DB).GetSession()
 		if err != nil {
 			return false, fmt.Errorf("error establishing connection: %v", err)
 		}
@@ -183,8 +349,7 @@ func (restore *MongoRestore) CreateIndexes(intent *intents.Intent, indexes []Ind
 			delete(index.Options, "v")
 		}
 	}
-
-	session, err := restore.SessionProvider.GetSession()
+	session, err := restore.sessionProviderFor(intent.DB).GetSession()
 	if err != nil {
 		return fmt.Errorf("error establishing connection: %v", err)
 	}
@@ -192,18 +357,42 @@ func (restore *MongoRestore) CreateIndexes(intent *intents.Intent, indexes []Ind
 	session.SetSocketTimeout(0)
 	defer session.Close()
 
+	var heldTTLIndexes []heldTTLIndex
+	if restore.OutputOptions.DeferTTLIndexes {
+		existing, err := existingIndexNames(session, intent)
+		if err != nil {
+			return fmt.Errorf("error listing indexes of %v: %v", intent.Namespace(), err)
+		}
+		heldTTLIndexes = holdTTLIndexes(intent, indexes, existing)
+	}
+
 	// then attempt the createIndexes command
 	rawCommand := bson.D{
 		{"createIndexes", intent.C},
 		{"indexes", indexes},
 	}
 	results := bson.M{}
-	err = session.DB(intent.DB).Run(rawCommand, &results)
+	if restore.OutputOptions.IndexHeartbeatInterval > 0 {
+		names := make([]string, 0, len(indexes))
+		for _, index := range indexes {
+			names = append(names, fmt.Sprintf("%v", index.Options["name"]))
+		}
+		interval := time.Duration(restore.OutputOptions.IndexHeartbeatInterval) * time.Second
+		stopHeartbeat := restore.startIndexHeartbeat(intent, names, interval)
+		defer stopHeartbeat()
+	}
+	err = restore.retry(session, "index build for "+intent.Namespace(), func() error {
+		return session.DB(intent.DB).Run(rawCommand, &results)
+	})
 	if err == nil {
+		restore.recordHeldTTLIndexes(heldTTLIndexes)
+		for _, index := range indexes {
+			restore.events().OnIndexBuilt(intent.Namespace(), fmt.Sprintf("%v", index.Options["name"]))
+		}
 		return nil
 	}
 	if err.Error() != "no such cmd: createIndexes" {
-		return fmt.Errorf("createIndex error: %v", err)
+		return partialFilterError(indexes, fmt.Errorf("createIndex error: %v", err))
 	}
 
 	// if we're here, the connected server does not support the command, so we fall back
@@ -212,8 +401,15 @@ func (restore *MongoRestore) CreateIndexes(intent *intents.Intent, indexes []Ind
 		log.Logf(log.Info, "\tmanually creating index %v", idx.Options["name"])
 		err = restore.LegacyInsertIndex(intent, idx)
 		if err != nil {
-			return fmt.Errorf("error creating index %v: %v", idx.Options["name"], err)
+			return partialFilterError([]IndexDocument{idx},
+				fmt.Errorf("error creating index %v: %v", idx.Options["name"], err))
 		}
+		for _, held := range heldTTLIndexes {
+			if held.name == fmt.Sprintf("%v", idx.Options["name"]) {
+				restore.recordHeldTTLIndexes([]heldTTLIndex{held})
+			}
+		}
+		restore.events().OnIndexBuilt(intent.Namespace(), fmt.Sprintf("%v", idx.Options["name"]))
 	}
 	return nil
 }
@@ -221,7 +417,7 @@ func (restore *MongoRestore) CreateIndexes(intent *intents.Intent, indexes []Ind
 // LegacyInsertIndex takes in an intent and an index document and attempts to
 // create the index on the "system.indexes" collection.
 func (restore *MongoRestore) LegacyInsertIndex(intent *intents.Intent, index IndexDocument) error {
-	session, err := restore.SessionProvider.GetSession()
+	session, err := restore.sessionProviderFor(intent.DB).GetSession()
 	if err != nil {
 		return fmt.Errorf("error establishing connection: %v", err)
 	}
@@ -249,7 +445,7 @@ func (restore *MongoRestore) CreateCollection(intent *intents.Intent, options bs
 		return err
 	}
 
-	session, err := restore.SessionProvider.GetSession()
+	session, err := restore.sessionProviderFor(intent.DB).GetSession()
 	if err != nil {
 		return fmt.Errorf("error establishing connection: %v", err)
 	}
@@ -267,12 +463,82 @@ func (restore *MongoRestore) CreateCollection(intent *intents.Intent, options bs
 	return nil
 }
 
+// isHashedShardKey returns true if the given shard key is a single hashed
+// field, the only kind of key that supports numInitialChunks.
+func isHashedShardKey(shardKey bson.D) bool {
+	return len(shardKey) == 1 && shardKey[0].Value == "hashed"
+}
+
+// alreadyInitializedCode is the code of the error that servers before 4.0
+// return when enabling sharding of a database that already has it enabled.
+const alreadyInitializedCode = 23
+
+// isAlreadyInitialized returns true if err is the error of enableSharding for
+// a database that already has sharding enabled.
+func isAlreadyInitialized(err error) bool {
+	queryErr, ok := err.(*mgo.QueryError)
+	return ok && queryErr.Code == alreadyInitializedCode
+}
+
+// ShardCollection shards the collection specified in the intent on the given
+// shard key, pre-splitting it into --numInitialChunks chunks, with the
+// collection's balancing as it was dumped. Hashed keys cannot be unique, so
+// the key's recorded uniqueness does not apply.
+func (restore *MongoRestore) ShardCollection(intent *intents.Intent, sharding *ShardingInfo) error {
+	if !isHashedShardKey(sharding.Key) {
+		return fmt.Errorf("--numInitialChunks requires a hashed shard key, "+
+			"but %v is sharded on %v", intent.Namespace(), sharding.Key)
+	}
+
+	session, err := restore.sessionProviderFor(intent.DB).GetSession()
+	if err != nil {
+		return fmt.Errorf("error establishing connection: %v", err)
+	}
+	session.SetSocketTimeout(0)
+	defer session.Close()
+
+	res := bson.M{}
+	err = session.Run(bson.D{{"enableSharding", intent.DB}}, &res)
+	if err != nil && !isAlreadyInitialized(err) {
+		return fmt.Errorf("error running enableSharding command: %v", err)
+	}
+
+	command := bson.D{
+		{"shardCollection", intent.Namespace()},
+		{"key", sharding.Key},
+		{"numInitialChunks", restore.OutputOptions.NumInitialChunks},
+	}
+	res = bson.M{}
+	err = session.Run(command, &res)
+	if err != nil {
+		return fmt.Errorf("error running shardCollection command: %v", err)
+	}
+	if util.IsFalsy(res["ok"]) {
+		return fmt.Errorf("shardCollection command: %v", res["errmsg"])
+	}
+
+	if sharding.NoBalance {
+		log.Logf(log.Info, "disabling balancing of %v, as it was when dumped", intent.Namespace())
+		if err = disableBalancing(session.DB("config").C("collections"), intent.Namespace()); err != nil {
+			return fmt.Errorf("error disabling balancing: %v", err)
+		}
+	}
+	return nil
+}
+
+// disableBalancing marks the sharded collection ns as not to be balanced in
+// collections, the config database's collection of them, as
+// sh.disableBalancing does.
+func disableBalancing(collections *mgo.Collection, ns string) error {
+	return collections.Update(bson.M{"_id": ns}, bson.M{"$set": bson.M{"noBalance": true}})
+}
+
 // RestoreUsersOrRoles accepts a collection type (Users or Roles) and restores the intent
 // in the appropriate collection.
 func (restore *MongoRestore) RestoreUsersOrRoles(collectionType string, intent *intents.Intent) error {
 	log.Logf(log.Always, "restoring %v from %v", collectionType, intent.BSONPath)
 
-	if intent.Size == 0 {
+	if restore.isEmptyDumpFile(intent) {
 		// MongoDB complains if we try and remove a non-existent collection, so we should
 		// just skip auth collections with empty .bson files to avoid gnarly logic later on.
 		log.Logf(log.Always, "%v file '%v' is empty; skipping %v restoration",
@@ -292,7 +558,7 @@ func (restore *MongoRestore) RestoreUsersOrRoles(collectionType string, intent *
 		return fmt.Errorf("cannot use %v as a collection type in RestoreUsersOrRoles", collectionType)
 	}
 
-	rawFile, err := os.Open(intent.BSONPath)
+	rawFile, err := restore.openDumpFile(intent.BSONPath)
 	if err != nil {
 		return fmt.Errorf("error reading index bson file %v: %v", intent.BSONPath, err)
 	}
@@ -312,6 +578,7 @@ func (restore *MongoRestore) RestoreUsersOrRoles(collectionType string, intent *
 	log.Logf(log.DebugLow, "restoring %v to temporary collection", collectionType)
 	err = restore.RestoreCollectionToDB("admin", tempCol, bsonSource, 0)
 	if err != nil {
+		restore.events().OnError("admin."+tempCol, err)
 		return fmt.Errorf("error restoring %v: %v", collectionType, err)
 	}
 
@@ -402,7 +669,7 @@ func (restore *MongoRestore) GetDumpAuthVersion() (int, error) {
 		log.Log(log.Always, "assuming users in the dump directory are from <= 2.4 (auth version 1)")
 		return 1, nil
 	}
-	rawFile, err := os.Open(intent.BSONPath)
+	rawFile, err := restore.openDumpFile(intent.BSONPath)
 	if err != nil {
 		return 0, fmt.Errorf("error reading version bson file %v: %v", intent.BSONPath, err)
 	}
@@ -480,6 +747,10 @@ func (restore *MongoRestore) ShouldRestoreUsersAndRoles() bool {
 	// of users and roles (i.e. used --restoreDbUsersAndRoles, -d admin, or
 	// is doing a full restore), then we check if users or roles BSON files
 	// actually exist in the dump dir. If they do, return true.
+	// Users and roles are documents, so --metadataOnly never restores them.
+	if restore.OutputOptions.MetadataOnly {
+		return false
+	}
 	if restore.InputOptions.RestoreDBUsersAndRoles ||
 		restore.ToolOptions.DB == "" ||
 		restore.ToolOptions.DB == "admin" {
@@ -492,7 +763,7 @@ func (restore *MongoRestore) ShouldRestoreUsersAndRoles() bool {
 
 // DropCollection drops the intent's collection.
 func (restore *MongoRestore) DropCollection(intent *intents.Intent) error {
-	session, err := restore.SessionProvider.GetSession()
+	session, err := restore.sessionProviderFor(intent.DB).GetSession()
 	if err != nil {
 		return fmt.Errorf("error establishing connection: %v", err)
 	}
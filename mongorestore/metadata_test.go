@@ -1,13 +1,23 @@
 package mongorestore
 
 import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
 	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/json"
 	commonOpts "github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/testutil"
+	"github.com/mongodb/mongo-tools/mongodump"
 	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 const ExistsDB = "restore_collection_exists"
@@ -166,3 +176,425 @@ func TestGetDumpAuthVersion(t *testing.T) {
 	})
 
 }
+
+func TestShardingFromJSON(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a test mongorestore", t, func() {
+		restore := &MongoRestore{}
+
+		Convey("a hashed shard key should be read from the metadata", func() {
+			sharding, err := restore.ShardingFromJSON(
+				[]byte(`{"indexes":[],"shardKey":{"userId":"hashed"}}`))
+			So(err, ShouldBeNil)
+			So(sharding.Key, ShouldResemble, bson.D{{"userId", "hashed"}})
+			So(isHashedShardKey(sharding.Key), ShouldBeTrue)
+			So(sharding.NoBalance, ShouldBeFalse)
+		})
+
+		Convey("a ranged shard key should be read but not be considered hashed", func() {
+			sharding, err := restore.ShardingFromJSON(
+				[]byte(`{"indexes":[],"shardKey":{"a":1,"b":1}}`))
+			So(err, ShouldBeNil)
+			So(len(sharding.Key), ShouldEqual, 2)
+			So(isHashedShardKey(sharding.Key), ShouldBeFalse)
+		})
+
+		Convey("disabled balancing should be read", func() {
+			sharding, err := restore.ShardingFromJSON(
+				[]byte(`{"indexes":[],"shardKey":{"a":"hashed"},"noBalance":true}`))
+			So(err, ShouldBeNil)
+			So(sharding.NoBalance, ShouldBeTrue)
+		})
+
+		Convey("metadata without a shard key should return nil", func() {
+			sharding, err := restore.ShardingFromJSON([]byte(`{"indexes":[]}`))
+			So(err, ShouldBeNil)
+			So(sharding, ShouldBeNil)
+		})
+	})
+}
+
+func TestIsAlreadyInitialized(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Only enableSharding's error for an enabled database should be ignored", t, func() {
+		So(isAlreadyInitialized(&mgo.QueryError{Code: 23, Message: "sharding already enabled for database test"}),
+			ShouldBeTrue)
+		So(isAlreadyInitialized(&mgo.QueryError{Code: 13, Message: "not authorized, already enabled"}),
+			ShouldBeFalse)
+		So(isAlreadyInitialized(fmt.Errorf("sharding already enabled")), ShouldBeFalse)
+	})
+}
+
+const BalancingDB = "restore_disable_balancing"
+
+func TestDisableBalancing(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.IntegrationTestType)
+
+	Convey("With a stand-in for the config database's collections", t, func() {
+		ssl := testutil.GetSSLOptions()
+		auth := testutil.GetAuthOptions()
+		sessionProvider, err := db.NewSessionProvider(commonOpts.ToolOptions{
+			Connection: &commonOpts.Connection{
+				Host: "localhost",
+				Port: db.DefaultTestPort,
+			},
+			Auth: &auth,
+			SSL:  &ssl,
+		})
+		So(err, ShouldBeNil)
+		session, err := sessionProvider.GetSession()
+		So(err, ShouldBeNil)
+		collections := session.DB(BalancingDB).C("collections")
+		So(collections.Insert(bson.M{"_id": "test.c", "key": bson.M{"a": "hashed"}}), ShouldBeNil)
+
+		Convey("the collection should be marked as not to be balanced", func() {
+			So(disableBalancing(collections, "test.c"), ShouldBeNil)
+			result := bson.M{}
+			So(collections.FindId("test.c").One(&result), ShouldBeNil)
+			So(result["noBalance"], ShouldEqual, true)
+			So(result["key"], ShouldNotBeNil)
+		})
+
+		Convey("a collection that is not sharded should be an error", func() {
+			So(disableBalancing(collections, "test.other"), ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			session.DB(BalancingDB).DropDatabase()
+			session.Close()
+		})
+	})
+}
+
+func TestIDIndexFromJSON(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a test mongorestore", t, func() {
+		restore := &MongoRestore{}
+
+		Convey("an _id index with a collation should be added to the create options", func() {
+			idIndex, err := restore.IDIndexFromJSON([]byte(`{"indexes":[],` +
+				`"idIndex":{"v":2,"key":{"_id":1},"name":"_id_","ns":"a.b","collation":{"locale":"fr"}}}`))
+			So(err, ShouldBeNil)
+			So(len(idIndex), ShouldEqual, 5)
+
+			options := withIDIndex(bson.D{{"autoIndexId", true}, {"capped", true}}, idIndex, "c.d", false)
+			So(len(options), ShouldEqual, 2)
+			So(options[0].Name, ShouldEqual, "capped")
+			So(options[1].Name, ShouldEqual, "idIndex")
+			spec := options[1].Value.(bson.D)
+			names := []string{}
+			for _, elem := range spec {
+				names = append(names, elem.Name)
+			}
+			So(names, ShouldResemble, []string{"key", "name", "collation", "ns"})
+			So(spec[3].Value, ShouldEqual, "c.d")
+
+			options = withIDIndex(nil, idIndex, "c.d", true)
+			So(len(options[0].Value.(bson.D)), ShouldEqual, 5)
+		})
+
+		Convey("an _id index without a collation should leave the options alone", func() {
+			idIndex, err := restore.IDIndexFromJSON(
+				[]byte(`{"indexes":[],"idIndex":{"v":2,"key":{"_id":1},"name":"_id_"}}`))
+			So(err, ShouldBeNil)
+			options := bson.D{{"capped", true}}
+			So(withIDIndex(options, idIndex, "c.d", false), ShouldResemble, options)
+		})
+
+		Convey("metadata without an _id index should return nil", func() {
+			idIndex, err := restore.IDIndexFromJSON([]byte(`{"indexes":[]}`))
+			So(err, ShouldBeNil)
+			So(idIndex, ShouldBeNil)
+		})
+	})
+}
+
+func TestSpecialValuesInIndexOptions(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With an index whose partial filter uses special numeric values", t, func() {
+		restore := &MongoRestore{}
+		index := bson.D{
+			{"v", 1},
+			{"key", bson.D{{"a", 1}}},
+			{"name", "a_1"},
+			{"partialFilterExpression", bson.D{{"a", bson.D{
+				{"$gt", math.Inf(-1)},
+				{"$lt", math.Inf(1)},
+				{"$ne", math.NaN()},
+			}}}},
+		}
+
+		Convey("the values should survive a dump and restore of the metadata", func() {
+			converted, err := bsonutil.ConvertBSONValueToJSON(index)
+			So(err, ShouldBeNil)
+			jsonBytes, err := json.Marshal(bson.M{"indexes": []interface{}{converted}})
+			So(err, ShouldBeNil)
+
+			_, indexes, err := restore.MetadataFromJSON(jsonBytes)
+			So(err, ShouldBeNil)
+			So(len(indexes), ShouldEqual, 1)
+			filter, ok := indexes[0].Options["partialFilterExpression"].(bson.D)
+			So(ok, ShouldBeTrue)
+			bounds, ok := filter.Map()["a"].(bson.D)
+			So(ok, ShouldBeTrue)
+			So(math.IsInf(bounds.Map()["$gt"].(float64), -1), ShouldBeTrue)
+			So(math.IsInf(bounds.Map()["$lt"].(float64), 1), ShouldBeTrue)
+			So(math.IsNaN(bounds.Map()["$ne"].(float64)), ShouldBeTrue)
+		})
+
+		Convey("canonical $numberDouble strings should be parsed", func() {
+			jsonBytes := []byte(`{"indexes":[{"v":1,"key":{"a":1},"name":"a_1",` +
+				`"partialFilterExpression":{"a":{"$lt":{"$numberDouble":"-Infinity"}}}}]}`)
+			_, indexes, err := restore.MetadataFromJSON(jsonBytes)
+			So(err, ShouldBeNil)
+			filter := indexes[0].Options["partialFilterExpression"].(bson.D).Map()
+			bound := filter["a"].(bson.D).Map()["$lt"]
+			So(math.IsInf(bound.(float64), -1), ShouldBeTrue)
+		})
+
+		Convey("Decimal128 values should be rejected rather than restored as documents", func() {
+			jsonBytes := []byte(`{"indexes":[{"v":1,"key":{"a":1},"name":"a_1",` +
+				`"partialFilterExpression":{"a":{"$gt":{"$numberDecimal":"1.5"}}}}]}`)
+			_, _, err := restore.MetadataFromJSON(jsonBytes)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestMetadataOnlyDumpStats(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("The metadata of mongodump --dumpMetadataOnly should be restored without its stats", t, func() {
+		restore := &MongoRestore{}
+		jsonBytes := []byte(`{"options":{"capped":true,"size":4096},` +
+			`"indexes":[{"v":2,"key":{"_id":1},"name":"_id_"}],` +
+			`"stats":{"count":10,"size":330,"storageSize":4096,"nindexes":1,"totalIndexSize":4096}}`)
+		options, indexes, err := restore.MetadataFromJSON(jsonBytes)
+		So(err, ShouldBeNil)
+		So(options.Map()["capped"], ShouldEqual, true)
+		So(len(indexes), ShouldEqual, 1)
+		So(indexes[0].Options["name"], ShouldEqual, "_id_")
+	})
+}
+
+func TestMetadataDateFormats(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With an index whose partial filter compares against a date", t, func() {
+		restore := &MongoRestore{}
+		date := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+		Convey("extended JSON $date values should be restored as dates", func() {
+			jsonBytes := []byte(`{"indexes":[{"v":1,"key":{"a":1},"name":"a_1",` +
+				`"partialFilterExpression":{"a":{"$lt":{"$date":"2020-01-02T03:04:05.000Z"}}}}]}`)
+			_, indexes, err := restore.MetadataFromJSON(jsonBytes)
+			So(err, ShouldBeNil)
+			filter := indexes[0].Options["partialFilterExpression"].(bson.D).Map()
+			bound := filter["a"].(bson.D).Map()["$lt"]
+			So(bound.(time.Time).Equal(date), ShouldBeTrue)
+		})
+
+		Convey("RFC 3339 strings should be restored as dates with dateFormat rfc3339", func() {
+			jsonBytes := []byte(`{"dateFormat":"rfc3339","options":{"validator":{"d":{"$gt":"2020-01-02T03:04:05.000Z"}}},` +
+				`"indexes":[{"v":1,"key":{"a":1},"name":"a_1",` +
+				`"partialFilterExpression":{"a":{"$lt":"2020-01-02T03:04:05.000Z"}}}]}`)
+			options, indexes, err := restore.MetadataFromJSON(jsonBytes)
+			So(err, ShouldBeNil)
+			filter := indexes[0].Options["partialFilterExpression"].(bson.D).Map()
+			bound := filter["a"].(bson.D).Map()["$lt"]
+			So(bound.(time.Time).Equal(date), ShouldBeTrue)
+			validator, err := bsonutil.FindValueByKey("validator", &options)
+			So(err, ShouldBeNil)
+			So(validator, ShouldNotBeNil)
+		})
+
+		Convey("RFC 3339 strings should stay strings without dateFormat", func() {
+			jsonBytes := []byte(`{"indexes":[{"v":1,"key":{"a":1},"name":"a_1",` +
+				`"partialFilterExpression":{"a":{"$lt":"2020-01-02T03:04:05.000Z"}}}]}`)
+			_, indexes, err := restore.MetadataFromJSON(jsonBytes)
+			So(err, ShouldBeNil)
+			filter := indexes[0].Options["partialFilterExpression"].(bson.D).Map()
+			So(filter["a"].(bson.D).Map()["$lt"], ShouldEqual, "2020-01-02T03:04:05.000Z")
+		})
+
+		Convey("RFC 3339 strings should keep their milliseconds", func() {
+			jsonBytes := []byte(`{"dateFormat":"rfc3339","indexes":[{"v":1,"key":{"a":1},"name":"a_1",` +
+				`"partialFilterExpression":{"a":{"$lt":"1969-12-31T23:59:59.999Z"}}}]}`)
+			_, indexes, err := restore.MetadataFromJSON(jsonBytes)
+			So(err, ShouldBeNil)
+			filter := indexes[0].Options["partialFilterExpression"].(bson.D).Map()
+			bound := filter["a"].(bson.D).Map()["$lt"]
+			So(bound.(time.Time).Equal(time.Date(1969, 12, 31, 23, 59, 59, 999e6, time.UTC)), ShouldBeTrue)
+		})
+
+		Convey("$date values with $numberLong should be restored as dates with dateFormat rfc3339", func() {
+			farDate := time.Date(12000, 1, 1, 0, 0, 0, 0, time.UTC)
+			jsonBytes := []byte(fmt.Sprintf(`{"dateFormat":"rfc3339","indexes":[{"v":1,"key":{"a":1},"name":"a_1",`+
+				`"partialFilterExpression":{"a":{"$lt":{"$date":{"$numberLong":"%v"}}}}}]}`,
+				farDate.Unix()*1000))
+			_, indexes, err := restore.MetadataFromJSON(jsonBytes)
+			So(err, ShouldBeNil)
+			filter := indexes[0].Options["partialFilterExpression"].(bson.D).Map()
+			bound := filter["a"].(bson.D).Map()["$lt"]
+			So(bound.(time.Time).Equal(farDate), ShouldBeTrue)
+		})
+
+		Convey("the _id index should be restored with dates with dateFormat rfc3339", func() {
+			jsonBytes := []byte(`{"dateFormat":"rfc3339","idIndex":{"v":2,"key":{"_id":1},"name":"_id_",` +
+				`"since":"2020-01-02T03:04:05.000Z"}}`)
+			idIndex, err := restore.IDIndexFromJSON(jsonBytes)
+			So(err, ShouldBeNil)
+			since, err := bsonutil.FindValueByKey("since", &idIndex)
+			So(err, ShouldBeNil)
+			So(since.(time.Time).Equal(date), ShouldBeTrue)
+		})
+	})
+}
+
+const EmptyCollectionsDB = "restore_empty_collections"
+
+func TestRestoreEmptyCollections(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.IntegrationTestType)
+
+	Convey("With a dump of a database whose collections are empty", t, func() {
+		ssl := testutil.GetSSLOptions()
+		auth := testutil.GetAuthOptions()
+		toolOptions := &commonOpts.ToolOptions{
+			Connection: &commonOpts.Connection{
+				Host: "localhost",
+				Port: db.DefaultTestPort,
+			},
+			Auth:          &auth,
+			SSL:           &ssl,
+			Namespace:     &commonOpts.Namespace{DB: EmptyCollectionsDB},
+			HiddenOptions: &commonOpts.HiddenOptions{},
+		}
+		sessionProvider, err := db.NewSessionProvider(*toolOptions)
+		So(err, ShouldBeNil)
+		restore := &MongoRestore{
+			ToolOptions:     toolOptions,
+			InputOptions:    &InputOptions{},
+			OutputOptions:   &OutputOptions{NumParallelCollections: 1, NumInsertionWorkers: 1},
+			SessionProvider: sessionProvider,
+			TargetDirectory: "testdata/emptycollections/db1",
+		}
+		session, err := sessionProvider.GetSession()
+		So(err, ShouldBeNil)
+		session.DB(EmptyCollectionsDB).DropDatabase()
+
+		Convey("every collection should exist after the restore, even without indexes", func() {
+			restore.OutputOptions.NoIndexRestore = true
+			So(restore.Restore(), ShouldBeNil)
+
+			names, err := session.DB(EmptyCollectionsDB).CollectionNames()
+			So(err, ShouldBeNil)
+			So(names, ShouldContain, "emptybson")
+			So(names, ShouldContain, "metadataonly")
+			So(names, ShouldContain, "noindexes")
+
+			count, err := session.DB(EmptyCollectionsDB).C("metadataonly").Count()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 0)
+		})
+
+		Reset(func() {
+			session.DB(EmptyCollectionsDB).DropDatabase()
+			session.Close()
+		})
+	})
+}
+
+const CollatedIDDB = "restore_collated_id"
+
+func TestCollatedIDIndexRoundTrip(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.IntegrationTestType)
+
+	Convey("With a dump of a collection whose _id index has a collation", t, func() {
+		ssl := testutil.GetSSLOptions()
+		auth := testutil.GetAuthOptions()
+		toolOptions := &commonOpts.ToolOptions{
+			Connection: &commonOpts.Connection{
+				Host: "localhost",
+				Port: db.DefaultTestPort,
+			},
+			Auth:          &auth,
+			SSL:           &ssl,
+			Namespace:     &commonOpts.Namespace{DB: CollatedIDDB},
+			HiddenOptions: &commonOpts.HiddenOptions{},
+			Verbosity:     &commonOpts.Verbosity{},
+		}
+		sessionProvider, err := db.NewSessionProvider(*toolOptions)
+		So(err, ShouldBeNil)
+		session, err := sessionProvider.GetSession()
+		So(err, ShouldBeNil)
+		database := session.DB(CollatedIDDB)
+		database.DropDatabase()
+
+		collation := bson.D{{"locale", "fr"}, {"strength", 2}}
+		So(database.Run(bson.D{{"create", "c"}, {"collation", collation}}, nil), ShouldBeNil)
+		So(database.C("c").Insert(bson.M{"_id": "a"}), ShouldBeNil)
+
+		dir, err := ioutil.TempDir("", "mongorestore-collated-id-")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		dump := &mongodump.MongoDump{
+			ToolOptions:   toolOptions,
+			InputOptions:  &mongodump.InputOptions{},
+			OutputOptions: &mongodump.OutputOptions{Out: dir},
+		}
+		So(dump.Init(), ShouldBeNil)
+		So(dump.Dump(), ShouldBeNil)
+		So(database.DropDatabase(), ShouldBeNil)
+
+		Convey("the restored _id index should keep its collation", func() {
+			restore := &MongoRestore{
+				ToolOptions:     toolOptions,
+				InputOptions:    &InputOptions{},
+				OutputOptions:   &OutputOptions{NumParallelCollections: 1, NumInsertionWorkers: 1},
+				SessionProvider: sessionProvider,
+				TargetDirectory: filepath.Join(dir, CollatedIDDB),
+			}
+			So(restore.Restore(), ShouldBeNil)
+
+			result := struct {
+				Cursor struct {
+					FirstBatch []bson.D `bson:"firstBatch"`
+				} `bson:"cursor"`
+			}{}
+			So(database.Run(bson.D{{"listIndexes", "c"}}, &result), ShouldBeNil)
+			var idIndex bson.D
+			for _, index := range result.Cursor.FirstBatch {
+				if name, _ := bsonutil.FindValueByKey("name", &index); name == "_id_" {
+					idIndex = index
+				}
+			}
+			So(idIndex, ShouldNotBeNil)
+			restored, err := bsonutil.FindValueByKey("collation", &idIndex)
+			So(err, ShouldBeNil)
+			restoredCollation := restored.(bson.D).Map()
+			So(restoredCollation["locale"], ShouldEqual, "fr")
+			So(restoredCollation["strength"], ShouldEqual, 2)
+
+			// the collation is what makes "A" a duplicate of "a"
+			So(mgo.IsDup(database.C("c").Insert(bson.M{"_id": "A"})), ShouldBeTrue)
+		})
+
+		Reset(func() {
+			database.DropDatabase()
+			session.Close()
+		})
+	})
+}
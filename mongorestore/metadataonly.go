@@ -0,0 +1,42 @@
+package mongorestore
+
+// metadataOnlyConflicts returns the flags set in the given options that only
+// affect how documents are read or inserted, and so make no sense with
+// --metadataOnly.
+func metadataOnlyConflicts(input *InputOptions, output *OutputOptions, targetDirectory string) []string {
+	conflicts := []string{}
+	if targetDirectory == "-" || input.Directory == "-" {
+		conflicts = append(conflicts, "restoring from stdin")
+	}
+	if input.DiffAgainst != "" {
+		conflicts = append(conflicts, "--diffAgainst")
+	}
+	if input.OplogReplay {
+		conflicts = append(conflicts, "--oplogReplay")
+	}
+	if input.RestoreDBUsersAndRoles {
+		conflicts = append(conflicts, "--restoreDbUsersAndRoles")
+	}
+	if output.MaintainInsertionOrder {
+		conflicts = append(conflicts, "--maintainInsertionOrder")
+	}
+	if output.InsertOrder == insertOrderReverse {
+		conflicts = append(conflicts, "--insertOrder "+insertOrderReverse)
+	}
+	if len(output.ExcludeFields) > 0 {
+		conflicts = append(conflicts, "--excludeField")
+	}
+	if output.ExcludeFieldsFile != "" {
+		conflicts = append(conflicts, "--excludeFieldsFile")
+	}
+	if len(output.RawSystemCollections) > 0 {
+		conflicts = append(conflicts, "--rawSystemCollections")
+	}
+	if output.CollectionWriteConcern != "" {
+		conflicts = append(conflicts, "--collectionWriteConcern")
+	}
+	if output.TransformCmd != "" {
+		conflicts = append(conflicts, "--transformCmd")
+	}
+	return conflicts
+}
@@ -0,0 +1,44 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestMetadataOnlyConflicts(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --metadataOnly", t, func() {
+
+		Convey("the default options should not conflict", func() {
+			input := &InputOptions{}
+			output := &OutputOptions{InsertOrder: insertOrderForward}
+			So(metadataOnlyConflicts(input, output, "dump"), ShouldBeEmpty)
+		})
+
+		Convey("options that only matter for inserted data should be reported", func() {
+			input := &InputOptions{OplogReplay: true}
+			output := &OutputOptions{
+				InsertOrder:   insertOrderReverse,
+				ExcludeFields: []string{"a.b"},
+				TransformCmd:  "cat",
+			}
+			So(metadataOnlyConflicts(input, output, "-"), ShouldResemble, []string{
+				"restoring from stdin", "--oplogReplay", "--insertOrder reverse",
+				"--excludeField", "--transformCmd",
+			})
+		})
+
+		Convey("options for collections and indexes should be allowed", func() {
+			input := &InputOptions{}
+			output := &OutputOptions{
+				InsertOrder:      insertOrderForward,
+				Drop:             true,
+				WaitForIndexes:   true,
+				StorageOverrides: "overrides.json",
+			}
+			So(metadataOnlyConflicts(input, output, "dump"), ShouldBeEmpty)
+		})
+	})
+}
@@ -7,12 +7,18 @@ import (
 	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/intents"
 	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/metrics"
+	"github.com/mongodb/mongo-tools/common/notify"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/progress"
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
+	"net"
+	"os"
+	"strings"
 	"sync"
+	"time"
 )
 
 // MongoRestore is a container for the user-specified options and
@@ -24,8 +30,20 @@ type MongoRestore struct {
 
 	SessionProvider *db.SessionProvider
 
+	// session providers authenticated by the --authSourcesFile, by the
+	// name of the database they are used for
+	authSourceProviders map[string]*db.SessionProvider
+
 	TargetDirectory string
 
+	// Events, if set, is notified of restore lifecycle events
+	Events EventHandler
+
+	// ProgressConn, if set, receives the restore's events and progress as
+	// newline-delimited JSON, like consumers of --progressSocket; it is left
+	// open for its owner to close
+	ProgressConn net.Conn
+
 	tempUsersCol string
 	tempRolesCol string
 
@@ -33,17 +51,99 @@ type MongoRestore struct {
 	manager         *intents.Manager
 	safety          *mgo.Safe
 	progressManager *progress.Manager
+	metrics         *metrics.TransferMetrics
 
 	objCheck         bool
+	transforms       []documentTransform
 	oplogLimit       bson.MongoTimestamp
 	useStdin         bool
 	isMongos         bool
 	useWriteCommands bool
+	configServerMode bool
 	authVersions     authVersionPair
 
 	// a map of database names to a list of collection names
 	knownCollections      map[string][]string
 	knownCollectionsMutex sync.Mutex
+
+	// databases that did not exist on the target, whose collections are
+	// created explicitly because of --createDatabases
+	createdDatabases map[string]bool
+
+	// system collection namespaces mapped to plain collections by --rawSystemCollections
+	rawSystemCollections map[string]string
+
+	// --nsRewriteFile mappings, and the dumped namespace each restored
+	// namespace was rewritten from
+	nsRewrites    []nsRewriteRule
+	rewrittenFrom map[string]string
+
+	// the first data file found for each namespace, and descriptions of
+	// the other data files found for the same namespaces
+	dataFilePaths      map[string]string
+	duplicateDataFiles []string
+
+	// the namespace each dumped collection is restored to, by its dumped
+	// namespace, for replaying the oplog
+	restoredNamespaces map[string]string
+
+	// write concerns from --collectionWriteConcern that replace safety, by namespace
+	collectionSafety map[string]*mgo.Safe
+
+	// collection create options from --storageOverrides, by namespace
+	storageOverrides map[string]bson.D
+
+	// total document bytes at which to end an insert batch, from
+	// --batchSizeFactor; 0 leaves the inserter's default
+	batchByteLimit int
+
+	// size of the ranges of a .bson file to read in parallel, from
+	// --collectionChunkSize; 0 reads each file as one stream
+	collectionChunkSize int64
+
+	// TTL indexes built by --deferTTLIndexes whose expiry is reset after
+	// the restore
+	heldTTLIndexes      []heldTTLIndex
+	heldTTLIndexesMutex sync.Mutex
+
+	// the oplog.metadata.json describing the dump's oplog, if it has one
+	oplogMetadataPath string
+
+	// per-database outcomes with --perDatabaseIsolation; nil otherwise
+	isolation *databaseIsolation
+
+	// what --mergeDocuments does with documents the target already has,
+	// from --onConflict
+	conflictPolicy conflictPolicy
+
+	// --filterOrphans filters of sharded collections, by namespace
+	orphanFilters      map[string]*orphanFilter
+	orphanFiltersMutex sync.Mutex
+
+	// compressed data files being restored, by namespace
+	gzipFiles      map[string]*gzipDumpFile
+	gzipFilesMutex sync.Mutex
+
+	// publishes events and progress to --progressSocket and ProgressConn
+	progressStream *progressStream
+
+	// insertion rate limiters from --collectionRateLimit, by namespace
+	rateLimiters map[string]*util.RateLimiter
+
+	// time left for retries across the whole restore, from --maxRetryTime;
+	// nil is unlimited
+	retryBudget *util.RetryBudget
+
+	// namespaces (e.g. "test.fs") of GridFS buckets with both halves being restored
+	gridFSBuckets map[string]bool
+
+	// namespaces abandoned by the --intentTimeout watchdog
+	timedOutIntents      []string
+	timedOutIntentsMutex sync.Mutex
+
+	// namespaces whose indexes failed --verifyIndexes
+	indexMismatches      []string
+	indexMismatchesMutex sync.Mutex
 }
 
 // ParseAndValidateOptions returns a non-nil error if user-supplied options are invalid.
@@ -52,6 +152,8 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 	// and we need to be able to see if they're both being used. We default to
 	// true here and then see if noobjcheck is enabled.
 	log.Log(log.DebugHigh, "checking options")
+	log.Logf(log.DebugHigh, "\tconnecting to %v as user '%v'",
+		restore.ToolOptions.Host, restore.ToolOptions.Username)
 	if restore.InputOptions.Objcheck {
 		restore.objCheck = true
 		log.Log(log.DebugHigh, "\tdumping with object check enabled")
@@ -80,7 +182,19 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 		return fmt.Errorf("cannot use --restoreDbUsersAndRoles with the admin database")
 	}
 
+	switch restore.InputOptions.PreferFormat {
+	case "", "bson", "json":
+	default:
+		return fmt.Errorf("--preferFormat must be either 'bson' or 'json', not '%v'",
+			restore.InputOptions.PreferFormat)
+	}
+
 	var err error
+	if restore.OutputOptions.AuthSourcesFile != "" {
+		if err = restore.loginAuthSources(restore.OutputOptions.AuthSourcesFile); err != nil {
+			return err
+		}
+	}
 	restore.isMongos, err = restore.SessionProvider.IsMongos()
 	if err != nil {
 		return err
@@ -89,6 +203,25 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 		log.Log(log.DebugLow, "restoring to a sharded system")
 	}
 
+	if restore.OutputOptions.ConfigServer {
+		if restore.isMongos {
+			return fmt.Errorf("--configsvr requires connecting directly to a config server, not through mongos")
+		}
+		if restore.ToolOptions.DB != "" && restore.ToolOptions.DB != "config" {
+			return fmt.Errorf("--configsvr can only restore the config database")
+		}
+		isConfigServer, err := restore.SessionProvider.IsConfigServer()
+		if err != nil {
+			return fmt.Errorf("error determining whether the connected server is a config server: %v", err)
+		}
+		if !isConfigServer {
+			return fmt.Errorf("--configsvr was specified, but the connected server is not a config server")
+		}
+		log.Log(log.Always, "restoring the config database to a config server; "+
+			"make sure all mongos and shard processes are stopped before restoring")
+		restore.configServerMode = true
+	}
+
 	if restore.InputOptions.OplogLimit != "" {
 		if !restore.InputOptions.OplogReplay {
 			return fmt.Errorf("cannot use --oplogLimit without --oplogReplay enabled")
@@ -99,6 +232,13 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 		}
 	}
 
+	if restore.InputOptions.OplogBatchSize < 0 {
+		return fmt.Errorf("--oplogBatchSize must not be negative")
+	}
+	if restore.InputOptions.OplogBatchSize > 0 && !restore.InputOptions.OplogReplay {
+		return fmt.Errorf("cannot use --oplogBatchSize without --oplogReplay enabled")
+	}
+
 	// check if we are using a replica set and fall back to w=1 if we aren't (for <= 2.4)
 	nodeType, err := restore.SessionProvider.GetNodeType()
 	if err != nil {
@@ -108,7 +248,15 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 	log.Logf(log.DebugLow, "connected to node type: %v", nodeType)
 	restore.safety, err = db.BuildWriteConcern(restore.OutputOptions.WriteConcern, nodeType)
 	if err != nil {
-		return fmt.Errorf("error parsing write concern: %v", err)
+		return WriteConcernError{"error parsing write concern", err}
+	}
+	if restore.OutputOptions.CollectionWriteConcern != "" {
+		restore.collectionSafety, err = readCollectionWriteConcerns(
+			restore.OutputOptions.CollectionWriteConcern, nodeType)
+		if err != nil {
+			return WriteConcernError{
+				fmt.Sprintf("error in --collectionWriteConcern %v", restore.OutputOptions.CollectionWriteConcern), err}
+		}
 	}
 
 	// handle the hidden auth collection flags
@@ -127,6 +275,218 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 		return fmt.Errorf(
 			"cannot specify a negative number of insertion workers per collection")
 	}
+	if len(restore.OutputOptions.RawSystemCollections) > 0 {
+		if !restore.OutputOptions.Force {
+			return fmt.Errorf("--rawSystemCollections bypasses the normal handling of system " +
+				"collections such as users and roles, and requires --force")
+		}
+		restore.rawSystemCollections, err = parseRawSystemCollections(restore.OutputOptions.RawSystemCollections)
+		if err != nil {
+			return fmt.Errorf("error parsing --rawSystemCollections: %v", err)
+		}
+		log.Log(log.Always, "WARNING: --rawSystemCollections is set; the mapped system collections "+
+			"will be restored as plain collections and will NOT take effect on the server")
+	}
+
+	if restore.OutputOptions.AssumeEmptyTarget && restore.OutputOptions.Drop {
+		return fmt.Errorf("cannot use --drop with --assumeEmptyTarget")
+	}
+	if restore.OutputOptions.LoadThenIndex && restore.OutputOptions.NoIndexRestore {
+		return fmt.Errorf("cannot use --loadThenIndex with --noIndexRestore")
+	}
+	if restore.OutputOptions.CreateDatabases && restore.OutputOptions.RequireDatabases {
+		return fmt.Errorf("cannot use --createDatabases with --requireExistingDatabases")
+	}
+	if restore.OutputOptions.NumInitialChunks < 0 {
+		return fmt.Errorf("--numInitialChunks must be a positive number")
+	}
+	if restore.OutputOptions.NumInitialChunks > 0 && !restore.isMongos {
+		return fmt.Errorf("--numInitialChunks can only be used when restoring to a mongos")
+	}
+	excludeFields := restore.OutputOptions.ExcludeFields
+	if restore.OutputOptions.ExcludeFieldsFile != "" {
+		fileFields, err := readFieldsFile(restore.OutputOptions.ExcludeFieldsFile)
+		if err != nil {
+			return fmt.Errorf("error reading --excludeFieldsFile: %v", err)
+		}
+		excludeFields = append(excludeFields, fileFields...)
+	}
+	if len(excludeFields) > 0 {
+		log.Logf(log.DebugLow, "excluding fields from restored documents: %v", excludeFields)
+		transform, err := newExcludeFieldsTransform(excludeFields)
+		if err != nil {
+			return fmt.Errorf("error parsing excluded fields: %v", err)
+		}
+		restore.transforms = append(restore.transforms, transform)
+	}
+
+	if restore.OutputOptions.NSRewriteFile != "" {
+		var err error
+		restore.nsRewrites, err = readNSRewriteFile(restore.OutputOptions.NSRewriteFile)
+		if err != nil {
+			return fmt.Errorf("error in --nsRewriteFile %v: %v", restore.OutputOptions.NSRewriteFile, err)
+		}
+		restore.rewrittenFrom = map[string]string{}
+	}
+
+	if restore.OutputOptions.StorageOverrides != "" {
+		var err error
+		restore.storageOverrides, err = readStorageOverrides(restore.OutputOptions.StorageOverrides)
+		if err != nil {
+			return fmt.Errorf("error in --storageOverrides %v: %v", restore.OutputOptions.StorageOverrides, err)
+		}
+		for namespace, options := range restore.storageOverrides {
+			log.Logf(log.DebugLow, "storage overrides for %v: %v", namespace, options)
+		}
+	}
+
+	if restore.OutputOptions.Retries < 0 {
+		return fmt.Errorf("--retries must be a positive number")
+	}
+	if restore.OutputOptions.RetryBaseDelay < 0 ||
+		restore.OutputOptions.RetryMaxDelay < restore.OutputOptions.RetryBaseDelay {
+		return fmt.Errorf("--retryBaseDelay must be positive and no greater than --retryMaxDelay")
+	}
+	if restore.OutputOptions.VerifyIndexes && restore.OutputOptions.NoIndexRestore {
+		return fmt.Errorf("cannot use --verifyIndexes with --noIndexRestore")
+	}
+	if restore.OutputOptions.FilterOrphans &&
+		(restore.OutputOptions.MergeDocuments || restore.InputOptions.DiffAgainst != "") {
+		return fmt.Errorf("cannot use --filterOrphans with --mergeDocuments or --diffAgainst")
+	}
+	if restore.OutputOptions.StrictIDIndex && restore.OutputOptions.NoIndexRestore {
+		return fmt.Errorf("cannot use --strictIdIndex with --noIndexRestore")
+	}
+	if restore.OutputOptions.DeferTTLIndexes && restore.OutputOptions.NoIndexRestore {
+		return fmt.Errorf("cannot use --deferTTLIndexes with --noIndexRestore")
+	}
+	if restore.OutputOptions.RestoreIndexesHidden {
+		if restore.OutputOptions.NoIndexRestore {
+			return fmt.Errorf("cannot use --restoreIndexesHidden with --noIndexRestore")
+		}
+		if err = restore.checkHiddenIndexSupport(); err != nil {
+			return err
+		}
+	}
+	if restore.OutputOptions.VerifyIndexesBestEffort && !restore.OutputOptions.VerifyIndexes {
+		return fmt.Errorf("--verifyIndexesBestEffort requires --verifyIndexes")
+	}
+	if restore.OutputOptions.ApplyCollMod && restore.OutputOptions.NoOptionsRestore {
+		return fmt.Errorf("cannot use --applyCollMod with --noOptionsRestore")
+	}
+	if restore.OutputOptions.MaxRetryTime < 0 {
+		return fmt.Errorf("--maxRetryTime must not be negative")
+	}
+	if restore.OutputOptions.MaxRetryTime > 0 {
+		restore.retryBudget = util.NewRetryBudget(restore.OutputOptions.MaxRetryTime)
+	}
+	if restore.OutputOptions.MaxConnections < 0 {
+		return fmt.Errorf("--maxConnections must be a positive number")
+	}
+	restore.SessionProvider.SetMaxConnections(restore.OutputOptions.MaxConnections)
+	if restore.OutputOptions.PoolSize < 0 {
+		return fmt.Errorf("--poolSize must be a positive number")
+	}
+	if len(restore.OutputOptions.CollectionRateLimits) > 0 {
+		restore.rateLimiters, err = parseCollectionRateLimits(restore.OutputOptions.CollectionRateLimits)
+		if err != nil {
+			return fmt.Errorf("error parsing --collectionRateLimit: %v", err)
+		}
+	}
+
+	if restore.OutputOptions.IndexHeartbeatInterval < 0 {
+		return fmt.Errorf("--indexHeartbeatInterval must not be negative")
+	}
+	if restore.OutputOptions.WaitForIndexes {
+		if restore.OutputOptions.IndexPollInterval <= 0 {
+			return fmt.Errorf("--indexPollInterval must be a positive number of milliseconds")
+		}
+		if restore.OutputOptions.IndexWaitTimeout < 0 {
+			return fmt.Errorf("--indexWaitTimeout must be a positive number of seconds")
+		}
+		if restore.OutputOptions.NoIndexRestore {
+			return fmt.Errorf("cannot use --waitForIndexes with --noIndexRestore")
+		}
+	}
+
+	switch restore.OutputOptions.InsertOrder {
+	case insertOrderForward, insertOrderReverse:
+	default:
+		return fmt.Errorf("--insertOrder must be either %v or %v",
+			insertOrderForward, insertOrderReverse)
+	}
+
+	if restore.OutputOptions.MetadataOnly {
+		conflicts := metadataOnlyConflicts(restore.InputOptions, restore.OutputOptions, restore.TargetDirectory)
+		if len(conflicts) > 0 {
+			return fmt.Errorf("cannot use --metadataOnly with %v", strings.Join(conflicts, ", "))
+		}
+		if restore.OutputOptions.NoIndexRestore && restore.OutputOptions.NoOptionsRestore {
+			return fmt.Errorf("cannot use --metadataOnly with both --noIndexRestore and --noOptionsRestore")
+		}
+	}
+
+	if restore.OutputOptions.BatchSizeFactor < 0 {
+		return fmt.Errorf("--batchSizeFactor must be a positive number")
+	}
+	if restore.OutputOptions.BatchSizeFactor > 0 {
+		maxDocSize, err := restore.SessionProvider.MaxBSONObjectSize()
+		if err != nil {
+			return fmt.Errorf("error getting the server's maximum document size: %v", err)
+		}
+		restore.batchByteLimit = maxDocSize * restore.OutputOptions.BatchSizeFactor
+		log.Logf(log.DebugLow, "ending insert batches at %v bytes", restore.batchByteLimit)
+	}
+
+	if restore.OutputOptions.CollectionChunkSize != "" {
+		restore.collectionChunkSize, err = parseByteSize(restore.OutputOptions.CollectionChunkSize)
+		if err != nil {
+			return fmt.Errorf("invalid --collectionChunkSize: %v", err)
+		}
+		if restore.OutputOptions.NumInsertionWorkers < 2 {
+			log.Log(log.Always, "warning: --collectionChunkSize has no effect with only one insertion worker per collection")
+		}
+	}
+
+	if restore.OutputOptions.ProgressInterval < 0 {
+		return fmt.Errorf("--progressInterval must be a positive number of seconds")
+	}
+
+	if len(restore.InputOptions.ExtraDirs) > 0 {
+		if restore.ToolOptions.Collection != "" || restore.TargetDirectory == "-" ||
+			isBSON(restore.TargetDirectory) {
+			return fmt.Errorf("--extraDir can only be used when restoring a directory of databases or collections")
+		}
+	}
+
+	if restore.InputOptions.MaxIntentsInMemory < 0 {
+		return fmt.Errorf("--maxIntentsInMemory must be a positive number")
+	}
+	if restore.OutputOptions.AdminFirst && restore.OutputOptions.AdminLast {
+		return fmt.Errorf("cannot use both --adminFirst and --adminLast")
+	}
+	if restore.InputOptions.MaxIntentsInMemory > 0 &&
+		(restore.OutputOptions.AdminFirst || restore.OutputOptions.AdminLast) {
+		return fmt.Errorf("cannot use --adminFirst or --adminLast with --maxIntentsInMemory, " +
+			"because collections spilled to disk are restored in the order their databases were found")
+	}
+	if restore.InputOptions.MaxIntentsInMemory > 0 && len(restore.InputOptions.ExtraDirs) > 0 {
+		return fmt.Errorf("cannot use --maxIntentsInMemory with --extraDir, " +
+			"because collections can only be merged across directories while they are in memory")
+	}
+
+	if restore.OutputOptions.CheckServerBeforeDrop {
+		if !restore.OutputOptions.Drop {
+			return fmt.Errorf("cannot use --checkServerBeforeDrop without --drop")
+		}
+		if restore.OutputOptions.DropCheckFactor <= 0 {
+			return fmt.Errorf("--dropCheckFactor must be a positive number")
+		}
+	}
+
+	if restore.OutputOptions.IntentTimeout < 0 {
+		return fmt.Errorf("--intentTimeout must be a positive number of seconds")
+	}
 
 	// a single dash signals reading from stdin
 	if restore.TargetDirectory == "-" {
@@ -135,20 +495,111 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 			return fmt.Errorf("cannot restore from stdin without a specified collection")
 		}
 	}
+	if restore.InputOptions.DiffAgainst != "" {
+		if restore.useStdin {
+			return fmt.Errorf("cannot use --diffAgainst when restoring from stdin")
+		}
+		if restore.OutputOptions.Drop {
+			return fmt.Errorf("cannot use --diffAgainst with --drop; the diff is applied " +
+				"to collections that already hold the base dump")
+		}
+	}
+	restore.conflictPolicy, err = parseConflictPolicy(restore.OutputOptions.OnConflict)
+	if err != nil {
+		return fmt.Errorf("bad option: --onConflict: %v", err)
+	}
+	if restore.conflictPolicy.mode != conflictDumpWins && !restore.OutputOptions.MergeDocuments {
+		return fmt.Errorf("cannot use --onConflict without --mergeDocuments")
+	}
+	if restore.OutputOptions.MergeDocuments {
+		if restore.InputOptions.DiffAgainst != "" {
+			return fmt.Errorf("cannot use --mergeDocuments with --diffAgainst")
+		}
+		if restore.OutputOptions.Drop {
+			return fmt.Errorf("cannot use --mergeDocuments with --drop; documents are " +
+				"merged into those already in the collections")
+		}
+	}
+	if restore.InputOptions.MergeIndexesFrom != "" {
+		if restore.useStdin {
+			return fmt.Errorf("cannot use --mergeIndexesFrom when restoring from stdin")
+		}
+		if restore.OutputOptions.NoIndexRestore {
+			return fmt.Errorf("cannot use --mergeIndexesFrom with --noIndexRestore")
+		}
+	}
+	if restore.InputOptions.PipeCmd != "" && !restore.useStdin {
+		return fmt.Errorf("--pipeCmd can only be used when restoring from stdin")
+	}
 
 	return nil
 }
 
 // Restore runs the mongorestore program.
-func (restore *MongoRestore) Restore() error {
-	err := restore.ParseAndValidateOptions()
+func (restore *MongoRestore) Restore() (err error) {
+	if restore.OutputOptions.OnComplete != "" {
+		start := time.Now()
+		defer func() {
+			notify.Complete(restore.OutputOptions.OnComplete,
+				notify.NewSummary("mongorestore", start, err, restore.metrics.Totals()))
+		}()
+	}
+
+	err = restore.ParseAndValidateOptions()
 	if err != nil {
 		log.Logf(log.DebugLow, "got error from options parsing: %v", err)
 		return err
 	}
+	defer func() {
+		if err != nil {
+			restore.warnHeldTTLIndexes()
+		}
+	}()
+
+	if restore.OutputOptions.TestConnection {
+		return restore.TestConnection(os.Stdout)
+	}
+
+	if restore.OutputOptions.ProgressSocket != "" || restore.ProgressConn != nil {
+		stream := newProgressStream(restore.ProgressConn, restore.events())
+		if restore.OutputOptions.ProgressSocket != "" {
+			if err = stream.listen(restore.OutputOptions.ProgressSocket); err != nil {
+				stream.close(err)
+				return fmt.Errorf("error creating --progressSocket: %v", err)
+			}
+			log.Logf(log.Always, "publishing progress on %v", restore.OutputOptions.ProgressSocket)
+		}
+		stream.start()
+		restore.progressStream = stream
+		defer func() { stream.close(err) }()
+	}
+
+	// the metrics also provide the totals of the --onComplete summary
+	if restore.OutputOptions.MetricsAddr != "" || restore.OutputOptions.OnComplete != "" {
+		registry := metrics.NewRegistry()
+		restore.metrics = metrics.NewTransferMetrics(registry, "mongorestore", "inserted")
+		if restore.OutputOptions.MetricsAddr != "" {
+			server, err := metrics.Serve(restore.OutputOptions.MetricsAddr, registry)
+			if err != nil {
+				return err
+			}
+			defer server.Close()
+		}
+	}
+
+	if restore.OutputOptions.TransformCmd != "" {
+		transform, err := startTransformCmd(restore.OutputOptions.TransformCmd)
+		if err != nil {
+			return fmt.Errorf("error starting --transformCmd: %v", err)
+		}
+		defer transform.Close()
+		restore.transforms = append(restore.transforms, transform.Transform)
+	}
 
 	// Build up all intents to be restored
 	restore.manager = intents.NewCategorizingIntentManager()
+	restore.manager.SetMaxIntentsInMemory(restore.InputOptions.MaxIntentsInMemory)
+	defer restore.manager.Close()
 
 	// handle cases where the user passes in a file instead of a directory
 	if isBSON(restore.TargetDirectory) {
@@ -192,12 +643,37 @@ func (restore *MongoRestore) Restore() error {
 			restore.TargetDirectory)
 	}
 	if err != nil {
-		return fmt.Errorf("error scanning filesystem: %v", err)
+		return IntentScanError{err}
+	}
+
+	// collections found in more than one directory are merged into the
+	// same intent, just like their files within a single directory
+	for _, extraDir := range restore.InputOptions.ExtraDirs {
+		extraDir = util.ToUniversalPath(extraDir)
+		log.Logf(log.Always, "adding collections to restore from %v dir", extraDir)
+		if restore.ToolOptions.DB == "" {
+			err = restore.CreateAllIntents(extraDir)
+		} else {
+			err = restore.CreateIntentsForDB(restore.ToolOptions.DB, extraDir)
+		}
+		if err != nil {
+			return IntentScanError{err}
+		}
+	}
+
+	if err = restore.duplicateDataFilesError(); err != nil {
+		return IntentScanError{err}
 	}
 
 	if restore.isMongos && restore.manager.HasConfigDBIntent() && restore.ToolOptions.DB == "" {
 		return fmt.Errorf("cannot do a full restore on a sharded system - " +
-			"remove the 'config' directory from the dump directory first")
+			"restore application data through mongos after removing the 'config' directory " +
+			"from the dump directory, then restore the config database separately by " +
+			"connecting directly to the config server with --configsvr")
+	}
+
+	if err = restore.findGridFSBuckets(); err != nil {
+		return IntentScanError{err}
 	}
 
 	// If restoring users and roles, make sure we validate auth versions
@@ -205,21 +681,39 @@ func (restore *MongoRestore) Restore() error {
 		log.Log(log.Info, "comparing auth version of the dump directory and target server")
 		restore.authVersions.Dump, err = restore.GetDumpAuthVersion()
 		if err != nil {
-			return fmt.Errorf("error getting auth version from dump: %v", err)
+			return AuthVersionError{"error getting auth version from dump", err}
 		}
 		restore.authVersions.Server, err = auth.GetAuthVersion(restore.SessionProvider)
 		if err != nil {
-			return fmt.Errorf("error getting auth version of server: %v", err)
+			return AuthVersionError{"error getting auth version of server", err}
 		}
 		err = restore.ValidateAuthVersions()
 		if err != nil {
-			return fmt.Errorf(
-				"the users and roles collections in the dump have an incompatible auth version with target server: %v",
-				err)
+			return AuthVersionError{
+				"the users and roles collections in the dump have an incompatible auth version with target server", err}
 		}
 	}
 
-	// Restore the regular collections
+	if err = restore.checkTargetDatabases(); err != nil {
+		return err
+	}
+	if err = restore.checkServerBeforeDrop(); err != nil {
+		return err
+	}
+
+	// Restore the regular collections, keeping views after the
+	// collections they read from
+	if err = restore.readCollectionOrder(); err != nil {
+		return err
+	}
+	if restore.OutputOptions.PerDatabaseIsolation {
+		restore.isolation = newDatabaseIsolation()
+	}
+	if restore.OutputOptions.AdminFirst {
+		restore.manager.ScheduleDatabase("admin", true)
+	} else if restore.OutputOptions.AdminLast {
+		restore.manager.ScheduleDatabase("admin", false)
+	}
 	if restore.OutputOptions.NumParallelCollections > 1 {
 		restore.manager.Finalize(intents.MultiDatabaseLTF)
 	} else {
@@ -227,24 +721,37 @@ func (restore *MongoRestore) Restore() error {
 		restore.manager.Finalize(intents.Legacy)
 	}
 
+	// each provider has a pool of its own, which splitting the limit
+	// between them could leave too small for a collection's workers
+	poolSize := restore.poolSize()
+	if len(restore.authSourceProviders) > 0 {
+		log.Logf(log.Info, "using up to %v connections to each server for each of %v sets of credentials",
+			poolSize, len(restore.authSourceProviders)+1)
+	} else {
+		log.Logf(log.Info, "using up to %v connections to each server", poolSize)
+	}
+	restore.SessionProvider.SetPoolLimit(poolSize)
+	for _, provider := range restore.authSourceProviders {
+		provider.SetPoolLimit(poolSize)
+	}
+
+	if restore.OutputOptions.AdminFirst {
+		if err = restore.restoreUsersAndRoles(); err != nil {
+			return RestoreError{err}
+		}
+	}
+
 	err = restore.RestoreIntents()
 	if err != nil {
-		return fmt.Errorf("restore error: %v", err)
+		return RestoreError{err}
+	}
+	if err = restore.manager.SpillError(); err != nil {
+		return RestoreError{err}
 	}
 
-	// Restore users/roles
-	if restore.ShouldRestoreUsersAndRoles() {
-		if restore.manager.Users() != nil {
-			err = restore.RestoreUsersOrRoles(Users, restore.manager.Users())
-			if err != nil {
-				return fmt.Errorf("restore error: %v", err)
-			}
-		}
-		if restore.manager.Roles() != nil {
-			err = restore.RestoreUsersOrRoles(Roles, restore.manager.Roles())
-			if err != nil {
-				return fmt.Errorf("restore error: %v", err)
-			}
+	if !restore.OutputOptions.AdminFirst {
+		if err = restore.restoreUsersAndRoles(); err != nil {
+			return RestoreError{err}
 		}
 	}
 
@@ -252,10 +759,41 @@ func (restore *MongoRestore) Restore() error {
 	if restore.InputOptions.OplogReplay {
 		err = restore.RestoreOplog()
 		if err != nil {
-			return fmt.Errorf("restore error: %v", err)
+			return RestoreError{err}
+		}
+	}
+
+	if err = restore.indexMismatchesError(); err != nil {
+		if !restore.OutputOptions.VerifyIndexesBestEffort {
+			return RestoreError{err}
 		}
+		log.Logf(log.Always, "warning: %v", err)
+	}
+
+	if err = restore.resetTTLIndexes(); err != nil {
+		return RestoreError{err}
 	}
 
 	log.Log(log.Always, "done")
 	return nil
 }
+
+// restoreUsersAndRoles restores the users and roles of the dump, if they
+// are being restored. They are restored after the other collections, or
+// before them with --adminFirst.
+func (restore *MongoRestore) restoreUsersAndRoles() error {
+	if !restore.ShouldRestoreUsersAndRoles() {
+		return nil
+	}
+	if restore.manager.Users() != nil {
+		if err := restore.RestoreUsersOrRoles(Users, restore.manager.Users()); err != nil {
+			return err
+		}
+	}
+	if restore.manager.Roles() != nil {
+		if err := restore.RestoreUsersOrRoles(Roles, restore.manager.Roles()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package mongorestore
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// splitNamespace splits a full "db.collection" namespace into its database and
+// collection names, validating both.
+func splitNamespace(namespace string) (string, string, error) {
+	parts := strings.SplitN(namespace, ".", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("'%v' is not a full namespace of the form db.collection", namespace)
+	}
+	if err := util.ValidateDBName(parts[0]); err != nil {
+		return "", "", fmt.Errorf("invalid database name in '%v': %v", namespace, err)
+	}
+	if err := util.ValidateCollectionGrammar(parts[1]); err != nil {
+		return "", "", fmt.Errorf("invalid collection name in '%v': %v", namespace, err)
+	}
+	return parts[0], parts[1], nil
+}
+
+// parseRawSystemCollections parses --rawSystemCollections mappings of the form
+// "source=target", where source is a dumped system collection and target is
+// the plain collection it should be restored into. The returned map is keyed
+// by source namespace.
+func parseRawSystemCollections(mappings []string) (map[string]string, error) {
+	parsed := map[string]string{}
+	for _, mapping := range mappings {
+		parts := strings.SplitN(mapping, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("mapping '%v' must be of the form source=target", mapping)
+		}
+		source, target := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		sourceParts := strings.SplitN(source, ".", 2)
+		if len(sourceParts) != 2 || !strings.HasPrefix(strings.TrimPrefix(sourceParts[1], "$admin."), "system.") {
+			return nil, fmt.Errorf("source '%v' is not a system collection", source)
+		}
+		_, targetC, err := splitNamespace(target)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(targetC, "system.") {
+			return nil, fmt.Errorf("target '%v' must not be a system collection", target)
+		}
+		if _, ok := parsed[source]; ok {
+			return nil, fmt.Errorf("system collection '%v' is mapped more than once", source)
+		}
+		parsed[source] = target
+	}
+	return parsed, nil
+}
+
+// nsRewriteRule maps dumped namespaces matching source to target. A "*" in
+// source matches any run of characters (within the database name, it cannot
+// match a dot), and each "*" in target is replaced by the text matched by the
+// corresponding "*" in source.
+type nsRewriteRule struct {
+	source  string
+	target  string
+	pattern *regexp.Regexp
+}
+
+// newNSRewriteRule validates a single source => target mapping.
+func newNSRewriteRule(source, target string) (nsRewriteRule, error) {
+	rule := nsRewriteRule{source: source, target: target}
+	sourceParts := strings.SplitN(source, ".", 2)
+	if len(sourceParts) != 2 || sourceParts[0] == "" || sourceParts[1] == "" {
+		return rule, fmt.Errorf("'%v' is not a full namespace of the form db.collection", source)
+	}
+	wildcards := strings.Count(source, "*")
+	if strings.Count(target, "*") != wildcards {
+		return rule, fmt.Errorf("'%v' and '%v' must have the same number of wildcards", source, target)
+	}
+	if wildcards == 0 {
+		if _, _, err := splitNamespace(target); err != nil {
+			return rule, err
+		}
+	} else if targetParts := strings.SplitN(target, ".", 2); len(targetParts) != 2 {
+		return rule, fmt.Errorf("'%v' is not a full namespace of the form db.collection", target)
+	}
+
+	dbPattern := strings.Replace(regexp.QuoteMeta(sourceParts[0]), `\*`, `([^.]*)`, -1)
+	collectionPattern := strings.Replace(regexp.QuoteMeta(sourceParts[1]), `\*`, `(.*)`, -1)
+	rule.pattern = regexp.MustCompile("^" + dbPattern + `\.` + collectionPattern + "$")
+	return rule, nil
+}
+
+// rewrite returns the namespace that namespace maps to and true, or false if
+// the rule does not match it.
+func (rule nsRewriteRule) rewrite(namespace string) (string, bool) {
+	matches := rule.pattern.FindStringSubmatch(namespace)
+	if matches == nil {
+		return "", false
+	}
+	target := rule.target
+	for _, match := range matches[1:] {
+		target = strings.Replace(target, "*", match, 1)
+	}
+	return target, true
+}
+
+// readNSRewriteFile reads and parses the --nsRewriteFile at path.
+func readNSRewriteFile(path string) ([]nsRewriteRule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseNSRewrites(file)
+}
+
+// parseNSRewrites reads --nsRewriteFile mappings, one "source => target" per
+// line. Blank lines and lines starting with "#" are ignored. Literal mappings
+// with the same source, or with the same target, are rejected.
+func parseNSRewrites(in io.Reader) ([]nsRewriteRule, error) {
+	rules := []nsRewriteRule{}
+	sources, targets := map[string]bool{}, map[string]string{}
+	scanner := bufio.NewScanner(in)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=>", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %v: mapping must be of the form 'source => target'", lineNum)
+		}
+		source, target := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		rule, err := newNSRewriteRule(source, target)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", lineNum, err)
+		}
+		if sources[source] {
+			return nil, fmt.Errorf("line %v: '%v' is mapped more than once", lineNum, source)
+		}
+		sources[source] = true
+		if other, ok := targets[target]; ok && !strings.Contains(target, "*") {
+			return nil, fmt.Errorf("line %v: '%v' and '%v' are both mapped to '%v'",
+				lineNum, other, source, target)
+		}
+		targets[target] = source
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// rewriteNamespace applies the first matching --nsRewriteFile rule to the
+// intent. It returns an error if the rewritten namespace is invalid or if
+// another dumped collection is already being restored to it.
+func (restore *MongoRestore) rewriteNamespace(intent *intents.Intent) error {
+	source := intent.Namespace()
+	// users, roles, indexes, and other special collections keep their names
+	if strings.HasPrefix(intent.C, "$") || strings.HasPrefix(intent.C, "system.") {
+		return nil
+	}
+	for _, rule := range restore.nsRewrites {
+		target, ok := rule.rewrite(source)
+		if !ok {
+			continue
+		}
+		db, collection, err := splitNamespace(target)
+		if err != nil {
+			return fmt.Errorf("mapping '%v => %v' rewrites %v to an invalid namespace: %v",
+				rule.source, rule.target, source, err)
+		}
+		log.Logf(log.Info, "restoring %v to %v", source, target)
+		intent.DB, intent.C = db, collection
+		break
+	}
+
+	if other, ok := restore.rewrittenFrom[intent.Namespace()]; ok && other != source {
+		return fmt.Errorf("both %v and %v would be restored to %v", other, source, intent.Namespace())
+	}
+	restore.rewrittenFrom[intent.Namespace()] = source
+	return nil
+}
@@ -0,0 +1,135 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+)
+
+func TestRawSystemCollections(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When parsing --rawSystemCollections mappings", t, func() {
+
+		Convey("a system collection mapped to a plain collection should be accepted", func() {
+			mappings, err := parseRawSystemCollections([]string{
+				"admin.system.users=staging.users",
+				"test.$admin.system.roles = staging.roles",
+			})
+			So(err, ShouldBeNil)
+			So(mappings, ShouldResemble, map[string]string{
+				"admin.system.users":       "staging.users",
+				"test.$admin.system.roles": "staging.roles",
+			})
+		})
+
+		Convey("invalid mappings should be rejected", func() {
+			for _, mapping := range []string{
+				"admin.system.users",
+				"test.users=staging.users",
+				"admin.system.users=staging",
+				"admin.system.users=staging.system.users",
+			} {
+				_, err := parseRawSystemCollections([]string{mapping})
+				So(err, ShouldNotBeNil)
+			}
+			_, err := parseRawSystemCollections([]string{
+				"admin.system.users=a.b", "admin.system.users=c.d"})
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("With a mapped system collection", t, func() {
+		restore := &MongoRestore{
+			manager:              intents.NewCategorizingIntentManager(),
+			rawSystemCollections: map[string]string{"admin.system.users": "staging.users"},
+		}
+
+		Convey("its intent should be put under the target namespace as a plain collection", func() {
+			So(restore.putRawSystemCollection(
+				&intents.Intent{DB: "admin", C: "system.users", BSONPath: "users.bson"}), ShouldBeTrue)
+			So(restore.manager.Users(), ShouldBeNil)
+			intent := restore.manager.Peek()
+			So(intent.Namespace(), ShouldEqual, "staging.users")
+
+			So(restore.putRawSystemCollection(
+				&intents.Intent{DB: "admin", C: "system.roles", BSONPath: "roles.bson"}), ShouldBeFalse)
+		})
+	})
+}
+
+func TestNSRewrites(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When parsing an --nsRewriteFile", t, func() {
+
+		Convey("literal and wildcard mappings should be accepted", func() {
+			rules, err := parseNSRewrites(strings.NewReader(
+				"# migration mappings\n" +
+					"test.users => accounts.users\n" +
+					"\n" +
+					"logs_*.* => archive.*_*\n"))
+			So(err, ShouldBeNil)
+			So(len(rules), ShouldEqual, 2)
+
+			target, ok := rules[0].rewrite("test.users")
+			So(ok, ShouldBeTrue)
+			So(target, ShouldEqual, "accounts.users")
+			_, ok = rules[0].rewrite("test.users2")
+			So(ok, ShouldBeFalse)
+
+			target, ok = rules[1].rewrite("logs_2016.app.errors")
+			So(ok, ShouldBeTrue)
+			So(target, ShouldEqual, "archive.2016_app.errors")
+		})
+
+		Convey("malformed mappings should be rejected", func() {
+			for _, line := range []string{
+				"test.users",
+				"test.users => accounts",
+				"test.users => bad$db.users",
+				"test.* => archive.all",
+				"users => accounts.users",
+			} {
+				_, err := parseNSRewrites(strings.NewReader(line))
+				So(err, ShouldNotBeNil)
+			}
+		})
+
+		Convey("two sources mapped to the same target should be rejected", func() {
+			_, err := parseNSRewrites(strings.NewReader(
+				"a.c => b.c\nother.c => b.c\n"))
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("With a mongorestore rewriting namespaces", t, func() {
+		restore := &MongoRestore{
+			manager:       intents.NewIntentManager(),
+			rewrittenFrom: map[string]string{},
+		}
+		var err error
+		restore.nsRewrites, err = parseNSRewrites(strings.NewReader("src.* => dst.*\n"))
+		So(err, ShouldBeNil)
+
+		Convey("matching intents should be renamed and others left alone", func() {
+			renamed := &intents.Intent{DB: "src", C: "c1", BSONPath: "c1.bson"}
+			So(restore.putIntent(renamed), ShouldBeNil)
+			So(renamed.Namespace(), ShouldEqual, "dst.c1")
+			So(restore.putIntent(&intents.Intent{DB: "src", C: "c1", MetadataPath: "c1.metadata.json"}), ShouldBeNil)
+
+			other := &intents.Intent{DB: "other", C: "c1", BSONPath: "c1.bson"}
+			So(restore.putIntent(other), ShouldBeNil)
+			So(other.Namespace(), ShouldEqual, "other.c1")
+		})
+
+		Convey("a rewrite onto a dumped collection should be an error", func() {
+			So(restore.putIntent(&intents.Intent{DB: "dst", C: "c1", BSONPath: "c1.bson"}), ShouldBeNil)
+			So(restore.putIntent(&intents.Intent{DB: "src", C: "c1", BSONPath: "c1.bson"}), ShouldNotBeNil)
+		})
+	})
+}
@@ -9,8 +9,6 @@ import (
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	"os"
-	"strconv"
-	"strings"
 	"time"
 )
 
@@ -32,8 +30,21 @@ func (restore *MongoRestore) RestoreOplog() error {
 	}
 	size := fileInfo.Size()
 	log.Logf(log.Info, "\toplog %v is %v bytes", intent.BSONPath, size)
+	if restore.oplogMetadataPath != "" {
+		metadata, err := readOplogMetadata(restore.oplogMetadataPath)
+		if err != nil {
+			log.Logf(log.Always, "warning: cannot tell which server the oplog was captured from: %v", err)
+		} else {
+			log.Logf(log.Always, "replaying oplog captured from local.%v on MongoDB %v",
+				metadata.Collection, metadata.ServerVersion)
+			if metadata.Since != "" {
+				log.Logf(log.Always, "oplog holds the entries after %v up to %v",
+					metadata.Since, metadata.Until)
+			}
+		}
+	}
 
-	oplogFile, err := os.Open(intent.BSONPath)
+	oplogFile, err := restore.openDumpFile(intent.BSONPath)
 	if err != nil {
 		return fmt.Errorf("error reading oplog file: %v", err)
 	}
@@ -44,8 +55,9 @@ func (restore *MongoRestore) RestoreOplog() error {
 	entryArray := make([]interface{}, 0, 1024)
 	rawOplogEntry := &bson.Raw{}
 
-	var totalOps int64
-	var entrySize, bufferedBytes int
+	var totalOps, skippedOps int64
+	var entrySize, bufferedBytes, batches int
+	format := &oplogFormat{}
 
 	oplogProgressor := progress.NewCounter(size)
 	bar := progress.Bar{
@@ -66,25 +78,32 @@ func (restore *MongoRestore) RestoreOplog() error {
 	session.SetSocketTimeout(0)
 	defer session.Close()
 
+	flush := func() error {
+		if len(entryArray) == 0 {
+			return nil
+		}
+		if err := restore.ApplyOps(session, entryArray); err != nil {
+			return fmt.Errorf("error applying oplog: %v", err)
+		}
+		batches++
+		entryArray = make([]interface{}, 0, 1024)
+		bufferedBytes = 0
+		return nil
+	}
+
 	// To restore the oplog, we iterate over the oplog entries,
-	// filling up a buffer. Once the buffer reaches max document size,
-	// apply the current buffered ops and reset the buffer.
+	// filling up a buffer. Once the buffer is full, or before and
+	// after a command, apply the current buffered ops and reset the buffer.
 	for bsonSource.Next(rawOplogEntry) {
 		entrySize = len(rawOplogEntry.Data)
-		if bufferedBytes+entrySize > oplogMaxCommandSize {
-			err = restore.ApplyOps(session, entryArray)
-			if err != nil {
-				return fmt.Errorf("error applying oplog: %v", err)
-			}
-			entryArray = make([]interface{}, 0, 1024)
-			bufferedBytes = 0
-		}
 
-		entryAsOplog := db.Oplog{}
-		err = bson.Unmarshal(rawOplogEntry.Data, &entryAsOplog)
+		entry := oplogEntry{}
+		err = bson.Unmarshal(rawOplogEntry.Data, &entry)
 		if err != nil {
 			return fmt.Errorf("error reading oplog: %v", err)
 		}
+		format.observe(&entry)
+		entryAsOplog := entry.Oplog
 		if entryAsOplog.Operation == "n" {
 			//skip no-ops
 			continue
@@ -99,24 +118,58 @@ func (restore *MongoRestore) RestoreOplog() error {
 			break
 		}
 
+		if !restore.filterOplogEntry(&entryAsOplog) {
+			skippedOps++
+			oplogProgressor.Inc(int64(entrySize))
+			continue
+		}
+
+		format.strippedUUIDs += normalizeOplogEntry(&entryAsOplog)
+
+		isCommand := entryAsOplog.Operation == "c"
+		if isCommand || restore.oplogBatchFull(len(entryArray), bufferedBytes+entrySize) {
+			if err = flush(); err != nil {
+				return err
+			}
+		}
+
 		totalOps++
 		bufferedBytes += entrySize
 		oplogProgressor.Inc(int64(entrySize))
 		entryArray = append(entryArray, entryAsOplog)
+		if isCommand {
+			if err = flush(); err != nil {
+				return err
+			}
+		}
 	}
 	// finally, flush the remaining entries
-	if len(entryArray) > 0 {
-		err = restore.ApplyOps(session, entryArray)
-		if err != nil {
-			return fmt.Errorf("error applying oplog: %v", err)
-		}
+	if err = flush(); err != nil {
+		return err
 	}
 
-	log.Logf(log.Info, "applied %v ops", totalOps)
+	format.log()
+	log.Logf(log.Info, "applied %v ops in %v batches", totalOps, batches)
+	if skippedOps > 0 {
+		log.Logf(log.Always, "skipped %v oplog ops on collections that were not restored", skippedOps)
+	}
 	return nil
 
 }
 
+// oplogBatchFull returns true if a batch of the given number of entries
+// cannot take another entry and still be at most the given size in bytes.
+// Batches are limited by the size of a command and by --oplogBatchSize.
+func (restore *MongoRestore) oplogBatchFull(entries, bytesWithEntry int) bool {
+	if entries == 0 {
+		return false
+	}
+	if bytesWithEntry > oplogMaxCommandSize {
+		return true
+	}
+	return restore.InputOptions.OplogBatchSize > 0 && entries >= restore.InputOptions.OplogBatchSize
+}
+
 // ApplyOps is a wrapper for the applyOps database command, we pass in
 // a session to avoid opening a new connection for a few inserts at a time.
 func (restore *MongoRestore) ApplyOps(session *mgo.Session, entries []interface{}) error {
@@ -142,35 +195,8 @@ func (restore *MongoRestore) TimestampBeforeLimit(ts bson.MongoTimestamp) bool {
 	return ts < restore.oplogLimit
 }
 
-// ParseTimestampFlag takes in a string the form of <time_t>:<ordinal>,
-// where <time_t> is the seconds since the UNIX epoch, and <ordinal> represents
-// a counter of operations in the oplog that occurred in the specified second.
-// It parses this timestamp string and returns a bson.MongoTimestamp type.
+// ParseTimestampFlag parses an --oplogLimit timestamp of the form
+// <time_t>:<ordinal>; see db.ParseTimestampFlag.
 func ParseTimestampFlag(ts string) (bson.MongoTimestamp, error) {
-	var seconds, increment int
-	timestampFields := strings.Split(ts, ":")
-	if len(timestampFields) > 2 {
-		return 0, fmt.Errorf("too many : characters")
-	}
-
-	seconds, err := strconv.Atoi(timestampFields[0])
-	if err != nil {
-		return 0, fmt.Errorf("error parsing timestamp seconds: %v", err)
-	}
-
-	// parse the increment field if it exists
-	if len(timestampFields) == 2 {
-		if len(timestampFields[1]) > 0 {
-			increment, err = strconv.Atoi(timestampFields[1])
-			if err != nil {
-				return 0, fmt.Errorf("error parsing timestamp increment: %v", err)
-			}
-		} else {
-			// handle the case where the user writes "<time_t>:" with no ordinal
-			increment = 0
-		}
-	}
-
-	timestamp := (int64(seconds) << 32) | int64(increment)
-	return bson.MongoTimestamp(timestamp), nil
+	return db.ParseTimestampFlag(ts)
 }
@@ -113,3 +113,30 @@ func TestValidOplogLimitChecking(t *testing.T) {
 	})
 
 }
+
+func TestOplogBatchFull(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With no --oplogBatchSize", t, func() {
+		restore := &MongoRestore{InputOptions: &InputOptions{}}
+
+		Convey("batches are only limited by the command size", func() {
+			So(restore.oplogBatchFull(100000, 1024), ShouldBeFalse)
+			So(restore.oplogBatchFull(10, oplogMaxCommandSize+1), ShouldBeTrue)
+		})
+
+		Convey("an empty batch always takes an entry", func() {
+			So(restore.oplogBatchFull(0, oplogMaxCommandSize+1), ShouldBeFalse)
+		})
+	})
+
+	Convey("With --oplogBatchSize 3", t, func() {
+		restore := &MongoRestore{InputOptions: &InputOptions{OplogBatchSize: 3}}
+
+		Convey("batches hold at most 3 entries", func() {
+			So(restore.oplogBatchFull(2, 1024), ShouldBeFalse)
+			So(restore.oplogBatchFull(3, 1024), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,127 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"strings"
+)
+
+// oplogCollectionCommands are the oplog commands whose value is the name of
+// the collection they apply to.
+var oplogCollectionCommands = []string{
+	"create", "drop", "collMod", "createIndexes", "dropIndexes",
+	"deleteIndexes", "convertToCapped", "emptycapped",
+}
+
+// recordNamespace notes that the dumped namespace source is restored to
+// target, so that oplog entries on it are replayed against target.
+func (restore *MongoRestore) recordNamespace(source, target string) {
+	if restore.restoredNamespaces == nil {
+		restore.restoredNamespaces = map[string]string{}
+	}
+	restore.restoredNamespaces[source] = target
+}
+
+// oplogTarget returns the namespace that oplog entries on the dumped
+// namespace are applied to, or false if they should be skipped. It follows
+// the same rules as the collections that were restored, so entries on
+// collections created after the dump started are handled the same way.
+func (restore *MongoRestore) oplogTarget(namespace string) (string, bool) {
+	if target, ok := restore.restoredNamespaces[namespace]; ok {
+		return target, true
+	}
+	dbName, collection := splitOplogNamespace(namespace)
+	if !restore.oplogDatabaseIncluded(dbName) {
+		return "", false
+	}
+	if strings.HasPrefix(collection, "$") || strings.HasPrefix(collection, "system.") {
+		return namespace, true
+	}
+	for _, rule := range restore.nsRewrites {
+		if target, ok := rule.rewrite(namespace); ok {
+			return target, true
+		}
+	}
+	return namespace, true
+}
+
+// oplogDatabaseIncluded returns true if oplog entries on the database
+// should be applied; only the config database is restored with --configsvr.
+func (restore *MongoRestore) oplogDatabaseIncluded(dbName string) bool {
+	return !restore.configServerMode || dbName == "config"
+}
+
+// splitOplogNamespace splits a namespace at its first dot.
+func splitOplogNamespace(namespace string) (string, string) {
+	parts := strings.SplitN(namespace, ".", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// filterOplogEntry rewrites the namespaces of the oplog entry to those its
+// collections are restored to, and returns false if the entry should be
+// skipped because its collections are not being restored.
+func (restore *MongoRestore) filterOplogEntry(entry *db.Oplog) bool {
+	dbName, collection := splitOplogNamespace(entry.Namespace)
+	switch {
+	case entry.Operation == "c":
+		return restore.filterOplogCommand(entry, dbName)
+	case collection == "system.indexes":
+		// indexes built on servers before 3.0 are inserts naming their
+		// collection in the ns field
+		indexNamespace, ok := entry.Object["ns"].(string)
+		if !ok {
+			return restore.oplogDatabaseIncluded(dbName)
+		}
+		target, ok := restore.oplogTarget(indexNamespace)
+		if !ok {
+			return false
+		}
+		targetDB, _ := splitOplogNamespace(target)
+		entry.Object["ns"] = target
+		entry.Namespace = targetDB + ".system.indexes"
+		return true
+	}
+	target, ok := restore.oplogTarget(entry.Namespace)
+	entry.Namespace = target
+	return ok
+}
+
+// filterOplogCommand does the work of filterOplogEntry for a command.
+func (restore *MongoRestore) filterOplogCommand(entry *db.Oplog, dbName string) bool {
+	for _, command := range oplogCollectionCommands {
+		collection, ok := entry.Object[command].(string)
+		if !ok {
+			continue
+		}
+		target, ok := restore.oplogTarget(dbName + "." + collection)
+		if !ok {
+			return false
+		}
+		targetDB, targetCollection := splitOplogNamespace(target)
+		entry.Object[command] = targetCollection
+		entry.Namespace = targetDB + ".$cmd"
+		return true
+	}
+
+	if from, ok := entry.Object["renameCollection"].(string); ok {
+		to, _ := entry.Object["to"].(string)
+		fromTarget, fromOK := restore.oplogTarget(from)
+		toTarget, toOK := restore.oplogTarget(to)
+		if !fromOK || !toOK {
+			if fromOK != toOK {
+				log.Logf(log.Always, "skipping oplog rename of %v to %v, since only one of them is restored",
+					from, to)
+			}
+			return false
+		}
+		entry.Object["renameCollection"] = fromTarget
+		entry.Object["to"] = toTarget
+		return true
+	}
+
+	// commands on a whole database, such as dropDatabase
+	return restore.oplogDatabaseIncluded(dbName)
+}
@@ -0,0 +1,79 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestFilterOplogEntry(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a restore that renamed some collections", t, func() {
+		rule, err := newNSRewriteRule("prod.*", "staging.*")
+		So(err, ShouldBeNil)
+		restore := &MongoRestore{nsRewrites: []nsRewriteRule{rule}}
+		restore.recordNamespace("test.users", "other.people")
+
+		Convey("writes to a restored collection follow it", func() {
+			entry := &db.Oplog{Operation: "i", Namespace: "test.users", Object: bson.M{"_id": 1}}
+			So(restore.filterOplogEntry(entry), ShouldBeTrue)
+			So(entry.Namespace, ShouldEqual, "other.people")
+		})
+
+		Convey("writes to collections created during the dump use the rewrite rules", func() {
+			entry := &db.Oplog{Operation: "u", Namespace: "prod.orders", Object: bson.M{}}
+			So(restore.filterOplogEntry(entry), ShouldBeTrue)
+			So(entry.Namespace, ShouldEqual, "staging.orders")
+
+			entry = &db.Oplog{Operation: "d", Namespace: "test.logs", Object: bson.M{}}
+			So(restore.filterOplogEntry(entry), ShouldBeTrue)
+			So(entry.Namespace, ShouldEqual, "test.logs")
+		})
+
+		Convey("collection commands are remapped", func() {
+			entry := &db.Oplog{Operation: "c", Namespace: "test.$cmd", Object: bson.M{"drop": "users"}}
+			So(restore.filterOplogEntry(entry), ShouldBeTrue)
+			So(entry.Namespace, ShouldEqual, "other.$cmd")
+			So(entry.Object["drop"], ShouldEqual, "people")
+		})
+
+		Convey("renames remap both namespaces", func() {
+			entry := &db.Oplog{Operation: "c", Namespace: "admin.$cmd",
+				Object: bson.M{"renameCollection": "test.users", "to": "prod.users"}}
+			So(restore.filterOplogEntry(entry), ShouldBeTrue)
+			So(entry.Object["renameCollection"], ShouldEqual, "other.people")
+			So(entry.Object["to"], ShouldEqual, "staging.users")
+		})
+
+		Convey("legacy index builds are remapped", func() {
+			entry := &db.Oplog{Operation: "i", Namespace: "test.system.indexes",
+				Object: bson.M{"ns": "test.users", "key": bson.M{"a": 1}, "name": "a_1"}}
+			So(restore.filterOplogEntry(entry), ShouldBeTrue)
+			So(entry.Namespace, ShouldEqual, "other.system.indexes")
+			So(entry.Object["ns"], ShouldEqual, "other.people")
+		})
+	})
+
+	Convey("With a config server restore", t, func() {
+		restore := &MongoRestore{configServerMode: true}
+
+		Convey("only entries on the config database are applied", func() {
+			entry := &db.Oplog{Operation: "i", Namespace: "config.chunks", Object: bson.M{}}
+			So(restore.filterOplogEntry(entry), ShouldBeTrue)
+
+			entry = &db.Oplog{Operation: "i", Namespace: "test.users", Object: bson.M{}}
+			So(restore.filterOplogEntry(entry), ShouldBeFalse)
+
+			entry = &db.Oplog{Operation: "c", Namespace: "test.$cmd", Object: bson.M{"dropDatabase": 1}}
+			So(restore.filterOplogEntry(entry), ShouldBeFalse)
+
+			entry = &db.Oplog{Operation: "c", Namespace: "admin.$cmd",
+				Object: bson.M{"renameCollection": "test.a", "to": "config.a"}}
+			So(restore.filterOplogEntry(entry), ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,116 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+)
+
+// oplogEntry is an oplog entry as read from the dump, with the fields that
+// tell apart the formats of different server versions.
+type oplogEntry struct {
+	db.Oplog `bson:",inline"`
+	// the UUID of the collection, added in 3.6
+	UUID interface{} `bson:"ui"`
+}
+
+// oplogFormat summarizes the format of the oplog entries being replayed.
+type oplogFormat struct {
+	entries        int64
+	withUUIDs      int64
+	nestedApplyOps int64
+	strippedUUIDs  int64
+}
+
+// observe records the format of the entry.
+func (format *oplogFormat) observe(entry *oplogEntry) {
+	format.entries++
+	if entry.UUID != nil {
+		format.withUUIDs++
+	}
+	if _, ok := entry.Object["applyOps"]; ok && entry.Operation == "c" {
+		format.nestedApplyOps++
+	}
+}
+
+// generation describes the server versions whose oplogs the observed
+// entries look like.
+func (format *oplogFormat) generation() string {
+	switch {
+	case format.entries == 0:
+		return "unknown"
+	case format.withUUIDs > 0:
+		return "MongoDB 3.6 or later"
+	default:
+		return "MongoDB 3.4 or earlier"
+	}
+}
+
+// log writes a description of the replayed oplog's format.
+func (format *oplogFormat) log() {
+	log.Logf(log.Info, "oplog entries are in the format of %v", format.generation())
+	if format.nestedApplyOps > 0 {
+		log.Logf(log.Info, "replayed %v applyOps command(s), such as transactions, as a whole",
+			format.nestedApplyOps)
+	}
+	if format.strippedUUIDs > 0 {
+		log.Logf(log.DebugLow, "removed the collection UUIDs of %v nested oplog entries",
+			format.strippedUUIDs)
+	}
+}
+
+// readOplogMetadata reads the oplog.metadata.json that mongodump writes
+// next to oplog.bson. Dumps made before it existed have none, in which case
+// the format is only detected from the entries.
+func readOplogMetadata(path string) (*db.OplogMetadata, error) {
+	jsonBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	metadata := &db.OplogMetadata{}
+	if err = json.Unmarshal(jsonBytes, metadata); err != nil {
+		return nil, fmt.Errorf("error parsing %v: %v", path, err)
+	}
+	return metadata, nil
+}
+
+// normalizeOplogEntry brings an entry of any supported server version to a
+// form that any target applies: the collection UUIDs of the entries nested
+// in an applyOps command are removed, as the top-level one already is by
+// decoding into db.Oplog. Restored collections get new UUIDs, so entries
+// naming the dumped ones would fail to apply on 3.6 or later, and servers
+// before 3.6 reject the field. Entries are then applied by namespace. It
+// returns the number of UUIDs removed.
+func normalizeOplogEntry(entry *db.Oplog) int64 {
+	if entry.Operation != "c" {
+		return 0
+	}
+	return stripNestedUUIDs(entry.Object)
+}
+
+// stripNestedUUIDs removes the ui field of each entry of the applyOps array
+// of the command, including those of nested applyOps commands.
+func stripNestedUUIDs(command bson.M) int64 {
+	nested, ok := command["applyOps"].([]interface{})
+	if !ok {
+		return 0
+	}
+	var stripped int64
+	for _, op := range nested {
+		opDoc, ok := op.(bson.M)
+		if !ok {
+			continue
+		}
+		if _, ok := opDoc["ui"]; ok {
+			delete(opDoc, "ui")
+			stripped++
+		}
+		if object, ok := opDoc["o"].(bson.M); ok && opDoc["op"] == "c" {
+			stripped += stripNestedUUIDs(object)
+		}
+	}
+	return stripped
+}
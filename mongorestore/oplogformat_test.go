@@ -0,0 +1,120 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// decodeOplogEntry marshals a sample entry and decodes it the way
+// RestoreOplog reads oplog.bson.
+func decodeOplogEntry(sample bson.D) oplogEntry {
+	raw, err := bson.Marshal(sample)
+	So(err, ShouldBeNil)
+	entry := oplogEntry{}
+	So(bson.Unmarshal(raw, &entry), ShouldBeNil)
+	return entry
+}
+
+func TestOplogFormats(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	ts := bson.MongoTimestamp(int64(1500000000) << 32)
+	uuid := bson.Binary{Kind: 4, Data: []byte("0123456789abcdef")}
+
+	Convey("With oplog entries from several server generations", t, func() {
+		// 2.6, master/slave (local.oplog.$main)
+		masterSlave := bson.D{{"ts", ts}, {"op", "i"}, {"ns", "test.c"}, {"o", bson.D{{"_id", 1}}}}
+		// 3.4, replica set
+		replSet34 := bson.D{{"ts", ts}, {"t", int64(1)}, {"h", int64(42)}, {"v", 2},
+			{"op", "u"}, {"ns", "test.c"}, {"o2", bson.D{{"_id", 1}}}, {"o", bson.D{{"$set", bson.D{{"a", 1}}}}}}
+		// 4.0, a transaction, with collection UUIDs in its nested entries
+		transaction40 := bson.D{{"ts", ts}, {"t", int64(1)}, {"h", int64(43)}, {"v", 2},
+			{"op", "c"}, {"ns", "admin.$cmd"}, {"lsid", bson.D{{"id", uuid}}}, {"txnNumber", int64(1)},
+			{"o", bson.D{{"applyOps", []bson.D{
+				{{"op", "i"}, {"ns", "test.c"}, {"ui", uuid}, {"o", bson.D{{"_id", 2}}}},
+				{{"op", "d"}, {"ns", "test.c"}, {"ui", uuid}, {"o", bson.D{{"_id", 1}}}},
+			}}}}}
+		// 4.2, without a hash and with a UUID
+		insert42 := bson.D{{"ts", ts}, {"t", int64(1)}, {"v", 2}, {"op", "i"}, {"ns", "test.c"},
+			{"ui", uuid}, {"wall", bson.Now()}, {"o", bson.D{{"_id", 3}}}}
+
+		Convey("entries before 3.6 should be recognized and left unchanged", func() {
+			format := &oplogFormat{}
+			for _, sample := range []bson.D{masterSlave, replSet34} {
+				entry := decodeOplogEntry(sample)
+				format.observe(&entry)
+				So(normalizeOplogEntry(&entry.Oplog), ShouldEqual, 0)
+			}
+			So(format.generation(), ShouldEqual, "MongoDB 3.4 or earlier")
+			So(format.withUUIDs, ShouldEqual, 0)
+		})
+
+		Convey("entries from 3.6 on should be recognized by their UUIDs", func() {
+			format := &oplogFormat{}
+			for _, sample := range []bson.D{replSet34, insert42} {
+				entry := decodeOplogEntry(sample)
+				format.observe(&entry)
+			}
+			So(format.generation(), ShouldEqual, "MongoDB 3.6 or later")
+			So(format.withUUIDs, ShouldEqual, 1)
+		})
+
+		Convey("the top-level UUID should not be applied", func() {
+			entry := decodeOplogEntry(insert42)
+			So(entry.UUID, ShouldNotBeNil)
+			raw, err := bson.Marshal(entry.Oplog)
+			So(err, ShouldBeNil)
+			applied := bson.M{}
+			So(bson.Unmarshal(raw, &applied), ShouldBeNil)
+			_, hasUUID := applied["ui"]
+			So(hasUUID, ShouldBeFalse)
+		})
+
+		Convey("the UUIDs nested in a transaction should be removed", func() {
+			format := &oplogFormat{}
+			entry := decodeOplogEntry(transaction40)
+			format.observe(&entry)
+			So(format.nestedApplyOps, ShouldEqual, 1)
+			So(normalizeOplogEntry(&entry.Oplog), ShouldEqual, 2)
+			for _, op := range entry.Object["applyOps"].([]interface{}) {
+				_, hasUUID := op.(bson.M)["ui"]
+				So(hasUUID, ShouldBeFalse)
+				So(op.(bson.M)["ns"], ShouldEqual, "test.c")
+			}
+		})
+
+		Convey("UUIDs in nested applyOps commands should be removed too", func() {
+			nested := bson.D{{"ts", ts}, {"op", "c"}, {"ns", "admin.$cmd"}, {"o", bson.D{{"applyOps", []bson.D{
+				{{"op", "c"}, {"ns", "admin.$cmd"}, {"o", bson.D{{"applyOps", []bson.D{
+					{{"op", "i"}, {"ns", "test.c"}, {"ui", uuid}, {"o", bson.D{{"_id", 4}}}},
+				}}}}},
+			}}}}}
+			entry := decodeOplogEntry(nested)
+			So(normalizeOplogEntry(&entry.Oplog), ShouldEqual, 1)
+		})
+	})
+}
+
+func TestReadOplogMetadata(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("The oplog metadata written by mongodump should be read back", t, func() {
+		file, err := ioutil.TempFile("", "oplog-metadata-")
+		So(err, ShouldBeNil)
+		defer os.Remove(file.Name())
+		_, err = file.WriteString(`{"collection":"oplog.$main","serverVersion":"2.6.12"}`)
+		So(err, ShouldBeNil)
+		So(file.Close(), ShouldBeNil)
+
+		metadata, err := readOplogMetadata(file.Name())
+		So(err, ShouldBeNil)
+		So(metadata, ShouldResemble, &db.OplogMetadata{Collection: "oplog.$main", ServerVersion: "2.6.12"})
+	})
+}
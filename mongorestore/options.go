@@ -1,5 +1,9 @@
 package mongorestore
 
+import (
+	"time"
+)
+
 var Usage = `<options> <directory or file to restore>
 
 Restore backups generated with mongodump to a running server.
@@ -11,11 +15,21 @@ See http://docs.mongodb.org/manual/reference/program/mongorestore/ for more info
 
 // InputOptions defines the set of options to use in configuring the restore process.
 type InputOptions struct {
-	Objcheck               bool   `long:"objcheck" description:"validate all objects before inserting"`
-	OplogReplay            bool   `long:"oplogReplay" description:"replay oplog for point-in-time restore"`
-	OplogLimit             string `long:"oplogLimit" description:"only include oplog entries before the provided Timestamp (seconds[:ordinal])"`
-	RestoreDBUsersAndRoles bool   `long:"restoreDbUsersAndRoles" description:"restore user and role definitions for the given database"`
-	Directory              string `long:"dir" description:"input directory, use '-' for stdin"`
+	Objcheck               bool     `long:"objcheck" description:"validate all objects before inserting"`
+	OplogReplay            bool     `long:"oplogReplay" description:"replay oplog for point-in-time restore"`
+	OplogLimit             string   `long:"oplogLimit" description:"only include oplog entries before the provided Timestamp (seconds[:ordinal])"`
+	OplogBatchSize         int      `long:"oplogBatchSize" description:"maximum number of oplog entries to apply with each applyOps command during --oplogReplay; batches are also limited to 16MB, and commands such as drop are always applied on their own (no limit by default)" default:"0" default-mask:"-"`
+	RestoreDBUsersAndRoles bool     `long:"restoreDbUsersAndRoles" description:"restore user and role definitions for the given database"`
+	Directory              string   `long:"dir" description:"input directory, use '-' for stdin"`
+	JSONInput              bool     `long:"jsonInput" description:"restore the .json files of the dump directories, such as those written by mongoexport, as collection data; without it, a .json file is only restored if its collection also has a .metadata.json file"`
+	PreferFormat           string   `long:"preferFormat" description:"file format to restore when a collection has both .bson and .json (mongoexport) files, either 'bson' or 'json'" default:"bson" default-mask:"-"`
+	ExtraDirs              []string `long:"extraDir" description:"additional directory to restore from, in the same form as the main one, such as one written by mongodump --extraOut (may be specified multiple times)"`
+	PipeCmd                string   `long:"pipeCmd" description:"command to pass stdin through when restoring from '-', such as a decompressor like 'zstd -d', split into arguments as a shell would split it; it reads mongorestore's stdin and writes the BSON to restore to its stdout"`
+	MergeIndexesFrom       string   `long:"mergeIndexesFrom" value-name:"<directory>" description:"directory of another dump whose indexes are also built: indexes it has that are missing from the restored dump are added, and indexes in both are built from the restored dump's spec"`
+	DiffAgainst            string   `long:"diffAgainst" description:"directory of an earlier dump, already restored to the target, to compare against: only documents that are new or changed since it are upserted, and documents no longer present are removed; each collection's files in both dumps are sorted by _id, in temporary files of about the size of the dump's file when they need more than 64MB of memory"`
+	StreamingInput         bool     `long:"streamingInput" description:"read every file of the dump sequentially, without seeking, for dumps on filesystems that do not support it, such as some object store mounts; --insertOrder reverse then copies each file to a local temporary file first"`
+	AllowDuplicateIntents  bool     `long:"allowDuplicateIntents" description:"when more than one data file in the dump would be restored to the same collection, such as a .bson file in the dump and another in an --extraDir, warn and restore only the first instead of failing"`
+	MaxIntentsInMemory     int      `long:"maxIntentsInMemory" description:"for dumps with very many collections, hold at most about this many collections in memory while scanning the dump, writing the rest to a temporary file; the collections are then restored one database at a time, so fewer databases are restored in parallel (no limit by default)" default:"0" default-mask:"-"`
 }
 
 // Name returns a human-readable group name for input options.
@@ -25,15 +39,66 @@ func (_ *InputOptions) Name() string {
 
 // OutputOptions defines the set of options for restoring dump data.
 type OutputOptions struct {
-	Drop                   bool   `long:"drop" description:"drop each collection before import"`
-	WriteConcern           string `long:"writeConcern" default:"majority" default-mask:"-" description:"write concern options e.g. --writeConcern majority, --writeConcern '{w: 3, wtimeout: 500, fsync: true, j: true}' (defaults to 'majority')"`
-	NoIndexRestore         bool   `long:"noIndexRestore" description:"don't restore indexes"`
-	NoOptionsRestore       bool   `long:"noOptionsRestore" description:"don't restore collection options"`
-	KeepIndexVersion       bool   `long:"keepIndexVersion" description:"don't update index version"`
-	MaintainInsertionOrder bool   `long:"maintainInsertionOrder" description:"preserve order of documents during restoration"`
-	NumParallelCollections int    `long:"numParallelCollections" short:"j" description:"number of collections to restore in parallel (4 by default)" default:"4" default-mask:"-"`
-	NumInsertionWorkers    int    `long:"numInsertionWorkersPerCollection" description:"number of insert operations to run concurrently per collection (1 by default)" default:"1" default-mask:"-"`
-	StopOnError            bool   `long:"stopOnError" description:"stop restoring if an error is encountered on insert (off by default)"`
+	Drop                    bool          `long:"drop" description:"drop each collection before import"`
+	CheckServerBeforeDrop   bool          `long:"checkServerBeforeDrop" description:"with --drop, refuse to drop a collection that has more than --dropCheckFactor times as many documents on the server as in the dump, to guard against restoring an old or partial dump over current data; every collection is checked before anything is restored, and --force drops them anyway"`
+	DropCheckFactor         float64       `long:"dropCheckFactor" description:"how many times more documents a collection may have on the server than in the dump before --checkServerBeforeDrop refuses to drop it (10 by default)" default:"10" default-mask:"-"`
+	WriteConcern            string        `long:"writeConcern" default:"majority" default-mask:"-" description:"write concern options e.g. --writeConcern majority, --writeConcern '{w: 3, wtimeout: 500, fsync: true, j: true}' (defaults to 'majority')"`
+	NoIndexRestore          bool          `long:"noIndexRestore" description:"don't restore indexes"`
+	DeferTTLIndexes         bool          `long:"deferTTLIndexes" description:"build TTL indexes with an expireAfterSeconds so large that no restored document expires, and reset each to its dumped value once the whole restore, including any oplog replay, is done"`
+	RestoreIndexesHidden    bool          `long:"restoreIndexesHidden" description:"create the restored indexes other than _id as hidden, so that queries do not use them until they are unhidden with collMod (requires MongoDB 4.4 or later)"`
+	LoadThenIndex           bool          `long:"loadThenIndex" description:"when restoring into a collection that already exists, drop its indexes other than _id before inserting and build them, with those of the dump, after; the dropped indexes are rebuilt if the insert fails"`
+	NoOptionsRestore        bool          `long:"noOptionsRestore" description:"don't restore collection options"`
+	ApplyCollMod            bool          `long:"applyCollMod" description:"set collection options that collMod can change, such as validator and changeStreamPreAndPostImages, with collMod after restoring the documents, so that they also apply to collections that already exist; options the server is too old to set are skipped"`
+	KeepIndexVersion        bool          `long:"keepIndexVersion" description:"don't update index version"`
+	MaintainInsertionOrder  bool          `long:"maintainInsertionOrder" description:"preserve order of documents during restoration"`
+	AdminFirst              bool          `long:"adminFirst" description:"restore users and roles, then start the collections of the admin database, before any other collection, for deployments where creating collections requires roles from the dump; by default users and roles are restored after all collections, and admin collections are scheduled with the others"`
+	AdminLast               bool          `long:"adminLast" description:"start the collections of the admin database only after every other collection has started, and restore users and roles after all collections, so that application data is in place before any access is granted"`
+	NumParallelCollections  int           `long:"numParallelCollections" short:"j" description:"number of collections to restore in parallel (4 by default)" default:"4" default-mask:"-"`
+	PerDatabaseIsolation    bool          `long:"perDatabaseIsolation" description:"restore each database as an independent job: a collection that fails only stops the remaining collections of its own database, the other databases are still restored, and a table of each database's status is logged at the end; mongorestore still exits with an error if any database failed"`
+	NumInsertionWorkers     int           `long:"numInsertionWorkersPerCollection" description:"number of insert operations to run concurrently per collection (1 by default)" default:"1" default-mask:"-"`
+	CollectionChunkSize     string        `long:"collectionChunkSize" value-name:"<size>" description:"with more than one insertion worker per collection, split each .bson file into ranges of about this size, e.g. '256MB', that are read in parallel, so that a single huge collection is not limited by reading one stream; files that cannot be read at an offset, such as stdin, are read as one stream (disabled by default)"`
+	StopOnError             bool          `long:"stopOnError" description:"stop restoring if an error is encountered on insert (off by default)"`
+	OnConflict              string        `long:"onConflict" value-name:"<policy>" description:"with --mergeDocuments, what to do with a document whose _id the target already has: 'dumpWins' sets its fields, 'targetWins' keeps the target's document, and 'newerWins:<field>' sets its fields only if the target's value of the field, which may be a dotted path, is older or missing; dump documents without the field are only inserted where the target has no document with their _id, and target values of a different type are kept (dumpWins by default)" default:"dumpWins" default-mask:"-"`
+	MergeDocuments          bool          `long:"mergeDocuments" description:"apply each document as an update by _id that sets its top-level fields, keeping other fields of the existing document; subdocuments are replaced whole, and documents that do not exist yet are inserted"`
+	IntentTimeout           int           `long:"intentTimeout" description:"give up on a collection if its restore makes no progress for the given number of seconds (0 disables)" default:"0" default-mask:"-"`
+	MetricsAddr             string        `long:"metricsAddr" description:"serve Prometheus metrics over HTTP at the given address, e.g. ':9000' (disabled by default)"`
+	OnComplete              string        `long:"onComplete" value-name:"<url-or-command>" description:"when the restore finishes or fails, send a JSON summary of its status, duration, errors and the documents and bytes of each namespace: POSTed to an http(s) URL, or otherwise on the standard input of the given command; a failed notification is logged and does not change the exit code"`
+	NumInitialChunks        int           `long:"numInitialChunks" description:"when restoring to a mongos, shard each new collection on the hashed shard key recorded in its metadata, pre-split into the given number of chunks, with the collection's balancing as it was dumped"`
+	ExcludeFields           []string      `long:"excludeField" description:"dotted path of a field to remove from every restored document (may be specified multiple times)"`
+	ExcludeFieldsFile       string        `long:"excludeFieldsFile" description:"file of newline-delimited dotted field paths to remove from every restored document; blank lines and lines starting with '#' are ignored"`
+	AssumeEmptyTarget       bool          `long:"assumeEmptyTarget" description:"skip checking whether each collection already exists before restoring it; unsafe unless the target deployment is empty"`
+	CreateDatabases         bool          `long:"createDatabases" description:"create each collection of a database that does not exist yet with an explicit create command, rather than implicitly by its first insert, for deployments that restrict implicit creation"`
+	RequireDatabases        bool          `long:"requireExistingDatabases" description:"fail before restoring anything if a database being restored to does not already exist on the target"`
+	RawSystemCollections    []string      `long:"rawSystemCollections" description:"restore a dumped system collection into a plain collection, given as source=target namespaces, e.g. 'admin.system.users=staging.users' (may be specified multiple times; requires --force)"`
+	Force                   bool          `long:"force" description:"allow options that bypass mongorestore's safety checks, such as --rawSystemCollections, and drop collections that fail --checkServerBeforeDrop"`
+	Retries                 int           `long:"retries" description:"number of times to retry a batch insert or index build that fails with a connection error, e.g. during a replica set failover (0 by default)" default:"0" default-mask:"-"`
+	RetryBaseDelay          int           `long:"retryBaseDelay" description:"base delay in milliseconds of the randomized exponential backoff between retries (100 by default)" default:"100" default-mask:"-"`
+	RetryMaxDelay           int           `long:"retryMaxDelay" description:"maximum delay in milliseconds between retries (10000 by default)" default:"10000" default-mask:"-"`
+	MaxRetryTime            time.Duration `long:"maxRetryTime" value-name:"<duration>" description:"maximum wall-clock time, such as '5m', to spend retrying across the whole restore, after which it fails; operations are retried until it is spent unless --retries also limits them (no limit by default)"`
+	MaxConnections          int           `long:"maxConnections" description:"maximum number of insertion workers, across all collections, that may hold a server connection at once (unlimited by default)" default:"0" default-mask:"-"`
+	PoolSize                int           `long:"poolSize" description:"maximum number of connections to open to each server (by default, one per insertion worker of each parallel collection, plus one per collection and one more); with --authSourcesFile, each set of credentials has a pool of this size of its own" default:"0" default-mask:"-"`
+	AuthSourcesFile         string        `long:"authSourcesFile" value-name:"<filename>" description:"JSON file mapping database names to additional credentials to authenticate with, each an object with username, password, authenticationDatabase (the database itself by default) and authenticationMechanism; each authentication database may be listed once. Each database is restored over connections of its own authenticated with its credentials, all checked at startup, so up to --poolSize more connections may be opened to each server for each entry. The file holds plain-text passwords, so keep it readable only by its owner"`
+	CollectionRateLimits    []string      `long:"collectionRateLimit" value-name:"<namespace>=<rate>" description:"limit the rate at which documents are inserted into a namespace, e.g. 'test.events=5MB/s', using units of B, KB, MB or GB per second; other collections are not limited (may be specified multiple times)"`
+	ConfigServer            bool          `long:"configsvr" description:"restore only the config database, connecting directly to a config server (not through mongos) as part of sharded cluster recovery"`
+	WaitForIndexes          bool          `long:"waitForIndexes" description:"after creating each collection's indexes, wait until the server reports their builds as finished"`
+	IndexPollInterval       int           `long:"indexPollInterval" description:"milliseconds between checks on index build progress when using --waitForIndexes (1000 by default)" default:"1000" default-mask:"-"`
+	IndexWaitTimeout        int           `long:"indexWaitTimeout" description:"seconds to wait for a collection's index builds when using --waitForIndexes (no limit by default)" default:"0" default-mask:"-"`
+	IndexHeartbeatInterval  int           `long:"indexHeartbeatInterval" description:"seconds between messages, and pings to keep the connection alive, while the server builds a collection's indexes (60 by default; 0 disables)" default:"60" default-mask:"-"`
+	VerifyIndexes           bool          `long:"verifyIndexes" description:"after building each collection's indexes, compare them with the indexes listed by the server, reporting any that are missing or different, and fail the restore at the end if any collection does not match; indexes on the collection that were not in the dump only cause a warning; best combined with --waitForIndexes"`
+	VerifyIndexesBestEffort bool          `long:"verifyIndexesBestEffort" description:"with --verifyIndexes, report index differences without failing the restore"`
+	FilterOrphans           bool          `long:"filterOrphans" description:"leave out the documents of each sharded collection that fall outside the chunks their shard owned, such as orphans left by migrations; requires a dump taken directly from a shard, whose metadata files record the shard's chunk ranges, and does not support hashed shard keys"`
+	StrictIDIndex           bool          `long:"strictIdIndex" description:"fail, rather than warn, when restoring into an existing collection whose _id index differs from the dumped one, for example in its collation"`
+	ValidatePartialFilters  bool          `long:"validatePartialFilters" description:"before building each collection's indexes, have the server parse the partialFilterExpression of each partial index, so that one it cannot parse is reported by index name"`
+	InsertOrder             string        `long:"insertOrder" description:"order in which to insert each collection's documents, either 'forward' or 'reverse'; reverse reads each file twice, spills streamed input such as stdin to a temporary file, and keeps 8 bytes per document in memory (forward by default)" default:"forward" default-mask:"-"`
+	NSRewriteFile           string        `long:"nsRewriteFile" description:"path to a file of namespace mappings, one 'source => target' per line, used to restore collections under new names; '*' in a source matches any characters and is substituted into the target"`
+	StorageOverrides        string        `long:"storageOverrides" description:"path to a JSON file mapping namespaces to collection create options, such as storageEngine, which replace the dumped options of the same name"`
+	CollectionWriteConcern  string        `long:"collectionWriteConcern" description:"path to a JSON file mapping namespaces to write concerns, in any form --writeConcern accepts; collections not in the file use --writeConcern"`
+	TransformCmd            string        `long:"transformCmd" description:"command to pass each document through before inserting it; it reads one extended JSON document per line on stdin and must write one line per document to stdout: the replacement document, or an empty line or null to skip it"`
+	ProgressSocket          string        `long:"progressSocket" value-name:"<path>" description:"create a Unix domain socket at the given path and write the restore's events, and every second the progress of each collection, to each connection as newline-delimited JSON; a consumer that falls behind misses messages, and the socket is removed when the restore ends"`
+	ProgressInterval        int           `long:"progressInterval" description:"when output is not a terminal, log a single line of progress every this many seconds instead of drawing progress bars; 0 always draws bars (10 by default)" default:"10" default-mask:"-"`
+	MetadataOnly            bool          `long:"metadataOnly" description:"create each collection with its options and build its indexes, but do not restore any documents"`
+	BatchSizeFactor         int           `long:"batchSizeFactor" description:"also end each insert batch before its documents add up to this many times the server's maximum document size, so collections mixing small and very large documents get full batches without exceeding command limits (batches are only limited by --batchSize and the 32MB message size by default)" default:"0" default-mask:"-"`
+	TestConnection          bool          `long:"testConnection" description:"connect, check that the authenticated user has the privileges this restore needs, print a report and exit without restoring"`
 }
 
 // Name returns a human-readable group name for output options.
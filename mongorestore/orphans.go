@@ -0,0 +1,444 @@
+package mongorestore
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"gopkg.in/mgo.v2/bson"
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// ownedChunk is a chunk range recorded in a metadata file by mongodump when
+// dumping a shard directly.
+type ownedChunk struct {
+	Min bson.D `json:"min"`
+	Max bson.D `json:"max"`
+}
+
+// keyRange is a chunk range as shard key values in key order, from min,
+// inclusive, to max, exclusive.
+type keyRange struct {
+	min, max []interface{}
+}
+
+type byMin []keyRange
+
+func (ranges byMin) Len() int           { return len(ranges) }
+func (ranges byMin) Swap(i, j int)      { ranges[i], ranges[j] = ranges[j], ranges[i] }
+func (ranges byMin) Less(i, j int) bool { return compareKeys(ranges[i].min, ranges[j].min) < 0 }
+
+// orphanFilter implements --filterOrphans for one collection: it tells
+// whether a document of the dump belongs to the chunks its shard owned, or
+// is an orphan left behind by a migration.
+type orphanFilter struct {
+	shard  string
+	fields []string
+	ranges []keyRange
+	// number of documents left out, updated atomically
+	skipped int64
+}
+
+// orphanFilterFromJSON returns the orphan filter for the collection of a
+// metadata file, or nil if the collection was not sharded, in which case
+// it has no orphans. The metadata must have been written by mongodump
+// dumping a shard directly, which records the shard's name and the chunk
+// ranges it owned, if any; hashed shard keys are not supported.
+func orphanFilterFromJSON(jsonBytes []byte) (*orphanFilter, error) {
+	meta := &Metadata{}
+	if err := json.Unmarshal(jsonBytes, meta); err != nil {
+		return nil, err
+	}
+	if meta.Shard == "" {
+		return nil, fmt.Errorf("no shard metadata; --filterOrphans needs a dump taken " +
+			"directly from a shard, whose metadata files record the chunk ranges it owned")
+	}
+	if len(meta.ShardKey) == 0 {
+		return nil, nil
+	}
+	shardKey, err := bsonutil.GetExtendedBsonD(meta.ShardKey)
+	if err != nil {
+		return nil, fmt.Errorf("extended json in 'shardKey': %v", err)
+	}
+	filter := &orphanFilter{shard: meta.Shard}
+	for _, elem := range shardKey {
+		if elem.Value == "hashed" {
+			return nil, fmt.Errorf("--filterOrphans does not support the hashed shard key %v", shardKey)
+		}
+		filter.fields = append(filter.fields, elem.Name)
+	}
+	// an empty list means the shard owned no chunks, making every document
+	// an orphan, while a missing one was never recorded
+	if meta.OwnedChunks == nil {
+		return nil, fmt.Errorf("no chunk ranges recorded for the shard key %v, "+
+			"so orphaned documents cannot be told apart", shardKey)
+	}
+	for _, chunk := range meta.OwnedChunks {
+		min, err := bsonutil.GetExtendedBsonD(chunk.Min)
+		if err != nil {
+			return nil, fmt.Errorf("extended json in 'ownedChunks': %v", err)
+		}
+		max, err := bsonutil.GetExtendedBsonD(chunk.Max)
+		if err != nil {
+			return nil, fmt.Errorf("extended json in 'ownedChunks': %v", err)
+		}
+		chunkRange := keyRange{
+			min: boundValues(min, filter.fields),
+			max: boundValues(max, filter.fields),
+		}
+		if err = checkComparable(append(chunkRange.min, chunkRange.max...)); err != nil {
+			return nil, fmt.Errorf("chunk range in 'ownedChunks': %v", err)
+		}
+		filter.ranges = append(filter.ranges, chunkRange)
+	}
+	sort.Sort(byMin(filter.ranges))
+	return filter, nil
+}
+
+// boundValues returns the values of a chunk bound, which is keyed by the
+// full names of the shard key fields, in key order.
+func boundValues(bound bson.D, fields []string) []interface{} {
+	values := make([]interface{}, len(fields))
+	for i, field := range fields {
+		for _, elem := range bound {
+			if elem.Name == field {
+				values[i] = elem.Value
+			}
+		}
+	}
+	return values
+}
+
+// owns returns true if the shard owned the chunk of the raw document. A
+// missing shard key field counts as null, as it does for the server.
+func (filter *orphanFilter) owns(data []byte) (bool, error) {
+	doc := bson.D{}
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return false, fmt.Errorf("error decoding document to check its chunk: %v", err)
+	}
+	key := make([]interface{}, len(filter.fields))
+	for i, field := range filter.fields {
+		key[i], _ = lookupField(doc, field)
+	}
+	if err := checkComparable(key); err != nil {
+		return false, fmt.Errorf("shard key of document: %v", err)
+	}
+	i := sort.Search(len(filter.ranges), func(i int) bool {
+		return compareKeys(filter.ranges[i].max, key) > 0
+	})
+	return i < len(filter.ranges) && compareKeys(filter.ranges[i].min, key) <= 0, nil
+}
+
+// skip records a document left out as an orphan.
+func (filter *orphanFilter) skip() {
+	atomic.AddInt64(&filter.skipped, 1)
+}
+
+// skippedCount returns the number of documents left out as orphans.
+func (filter *orphanFilter) skippedCount() int64 {
+	return atomic.LoadInt64(&filter.skipped)
+}
+
+// setOrphanFilter records the orphan filter of a namespace for its insertion.
+func (restore *MongoRestore) setOrphanFilter(namespace string, filter *orphanFilter) {
+	restore.orphanFiltersMutex.Lock()
+	defer restore.orphanFiltersMutex.Unlock()
+	if restore.orphanFilters == nil {
+		restore.orphanFilters = map[string]*orphanFilter{}
+	}
+	restore.orphanFilters[namespace] = filter
+}
+
+// orphanFilterFor returns the orphan filter of a namespace, or nil if its
+// documents are not filtered.
+func (restore *MongoRestore) orphanFilterFor(namespace string) *orphanFilter {
+	restore.orphanFiltersMutex.Lock()
+	defer restore.orphanFiltersMutex.Unlock()
+	return restore.orphanFilters[namespace]
+}
+
+// compareKeys compares two shard key values field by field.
+func compareKeys(a, b []interface{}) int {
+	for i := range a {
+		if c := compareBSONValues(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// canonicalType returns the rank of the value's type in the order in which
+// MongoDB compares values of different types, or 0 if the value cannot be
+// compared. The driver cannot decode Decimal128 values, so documents and
+// chunk bounds holding one fail to decode before they are compared.
+func canonicalType(value interface{}) int {
+	if value == bson.MinKey {
+		return 1
+	}
+	if value == bson.MaxKey {
+		return 16
+	}
+	if value == nil || value == bson.Undefined {
+		return 2
+	}
+	switch x := value.(type) {
+	case int, int32, int64, float64:
+		return 3
+	case string, bson.Symbol:
+		return 4
+	case bson.D, bson.M, map[string]interface{}:
+		return 5
+	case []interface{}:
+		return 6
+	case []byte, bson.Binary:
+		return 7
+	case bson.ObjectId:
+		return 8
+	case bool:
+		return 9
+	case time.Time:
+		return 10
+	case bson.MongoTimestamp:
+		return 11
+	case bson.RegEx:
+		return 12
+	case bson.DBPointer:
+		return 13
+	case bson.JavaScript:
+		if x.Scope == nil {
+			return 14
+		}
+		return 15
+	}
+	return 0
+}
+
+// checkComparable returns an error for the first value that
+// compareBSONValues cannot compare.
+func checkComparable(values []interface{}) error {
+	for _, value := range values {
+		if canonicalType(value) == 0 {
+			return fmt.Errorf("cannot compare value %v of type %T", value, value)
+		}
+	}
+	return nil
+}
+
+// compareBSONValues compares two decoded BSON values in MongoDB's order,
+// returning -1, 0 or 1.
+func compareBSONValues(a, b interface{}) int {
+	if c := compareInts(int64(canonicalType(a)), int64(canonicalType(b))); c != 0 {
+		return c
+	}
+	switch x := a.(type) {
+	case int, int32, int64, float64:
+		return compareNumbers(x, b)
+	case string:
+		return compareStrings(x, stringValue(b))
+	case bson.Symbol:
+		return compareStrings(string(x), stringValue(b))
+	case bson.D:
+		return compareDocuments(x, documentValue(b))
+	case bson.M:
+		return compareDocuments(documentValue(x), documentValue(b))
+	case map[string]interface{}:
+		return compareDocuments(documentValue(x), documentValue(b))
+	case []interface{}:
+		y := b.([]interface{})
+		for i := 0; i < len(x) && i < len(y); i++ {
+			if c := compareBSONValues(x[i], y[i]); c != 0 {
+				return c
+			}
+		}
+		return compareInts(int64(len(x)), int64(len(y)))
+	case []byte, bson.Binary:
+		return compareBinaries(binaryValue(a), binaryValue(b))
+	case bson.ObjectId:
+		return compareStrings(string(x), string(b.(bson.ObjectId)))
+	case bool:
+		y := b.(bool)
+		switch {
+		case x == y:
+			return 0
+		case y:
+			return -1
+		}
+		return 1
+	case time.Time:
+		y := b.(time.Time)
+		switch {
+		case x.Before(y):
+			return -1
+		case x.After(y):
+			return 1
+		}
+		return 0
+	case bson.MongoTimestamp:
+		y := b.(bson.MongoTimestamp)
+		switch {
+		case uint64(x) < uint64(y):
+			return -1
+		case uint64(x) > uint64(y):
+			return 1
+		}
+		return 0
+	case bson.RegEx:
+		y := b.(bson.RegEx)
+		if c := compareStrings(x.Pattern, y.Pattern); c != 0 {
+			return c
+		}
+		return compareStrings(x.Options, y.Options)
+	case bson.DBPointer:
+		y := b.(bson.DBPointer)
+		if c := compareInts(int64(len(x.Namespace)), int64(len(y.Namespace))); c != 0 {
+			return c
+		}
+		if c := compareStrings(x.Namespace, y.Namespace); c != 0 {
+			return c
+		}
+		return compareStrings(string(x.Id), string(y.Id))
+	case bson.JavaScript:
+		y := b.(bson.JavaScript)
+		if c := compareStrings(x.Code, y.Code); c != 0 {
+			return c
+		}
+		if x.Scope == nil {
+			return 0
+		}
+		return compareDocuments(documentValue(x.Scope), documentValue(y.Scope))
+	}
+	// MinKey, MaxKey, null and values that cannot be in a shard key
+	return 0
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareStrings(a, b string) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareNumbers compares two numbers, exactly if both are integers. NaN
+// is less than any other number, as it is for MongoDB.
+func compareNumbers(a, b interface{}) int {
+	x, xIsInt := intValue(a)
+	y, yIsInt := intValue(b)
+	if xIsInt && yIsInt {
+		return compareInts(x, y)
+	}
+	fx, fy := floatValue(a), floatValue(b)
+	switch {
+	case math.IsNaN(fx) || math.IsNaN(fy):
+		if math.IsNaN(fx) && math.IsNaN(fy) {
+			return 0
+		}
+		if math.IsNaN(fx) {
+			return -1
+		}
+		return 1
+	case fx < fy:
+		return -1
+	case fx > fy:
+		return 1
+	}
+	return 0
+}
+
+func intValue(value interface{}) (int64, bool) {
+	switch x := value.(type) {
+	case int:
+		return int64(x), true
+	case int32:
+		return int64(x), true
+	case int64:
+		return x, true
+	}
+	return 0, false
+}
+
+func floatValue(value interface{}) float64 {
+	if x, ok := intValue(value); ok {
+		return float64(x)
+	}
+	return value.(float64)
+}
+
+func stringValue(value interface{}) string {
+	if x, ok := value.(bson.Symbol); ok {
+		return string(x)
+	}
+	return value.(string)
+}
+
+// documentValue returns a document as a bson.D; the fields of a map are
+// sorted by name, as their order is lost.
+func documentValue(value interface{}) bson.D {
+	switch x := value.(type) {
+	case bson.D:
+		return x
+	case bson.M:
+		return documentValue(map[string]interface{}(x))
+	}
+	m := value.(map[string]interface{})
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	doc := make(bson.D, 0, len(names))
+	for _, name := range names {
+		doc = append(doc, bson.DocElem{name, m[name]})
+	}
+	return doc
+}
+
+// compareDocuments compares two documents field by field, by the type,
+// then the name, then the value of each field.
+func compareDocuments(a, b bson.D) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := compareInts(int64(canonicalType(a[i].Value)), int64(canonicalType(b[i].Value))); c != 0 {
+			return c
+		}
+		if c := compareStrings(a[i].Name, b[i].Name); c != 0 {
+			return c
+		}
+		if c := compareBSONValues(a[i].Value, b[i].Value); c != 0 {
+			return c
+		}
+	}
+	return compareInts(int64(len(a)), int64(len(b)))
+}
+
+func binaryValue(value interface{}) bson.Binary {
+	if x, ok := value.([]byte); ok {
+		return bson.Binary{Data: x}
+	}
+	return value.(bson.Binary)
+}
+
+// compareBinaries compares two binaries by length, then subtype, then data.
+func compareBinaries(a, b bson.Binary) int {
+	if c := compareInts(int64(len(a.Data)), int64(len(b.Data))); c != 0 {
+		return c
+	}
+	if c := compareInts(int64(a.Kind), int64(b.Kind)); c != 0 {
+		return c
+	}
+	return bytes.Compare(a.Data, b.Data)
+}
@@ -0,0 +1,138 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestOrphanFilter(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	owns := func(filter *orphanFilter, doc bson.D) bool {
+		raw, err := bson.Marshal(doc)
+		So(err, ShouldBeNil)
+		owned, err := filter.owns(raw)
+		So(err, ShouldBeNil)
+		return owned
+	}
+
+	Convey("With the metadata of a collection dumped from a shard owning two chunks", t, func() {
+		metadata := `{"indexes":[],"shardKey":{"a.b":1,"c":1},"shard":"rs1","ownedChunks":[` +
+			`{"min":{"a.b":100,"c":{"$minKey":1}},"max":{"a.b":{"$maxKey":1},"c":{"$maxKey":1}}},` +
+			`{"min":{"a.b":{"$minKey":1},"c":{"$minKey":1}},"max":{"a.b":10,"c":"m"}}]}`
+		filter, err := orphanFilterFromJSON([]byte(metadata))
+		So(err, ShouldBeNil)
+		So(filter, ShouldNotBeNil)
+		So(filter.fields, ShouldResemble, []string{"a.b", "c"})
+
+		Convey("documents in the owned chunks should be kept", func() {
+			So(owns(filter, bson.D{{"a", bson.D{{"b", 5}}}, {"c", "a"}}), ShouldBeTrue)
+			So(owns(filter, bson.D{{"a", bson.D{{"b", 10}}}, {"c", "a"}}), ShouldBeTrue)
+			So(owns(filter, bson.D{{"a", bson.D{{"b", int64(100)}}}}), ShouldBeTrue)
+			So(owns(filter, bson.D{{"a", bson.D{{"b", "text"}}}}), ShouldBeTrue)
+			So(owns(filter, bson.D{{"c", "z"}}), ShouldBeTrue)
+		})
+
+		Convey("documents outside them should be orphans", func() {
+			So(owns(filter, bson.D{{"a", bson.D{{"b", 10}}}, {"c", "m"}}), ShouldBeFalse)
+			So(owns(filter, bson.D{{"a", bson.D{{"b", 50.5}}}, {"c", "a"}}), ShouldBeFalse)
+		})
+	})
+
+	Convey("A collection that was not sharded should not be filtered", t, func() {
+		filter, err := orphanFilterFromJSON([]byte(`{"indexes":[],"shard":"rs1"}`))
+		So(err, ShouldBeNil)
+		So(filter, ShouldBeNil)
+	})
+
+	Convey("Metadata without shard metadata should be an error", t, func() {
+		_, err := orphanFilterFromJSON([]byte(`{"indexes":[],"shardKey":{"a":1}}`))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "needs a dump taken directly from a shard")
+	})
+
+	Convey("A shard key without owned chunk ranges should be an error", t, func() {
+		_, err := orphanFilterFromJSON([]byte(`{"indexes":[],"shardKey":{"a":1},"shard":"rs1"}`))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "no chunk ranges")
+	})
+
+	Convey("With the metadata of a collection dumped from a shard owning no chunks", t, func() {
+		filter, err := orphanFilterFromJSON([]byte(
+			`{"indexes":[],"shardKey":{"a":1},"shard":"rs1","ownedChunks":[]}`))
+		So(err, ShouldBeNil)
+		So(filter, ShouldNotBeNil)
+
+		Convey("every document should be an orphan", func() {
+			So(owns(filter, bson.D{{"a", 1}}), ShouldBeFalse)
+			So(owns(filter, bson.D{{"b", 1}}), ShouldBeFalse)
+		})
+	})
+
+	Convey("A document whose shard key cannot be decoded should be an error", t, func() {
+		filter, err := orphanFilterFromJSON([]byte(`{"indexes":[],"shardKey":{"a":1},"shard":"rs1",` +
+			`"ownedChunks":[{"min":{"a":{"$minKey":1}},"max":{"a":{"$maxKey":1}}}]}`))
+		So(err, ShouldBeNil)
+		// {a: NumberDecimal(...)}, which the driver cannot decode
+		raw := append([]byte{24, 0, 0, 0, 0x13, 'a', 0}, make([]byte, 16)...)
+		raw = append(raw, 0)
+		_, err = filter.owns(raw)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("A hashed shard key should be an error", t, func() {
+		_, err := orphanFilterFromJSON([]byte(`{"indexes":[],"shardKey":{"a":"hashed"},"shard":"rs1"}`))
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestCompareBSONValues(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Values should be ordered as MongoDB orders them", t, func() {
+		ordered := []interface{}{
+			bson.MinKey,
+			nil,
+			math.NaN(),
+			int32(-1),
+			2.5,
+			int64(3),
+			"a",
+			bson.Symbol("b"),
+			bson.D{{"a", 1}},
+			bson.D{{"a", 1}, {"b", 1}},
+			[]interface{}{1},
+			[]byte{0xff},
+			bson.ObjectIdHex("5a0000000000000000000000"),
+			false,
+			true,
+			time.Unix(0, 0),
+			bson.MongoTimestamp(1),
+			bson.RegEx{Pattern: "a"},
+			bson.DBPointer{Namespace: "db.c", Id: bson.ObjectIdHex("5a0000000000000000000000")},
+			bson.JavaScript{Code: "a"},
+			bson.JavaScript{Code: "b"},
+			bson.JavaScript{Code: "a", Scope: bson.M{"x": 1}},
+			bson.MaxKey,
+		}
+		for i := range ordered {
+			So(compareBSONValues(ordered[i], ordered[i]), ShouldEqual, 0)
+			for j := i + 1; j < len(ordered); j++ {
+				So(compareBSONValues(ordered[i], ordered[j]), ShouldEqual, -1)
+				So(compareBSONValues(ordered[j], ordered[i]), ShouldEqual, 1)
+			}
+		}
+		So(compareBSONValues(1, 1.0), ShouldEqual, 0)
+	})
+
+	Convey("Values of types that cannot be compared should be reported", t, func() {
+		So(checkComparable([]interface{}{1, "a", bson.MaxKey}), ShouldBeNil)
+		So(checkComparable([]interface{}{1, struct{}{}}), ShouldNotBeNil)
+	})
+}
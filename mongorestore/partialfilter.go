@@ -0,0 +1,96 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// ValidatePartialFilters has the server parse the partialFilterExpression of
+// each index, by explaining a find that uses it as the filter, so that an
+// expression the server cannot parse is reported by index name before any
+// index is built. Servers without the explain command are not checked.
+func (restore *MongoRestore) ValidatePartialFilters(intent *intents.Intent, indexes []IndexDocument) error {
+	session, err := restore.sessionProviderFor(intent.DB).GetSession()
+	if err != nil {
+		return fmt.Errorf("error establishing connection: %v", err)
+	}
+	defer session.Close()
+
+	for _, index := range indexes {
+		filter, ok := index.Options["partialFilterExpression"]
+		if !ok {
+			continue
+		}
+		explain := bson.D{
+			{"explain", bson.D{{"find", intent.C}, {"filter", filter}}},
+			{"verbosity", "queryPlanner"},
+		}
+		res := bson.M{}
+		err = session.DB(intent.DB).Run(explain, &res)
+		if db.IsNoCmd(err) {
+			log.Logf(log.Info, "the server has no explain command, so partial filters of %v are not checked",
+				intent.Namespace())
+			return nil
+		}
+		if err == nil && util.IsFalsy(res["ok"]) {
+			err = fmt.Errorf("%v", res["errmsg"])
+		}
+		if err != nil {
+			return fmt.Errorf("partialFilterExpression %v of index %v cannot be parsed: %v",
+				describePartialFilter(filter), index.Options["name"], err)
+		}
+		log.Logf(log.DebugLow, "partialFilterExpression of index %v on %v parses", index.Options["name"],
+			intent.Namespace())
+	}
+	return nil
+}
+
+// partialFilterError returns err, from building the given indexes, with
+// the partialFilterExpression of each index that has one when the server's
+// message blames a partial filter, and err unchanged otherwise.
+func partialFilterError(indexes []IndexDocument, err error) error {
+	if !strings.Contains(strings.ToLower(err.Error()), "partial") {
+		return err
+	}
+	filters := []string{}
+	for _, index := range indexes {
+		if filter, ok := index.Options["partialFilterExpression"]; ok {
+			filters = append(filters, fmt.Sprintf("%v: %v", index.Options["name"], describePartialFilter(filter)))
+		}
+	}
+	if len(filters) == 0 {
+		return err
+	}
+	return fmt.Errorf("%v; the server rejected a partialFilterExpression, which may use operators "+
+		"or types the target server does not support in partial indexes: %v", err, strings.Join(filters, "; "))
+}
+
+// describePartialFilter returns the filter as extended JSON, or as Go
+// formats it if it cannot be converted. The filter is converted from a
+// copy, since the conversion replaces values in place.
+func describePartialFilter(filter interface{}) string {
+	raw, err := bson.Marshal(bson.D{{"filter", filter}})
+	if err != nil {
+		return fmt.Sprintf("%v", filter)
+	}
+	copied := bson.D{}
+	if err = bson.Unmarshal(raw, &copied); err != nil {
+		return fmt.Sprintf("%v", filter)
+	}
+	converted, err := bsonutil.ConvertBSONValueToJSON(copied[0].Value)
+	if err != nil {
+		return fmt.Sprintf("%v", filter)
+	}
+	jsonBytes, err := json.Marshal(converted)
+	if err != nil {
+		return fmt.Sprintf("%v", filter)
+	}
+	return string(jsonBytes)
+}
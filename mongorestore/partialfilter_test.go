@@ -0,0 +1,79 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+	"time"
+)
+
+func TestPartialFilterRoundTrip(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a partial index dumped to a metadata file", t, func() {
+		restore := &MongoRestore{}
+		// built by a function, since converting to JSON replaces values in place
+		newFilter := func() bson.D {
+			return bson.D{
+				{"status", bson.D{{"$eq", "active"}}},
+				{"age", bson.D{{"$gte", int64(21)}, {"$lt", 65}}},
+				{"created", bson.D{{"$gt", time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)}}},
+				{"$and", []interface{}{bson.D{{"z", bson.D{{"$exists", true}}}}, bson.D{{"b", 1.5}}}},
+			}
+		}
+		index := bson.D{
+			{"v", 2},
+			{"key", bson.D{{"status", 1}, {"age", -1}}},
+			{"name", "status_1_age_-1"},
+			{"partialFilterExpression", newFilter()},
+		}
+		converted, err := bsonutil.ConvertBSONValueToJSON(index)
+		So(err, ShouldBeNil)
+		jsonBytes, err := json.Marshal(bson.M{"indexes": []interface{}{converted}})
+		So(err, ShouldBeNil)
+
+		Convey("the expression should be restored with the same keys, order and types", func() {
+			_, indexes, err := restore.MetadataFromJSON(jsonBytes)
+			So(err, ShouldBeNil)
+			So(len(indexes), ShouldEqual, 1)
+			restored, ok := indexes[0].Options["partialFilterExpression"].(bson.D)
+			So(ok, ShouldBeTrue)
+
+			// compare the BSON the server would receive
+			expected, err := bson.Marshal(bson.D{{"f", newFilter()}})
+			So(err, ShouldBeNil)
+			actual, err := bson.Marshal(bson.D{{"f", restored}})
+			So(err, ShouldBeNil)
+			So(actual, ShouldResemble, expected)
+		})
+	})
+}
+
+func TestPartialFilterError(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With indexes that include a partial index", t, func() {
+		indexes := []IndexDocument{
+			{Options: bson.M{"name": "a_1"}, Key: bson.D{{"a", 1}}},
+			{Options: bson.M{"name": "b_1", "partialFilterExpression": bson.D{{"b", bson.D{{"$gt", 5}}}}},
+				Key: bson.D{{"b", 1}}},
+		}
+
+		Convey("a build failure blaming a partial filter names the expression", func() {
+			err := partialFilterError(indexes,
+				fmt.Errorf("createIndex error: unsupported expression in partial index: b $gt 5"))
+			So(err.Error(), ShouldContainSubstring, `b_1: {"b":{"$gt":`)
+		})
+
+		Convey("other build failures are returned unchanged", func() {
+			cause := fmt.Errorf("createIndex error: index key too long")
+			So(partialFilterError(indexes, cause), ShouldEqual, cause)
+		})
+	})
+}
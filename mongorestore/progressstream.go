@@ -0,0 +1,362 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/progress"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// time between progress messages on a progress stream
+	progressStreamInterval = time.Second
+	// messages buffered for each consumer of a progress stream; a consumer
+	// that falls further behind misses messages rather than block the restore
+	progressStreamBuffer = 1024
+)
+
+// ProgressMessage is one line of a progress stream. Event is one of
+// "collectionStart", "batchInserted", "collectionDone", "indexBuilt",
+// "error", "progress" or, last, "done"; the other fields are set as they
+// apply to it.
+type ProgressMessage struct {
+	Event         string               `json:"event"`
+	Time          string               `json:"time"`
+	Namespace     string               `json:"ns,omitempty"`
+	ExpectedCount int64                `json:"expectedCount,omitempty"`
+	Count         int64                `json:"count,omitempty"`
+	Inserted      int64                `json:"inserted,omitempty"`
+	Failed        int64                `json:"failed,omitempty"`
+	Index         string               `json:"index,omitempty"`
+	Error         string               `json:"error,omitempty"`
+	Collections   []CollectionProgress `json:"collections,omitempty"`
+}
+
+// CollectionProgress is the progress of a collection being restored, in
+// bytes of its BSON source, in a "progress" message.
+type CollectionProgress struct {
+	Namespace string `json:"ns"`
+	Current   int64  `json:"current"`
+	Max       int64  `json:"max"`
+}
+
+// progressConsumer is a connection a progress stream writes to. The stream
+// only closes the connections it accepted itself, and leaves one given to it
+// by an embedder open.
+type progressConsumer struct {
+	conn     net.Conn
+	owned    bool
+	messages chan []byte
+	done     chan struct{}
+}
+
+// progressStream publishes the events of a restore, and the progress of the
+// collections being restored every progressStreamInterval, as
+// newline-delimited JSON ProgressMessages to each of its consumers. It is
+// an EventHandler that passes events on to the restore's own handler.
+// Writing to a consumer never blocks the restore: a consumer that cannot
+// keep up misses messages, and one that disconnects is dropped.
+type progressStream struct {
+	next     EventHandler
+	listener net.Listener
+	path     string
+
+	lock      sync.Mutex
+	consumers []*progressConsumer
+	manager   *progress.Manager
+	closed    bool
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+var _ EventHandler = &progressStream{}
+
+// newProgressStream returns a progress stream writing to conn, if not nil.
+func newProgressStream(conn net.Conn, next EventHandler) *progressStream {
+	stream := &progressStream{next: next, stopChan: make(chan struct{})}
+	if conn != nil {
+		stream.addConsumer(conn, false)
+	}
+	return stream
+}
+
+// listen makes consumers able to connect to the stream through a Unix
+// domain socket created at path. The socket is removed when the stream is
+// closed. A socket left at path by a restore that did not remove it, such
+// as one that crashed, is replaced.
+func (stream *progressStream) listen(path string) error {
+	if err := removeStaleSocket(path); err != nil {
+		return err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	stream.listener = listener
+	stream.path = path
+	stream.wg.Add(1)
+	go stream.accept()
+	return nil
+}
+
+// removeStaleSocket removes the Unix domain socket at path if nothing is
+// listening on it. It is an error if something is, and any other kind of
+// file is left for net.Listen to report.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return nil
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("%v is in use by another process", path)
+	}
+	log.Logf(log.Info, "removing stale progress socket %v", path)
+	return os.Remove(path)
+}
+
+// accept adds each connection to the stream's socket as a consumer.
+func (stream *progressStream) accept() {
+	defer stream.wg.Done()
+	for {
+		conn, err := stream.listener.Accept()
+		if err != nil {
+			return // the listener was closed
+		}
+		log.Logf(log.DebugLow, "progress consumer connected to %v", stream.path)
+		stream.addConsumer(conn, true)
+	}
+}
+
+// start begins sending progress messages.
+func (stream *progressStream) start() {
+	stream.wg.Add(1)
+	go func() {
+		defer stream.wg.Done()
+		ticker := time.NewTicker(progressStreamInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stream.stopChan:
+				return
+			case <-ticker.C:
+				stream.publishProgress()
+			}
+		}
+	}()
+}
+
+// addConsumer makes the stream write to conn until it is closed, and
+// closes conn then if owned is true.
+func (stream *progressStream) addConsumer(conn net.Conn, owned bool) {
+	consumer := &progressConsumer{
+		conn:     conn,
+		owned:    owned,
+		messages: make(chan []byte, progressStreamBuffer),
+		done:     make(chan struct{}),
+	}
+	stream.lock.Lock()
+	if stream.closed {
+		stream.lock.Unlock()
+		if owned {
+			conn.Close()
+		}
+		return
+	}
+	stream.consumers = append(stream.consumers, consumer)
+	stream.lock.Unlock()
+
+	go func() {
+		defer close(consumer.done)
+		if owned {
+			defer conn.Close()
+		}
+		for message := range consumer.messages {
+			if _, err := conn.Write(message); err != nil {
+				log.Logf(log.DebugLow, "dropping progress consumer: %v", err)
+				stream.removeConsumer(consumer)
+				// drain, so that publishing never blocks
+				for range consumer.messages {
+				}
+				return
+			}
+		}
+	}()
+}
+
+// disconnect stops the consumer's writes. Its connection is closed if the
+// stream owns it; otherwise a pending write is cut short with a deadline,
+// which is cleared again once the consumer is done.
+func (consumer *progressConsumer) disconnect() {
+	if consumer.owned {
+		consumer.conn.Close()
+		return
+	}
+	consumer.conn.SetWriteDeadline(time.Now())
+	<-consumer.done
+	consumer.conn.SetWriteDeadline(time.Time{})
+}
+
+func (stream *progressStream) removeConsumer(consumer *progressConsumer) {
+	stream.lock.Lock()
+	defer stream.lock.Unlock()
+	for i, c := range stream.consumers {
+		if c == consumer {
+			stream.consumers = append(stream.consumers[:i], stream.consumers[i+1:]...)
+			close(consumer.messages)
+			return
+		}
+	}
+}
+
+// watch makes the progress messages report the bars of manager.
+func (stream *progressStream) watch(manager *progress.Manager) {
+	if stream == nil {
+		return
+	}
+	stream.lock.Lock()
+	defer stream.lock.Unlock()
+	stream.manager = manager
+}
+
+// encodeMessage returns the line of a message, with any credentials in its
+// error redacted, or nil if it cannot be encoded.
+func encodeMessage(message ProgressMessage) []byte {
+	message.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	message.Error = log.Redact(message.Error)
+	line, err := json.Marshal(message)
+	if err != nil {
+		log.Logf(log.DebugLow, "error encoding progress message: %v", err)
+		return nil
+	}
+	return append(line, '\n')
+}
+
+// publish sends the message to every consumer that has room for it.
+func (stream *progressStream) publish(message ProgressMessage) {
+	line := encodeMessage(message)
+	if line == nil {
+		return
+	}
+
+	stream.lock.Lock()
+	defer stream.lock.Unlock()
+	if stream.closed {
+		return
+	}
+	for _, consumer := range stream.consumers {
+		select {
+		case consumer.messages <- line:
+		default:
+			// the consumer is too far behind
+		}
+	}
+}
+
+// publishProgress sends the progress of the collections being restored.
+func (stream *progressStream) publishProgress() {
+	stream.lock.Lock()
+	manager := stream.manager
+	stream.lock.Unlock()
+	if manager == nil {
+		return
+	}
+	bars := manager.Progress()
+	if len(bars) == 0 {
+		return
+	}
+	collections := make([]CollectionProgress, 0, len(bars))
+	for _, bar := range bars {
+		collections = append(collections, CollectionProgress{bar.Name, bar.Current, bar.Max})
+	}
+	stream.publish(ProgressMessage{Event: "progress", Collections: collections})
+}
+
+// close sends a final "done" message with the restore's error, if any,
+// waits for the consumers to receive what was sent to them, disconnects
+// them and removes the socket. Unlike other messages, "done" waits for
+// room in each consumer's buffer, so that a consumer that is only behind
+// still learns how the restore ended; consumers that stopped reading are
+// given up on after progressStreamInterval in all.
+func (stream *progressStream) close(restoreErr error) {
+	if stream == nil {
+		return
+	}
+	done := ProgressMessage{Event: "done"}
+	if restoreErr != nil {
+		done.Error = restoreErr.Error()
+	}
+	line := encodeMessage(done)
+
+	close(stream.stopChan)
+	if stream.listener != nil {
+		stream.listener.Close()
+	}
+	stream.lock.Lock()
+	stream.closed = true
+	consumers := stream.consumers
+	stream.consumers = nil
+	stream.lock.Unlock()
+
+	timeout := time.NewTimer(progressStreamInterval)
+	defer timeout.Stop()
+	expired := false
+	for _, consumer := range consumers {
+		if line != nil && !expired {
+			select {
+			case consumer.messages <- line:
+			case <-timeout.C:
+				expired = true
+			}
+		}
+		close(consumer.messages)
+	}
+	for _, consumer := range consumers {
+		if !expired {
+			select {
+			case <-consumer.done:
+				continue
+			case <-timeout.C:
+				expired = true
+			}
+		}
+		consumer.disconnect()
+	}
+	stream.wg.Wait()
+	if stream.path != "" {
+		// closing a Unix listener usually removes its socket already
+		if err := os.Remove(stream.path); err != nil && !os.IsNotExist(err) {
+			log.Logf(log.Always, "warning: cannot remove progress socket %v: %v", stream.path, err)
+		}
+	}
+}
+
+func (stream *progressStream) OnCollectionStart(ns string, expectedCount int64) {
+	stream.publish(ProgressMessage{Event: "collectionStart", Namespace: ns, ExpectedCount: expectedCount})
+	stream.next.OnCollectionStart(ns, expectedCount)
+}
+
+func (stream *progressStream) OnBatchInserted(ns string, n int) {
+	stream.publish(ProgressMessage{Event: "batchInserted", Namespace: ns, Count: int64(n)})
+	stream.next.OnBatchInserted(ns, n)
+}
+
+func (stream *progressStream) OnCollectionDone(ns string, inserted, failed int64) {
+	stream.publish(ProgressMessage{Event: "collectionDone", Namespace: ns, Inserted: inserted, Failed: failed})
+	stream.next.OnCollectionDone(ns, inserted, failed)
+}
+
+func (stream *progressStream) OnIndexBuilt(ns, indexName string) {
+	stream.publish(ProgressMessage{Event: "indexBuilt", Namespace: ns, Index: indexName})
+	stream.next.OnIndexBuilt(ns, indexName)
+}
+
+func (stream *progressStream) OnError(ns string, err error) {
+	stream.publish(ProgressMessage{Event: "error", Namespace: ns, Error: fmt.Sprintf("%v", err)})
+	stream.next.OnError(ns, err)
+}
@@ -0,0 +1,205 @@
+package mongorestore
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// consumeProgress is an example consumer of a progress stream: it reads
+// each newline-delimited message from conn until the "done" message.
+func consumeProgress(conn net.Conn) ([]ProgressMessage, error) {
+	messages := []ProgressMessage{}
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		message := ProgressMessage{}
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			return messages, err
+		}
+		messages = append(messages, message)
+		if message.Event == "done" {
+			return messages, nil
+		}
+	}
+	return messages, fmt.Errorf("stream ended without a done message: %v", scanner.Err())
+}
+
+func TestProgressStream(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a progress stream on a Unix socket", t, func() {
+		dir, err := ioutil.TempDir("", "progressstream")
+		So(err, ShouldBeNil)
+		Reset(func() { os.RemoveAll(dir) })
+		path := filepath.Join(dir, "progress.sock")
+
+		recorder := &recordingEventHandler{}
+		stream := newProgressStream(nil, recorder)
+		So(stream.listen(path), ShouldBeNil)
+		stream.start()
+
+		conn, err := net.Dial("unix", path)
+		So(err, ShouldBeNil)
+		Reset(func() { conn.Close() })
+		// wait for the stream to accept the consumer
+		for i := 0; i < 100 && consumerCount(stream) == 0; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		manager := progress.NewProgressBarManager(ioutil.Discard, time.Hour)
+		counter := progress.NewCounter(100)
+		counter.Inc(40)
+		manager.Attach(&progress.Bar{Name: "db.c", Watching: counter, BarLength: 10})
+		stream.watch(manager)
+
+		Convey("a consumer should receive the events, progress and a final done message", func() {
+			stream.OnCollectionStart("db.c", 100)
+			stream.OnBatchInserted("db.c", 10)
+			stream.publishProgress()
+			stream.OnCollectionDone("db.c", 10, 0)
+			stream.close(nil)
+
+			messages, err := consumeProgress(conn)
+			So(err, ShouldBeNil)
+			So(len(messages), ShouldEqual, 5)
+			So(messages[0].Event, ShouldEqual, "collectionStart")
+			So(messages[0].ExpectedCount, ShouldEqual, 100)
+			So(messages[1].Count, ShouldEqual, 10)
+			So(messages[2].Event, ShouldEqual, "progress")
+			So(messages[2].Collections, ShouldResemble, []CollectionProgress{{"db.c", 40, 100}})
+			So(messages[3].Inserted, ShouldEqual, 10)
+			So(messages[4].Event, ShouldEqual, "done")
+			So(messages[4].Error, ShouldEqual, "")
+
+			So(recorder.starts, ShouldEqual, 1)
+			_, err = os.Stat(path)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+	})
+
+	Convey("A consumer that does not read should not block the restore", t, func() {
+		server, client := net.Pipe()
+		defer client.Close()
+		stream := newProgressStream(server, NopEventHandler{})
+
+		finished := make(chan struct{})
+		go func() {
+			for i := 0; i < 2*progressStreamBuffer; i++ {
+				stream.OnBatchInserted("db.c", 1)
+			}
+			stream.close(fmt.Errorf("failed"))
+			close(finished)
+		}()
+		select {
+		case <-finished:
+		case <-time.After(10 * time.Second):
+			t.Fatal("publishing to a stalled consumer blocked")
+		}
+	})
+
+	Convey("A consumer that is behind should still receive the done message", t, func() {
+		server, client := net.Pipe()
+		defer client.Close()
+		stream := newProgressStream(server, NopEventHandler{})
+		// fills the consumer's buffer, so that later messages are missed
+		for i := 0; i < 2*progressStreamBuffer; i++ {
+			stream.OnBatchInserted("db.c", 1)
+		}
+
+		closed := make(chan struct{})
+		go func() {
+			stream.close(fmt.Errorf("failed"))
+			close(closed)
+		}()
+		messages, err := consumeProgress(client)
+		So(err, ShouldBeNil)
+		So(len(messages), ShouldBeLessThan, 2*progressStreamBuffer+1)
+		So(messages[len(messages)-1].Event, ShouldEqual, "done")
+		So(messages[len(messages)-1].Error, ShouldEqual, "failed")
+		<-closed
+	})
+}
+
+func TestProgressStreamConnections(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("A connection given by an embedder should be left open", t, func() {
+		server, client := net.Pipe()
+		defer client.Close()
+		defer server.Close()
+		stream := newProgressStream(server, NopEventHandler{})
+		go stream.close(nil)
+		messages, err := consumeProgress(client)
+		So(err, ShouldBeNil)
+		So(messages[len(messages)-1].Event, ShouldEqual, "done")
+
+		// it only stays writable if the stream did not close it
+		written := make(chan error, 1)
+		go func() {
+			_, err := server.Write([]byte("still open\n"))
+			written <- err
+		}()
+		line, err := bufio.NewReader(client).ReadString('\n')
+		So(err, ShouldBeNil)
+		So(line, ShouldEqual, "still open\n")
+		So(<-written, ShouldBeNil)
+	})
+
+	Convey("With a directory for a progress socket", t, func() {
+		dir, err := ioutil.TempDir("", "progressstream")
+		So(err, ShouldBeNil)
+		Reset(func() { os.RemoveAll(dir) })
+		path := filepath.Join(dir, "progress.sock")
+
+		Convey("a socket left behind by a crashed restore should be replaced", func() {
+			listener, err := net.Listen("unix", path)
+			So(err, ShouldBeNil)
+			// closing a Unix listener this way leaves its socket behind
+			listener.(*net.UnixListener).SetUnlinkOnClose(false)
+			listener.Close()
+			_, err = os.Stat(path)
+			So(err, ShouldBeNil)
+
+			stream := newProgressStream(nil, NopEventHandler{})
+			So(stream.listen(path), ShouldBeNil)
+			stream.close(nil)
+		})
+
+		Convey("a socket that another process listens on should be an error", func() {
+			listener, err := net.Listen("unix", path)
+			So(err, ShouldBeNil)
+			defer listener.Close()
+
+			stream := newProgressStream(nil, NopEventHandler{})
+			err = stream.listen(path)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "in use by another process")
+		})
+	})
+}
+
+func consumerCount(stream *progressStream) int {
+	stream.lock.Lock()
+	defer stream.lock.Unlock()
+	return len(stream.consumers)
+}
+
+type recordingEventHandler struct {
+	NopEventHandler
+	starts int
+}
+
+func (handler *recordingEventHandler) OnCollectionStart(string, int64) {
+	handler.starts++
+}
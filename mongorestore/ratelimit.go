@@ -0,0 +1,84 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/util"
+	"strconv"
+	"strings"
+)
+
+// byteUnits are the units accepted in --collectionRateLimit rates and
+// --collectionChunkSize.
+var byteUnits = map[string]int64{
+	"B":  1,
+	"KB": 1024,
+	"MB": 1024 * 1024,
+	"GB": 1024 * 1024 * 1024,
+}
+
+// parseByteRate parses a rate such as "5MB/s" into bytes per second. The
+// units are B, KB, MB and GB, in powers of 1024.
+func parseByteRate(rate string) (int64, error) {
+	rate = strings.TrimSpace(rate)
+	if !strings.HasSuffix(rate, "/s") {
+		return 0, fmt.Errorf("rate '%v' must be given per second, e.g. '5MB/s'", rate)
+	}
+	bytesPerSecond, err := parseByteSize(strings.TrimSuffix(rate, "/s"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate '%v': %v", rate, err)
+	}
+	return bytesPerSecond, nil
+}
+
+// parseByteSize parses a size such as "64MB" into bytes. The units are B,
+// KB, MB and GB, in powers of 1024.
+func parseByteSize(amount string) (int64, error) {
+	amount = strings.TrimSpace(amount)
+	unitStart := strings.IndexFunc(amount, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if unitStart <= 0 {
+		return 0, fmt.Errorf("'%v' must start with a number and end with a unit, e.g. '5MB'", amount)
+	}
+	unit, ok := byteUnits[strings.ToUpper(amount[unitStart:])]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit '%v' in '%v'; use B, KB, MB or GB", amount[unitStart:], amount)
+	}
+	number, err := strconv.ParseFloat(amount[:unitStart], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number in '%v': %v", amount, err)
+	}
+	bytes := int64(number * float64(unit))
+	if bytes < 1 {
+		return 0, fmt.Errorf("'%v' must be at least 1B", amount)
+	}
+	return bytes, nil
+}
+
+// parseCollectionRateLimits parses --collectionRateLimit values of the form
+// 'db.collection=rate' into a rate limiter for each namespace.
+func parseCollectionRateLimits(limits []string) (map[string]*util.RateLimiter, error) {
+	limiters := map[string]*util.RateLimiter{}
+	for _, limit := range limits {
+		parts := strings.SplitN(limit, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("'%v' should be of the form 'db.collection=rate'", limit)
+		}
+		namespace := strings.TrimSpace(parts[0])
+		if !strings.Contains(namespace, ".") {
+			return nil, fmt.Errorf("'%v' should name a collection as 'db.collection'", limit)
+		}
+		if err := util.ValidateFullNamespace(namespace); err != nil {
+			return nil, fmt.Errorf("invalid namespace in '%v': %v", limit, err)
+		}
+		if _, ok := limiters[namespace]; ok {
+			return nil, fmt.Errorf("more than one rate limit for %v", namespace)
+		}
+		bytesPerSecond, err := parseByteRate(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		limiters[namespace] = util.NewRateLimiter(bytesPerSecond)
+	}
+	return limiters, nil
+}
@@ -0,0 +1,47 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestParseCollectionRateLimits(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Rates should be parsed into bytes per second", t, func() {
+		for rate, expected := range map[string]int64{
+			"500B/s":  500,
+			"5MB/s":   5 * 1024 * 1024,
+			"1.5kb/s": 1536,
+			"2GB/s":   2 * 1024 * 1024 * 1024,
+		} {
+			bytesPerSecond, err := parseByteRate(rate)
+			So(err, ShouldBeNil)
+			So(bytesPerSecond, ShouldEqual, expected)
+		}
+	})
+
+	Convey("Invalid rates should be rejected", t, func() {
+		for _, rate := range []string{"5MB", "MB/s", "5XB/s", "0B/s", "5..1MB/s"} {
+			_, err := parseByteRate(rate)
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("Limits should be keyed by namespace", t, func() {
+		limiters, err := parseCollectionRateLimits([]string{"test.events=5MB/s", "test.logs = 1KB/s"})
+		So(err, ShouldBeNil)
+		So(len(limiters), ShouldEqual, 2)
+		So(limiters["test.events"], ShouldNotBeNil)
+		So(limiters["test.logs"], ShouldNotBeNil)
+
+		_, err = parseCollectionRateLimits([]string{"test=5MB/s"})
+		So(err, ShouldNotBeNil)
+		_, err = parseCollectionRateLimits([]string{"test.events"})
+		So(err, ShouldNotBeNil)
+		_, err = parseCollectionRateLimits([]string{"test.events=1MB/s", "test.events=2MB/s"})
+		So(err, ShouldNotBeNil)
+	})
+}
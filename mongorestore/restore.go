@@ -6,11 +6,14 @@ import (
 	"github.com/mongodb/mongo-tools/common/intents"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	"io"
 	"io/ioutil"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -25,9 +28,18 @@ const (
 func (restore *MongoRestore) RestoreIntents() error {
 
 	// start up the progress bar manager
-	restore.progressManager = progress.NewProgressBarManager(log.Writer(0), progressBarWaitTime)
+	// bars only render well on a terminal, so redirected output gets a
+	// periodic progress line instead
+	if progress.IsTerminal(os.Stderr) || restore.OutputOptions.ProgressInterval <= 0 {
+		restore.progressManager = progress.NewProgressBarManager(log.Writer(0), progressBarWaitTime)
+	} else {
+		interval := time.Duration(restore.OutputOptions.ProgressInterval) * time.Second
+		restore.progressManager = progress.NewProgressBarManager(log.Writer(0), interval)
+		restore.progressManager.SetLineMode(true)
+	}
 	restore.progressManager.Start()
 	defer restore.progressManager.Stop()
+	restore.progressStream.watch(restore.progressManager)
 
 	log.Logf(log.DebugLow, "restoring up to %v collections in parallel", restore.OutputOptions.NumParallelCollections)
 
@@ -45,12 +57,10 @@ func (restore *MongoRestore) RestoreIntents() error {
 						resultChan <- nil // done
 						return
 					}
-					err := restore.RestoreIntent(intent)
-					if err != nil {
-						resultChan <- fmt.Errorf("%v: %v", intent.Namespace(), err)
+					if err := restore.runIntent(intent); err != nil {
+						resultChan <- err
 						return
 					}
-					restore.manager.Finish(intent)
 				}
 			}(i)
 		}
@@ -61,29 +71,113 @@ func (restore *MongoRestore) RestoreIntents() error {
 				return err
 			}
 		}
-		return nil
+		return restore.intentsError()
 	}
 
 	// single-threaded
 	for intent := restore.manager.Pop(); intent != nil; intent = restore.manager.Pop() {
-		err := restore.RestoreIntent(intent)
+		if err := restore.runIntent(intent); err != nil {
+			return err
+		}
+	}
+	return restore.intentsError()
+}
+
+// runIntent restores the intent and marks it finished, returning an error
+// if the restore should stop. The intent is finished even then, so that
+// other restore routines waiting for it to finish do not wait forever. With
+// --perDatabaseIsolation, a failure only stops the rest of the intent's
+// database, and intents of a database that already failed are skipped.
+func (restore *MongoRestore) runIntent(intent *intents.Intent) error {
+	defer restore.manager.Finish(intent)
+	if restore.isolation != nil && !restore.isolation.begin(intent) {
+		log.Logf(log.Info, "skipping %v, since another collection of its database failed", intent.Namespace())
+		return nil
+	}
+	restore.metrics.WorkerStarted()
+	failed, err := restore.restoreWithAttached(intent)
+	restore.metrics.WorkerDone()
+	if err != nil {
+		restore.events().OnError(failed.Namespace(), err)
+		restore.metrics.AddError(failed.Namespace())
+	}
+	if restore.isolation != nil {
+		restore.isolation.end(failed, err)
 		if err != nil {
-			return fmt.Errorf("%v: %v", intent.Namespace(), err)
+			log.Logf(log.Always, "error restoring %v: %v; skipping the rest of database %v",
+				failed.Namespace(), err, intent.DB)
 		}
-		restore.manager.Finish(intent)
+	} else if err != nil && !restore.skipTimedOutIntent(failed, err) {
+		return CollectionRestoreError{failed.Namespace(), err}
 	}
 	return nil
 }
 
+// restoreWithAttached restores the intent and then each intent attached to
+// it, stopping at the first that fails. It returns the intent that failed,
+// or the given intent if all of them were restored.
+func (restore *MongoRestore) restoreWithAttached(intent *intents.Intent) (*intents.Intent, error) {
+	if err := restore.RestoreIntent(intent); err != nil {
+		return intent, err
+	}
+	for _, attached := range intent.Attached {
+		log.Logf(log.DebugLow, "restoring %v together with %v", attached.Namespace(), intent.Namespace())
+		if err := restore.RestoreIntent(attached); err != nil {
+			return attached, err
+		}
+	}
+	return intent, nil
+}
+
+// intentsError returns the error, if any, of intents that failed without
+// stopping the restore. With --perDatabaseIsolation, it also logs the
+// status of each database.
+func (restore *MongoRestore) intentsError() error {
+	if restore.isolation != nil {
+		restore.isolation.writeTable(log.Writer(0))
+		if err := restore.isolation.err(); err != nil {
+			return err
+		}
+	}
+	return restore.timedOutIntentsError()
+}
+
+// skipTimedOutIntent records the intent as failed and returns true if the
+// given error was raised by the --intentTimeout watchdog and we are allowed
+// to carry on with the remaining intents.
+func (restore *MongoRestore) skipTimedOutIntent(intent *intents.Intent, err error) bool {
+	if _, ok := err.(intentTimeoutError); !ok || restore.OutputOptions.StopOnError {
+		return false
+	}
+	log.Logf(log.Always, "error: %v: %v; continuing with remaining collections", intent.Namespace(), err)
+	restore.timedOutIntentsMutex.Lock()
+	defer restore.timedOutIntentsMutex.Unlock()
+	restore.timedOutIntents = append(restore.timedOutIntents, intent.Namespace())
+	return true
+}
+
+// timedOutIntentsError returns an error listing all collections abandoned by
+// the --intentTimeout watchdog, or nil if there were none.
+func (restore *MongoRestore) timedOutIntentsError() error {
+	restore.timedOutIntentsMutex.Lock()
+	defer restore.timedOutIntentsMutex.Unlock()
+	if len(restore.timedOutIntents) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%v collection(s) failed to make progress within %v seconds: %v",
+		len(restore.timedOutIntents), restore.OutputOptions.IntentTimeout,
+		strings.Join(restore.timedOutIntents, ", "))
+}
+
 // RestoreIntent attempts to restore a given intent into MongoDB.
-func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) error {
+func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) (err error) {
 
-	collectionExists, err := restore.CollectionExists(intent)
+	collectionExists, err := restore.targetCollectionExists(intent)
 	if err != nil {
 		return fmt.Errorf("error reading database: %v", err)
 	}
 
-	if restore.safety == nil && !restore.OutputOptions.Drop && collectionExists {
+	if restore.safetyFor(intent.Namespace()) == nil && !restore.OutputOptions.Drop && collectionExists {
 		log.Logf(log.Always, "restoring to existing collection %v without dropping", intent.Namespace())
 		log.Log(log.Always, "Important: restored data will be inserted without raising errors; check your server log")
 	}
@@ -106,6 +200,7 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) error {
 	}
 
 	var options bson.D
+	var collModOptions bson.D
 	var indexes []IndexDocument
 
 	// get indexes from system.indexes dump if we have it but don't have metadata files
@@ -118,6 +213,19 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) error {
 		}
 	}
 
+	// collections without a metadata file are only created up front when
+	// --storageOverrides gives them options
+	if intent.MetadataPath == "" {
+		if restore.OutputOptions.FilterOrphans && intent.BSONPath != "" {
+			return fmt.Errorf("no metadata file for %v, whose shard metadata --filterOrphans needs",
+				intent.Namespace())
+		}
+		err = restore.createCollectionWithOptions(intent, nil, collectionExists)
+		if err != nil {
+			return err
+		}
+	}
+
 	// first create the collection with options from the metadata file
 	if intent.MetadataPath != "" {
 		log.Logf(log.Always, "reading metadata file from %v", intent.MetadataPath)
@@ -129,32 +237,94 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) error {
 		if err != nil {
 			return fmt.Errorf("error parsing metadata file %v: %v", intent.MetadataPath, err)
 		}
-		if !restore.OutputOptions.NoOptionsRestore {
-			if options != nil {
-				if !collectionExists {
-					log.Logf(log.Info, "creating collection %v using options from metadata", intent.Namespace())
-					err = restore.CreateCollection(intent, options)
-					if err != nil {
-						return fmt.Errorf("error creating collection %v: %v", intent.Namespace(), err)
-					}
-				} else {
-					log.Logf(log.Info, "collection %v already exists", intent.Namespace())
+		if restore.OutputOptions.NoOptionsRestore {
+			log.Log(log.Info, "skipping options restoration")
+			options = nil
+		} else if options == nil {
+			log.Log(log.Info, "no collection options to restore")
+		}
+		if !restore.OutputOptions.NoIndexRestore {
+			idIndex, err := restore.IDIndexFromJSON(jsonBytes)
+			if err != nil {
+				return fmt.Errorf("error parsing metadata file %v: %v", intent.MetadataPath, err)
+			}
+			if idIndex != nil && collectionExists {
+				if err = restore.checkIDIndex(intent, idIndex); err != nil {
+					return err
+				}
+			}
+			if idIndex != nil {
+				options = withIDIndex(options, idIndex, intent.Namespace(), restore.OutputOptions.KeepIndexVersion)
+			}
+		}
+		if restore.OutputOptions.FilterOrphans {
+			filter, err := orphanFilterFromJSON(jsonBytes)
+			if err != nil {
+				return fmt.Errorf("error reading shard metadata from %v: %v", intent.MetadataPath, err)
+			}
+			restore.setOrphanFilter(intent.Namespace(), filter)
+		}
+		if restore.OutputOptions.ApplyCollMod {
+			options, collModOptions = splitCollModOptions(options)
+		}
+		err = restore.createCollectionWithOptions(intent, options, collectionExists)
+		if err != nil {
+			return err
+		}
+		if restore.OutputOptions.NumInitialChunks > 0 && !collectionExists {
+			sharding, err := restore.ShardingFromJSON(jsonBytes)
+			if err != nil {
+				return fmt.Errorf("error parsing metadata file %v: %v", intent.MetadataPath, err)
+			}
+			if sharding != nil {
+				log.Logf(log.Info, "sharding collection %v on %v with %v initial chunks",
+					intent.Namespace(), sharding.Key, restore.OutputOptions.NumInitialChunks)
+				err = restore.ShardCollection(intent, sharding)
+				if err != nil {
+					return fmt.Errorf("error sharding collection %v: %v", intent.Namespace(), err)
 				}
 			} else {
-				log.Log(log.Info, "no collection options to restore")
+				log.Logf(log.Info, "no shard key in metadata for %v, leaving it unsharded", intent.Namespace())
 			}
-		} else {
-			log.Log(log.Info, "skipping options restoration")
+		}
+	}
+
+	// with --loadThenIndex, the documents are loaded into an existing
+	// collection without its secondary indexes, which are rebuilt after,
+	// or as soon as the restore fails
+	var droppedIndexes []IndexDocument
+	if restore.OutputOptions.LoadThenIndex && collectionExists && intent.BSONPath != "" &&
+		!restore.OutputOptions.MetadataOnly && !isView(options) {
+		defer func() {
+			if err != nil {
+				err = restore.rebuildDroppedIndexes(intent, droppedIndexes, err)
+			}
+		}()
+		droppedIndexes, err = restore.dropSecondaryIndexes(intent)
+		if err != nil {
+			return err
 		}
 	}
 
 	// then do bson
-	if intent.BSONPath != "" {
+	if intent.BSONPath != "" && restore.OutputOptions.MetadataOnly {
+		log.Logf(log.Info, "skipping documents for %v because of --metadataOnly", intent.Namespace())
+	} else if intent.BSONPath != "" && isView(options) {
+		// a view's documents are computed by the server from its source
+		log.Logf(log.Info, "skipping documents for %v because it is a view", intent.Namespace())
+	} else if intent.BSONPath != "" {
 		log.Logf(log.Always, "restoring %v from file %v", intent.Namespace(), intent.BSONPath)
 		var rawBSONSource io.ReadCloser
 		var size int64
 
-		if restore.useStdin {
+		if restore.useStdin && restore.InputOptions.PipeCmd != "" {
+			// the command is given stdin directly, which it does not close
+			rawBSONSource, err = util.NewPipeCmdReader(restore.InputOptions.PipeCmd, os.Stdin)
+			if err != nil {
+				return fmt.Errorf("error starting --pipeCmd: %v", err)
+			}
+			log.Logf(log.Always, "restoring from stdin through '%v'", restore.InputOptions.PipeCmd)
+		} else if restore.useStdin {
 			// closing stdin results in inconsistent behavior between
 			// environments, so we just avoid closing it
 			rawBSONSource = ioutil.NopCloser(os.Stdin)
@@ -167,28 +337,129 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) error {
 			size = fileInfo.Size()
 			log.Logf(log.Info, "\tfile %v is %v bytes", intent.BSONPath, size)
 
-			rawBSONSource, err = os.Open(intent.BSONPath)
+			rawBSONSource, err = restore.openDumpFile(intent.BSONPath)
 			if err != nil {
 				return fmt.Errorf("error reading BSON file %v: %v", intent.BSONPath, err)
 			}
+			if dumpFile, ok := rawBSONSource.(*gzipDumpFile); ok {
+				// progress is measured in compressed bytes, out of size
+				log.Logf(log.Info, "\tdecompressing %v with gzip", intent.BSONPath)
+				restore.setGzipFile(intent.Namespace(), dumpFile)
+				defer restore.setGzipFile(intent.Namespace(), nil)
+			}
+		}
+
+		if _, fileType := GetInfoFromFilename(intent.BSONPath); fileType == JSONFileType {
+			log.Logf(log.Info, "\tconverting %v from extended JSON", intent.BSONPath)
+			rawBSONSource = newJSONToBSONReader(rawBSONSource)
+		} else {
+			rawBSONSource, err = checkNotJSON(rawBSONSource, intent.BSONPath)
+			if err != nil {
+				return err
+			}
+		}
+
+		if restore.OutputOptions.InsertOrder == insertOrderReverse {
+			log.Logf(log.Info, "\tscanning %v to insert its documents in reverse order", intent.BSONPath)
+			rawBSONSource, err = newReverseBSONReader(rawBSONSource)
+			if err != nil {
+				return fmt.Errorf("error reading %v for reverse insertion: %v", intent.BSONPath, err)
+			}
 		}
 
 		bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(rawBSONSource))
 		defer bsonSource.Close()
 
-		err = restore.RestoreCollectionToDB(intent.DB, intent.C, bsonSource, size)
+		if restore.InputOptions.DiffAgainst != "" {
+			err = restore.RestoreCollectionDiff(intent, bsonSource, size)
+		} else {
+			var chunks []bsonChunk
+			var expectedCount int64
+			chunks, expectedCount, err = restore.collectionChunks(intent, rawBSONSource)
+			if err == nil && chunks != nil {
+				err = restore.RestoreCollectionChunks(intent.DB, intent.C, rawBSONSource.(*os.File), chunks,
+					size, expectedCount)
+			} else if err == nil {
+				err = restore.restoreDocuments(intent.DB, intent.C, bsonSource, size, expectedCount)
+			}
+		}
+		if _, ok := err.(intentTimeoutError); ok {
+			return err // passed through so RestoreIntents can recognize it
+		}
 		if err != nil {
 			return fmt.Errorf("error restoring from %v: %v", intent.BSONPath, err)
 		}
 	}
 
+	// options set with collMod apply whether or not the collection existed,
+	// and a validator only applies to documents written after it
+	if len(collModOptions) > 0 {
+		err = restore.ApplyCollMod(intent, collModOptions)
+		if err != nil {
+			return fmt.Errorf("error setting options of %v: %v", intent.Namespace(), err)
+		}
+	}
+
+	// indexes dumped with --dumpIndexesSeparately take precedence over
+	// any of the same name in the metadata file
+	if intent.IndexesPath != "" {
+		log.Logf(log.Always, "reading indexes file from %v", intent.IndexesPath)
+		separateIndexes, err := restore.IndexesFromJSON(intent.IndexesPath)
+		if err != nil {
+			return fmt.Errorf("error reading indexes file %v: %v", intent.IndexesPath, err)
+		}
+		indexes = replaceIndexes(indexes, separateIndexes)
+	}
+
+	if restore.InputOptions.MergeIndexesFrom != "" {
+		indexes, err = restore.mergeIndexesFrom(intent, indexes)
+		if err != nil {
+			return err
+		}
+	}
+
+	// only the dump's indexes are hidden; existing ones keep their state
+	if restore.OutputOptions.RestoreIndexesHidden {
+		hideIndexes(indexes)
+	}
+
+	// existing indexes that were dropped are rebuilt with those of the dump
+	indexes = addMissingIndexes(indexes, droppedIndexes)
+
+	// GridFS reads depend on specific indexes, so make sure they are
+	// created even if the dump did not include them
+	if required := restore.gridFSIndexes(intent); required != nil {
+		indexes = addMissingIndexes(indexes, required)
+	}
+
 	// finally, add indexes
 	if len(indexes) > 0 && !restore.OutputOptions.NoIndexRestore {
 		log.Logf(log.Always, "restoring indexes for collection %v from metadata", intent.Namespace())
+		if restore.OutputOptions.ValidatePartialFilters {
+			err = restore.ValidatePartialFilters(intent, indexes)
+			if err != nil {
+				return fmt.Errorf("error validating indexes for %v: %v", intent.Namespace(), err)
+			}
+		}
+		indexStart := time.Now()
 		err = restore.CreateIndexes(intent, indexes)
 		if err != nil {
 			return fmt.Errorf("error creating indexes for %v: %v", intent.Namespace(), err)
 		}
+		if restore.OutputOptions.WaitForIndexes {
+			err = restore.WaitForIndexBuilds(intent, indexes)
+			if err != nil {
+				return fmt.Errorf("error waiting for index builds on %v: %v", intent.Namespace(), err)
+			}
+			log.Logf(log.Always, "indexes for %v finished building in %v",
+				intent.Namespace(), time.Since(indexStart))
+		}
+		if restore.OutputOptions.VerifyIndexes {
+			err = restore.VerifyIndexes(intent, indexes)
+			if err != nil {
+				return fmt.Errorf("error verifying indexes of %v: %v", intent.Namespace(), err)
+			}
+		}
 	} else {
 		log.Log(log.Always, "no indexes to restore")
 	}
@@ -197,23 +468,211 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) error {
 	return nil
 }
 
+// createCollectionWithOptions creates the intent's collection with the given
+// options, merged with any --storageOverrides for it. It does nothing if the
+// collection already exists or, unless --metadataOnly is set, if there are no
+// options to create it with and its database is not being created by
+// --createDatabases.
+func (restore *MongoRestore) createCollectionWithOptions(intent *intents.Intent,
+	options bson.D, collectionExists bool) error {
+
+	override := restore.storageOverrides[intent.Namespace()]
+	if override != nil {
+		options = mergeCreateOptions(options, override)
+	}
+	// with no documents to insert, nothing else would create the collection,
+	// and --createDatabases creates collections of new databases explicitly
+	if options == nil && !restore.OutputOptions.MetadataOnly && !restore.createdDatabases[intent.DB] &&
+		!restore.hasNoDocuments(intent) {
+		return nil
+	}
+	if collectionExists {
+		if override != nil {
+			log.Logf(log.Always, "collection %v already exists, so its storage overrides "+
+				"were not applied", intent.Namespace())
+		} else {
+			log.Logf(log.Info, "collection %v already exists", intent.Namespace())
+		}
+		return nil
+	}
+
+	if override != nil {
+		log.Logf(log.Always, "creating collection %v with storage overrides, using options %v",
+			intent.Namespace(), options)
+	} else {
+		log.Logf(log.Info, "creating collection %v using options from metadata", intent.Namespace())
+	}
+	if err := restore.CreateCollection(intent, options); err != nil {
+		if restore.OutputOptions.AssumeEmptyTarget {
+			return fmt.Errorf("error creating collection %v (the target was assumed "+
+				"to be empty because of --assumeEmptyTarget): %v", intent.Namespace(), err)
+		}
+		return fmt.Errorf("error creating collection %v: %v", intent.Namespace(), err)
+	}
+	return nil
+}
+
+// targetCollectionExists returns true if the intent's collection already
+// exists on the target. With --assumeEmptyTarget it is assumed not to,
+// without listing the collections, and the create command fails if it does.
+func (restore *MongoRestore) targetCollectionExists(intent *intents.Intent) (bool, error) {
+	if restore.OutputOptions.AssumeEmptyTarget {
+		return false, nil
+	}
+	return restore.CollectionExists(intent)
+}
+
+// hasNoDocuments returns true if the intent is for a collection that was
+// dumped empty: one with only a metadata file, or with an empty data file.
+// Such collections are created explicitly, since no insert would create
+// them.
+func (restore *MongoRestore) hasNoDocuments(intent *intents.Intent) bool {
+	if intent.BSONPath == "" {
+		return intent.MetadataPath != ""
+	}
+	return !restore.useStdin && restore.isEmptyDumpFile(intent)
+}
+
 // RestoreCollectionToDB pipes the given BSON data into the database.
 func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 	bsonSource *db.DecodedBSONSource, fileSize int64) error {
+	return restore.restoreDocuments(dbName, colName, bsonSource, fileSize, 0)
+}
+
+// restoreDocuments pipes the given BSON data, of expectedCount documents if
+// known, into the database.
+func (restore *MongoRestore) restoreDocuments(dbName, colName string,
+	bsonSource *db.DecodedBSONSource, fileSize, expectedCount int64) error {
+
+	feed := func(docChan chan<- bson.Raw, doneChan <-chan struct{}, limiter *util.RateLimiter) error {
+		return feedDocuments(bsonSource, docChan, doneChan, limiter)
+	}
+	return restore.insertDocuments(dbName, colName, feed, fileSize, expectedCount)
+}
+
+// feedDocuments sends copies of the documents of bsonSource to docChan until
+// it runs out or doneChan is closed, and returns any error reading them.
+func feedDocuments(bsonSource *db.DecodedBSONSource, docChan chan<- bson.Raw,
+	doneChan <-chan struct{}, limiter *util.RateLimiter) error {
+
+	doc := bson.Raw{}
+	for bsonSource.Next(&doc) {
+		rawBytes := make([]byte, len(doc.Data))
+		copy(rawBytes, doc.Data)
+		if limiter != nil {
+			limiter.Wait(len(rawBytes))
+		}
+		select {
+		case docChan <- bson.Raw{Data: rawBytes}:
+		case <-doneChan:
+			return nil
+		}
+	}
+	return bsonSource.Err()
+}
+
+// documentFeed sends the documents to restore to docChan, stopping early if
+// doneChan is closed, and returns any error reading them. The limiter, if
+// not nil, limits the rate of the documents.
+type documentFeed func(docChan chan<- bson.Raw, doneChan <-chan struct{}, limiter *util.RateLimiter) error
+
+// documentWriter writes the documents of an insertion worker to its
+// collection, queuing them up and sending them in batches.
+type documentWriter interface {
+	// Write queues a document, sending the queued ones if the buffer is
+	// full, and returns any error that occurs.
+	Write(doc []byte) error
+	// Flush sends the queued documents.
+	Flush() error
+}
 
-	session, err := restore.SessionProvider.GetSession()
+// collectionWrites creates the writers of a collection's insertion workers.
+type collectionWrites interface {
+	// newWriter returns the writer of a worker, which calls flushed after
+	// each batch with the number of documents in it and its error, if any.
+	newWriter(collection *mgo.Collection, flushed func(docCount int, err error)) documentWriter
+	// done is called once all the documents were written, to report on them.
+	done()
+}
+
+// writesFor returns how the documents of the namespace are written: merged
+// into the target's documents with --mergeDocuments, and inserted otherwise.
+func (restore *MongoRestore) writesFor(namespace string) collectionWrites {
+	if restore.OutputOptions.MergeDocuments {
+		return newMergeWrites(restore, namespace)
+	}
+	return insertWrites{restore}
+}
+
+// insertWrites inserts the documents with a BufferedBulkInserter.
+type insertWrites struct {
+	restore *MongoRestore
+}
+
+func (writes insertWrites) newWriter(collection *mgo.Collection,
+	flushed func(docCount int, err error)) documentWriter {
+	restore := writes.restore
+	bulk := db.NewBufferedBulkInserter(
+		collection, restore.ToolOptions.BulkBufferSize, !restore.OutputOptions.StopOnError)
+	bulk.SetRetryPolicy(restore.retryLimit(), restore.retryBackoff())
+	if restore.batchByteLimit > 0 {
+		bulk.SetByteLimit(restore.batchByteLimit)
+	}
+	bulk.SetFlushCallback(flushed)
+	return insertWriter{bulk}
+}
+
+func (writes insertWrites) done() {}
+
+type insertWriter struct {
+	bulk *db.BufferedBulkInserter
+}
+
+func (writer insertWriter) Write(doc []byte) error {
+	return writer.bulk.Insert(bson.Raw{Data: doc})
+}
+
+func (writer insertWriter) Flush() error {
+	return writer.bulk.Flush()
+}
+
+// insertDocuments writes the documents of feed to the collection with the
+// configured number of insertion workers, inserting them or, with
+// --mergeDocuments, merging them into the target's. Its events are reported
+// whether or not it succeeds: OnCollectionStart with expectedCount, the
+// number of documents if known, and OnCollectionDone when it returns.
+func (restore *MongoRestore) insertDocuments(dbName, colName string, feed documentFeed,
+	fileSize, expectedCount int64) error {
+	session, err := restore.sessionProviderFor(dbName).GetSession()
 	if err != nil {
 		return fmt.Errorf("error establishing connection: %v", err)
 	}
-	session.SetSafe(restore.safety)
+	namespace := fmt.Sprintf("%v.%v", dbName, colName)
+	session.SetSafe(restore.safetyFor(namespace))
 	session.SetSocketTimeout(0)
 	defer session.Close()
 
 	collection := session.DB(dbName).C(colName)
+	events := restore.events()
+	events.OnCollectionStart(namespace, expectedCount)
+	restore.metrics.ExpectBytes(namespace, fileSize)
+
+	// counts of documents in successful and failed bulk inserts, for events;
+	// workers abandoned on an error may still finish a batch after the
+	// collection is done, which is then no longer reported
+	var countsLock sync.Mutex
+	var insertedCount, failedCount int64
+	collectionDone := false
+	defer func() {
+		countsLock.Lock()
+		defer countsLock.Unlock()
+		collectionDone = true
+		events.OnCollectionDone(namespace, insertedCount, failedCount)
+	}()
 
-	watchProgressor := progress.NewCounter(fileSize)
+	watchProgressor := restore.newBytesProgressor(namespace, fileSize)
 	bar := &progress.Bar{
-		Name:      fmt.Sprintf("%v.%v", dbName, colName),
+		Name:      namespace,
 		Watching:  watchProgressor,
 		BarLength: progressBarLength,
 		IsBytes:   true,
@@ -227,29 +686,71 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 	}
 	docChan := make(chan bson.Raw, insertBufferFactor)
 	resultChan := make(chan error, maxInsertWorkers)
+	doneChan := make(chan struct{})
+	defer close(doneChan)
+
+	orphans := restore.orphanFilterFor(namespace)
+	writes := restore.writesFor(namespace)
+	transform := restore.transformsApplyTo(dbName, colName)
+
+	limiter := restore.rateLimiters[namespace]
+	if limiter != nil {
+		log.Logf(log.Info, "\tlimiting the insertion rate of %v (--collectionRateLimit)", namespace)
+	}
 
+	// feedErr is set before docChan is closed, and so before the insertion
+	// workers finish
+	var feedErr error
 	go func() {
-		doc := bson.Raw{}
-		for bsonSource.Next(&doc) {
-			rawBytes := make([]byte, len(doc.Data))
-			copy(rawBytes, doc.Data)
-			docChan <- bson.Raw{Data: rawBytes}
-		}
-		close(docChan)
+		defer close(docChan)
+		feedErr = feed(docChan, doneChan, limiter)
 	}()
 
+	var stallChan <-chan struct{}
+	if restore.OutputOptions.IntentTimeout > 0 {
+		timeout := time.Duration(restore.OutputOptions.IntentTimeout) * time.Second
+		stallChan = watchForStall(watchProgressor, timeout, doneChan)
+	}
+
 	log.Logf(log.DebugLow, "using %v insertion workers", maxInsertWorkers)
 
 	for i := 0; i < maxInsertWorkers; i++ {
 		go func() {
-			// get a session copy for each insert worker
+			// wait for our share of --maxConnections, then get a session
+			// copy for each insert worker
+			release := restore.SessionProvider.AcquireConnection()
+			defer release()
 			s := session.Copy()
 			defer s.Close()
+			if restore.OutputOptions.IntentTimeout > 0 {
+				// a write blocked for as long as the watchdog waits fails,
+				// so that an abandoned worker does not hold on to its
+				// connection forever
+				s.SetSocketTimeout(time.Duration(restore.OutputOptions.IntentTimeout) * time.Second)
+			}
 
-			coll := collection.With(s)
-			bulk := db.NewBufferedBulkInserter(
-				coll, restore.ToolOptions.BulkBufferSize, !restore.OutputOptions.StopOnError)
+			writer := writes.newWriter(collection.With(s), func(docCount int, err error) {
+				if err == nil {
+					restore.metrics.AddDocuments(namespace, int64(docCount))
+				}
+				countsLock.Lock()
+				defer countsLock.Unlock()
+				if collectionDone {
+					return
+				}
+				if err != nil {
+					failedCount += int64(docCount)
+					return
+				}
+				insertedCount += int64(docCount)
+				events.OnBatchInserted(namespace, docCount)
+			})
 			for rawDoc := range docChan {
+				if isClosed(doneChan) {
+					// the collection was abandoned
+					resultChan <- nil
+					return
+				}
 				if restore.objCheck {
 					err := bson.Unmarshal(rawDoc.Data, &bson.D{})
 					if err != nil {
@@ -257,7 +758,33 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 						return
 					}
 				}
-				if err := bulk.Insert(rawDoc); err != nil {
+				readSize := int64(len(rawDoc.Data))
+				if orphans != nil {
+					owned, err := orphans.owns(rawDoc.Data)
+					if err != nil {
+						resultChan <- err
+						return
+					}
+					if !owned {
+						orphans.skip()
+						watchProgressor.Inc(readSize)
+						restore.metrics.AddBytes(namespace, readSize)
+						continue
+					}
+				}
+				var err error
+				transformed := rawDoc.Data
+				if transform {
+					if transformed, err = restore.applyTransforms(rawDoc.Data); err != nil {
+						resultChan <- err
+						return
+					}
+				}
+				// a nil document was dropped by one of the transforms
+				if transformed != nil {
+					err = writer.Write(transformed)
+				}
+				if err != nil {
 					if db.IsConnectionError(err) || restore.OutputOptions.StopOnError {
 						// Propagate this error, since it's either a fatal connection error
 						// or the user has turned on --stopOnError
@@ -265,16 +792,27 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 					} else {
 						// Otherwise just log the error but don't propagate it.
 						log.Logf(log.Always, "error: %v", err)
+						events.OnError(namespace, err)
+						restore.metrics.AddError(namespace)
 					}
 				}
-				watchProgressor.Inc(int64(len(rawDoc.Data)))
+				watchProgressor.Inc(readSize)
+				restore.metrics.AddBytes(namespace, readSize)
+			}
+			if isClosed(doneChan) {
+				// the documents left in the buffer are not written once
+				// the collection was abandoned
+				resultChan <- nil
+				return
 			}
-			err := bulk.Flush()
+			err := writer.Flush()
 			if err != nil {
 				if !db.IsConnectionError(err) && !restore.OutputOptions.StopOnError {
 					// Suppress this error since it's not a severe connection error and
 					// the user has not specified --stopOnError
 					log.Logf(log.Always, "error: %v", err)
+					events.OnError(namespace, err)
+					restore.metrics.AddError(namespace)
 					err = nil
 				}
 			}
@@ -286,16 +824,148 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 		time.Sleep(time.Duration(i) * 10 * time.Millisecond)
 	}
 
-	// wait until all insert jobs finish
+	// wait until all insert jobs finish, or until the watchdog gives up on them
 	for done := 0; done < maxInsertWorkers; done++ {
-		err := <-resultChan
-		if err != nil {
-			return fmt.Errorf("insertion error: %v", err)
+		select {
+		case err := <-resultChan:
+			if err != nil {
+				return fmt.Errorf("insertion error: %v", err)
+			}
+		case <-stallChan:
+			return intentTimeoutError{
+				namespace: namespace,
+				timeout:   restore.OutputOptions.IntentTimeout,
+			}
 		}
 	}
 	// final error check
-	if err = bsonSource.Err(); err != nil {
-		return fmt.Errorf("reading bson input: %v", err)
+	if feedErr != nil {
+		return fmt.Errorf("reading bson input: %v", feedErr)
+	}
+	if orphans != nil {
+		log.Logf(log.Always, "left out %v orphaned document(s) of %v outside the chunks owned by shard %v",
+			orphans.skippedCount(), namespace, orphans.shard)
 	}
+	writes.done()
 	return nil
 }
+
+// intentTimeoutError is returned by RestoreCollectionToDB when the
+// --intentTimeout watchdog abandons a collection that has stopped progressing.
+type intentTimeoutError struct {
+	namespace string
+	timeout   int
+}
+
+func (e intentTimeoutError) Error() string {
+	return fmt.Sprintf("no progress restoring %v for %v seconds, abandoning its insertion workers",
+		e.namespace, e.timeout)
+}
+
+// isClosed returns true if the channel has been closed.
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// watchForStall polls the given progressor and closes the returned channel if
+// the amount completed doesn't change for the given duration. Polling stops
+// once the done channel is closed.
+func watchForStall(progressor progress.Progressor, timeout time.Duration,
+	done <-chan struct{}) <-chan struct{} {
+
+	stallChan := make(chan struct{})
+	pollInterval := timeout / 4
+	if pollInterval > time.Second {
+		pollInterval = time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		_, lastProgress := progressor.Progress()
+		lastChange := time.Now()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				_, current := progressor.Progress()
+				if current != lastProgress {
+					lastProgress, lastChange = current, now
+					continue
+				}
+				if now.Sub(lastChange) >= timeout {
+					log.Logf(log.Always, "no progress for %v (stuck at %v)", timeout, current)
+					close(stallChan)
+					return
+				}
+			}
+		}
+	}()
+	return stallChan
+}
+
+// poolSize returns the number of connections to allow to each server:
+// --poolSize, or enough for every insertion worker of every collection
+// restored in parallel, plus one per collection for its other commands and
+// one for the restore itself.
+func (restore *MongoRestore) poolSize() int {
+	if restore.OutputOptions.PoolSize > 0 {
+		return restore.OutputOptions.PoolSize
+	}
+	collections := restore.OutputOptions.NumParallelCollections
+	if collections < 1 {
+		collections = 1
+	}
+	workers := restore.OutputOptions.NumInsertionWorkers
+	if restore.OutputOptions.MaintainInsertionOrder || workers < 1 {
+		workers = 1
+	}
+	workers *= collections
+	if max := restore.OutputOptions.MaxConnections; max > 0 && max < workers {
+		workers = max
+	}
+	return workers + collections + 1
+}
+
+// retryBackoff returns the delays between retries configured by
+// --retryBaseDelay and --retryMaxDelay, bounded by --maxRetryTime.
+func (restore *MongoRestore) retryBackoff() util.Backoff {
+	return util.Backoff{
+		BaseDelay: time.Duration(restore.OutputOptions.RetryBaseDelay) * time.Millisecond,
+		MaxDelay:  time.Duration(restore.OutputOptions.RetryMaxDelay) * time.Millisecond,
+		Budget:    restore.retryBudget,
+	}
+}
+
+// retryLimit returns the number of times to retry an operation: --retries,
+// or no limit if only --maxRetryTime bounds the retries.
+func (restore *MongoRestore) retryLimit() int {
+	if restore.OutputOptions.Retries == 0 && restore.retryBudget != nil {
+		return -1
+	}
+	return restore.OutputOptions.Retries
+}
+
+// retry runs fn, retrying it up to --retries times, and within
+// --maxRetryTime, if it fails with a connection error. The session is
+// refreshed before each retry so that it reconnects, possibly to a newly
+// elected primary.
+func (restore *MongoRestore) retry(session *mgo.Session, operation string, fn func() error) error {
+	return util.Retry(restore.retryLimit(), restore.retryBackoff(), func(err error) bool {
+		if !db.IsConnectionError(err) {
+			return false
+		}
+		if restore.retryBudget.Spent() {
+			// Retry fails with the spent budget without retrying
+			return true
+		}
+		log.Logf(log.Always, "retrying %v after connection error: %v", operation, err)
+		session.Refresh()
+		return true
+	}, fn)
+}
@@ -0,0 +1,127 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	"github.com/mongodb/mongo-tools/common/util"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestWatchForStall(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a progress counter and a stall watchdog", t, func() {
+		counter := progress.NewCounter(100)
+
+		Convey("a counter that never moves should trip the watchdog", func() {
+			done := make(chan struct{})
+			defer close(done)
+			stallChan := watchForStall(counter, 40*time.Millisecond, done)
+			select {
+			case <-stallChan:
+			case <-time.After(time.Second):
+				t.Fatal("watchdog never fired")
+			}
+		})
+
+		Convey("a counter that keeps moving should not trip the watchdog", func() {
+			done := make(chan struct{})
+			defer close(done)
+			stallChan := watchForStall(counter, 100*time.Millisecond, done)
+			stalled := false
+			for i := 0; i < 10; i++ {
+				counter.Inc(1)
+				select {
+				case <-stallChan:
+					stalled = true
+				case <-time.After(20 * time.Millisecond):
+				}
+			}
+			So(stalled, ShouldBeFalse)
+		})
+
+		Convey("workers should see that an abandoned collection's channel is closed", func() {
+			done := make(chan struct{})
+			So(isClosed(done), ShouldBeFalse)
+			close(done)
+			So(isClosed(done), ShouldBeTrue)
+		})
+	})
+}
+
+func TestPoolSize(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a restore of 4 collections with 3 insertion workers each", t, func() {
+		restore := &MongoRestore{OutputOptions: &OutputOptions{
+			NumParallelCollections: 4,
+			NumInsertionWorkers:    3,
+		}}
+
+		Convey("the pool should fit every worker and collection", func() {
+			So(restore.poolSize(), ShouldEqual, 4*3+4+1)
+		})
+
+		Convey("--maxConnections should bound the insertion workers", func() {
+			restore.OutputOptions.MaxConnections = 5
+			So(restore.poolSize(), ShouldEqual, 5+4+1)
+		})
+
+		Convey("--maintainInsertionOrder should leave one worker per collection", func() {
+			restore.OutputOptions.MaintainInsertionOrder = true
+			So(restore.poolSize(), ShouldEqual, 4+4+1)
+		})
+
+		Convey("--poolSize should override the computed size", func() {
+			restore.OutputOptions.PoolSize = 7
+			So(restore.poolSize(), ShouldEqual, 7)
+		})
+	})
+}
+
+func TestRetrySpentBudget(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a restore whose retry budget is spent", t, func() {
+		restore := &MongoRestore{
+			OutputOptions: &OutputOptions{RetryBaseDelay: 100, RetryMaxDelay: 1000},
+			retryBudget:   util.NewRetryBudget(0),
+		}
+
+		Convey("a connection error should fail without touching the session", func() {
+			calls := 0
+			start := time.Now()
+			// a nil session would panic if it were refreshed
+			err := restore.retry(nil, "test", func() error {
+				calls++
+				return io.EOF
+			})
+			So(err, ShouldHaveSameTypeAs, util.RetryBudgetError{})
+			So(calls, ShouldEqual, 1)
+			So(time.Since(start), ShouldBeLessThan, 100*time.Millisecond)
+		})
+	})
+}
+
+func TestAssumeEmptyTarget(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --assumeEmptyTarget", t, func() {
+		// no session provider, so listing collections would panic
+		restore := &MongoRestore{OutputOptions: &OutputOptions{AssumeEmptyTarget: true}}
+
+		Convey("collections should be assumed not to exist without asking the server", func() {
+			exists, err := restore.targetCollectionExists(&intents.Intent{DB: "db", C: "c"})
+			So(err, ShouldBeNil)
+			So(exists, ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,131 @@
+package mongorestore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Values accepted by --insertOrder.
+const (
+	insertOrderForward = "forward"
+	insertOrderReverse = "reverse"
+)
+
+// reverseBSONReader yields the BSON documents of a stream in reverse order.
+// It needs random access to the data, so a first pass records the offset of
+// every document: regular files are read in place, while any other stream
+// (stdin, converted JSON) is first spilled to a temporary file. Apart from
+// the temporary file, the cost is one offset per document held in memory.
+type reverseBSONReader struct {
+	file    *os.File
+	offsets []int64
+	end     int64
+	next    int
+	buf     []byte
+
+	// spilled is true when file is a temporary copy that must be removed
+	spilled bool
+	source  io.ReadCloser
+}
+
+// newReverseBSONReader scans the whole of source and returns a reader over
+// its documents from last to first. Closing the returned reader closes source
+// and removes any temporary file.
+func newReverseBSONReader(source io.ReadCloser) (io.ReadCloser, error) {
+	reader := &reverseBSONReader{source: source}
+
+	file, ok := source.(*os.File)
+	if ok {
+		info, err := file.Stat()
+		ok = err == nil && info.Mode().IsRegular()
+	}
+	var spill io.Writer
+	if ok {
+		reader.file = file
+	} else {
+		temp, err := ioutil.TempFile("", "mongorestore-reverse-")
+		if err != nil {
+			return nil, fmt.Errorf("error creating temporary file: %v", err)
+		}
+		reader.file = temp
+		reader.spilled = true
+		spill = temp
+	}
+
+	if err := reader.scan(source, spill); err != nil {
+		reader.Close()
+		return nil, err
+	}
+	reader.next = len(reader.offsets) - 1
+	return reader, nil
+}
+
+// scan records the offset of each document in source. If spill is non-nil,
+// the documents are copied to it; otherwise source must be reader.file and
+// the document bodies are skipped over with Seek.
+func (reader *reverseBSONReader) scan(source io.Reader, spill io.Writer) error {
+	var offset int64
+	header := make([]byte, 4)
+	for {
+		_, err := io.ReadFull(source, header)
+		if err == io.EOF {
+			reader.end = offset
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading document #%v: %v", len(reader.offsets)+1, err)
+		}
+		size := int64(binary.LittleEndian.Uint32(header))
+		if size < 5 || size > db.MaxBSONSize {
+			return fmt.Errorf("invalid BSONSize: %v bytes", size)
+		}
+		if spill != nil {
+			if _, err = spill.Write(header); err == nil {
+				_, err = io.CopyN(spill, source, size-4)
+			}
+		} else {
+			_, err = reader.file.Seek(size-4, os.SEEK_CUR)
+		}
+		if err != nil {
+			return fmt.Errorf("error reading document #%v: %v", len(reader.offsets)+1, err)
+		}
+		reader.offsets = append(reader.offsets, offset)
+		offset += size
+	}
+}
+
+// Read fills p from the current document, loading the previous document in
+// the stream once the current one is used up.
+func (reader *reverseBSONReader) Read(p []byte) (int, error) {
+	if len(reader.buf) == 0 {
+		if reader.next < 0 {
+			return 0, io.EOF
+		}
+		start, end := reader.offsets[reader.next], reader.end
+		if reader.next+1 < len(reader.offsets) {
+			end = reader.offsets[reader.next+1]
+		}
+		reader.buf = make([]byte, end-start)
+		if _, err := reader.file.ReadAt(reader.buf, start); err != nil {
+			return 0, fmt.Errorf("error re-reading document: %v", err)
+		}
+		reader.next--
+	}
+	n := copy(p, reader.buf)
+	reader.buf = reader.buf[n:]
+	return n, nil
+}
+
+// Close closes the source and removes the temporary file, if one was used.
+func (reader *reverseBSONReader) Close() error {
+	err := reader.source.Close()
+	if reader.spilled {
+		reader.file.Close()
+		os.Remove(reader.file.Name())
+	}
+	return err
+}
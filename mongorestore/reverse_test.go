@@ -0,0 +1,69 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// readIds decodes every document from reader and returns their _id values.
+func readIds(reader io.ReadCloser) ([]interface{}, error) {
+	source := db.NewDecodedBSONSource(db.NewBSONSource(reader))
+	defer source.Close()
+	ids := []interface{}{}
+	doc := bson.M{}
+	for source.Next(&doc) {
+		ids = append(ids, doc["_id"])
+	}
+	return ids, source.Err()
+}
+
+func TestReverseBSONReader(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a stream of BSON documents", t, func() {
+		data := &bytes.Buffer{}
+		for i := 1; i <= 3; i++ {
+			raw, err := bson.Marshal(bson.M{"_id": i, "padding": bytes.Repeat([]byte("x"), i*100)})
+			So(err, ShouldBeNil)
+			data.Write(raw)
+		}
+
+		Convey("a non-file stream should be spilled and read back in reverse", func() {
+			reader, err := newReverseBSONReader(ioutil.NopCloser(bytes.NewReader(data.Bytes())))
+			So(err, ShouldBeNil)
+			ids, err := readIds(reader)
+			So(err, ShouldBeNil)
+			So(ids, ShouldResemble, []interface{}{3, 2, 1})
+		})
+
+		Convey("a regular file should be read in reverse in place", func() {
+			file, err := ioutil.TempFile("", "reverse_test")
+			So(err, ShouldBeNil)
+			defer os.Remove(file.Name())
+			_, err = file.Write(data.Bytes())
+			So(err, ShouldBeNil)
+			_, err = file.Seek(0, os.SEEK_SET)
+			So(err, ShouldBeNil)
+
+			reader, err := newReverseBSONReader(file)
+			So(err, ShouldBeNil)
+			ids, err := readIds(reader)
+			So(err, ShouldBeNil)
+			So(ids, ShouldResemble, []interface{}{3, 2, 1})
+		})
+
+		Convey("a truncated stream should be an error", func() {
+			truncated := data.Bytes()[:data.Len()-10]
+			_, err := newReverseBSONReader(ioutil.NopCloser(bytes.NewReader(truncated)))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,53 @@
+package mongorestore
+
+import (
+	"gopkg.in/mgo.v2/bson"
+)
+
+// javaScriptOperators are the query and aggregation operators that run
+// JavaScript on the server, which may call functions stored in system.js.
+var javaScriptOperators = map[string]bool{
+	"$where":       true,
+	"$function":    true,
+	"$accumulator": true,
+}
+
+// usesServerSideJavaScript returns true if value, such as a collection's
+// validator, contains JavaScript code or an operator that runs it.
+func usesServerSideJavaScript(value interface{}) bool {
+	switch typed := value.(type) {
+	case bson.JavaScript:
+		return true
+	case bson.D:
+		for _, elem := range typed {
+			if javaScriptOperators[elem.Name] || usesServerSideJavaScript(elem.Value) {
+				return true
+			}
+		}
+	case bson.M:
+		return usesServerSideJavaScript(map[string]interface{}(typed))
+	case map[string]interface{}:
+		for key, elem := range typed {
+			if javaScriptOperators[key] || usesServerSideJavaScript(elem) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, elem := range typed {
+			if usesServerSideJavaScript(elem) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// scriptDependencies returns the system.js namespace of the database if
+// the collection options run JavaScript on the server, which may call the
+// functions stored there, and nil otherwise.
+func scriptDependencies(dbName string, options bson.D) []string {
+	if !usesServerSideJavaScript(options) {
+		return nil
+	}
+	return []string{dbName + ".system.js"}
+}
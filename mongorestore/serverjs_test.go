@@ -0,0 +1,77 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+	"time"
+)
+
+func TestScriptDependencies(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("A validator using $where should depend on system.js", t, func() {
+		options := bson.D{{"validator", map[string]interface{}{
+			"$and": []interface{}{
+				map[string]interface{}{"a": map[string]interface{}{"$exists": true}},
+				map[string]interface{}{"$where": "isValidOrder(this)"},
+			},
+		}}}
+		So(scriptDependencies("shop", options), ShouldResemble, []string{"shop.system.js"})
+	})
+
+	Convey("A validator using $expr with $function should depend on system.js", t, func() {
+		options := bson.D{{"validator", bson.D{{"$expr", bson.D{{"$function", bson.D{
+			{"body", bson.JavaScript{Code: "function(x) { return check(x) }"}},
+			{"args", []interface{}{"$a"}},
+			{"lang", "js"},
+		}}}}}}}
+		So(scriptDependencies("shop", options), ShouldResemble, []string{"shop.system.js"})
+	})
+
+	Convey("Options without JavaScript should have no dependencies", t, func() {
+		options := bson.D{
+			{"capped", true},
+			{"validator", bson.D{{"where", "$where"}}},
+		}
+		So(scriptDependencies("shop", options), ShouldBeNil)
+	})
+}
+
+func TestScriptDependencyScheduling(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("A collection validated with JavaScript should wait for system.js to be restored", t, func() {
+		options := bson.D{{"validator", bson.D{{"$where", "isValidOrder(this)"}}}}
+		manager := intents.NewIntentManager()
+		manager.Put(&intents.Intent{DB: "shop", C: "orders", DependsOn: scriptDependencies("shop", options)})
+		manager.Put(&intents.Intent{DB: "shop", C: "system.js"})
+		manager.Finalize(intents.Legacy)
+
+		scripts := manager.Pop()
+		So(scripts.C, ShouldEqual, "system.js")
+		popped := make(chan *intents.Intent, 1)
+		go func() {
+			popped <- manager.Pop()
+		}()
+		select {
+		case <-popped:
+			So("Pop returned before system.js was finished", ShouldBeEmpty)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		manager.Finish(scripts)
+		select {
+		case orders := <-popped:
+			So(orders.C, ShouldEqual, "orders")
+			manager.Finish(orders)
+		case <-time.After(5 * time.Second):
+			So("Pop did not return after system.js was finished", ShouldBeEmpty)
+		}
+		So(manager.Pop(), ShouldBeNil)
+	})
+}
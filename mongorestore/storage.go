@@ -0,0 +1,65 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+)
+
+// readStorageOverrides reads a --storageOverrides file: a JSON document
+// mapping full namespaces to the collection create options to use for them.
+// Values may use extended JSON.
+func readStorageOverrides(path string) (map[string]bson.D, error) {
+	jsonBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseStorageOverrides(jsonBytes)
+}
+
+// parseStorageOverrides parses and validates the contents of a
+// --storageOverrides file.
+func parseStorageOverrides(jsonBytes []byte) (map[string]bson.D, error) {
+	raw := map[string]bson.D{}
+	if err := json.Unmarshal(jsonBytes, &raw); err != nil {
+		return nil, fmt.Errorf("expected a JSON document mapping namespaces to create options: %v", err)
+	}
+	overrides := map[string]bson.D{}
+	for namespace, options := range raw {
+		if _, _, err := splitNamespace(namespace); err != nil {
+			return nil, err
+		}
+		if len(options) == 0 {
+			return nil, fmt.Errorf("no create options given for %v", namespace)
+		}
+		parsed, err := bsonutil.GetExtendedBsonD(options)
+		if err != nil {
+			return nil, fmt.Errorf("extended json in options for %v: %v", namespace, err)
+		}
+		for _, option := range parsed {
+			if option.Name == "create" {
+				return nil, fmt.Errorf("options for %v must not include the 'create' field", namespace)
+			}
+		}
+		overrides[namespace] = parsed
+	}
+	return overrides, nil
+}
+
+// mergeCreateOptions returns base with each top-level option in override
+// added to it, replacing any option of the same name.
+func mergeCreateOptions(base, override bson.D) bson.D {
+	merged := make(bson.D, 0, len(base)+len(override))
+	replaced := map[string]bool{}
+	for _, option := range override {
+		replaced[option.Name] = true
+	}
+	for _, option := range base {
+		if !replaced[option.Name] {
+			merged = append(merged, option)
+		}
+	}
+	return append(merged, override...)
+}
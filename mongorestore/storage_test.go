@@ -0,0 +1,54 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestStorageOverrides(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When parsing --storageOverrides", t, func() {
+
+		Convey("a map of namespaces to create options should be accepted", func() {
+			overrides, err := parseStorageOverrides([]byte(`{
+				"test.hot": {"storageEngine": {"wiredTiger": {"configString": "block_compressor=none"}}},
+				"test.capped": {"capped": true, "size": NumberLong(1048576)}
+			}`))
+			So(err, ShouldBeNil)
+			So(len(overrides), ShouldEqual, 2)
+			So(overrides["test.capped"], ShouldResemble, bson.D{{"capped", true}, {"size", int64(1048576)}})
+		})
+
+		Convey("invalid files should be rejected", func() {
+			for _, contents := range []string{
+				`[]`,
+				`{"test.hot": 5}`,
+				`{"nodot": {"capped": true}}`,
+				`{"test.hot": {}}`,
+				`{"test.hot": {"create": "other"}}`,
+			} {
+				_, err := parseStorageOverrides([]byte(contents))
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+
+	Convey("When merging overrides into dumped options", t, func() {
+		dumped := bson.D{{"capped", true}, {"size", 4096}, {"storageEngine", bson.M{"old": 1}}}
+
+		Convey("overridden options should replace the dumped ones", func() {
+			merged := mergeCreateOptions(dumped, bson.D{{"storageEngine", bson.M{"new": 1}}})
+			So(merged, ShouldResemble, bson.D{
+				{"capped", true}, {"size", 4096}, {"storageEngine", bson.M{"new": 1}},
+			})
+		})
+
+		Convey("overrides should apply to collections with no dumped options", func() {
+			So(mergeCreateOptions(nil, bson.D{{"capped", true}}), ShouldResemble, bson.D{{"capped", true}})
+		})
+	})
+}
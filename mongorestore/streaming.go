@@ -0,0 +1,37 @@
+package mongorestore
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// sequentialReader exposes only the Read and Close methods of a file, so
+// that readers which would otherwise seek or read at an offset, such as
+// --insertOrder reverse, fall back to reading it from start to end.
+type sequentialReader struct {
+	io.ReadCloser
+}
+
+// openDumpFile opens a data file of the dump. With --streamingInput, the
+// file is only ever read sequentially, for filesystems such as object store
+// mounts that do not support seeking. A file compressed with gzip is
+// decompressed as it is read, and so is always read sequentially.
+func (restore *MongoRestore) openDumpFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if isGzipped(path) {
+		dumpFile, err := newGzipDumpFile(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("error decompressing %v: %v", path, err)
+		}
+		return dumpFile, nil
+	}
+	if restore.InputOptions.StreamingInput {
+		return sequentialReader{file}, nil
+	}
+	return file, nil
+}
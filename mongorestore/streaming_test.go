@@ -0,0 +1,104 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// rejectSeekFile is a file on a filesystem that does not support seeking.
+type rejectSeekFile struct {
+	*os.File
+}
+
+func (rejectSeekFile) Seek(int64, int) (int64, error) {
+	return 0, fmt.Errorf("seek not supported")
+}
+
+func (rejectSeekFile) ReadAt([]byte, int64) (int, error) {
+	return 0, fmt.Errorf("seek not supported")
+}
+
+func TestStreamingInput(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	dir, err := ioutil.TempDir("", "mongorestore-streaming-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "c.bson")
+	data := []byte{}
+	for i := 1; i <= 3; i++ {
+		raw, err := bson.Marshal(bson.D{{"_id", i}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, raw...)
+	}
+	if err = ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("With --streamingInput", t, func() {
+		restore := &MongoRestore{InputOptions: &InputOptions{StreamingInput: true}}
+
+		Convey("dump files should be opened without Seek", func() {
+			source, err := restore.openDumpFile(path)
+			So(err, ShouldBeNil)
+			defer source.Close()
+			_, canSeek := source.(io.Seeker)
+			So(canSeek, ShouldBeFalse)
+		})
+
+		Convey("a file that rejects Seek should be counted and reversed", func() {
+			file, err := os.Open(path)
+			So(err, ShouldBeNil)
+			_, err = countBSONDocuments(rejectSeekFile{file})
+			So(err, ShouldNotBeNil)
+			file.Close()
+
+			file, err = os.Open(path)
+			So(err, ShouldBeNil)
+			count, err := countBSONDocuments(sequentialReader{rejectSeekFile{file}})
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 3)
+			file.Close()
+
+			file, err = os.Open(path)
+			So(err, ShouldBeNil)
+			source, err := checkNotJSON(sequentialReader{rejectSeekFile{file}}, path)
+			So(err, ShouldBeNil)
+			reversed, err := newReverseBSONReader(source)
+			So(err, ShouldBeNil)
+			defer reversed.Close()
+			bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(reversed))
+			ids := []interface{}{}
+			doc := bson.M{}
+			for bsonSource.Next(&doc) {
+				ids = append(ids, doc["_id"])
+			}
+			So(bsonSource.Err(), ShouldBeNil)
+			So(ids, ShouldResemble, []interface{}{3, 2, 1})
+		})
+	})
+
+	Convey("Without --streamingInput, files should stay seekable after checking for JSON", t, func() {
+		restore := &MongoRestore{InputOptions: &InputOptions{}}
+		source, err := restore.openDumpFile(path)
+		So(err, ShouldBeNil)
+		source, err = checkNotJSON(source, path)
+		So(err, ShouldBeNil)
+		defer source.Close()
+		_, isFile := source.(*os.File)
+		So(isFile, ShouldBeTrue)
+	})
+}
@@ -0,0 +1,89 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/auth"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// restoresUsersAndRoles returns true if the restore may restore users and
+// roles. Unlike ShouldRestoreUsersAndRoles, it only looks for the users file
+// of a full dump, since intents have not been created yet.
+func (restore *MongoRestore) restoresUsersAndRoles() bool {
+	if restore.OutputOptions.MetadataOnly {
+		return false
+	}
+	if restore.InputOptions.RestoreDBUsersAndRoles {
+		return true
+	}
+	if restore.ToolOptions.DB == "" || restore.ToolOptions.DB == "admin" {
+		usersFile := filepath.Join(restore.TargetDirectory, "admin", "system.users.bson")
+		if restore.ToolOptions.DB == "admin" {
+			usersFile = filepath.Join(restore.TargetDirectory, "system.users.bson")
+		}
+		_, err := os.Stat(usersFile)
+		return err == nil
+	}
+	return false
+}
+
+// requiredActions returns the actions that the restore described by the
+// options needs to perform.
+func (restore *MongoRestore) requiredActions() []auth.RequiredAction {
+	dbName := restore.ToolOptions.DB
+	data := auth.Resource{DB: dbName, Collection: restore.ToolOptions.Collection}
+	required := []auth.RequiredAction{
+		{Action: "createCollection", Resource: data, Reason: "creating collections"},
+		{Action: "createIndex", Resource: data, Reason: "building indexes"},
+	}
+	if !restore.OutputOptions.MetadataOnly {
+		required = append(required,
+			auth.RequiredAction{Action: "insert", Resource: data, Reason: "inserting documents"})
+	}
+	if restore.OutputOptions.Drop {
+		required = append(required,
+			auth.RequiredAction{Action: "dropCollection", Resource: data, Reason: "dropping collections with --drop"})
+	}
+	if restore.restoresUsersAndRoles() {
+		database := auth.Resource{DB: dbName}
+		required = append(required,
+			auth.RequiredAction{Action: "createUser", Resource: database, Reason: "restoring users"},
+			auth.RequiredAction{Action: "createRole", Resource: database, Reason: "restoring roles"},
+			auth.RequiredAction{Action: "grantRole", Resource: database, Reason: "restoring role grants"})
+	}
+	if restore.InputOptions.OplogReplay {
+		// applyOps can run any operation, so it requires anyAction on
+		// anyResource, which only the __system role grants
+		everything := auth.Resource{AnyResource: true}
+		required = append(required,
+			auth.RequiredAction{Action: "anyAction", Resource: everything, Reason: "replaying the oplog with --oplogReplay"})
+	}
+	return required
+}
+
+// TestConnection writes a report to out on the connected server and on
+// whether the authenticated user can perform the restore, without restoring
+// anything. It returns an error if any required privilege is missing.
+func (restore *MongoRestore) TestConnection(out io.Writer) error {
+	nodeType, err := restore.SessionProvider.GetNodeType()
+	if err != nil {
+		return fmt.Errorf("error connecting: %v", err)
+	}
+	fmt.Fprintln(out, log.Redact(fmt.Sprintf("connected to %v (%v)",
+		util.CreateConnectionAddrs(restore.ToolOptions.Host, restore.ToolOptions.Port), nodeType)))
+
+	status, err := auth.GetConnectionStatus(restore.SessionProvider)
+	if err != nil {
+		return err
+	}
+	missing := auth.WriteConnectionReport(out, status, restore.requiredActions())
+	if len(missing) > 0 {
+		return fmt.Errorf("the authenticated user is missing %v privilege(s) needed for this restore", len(missing))
+	}
+	fmt.Fprintln(out, "connection test passed")
+	return nil
+}
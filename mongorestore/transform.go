@@ -0,0 +1,111 @@
+package mongorestore
+
+import (
+	"bufio"
+	"fmt"
+	"gopkg.in/mgo.v2/bson"
+	"os"
+	"strings"
+)
+
+// documentTransform rewrites the raw bytes of a document before it is
+// inserted. Returning nil bytes and a nil error drops the document.
+type documentTransform func(data []byte) ([]byte, error)
+
+// applyTransforms runs each of the restore's transforms over the document in
+// order, stopping early if one of them drops it.
+func (restore *MongoRestore) applyTransforms(data []byte) ([]byte, error) {
+	var err error
+	for _, transform := range restore.transforms {
+		data, err = transform(data)
+		if err != nil || data == nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// transformsApplyTo returns false for the temporary collections that users
+// and roles are restored to before being merged into the server's, whose
+// documents must be merged as they were dumped.
+func (restore *MongoRestore) transformsApplyTo(dbName, colName string) bool {
+	return dbName != "admin" || (colName != restore.tempUsersCol && colName != restore.tempRolesCol)
+}
+
+// readFieldsFile reads a list of newline-delimited dotted field paths,
+// ignoring blank lines and lines starting with '#'.
+func readFieldsFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	fields := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields = append(fields, line)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// newExcludeFieldsTransform returns a transform that removes each of the given
+// dotted field paths from documents. Paths descend into subdocuments and into
+// any subdocuments held in arrays.
+func newExcludeFieldsTransform(fields []string) (documentTransform, error) {
+	paths := make([][]string, 0, len(fields))
+	for _, field := range fields {
+		path := strings.Split(field, ".")
+		for _, part := range path {
+			if part == "" {
+				return nil, fmt.Errorf("invalid field path '%v'", field)
+			}
+		}
+		paths = append(paths, path)
+	}
+
+	return func(data []byte) ([]byte, error) {
+		doc := bson.D{}
+		if err := bson.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("error decoding document to exclude fields: %v", err)
+		}
+		for _, path := range paths {
+			doc = removeField(doc, path)
+		}
+		return bson.Marshal(doc)
+	}, nil
+}
+
+// removeField removes the field at path from doc, returning the updated document.
+func removeField(doc bson.D, path []string) bson.D {
+	for i, elem := range doc {
+		if elem.Name != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return append(doc[:i], doc[i+1:]...)
+		}
+		doc[i].Value = removeNestedField(elem.Value, path[1:])
+		return doc
+	}
+	return doc
+}
+
+func removeNestedField(value interface{}, path []string) interface{} {
+	switch v := value.(type) {
+	case bson.D:
+		return removeField(v, path)
+	case []interface{}:
+		for i := range v {
+			v[i] = removeNestedField(v[i], path)
+		}
+	}
+	return value
+}
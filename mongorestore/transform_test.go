@@ -0,0 +1,87 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestExcludeFieldsTransform(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a document containing nested fields and arrays", t, func() {
+		data, err := bson.Marshal(bson.D{
+			{"_id", 1},
+			{"ssn", "123-45-6789"},
+			{"profile", bson.D{{"name", "x"}, {"email", "x@example.com"}}},
+			{"cards", []interface{}{
+				bson.D{{"number", "4111"}, {"type", "visa"}},
+				bson.D{{"number", "5500"}, {"type", "mc"}},
+			}},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("top-level, nested, and array fields should all be removed", func() {
+			transform, err := newExcludeFieldsTransform(
+				[]string{"ssn", "profile.email", "cards.number", "missing.field"})
+			So(err, ShouldBeNil)
+			out, err := transform(data)
+			So(err, ShouldBeNil)
+
+			result := bson.D{}
+			So(bson.Unmarshal(out, &result), ShouldBeNil)
+			So(result, ShouldResemble, bson.D{
+				{"_id", 1},
+				{"profile", bson.D{{"name", "x"}}},
+				{"cards", []interface{}{
+					bson.D{{"type", "visa"}},
+					bson.D{{"type", "mc"}},
+				}},
+			})
+		})
+
+		Convey("an empty path segment should be rejected", func() {
+			_, err := newExcludeFieldsTransform([]string{"profile..email"})
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("A fields file should skip blank and comment lines", t, func() {
+		file, err := ioutil.TempFile("", "exclude_fields")
+		So(err, ShouldBeNil)
+		defer os.Remove(file.Name())
+		_, err = file.WriteString("# pii\nssn\n\n  profile.email  \n#cards.number\n")
+		So(err, ShouldBeNil)
+		So(file.Close(), ShouldBeNil)
+
+		fields, err := readFieldsFile(file.Name())
+		So(err, ShouldBeNil)
+		So(fields, ShouldResemble, []string{"ssn", "profile.email"})
+
+		_, err = readFieldsFile(file.Name() + ".missing")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestTransformsApplyTo(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a restore using the default temporary collections", t, func() {
+		restore := &MongoRestore{tempUsersCol: "tempusers", tempRolesCol: "temproles"}
+
+		Convey("users and roles should be merged as they were dumped", func() {
+			So(restore.transformsApplyTo("admin", "tempusers"), ShouldBeFalse)
+			So(restore.transformsApplyTo("admin", "temproles"), ShouldBeFalse)
+		})
+
+		Convey("the documents of other collections should be transformed", func() {
+			So(restore.transformsApplyTo("admin", "system.version"), ShouldBeTrue)
+			So(restore.transformsApplyTo("test", "tempusers"), ShouldBeTrue)
+		})
+	})
+}
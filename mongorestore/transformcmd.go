@@ -0,0 +1,210 @@
+package mongorestore
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// transformCmdQueueSize bounds the number of documents waiting to be
+// written to a --transformCmd process.
+const transformCmdQueueSize = 1024
+
+// transformCmd runs documents through an external --transformCmd process.
+//
+// The protocol is line based: each document is written to the process's
+// stdin as one line of extended JSON, and the process must write exactly one
+// line to its stdout for every line it reads, in the same order. A line
+// holding a document replaces the input document; an empty line or "null"
+// drops it. The process must flush its output whenever it runs out of input
+// to read, or simply after every line. Anything it writes to stderr is
+// passed through.
+//
+// Documents from concurrent callers are pipelined: the input is only flushed
+// when no more documents are queued, so the process sees them in batches and
+// several can be in flight at once.
+type transformCmd struct {
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	requests chan transformRequest
+
+	// reply channels for documents written to the process, oldest first
+	pending     []chan []byte
+	pendingLock sync.Mutex
+
+	// err is set once the process fails; all later calls return it
+	err     error
+	errLock sync.Mutex
+	done    chan struct{}
+}
+
+// transformRequest is a document line waiting to be written to the
+// process, and the channel to send the process's reply line to.
+type transformRequest struct {
+	line  []byte
+	reply chan []byte
+}
+
+// startTransformCmd starts command, split into a program and its arguments
+// as a shell would split it, as a --transformCmd process.
+func startTransformCmd(command string) (*transformCmd, error) {
+	args, err := util.SplitCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	tc := &transformCmd{
+		cmd:      exec.Command(args[0], args[1:]...),
+		requests: make(chan transformRequest, transformCmdQueueSize),
+		done:     make(chan struct{}),
+	}
+	tc.cmd.Stderr = os.Stderr
+	stdin, err := tc.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := tc.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = tc.cmd.Start(); err != nil {
+		return nil, err
+	}
+	tc.stdin = stdin
+	go tc.writeLoop()
+	go tc.readLoop(stdout)
+	return tc, nil
+}
+
+// Transform sends a document to the process and waits for its replacement.
+// It has the signature of a documentTransform.
+func (tc *transformCmd) Transform(data []byte) ([]byte, error) {
+	document := bson.D{}
+	if err := bson.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	extended, err := bsonutil.ConvertBSONValueToJSON(document)
+	if err != nil {
+		return nil, fmt.Errorf("error converting document to extended JSON: %v", err)
+	}
+	line, err := json.Marshal(extended)
+	if err != nil {
+		return nil, fmt.Errorf("error converting document to extended JSON: %v", err)
+	}
+
+	reply := make(chan []byte, 1)
+	select {
+	case tc.requests <- transformRequest{append(line, '\n'), reply}:
+	case <-tc.done:
+		return nil, tc.failure()
+	}
+	var output []byte
+	select {
+	case output = <-reply:
+	case <-tc.done:
+		return nil, tc.failure()
+	}
+
+	output = bytes.TrimSpace(output)
+	if len(output) == 0 || string(output) == "null" {
+		return nil, nil
+	}
+	transformed, err := jsonDocumentToBSON(output)
+	if err != nil {
+		return nil, fmt.Errorf("--transformCmd wrote an invalid document: %v", err)
+	}
+	return transformed, nil
+}
+
+// writeLoop writes queued documents to the process, flushing whenever the
+// queue runs dry.
+func (tc *transformCmd) writeLoop() {
+	writer := bufio.NewWriter(tc.stdin)
+	for {
+		var request transformRequest
+		select {
+		case request = <-tc.requests:
+		case <-tc.done:
+			return
+		}
+		// register the reply before writing, so the read loop cannot see
+		// the process's answer first
+		tc.pendingLock.Lock()
+		tc.pending = append(tc.pending, request.reply)
+		tc.pendingLock.Unlock()
+
+		_, err := writer.Write(request.line)
+		if err == nil && len(tc.requests) == 0 {
+			err = writer.Flush()
+		}
+		if err != nil {
+			tc.fail(fmt.Errorf("error writing to --transformCmd: %v", err))
+			return
+		}
+	}
+}
+
+// readLoop reads the process's output lines and hands each to the oldest
+// waiting caller.
+func (tc *transformCmd) readLoop(stdout io.Reader) {
+	reader := bufio.NewReader(stdout)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			if err == io.EOF {
+				err = fmt.Errorf("--transformCmd exited or closed its output")
+			} else {
+				err = fmt.Errorf("error reading from --transformCmd: %v", err)
+			}
+			tc.fail(err)
+			return
+		}
+		tc.pendingLock.Lock()
+		if len(tc.pending) == 0 {
+			tc.pendingLock.Unlock()
+			tc.fail(fmt.Errorf("--transformCmd wrote more lines than documents it was sent"))
+			return
+		}
+		reply := tc.pending[0]
+		tc.pending = tc.pending[1:]
+		tc.pendingLock.Unlock()
+		reply <- line
+	}
+}
+
+// fail records the first error from the process and releases all callers.
+func (tc *transformCmd) fail(err error) {
+	tc.errLock.Lock()
+	defer tc.errLock.Unlock()
+	if tc.err != nil {
+		return
+	}
+	tc.err = err
+	close(tc.done)
+}
+
+// failure returns the error that stopped the process.
+func (tc *transformCmd) failure() error {
+	tc.errLock.Lock()
+	defer tc.errLock.Unlock()
+	return tc.err
+}
+
+// Close closes the process's input and waits for it to exit.
+func (tc *transformCmd) Close() error {
+	tc.fail(fmt.Errorf("--transformCmd was closed"))
+	tc.stdin.Close()
+	err := tc.cmd.Wait()
+	if err != nil {
+		log.Logf(log.Always, "--transformCmd exited with an error: %v", err)
+	}
+	return err
+}
@@ -0,0 +1,102 @@
+package mongorestore
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestTransformCmdHelper is not a real test: it is run as the --transformCmd
+// process by TestTransformCmd. It echoes each document back, and drops any
+// document containing "drop".
+func TestTransformCmdHelper(t *testing.T) {
+	if os.Getenv("MONGORESTORE_TRANSFORM_HELPER") == "" {
+		return
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		if strings.Contains(scanner.Text(), "drop") {
+			fmt.Println("null")
+		} else {
+			fmt.Println(scanner.Text())
+		}
+	}
+	os.Exit(0)
+}
+
+func TestTransformCmd(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	os.Setenv("MONGORESTORE_TRANSFORM_HELPER", "1")
+	defer os.Unsetenv("MONGORESTORE_TRANSFORM_HELPER")
+	// quoted, since the test binary may be in a directory with spaces
+	command := "'" + os.Args[0] + "' -test.run=TestTransformCmdHelper"
+
+	Convey("With a running --transformCmd process", t, func() {
+
+		Convey("concurrent documents should each get their own reply", func() {
+			tc, err := startTransformCmd(command)
+			So(err, ShouldBeNil)
+			defer tc.Close()
+
+			var wg sync.WaitGroup
+			errs := make(chan error, 50)
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					data, _ := bson.Marshal(bson.D{{"_id", i}, {"name", fmt.Sprintf("doc%v", i)}})
+					out, err := tc.Transform(data)
+					if err == nil {
+						doc := bson.M{}
+						err = bson.Unmarshal(out, &doc)
+						if err == nil && doc["name"] != fmt.Sprintf("doc%v", i) {
+							err = fmt.Errorf("document %v came back as %v", i, doc)
+						}
+					}
+					errs <- err
+				}(i)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				So(err, ShouldBeNil)
+			}
+		})
+
+		Convey("documents the process drops should be nil", func() {
+			tc, err := startTransformCmd(command)
+			So(err, ShouldBeNil)
+			defer tc.Close()
+
+			data, _ := bson.Marshal(bson.M{"action": "drop"})
+			out, err := tc.Transform(data)
+			So(err, ShouldBeNil)
+			So(out, ShouldBeNil)
+		})
+
+		Convey("a command that cannot be split should not be started", func() {
+			_, err := startTransformCmd(`"` + os.Args[0])
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "unterminated double quote")
+		})
+
+		Convey("a process that exits should fail the transform", func() {
+			os.Setenv("MONGORESTORE_TRANSFORM_HELPER", "")
+			tc, err := startTransformCmd(command)
+			So(err, ShouldBeNil)
+			defer tc.Close()
+
+			data, _ := bson.Marshal(bson.M{"a": 1})
+			_, err = tc.Transform(data)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,125 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"math"
+	"strings"
+)
+
+// ttlHoldSeconds is the expireAfterSeconds that --deferTTLIndexes builds
+// TTL indexes with, far enough in the future that the TTL monitor deletes
+// nothing while the restore runs.
+const ttlHoldSeconds = math.MaxInt32
+
+// heldTTLIndex is a TTL index built with ttlHoldSeconds, and the
+// expireAfterSeconds it is reset to once the restore is done.
+type heldTTLIndex struct {
+	db, collection, name string
+	expireAfterSeconds   interface{}
+}
+
+// isTTLIndex returns true if the index expires documents.
+func isTTLIndex(index IndexDocument) bool {
+	_, ok := index.Options["expireAfterSeconds"]
+	return ok
+}
+
+// holdTTLIndexes implements --deferTTLIndexes: it replaces the
+// expireAfterSeconds of the intent's TTL indexes with ttlHoldSeconds, and
+// returns them to be recorded by recordHeldTTLIndexes once they are built.
+// createIndexes leaves an index the target already has as it is, so the
+// indexes named in existing are not held.
+func holdTTLIndexes(intent *intents.Intent, indexes []IndexDocument, existing map[string]bool) []heldTTLIndex {
+	held := []heldTTLIndex{}
+	for _, index := range indexes {
+		name := fmt.Sprintf("%v", index.Options["name"])
+		if !isTTLIndex(index) || existing[name] {
+			continue
+		}
+		held = append(held, heldTTLIndex{
+			db:                 intent.DB,
+			collection:         intent.C,
+			name:               name,
+			expireAfterSeconds: index.Options["expireAfterSeconds"],
+		})
+		log.Logf(log.Info, "\tbuilding TTL index %v of %v with its expiry deferred until the restore is done",
+			name, intent.Namespace())
+		index.Options["expireAfterSeconds"] = ttlHoldSeconds
+	}
+	return held
+}
+
+// existingIndexNames returns the names of the indexes on the intent's
+// collection, which has none if it does not exist yet.
+func existingIndexNames(session *mgo.Session, intent *intents.Intent) (map[string]bool, error) {
+	found, err := listIndexes(session, intent)
+	if err != nil && !strings.Contains(err.Error(), db.ErrNsNotFound.Error()) {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, index := range found {
+		names[fmt.Sprintf("%v", index.Options["name"])] = true
+	}
+	return names, nil
+}
+
+// recordHeldTTLIndexes records TTL indexes that were built with
+// ttlHoldSeconds, to be reset by resetTTLIndexes.
+func (restore *MongoRestore) recordHeldTTLIndexes(held []heldTTLIndex) {
+	restore.heldTTLIndexesMutex.Lock()
+	defer restore.heldTTLIndexesMutex.Unlock()
+	restore.heldTTLIndexes = append(restore.heldTTLIndexes, held...)
+}
+
+// resetTTLIndexes sets the expireAfterSeconds of each TTL index held by
+// --deferTTLIndexes back to its dumped value with collMod, after which the
+// TTL monitor starts deleting expired documents.
+func (restore *MongoRestore) resetTTLIndexes() error {
+	if len(restore.heldTTLIndexes) == 0 {
+		return nil
+	}
+	log.Logf(log.Always, "resetting the expiry of %v TTL index(es) deferred by --deferTTLIndexes",
+		len(restore.heldTTLIndexes))
+	for len(restore.heldTTLIndexes) > 0 {
+		held := restore.heldTTLIndexes[0]
+		if err := restore.resetTTLIndex(held); err != nil {
+			return fmt.Errorf("error resetting expireAfterSeconds of TTL index %v on %v.%v to %v: %v",
+				held.name, held.db, held.collection, held.expireAfterSeconds, err)
+		}
+		restore.heldTTLIndexes = restore.heldTTLIndexes[1:]
+	}
+	return nil
+}
+
+// resetTTLIndex runs the collMod that resets a held TTL index, identified
+// by its name.
+func (restore *MongoRestore) resetTTLIndex(held heldTTLIndex) error {
+	session, err := restore.sessionProviderFor(held.db).GetSession()
+	if err != nil {
+		return fmt.Errorf("error establishing connection: %v", err)
+	}
+	defer session.Close()
+	command := bson.D{
+		{"collMod", held.collection},
+		{"index", bson.D{
+			{"name", held.name},
+			{"expireAfterSeconds", held.expireAfterSeconds},
+		}},
+	}
+	return session.DB(held.db).Run(command, &bson.M{})
+}
+
+// warnHeldTTLIndexes logs the TTL indexes left with ttlHoldSeconds by a
+// restore that failed before resetting them.
+func (restore *MongoRestore) warnHeldTTLIndexes() {
+	for _, held := range restore.heldTTLIndexes {
+		log.Logf(log.Always, "warning: TTL index %v on %v.%v still has the expireAfterSeconds "+
+			"of --deferTTLIndexes; reset it to %v with collMod once the data is in place",
+			held.name, held.db, held.collection, held.expireAfterSeconds)
+	}
+}
@@ -0,0 +1,52 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestHoldTTLIndexes(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With the indexes of a collection restored with --deferTTLIndexes", t, func() {
+		intent := &intents.Intent{DB: "db1", C: "sessions"}
+		indexes := []IndexDocument{
+			{Options: bson.M{"name": "_id_"}, Key: bson.D{{"_id", 1}}},
+			{Options: bson.M{"name": "createdAt_1", "expireAfterSeconds": 3600}, Key: bson.D{{"createdAt", 1}}},
+			{Options: bson.M{"name": "user_1"}, Key: bson.D{{"user", 1}}},
+			{Options: bson.M{"name": "seenAt_1", "expireAfterSeconds": 60}, Key: bson.D{{"seenAt", 1}}},
+		}
+		// the target already has the _id index and seenAt_1
+		held := holdTTLIndexes(intent, indexes, map[string]bool{"_id_": true, "seenAt_1": true})
+
+		Convey("only TTL indexes should be built with the hold expiry", func() {
+			So(indexes[1].Options["expireAfterSeconds"], ShouldEqual, ttlHoldSeconds)
+			So(isTTLIndex(indexes[0]), ShouldBeFalse)
+			So(isTTLIndex(indexes[2]), ShouldBeFalse)
+		})
+
+		Convey("TTL indexes the target already has should be left as they are", func() {
+			So(indexes[3].Options["expireAfterSeconds"], ShouldEqual, 60)
+		})
+
+		Convey("and their dumped expiry should be kept to reset them by name", func() {
+			So(held, ShouldResemble, []heldTTLIndex{{
+				db:                 "db1",
+				collection:         "sessions",
+				name:               "createdAt_1",
+				expireAfterSeconds: 3600,
+			}})
+		})
+
+		Convey("they should not be recorded for resetting until their build succeeds", func() {
+			restore := &MongoRestore{}
+			So(restore.heldTTLIndexes, ShouldBeEmpty)
+			restore.recordHeldTTLIndexes(held)
+			So(restore.heldTTLIndexes, ShouldResemble, held)
+		})
+	})
+}
@@ -0,0 +1,254 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ignoredIndexOptions are the fields of an index spec that --verifyIndexes
+// does not compare: the name and key are compared separately, the namespace
+// is rewritten on restore and no longer reported by newer servers, and
+// newer servers ignore and drop the background option.
+var ignoredIndexOptions = map[string]bool{
+	"name":       true,
+	"key":        true,
+	"ns":         true,
+	"background": true,
+}
+
+// indexDiff describes how the indexes of a restored collection differ from
+// those that should have been built. Extra indexes are ones this restore
+// did not create, such as those of a collection that was not dropped, so
+// they are reported but do not make the indexes mismatch.
+type indexDiff struct {
+	Missing   []string
+	Extra     []string
+	Divergent []string
+}
+
+// matches returns true if every index that should have been built was
+// built as expected.
+func (diff indexDiff) matches() bool {
+	return len(diff.Missing) == 0 && len(diff.Divergent) == 0
+}
+
+// String describes the missing and different indexes.
+func (diff indexDiff) String() string {
+	parts := []string{}
+	if len(diff.Missing) > 0 {
+		parts = append(parts, "missing "+strings.Join(diff.Missing, ", "))
+	}
+	if len(diff.Divergent) > 0 {
+		parts = append(parts, "different "+strings.Join(diff.Divergent, "; "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// compareIndexes returns the differences between the expected indexes and
+// those found on the server, matching them by name. The index version is
+// only compared when compareVersion is set, since it is otherwise left for
+// the server to choose. The _id index is never reported as extra.
+func compareIndexes(expected, found []IndexDocument, compareVersion bool) indexDiff {
+	foundByName := map[string]IndexDocument{}
+	for _, index := range found {
+		foundByName[fmt.Sprintf("%v", index.Options["name"])] = index
+	}
+
+	diff := indexDiff{}
+	expectedNames := map[string]bool{}
+	for _, index := range expected {
+		name := fmt.Sprintf("%v", index.Options["name"])
+		expectedNames[name] = true
+		actual, ok := foundByName[name]
+		if !ok {
+			diff.Missing = append(diff.Missing, name)
+			continue
+		}
+		if differences := indexDifferences(index, actual, compareVersion); len(differences) > 0 {
+			diff.Divergent = append(diff.Divergent,
+				fmt.Sprintf("%v (%v)", name, strings.Join(differences, ", ")))
+		}
+	}
+	for name := range foundByName {
+		if !expectedNames[name] && name != "_id_" {
+			diff.Extra = append(diff.Extra, name)
+		}
+	}
+	sort.Strings(diff.Extra)
+	return diff
+}
+
+// indexDifferences describes each way in which the found index differs
+// from the expected one.
+func indexDifferences(expected, found IndexDocument, compareVersion bool) []string {
+	differences := []string{}
+	if !reflect.DeepEqual(normalizeIndexValue(expected.Key), normalizeIndexValue(found.Key)) {
+		differences = append(differences, fmt.Sprintf("key %v, found %v", expected.Key, found.Key))
+	}
+
+	fields := map[string]bool{}
+	for field := range expected.Options {
+		fields[field] = true
+	}
+	for field := range found.Options {
+		fields[field] = true
+	}
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		if !ignoredIndexOptions[field] && (compareVersion || field != "v") {
+			names = append(names, field)
+		}
+	}
+	sort.Strings(names)
+
+	for _, field := range names {
+		expectedValue, foundValue := expected.Options[field], found.Options[field]
+		if !reflect.DeepEqual(normalizeIndexOption(expectedValue), normalizeIndexOption(foundValue)) {
+			differences = append(differences, fmt.Sprintf("%v %v, found %v", field, expectedValue, foundValue))
+		}
+	}
+	return differences
+}
+
+// normalizeIndexOption normalizes the value of an index option like
+// normalizeIndexValue, but without regard to the order of keys in its
+// documents, since the server's copy of the options is decoded as maps.
+func normalizeIndexOption(value interface{}) interface{} {
+	return normalizeIndexValue(unorderedIndexValue(value))
+}
+
+// unorderedIndexValue returns value with every bson.D in it turned into a map.
+func unorderedIndexValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case bson.D:
+		unordered := map[string]interface{}{}
+		for _, elem := range typed {
+			unordered[elem.Name] = unorderedIndexValue(elem.Value)
+		}
+		return unordered
+	case bson.M:
+		return unorderedIndexValue(map[string]interface{}(typed))
+	case map[string]interface{}:
+		unordered := map[string]interface{}{}
+		for key, elem := range typed {
+			unordered[key] = unorderedIndexValue(elem)
+		}
+		return unordered
+	case []interface{}:
+		unordered := make([]interface{}, len(typed))
+		for i, elem := range typed {
+			unordered[i] = unorderedIndexValue(elem)
+		}
+		return unordered
+	}
+	return value
+}
+
+// normalizeIndexValue converts every number in an index spec value to a
+// float64 and every document to a bson.D, since the same spec may be read
+// back from the server with different types than it was parsed from JSON.
+func normalizeIndexValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case int:
+		return float64(typed)
+	case int32:
+		return float64(typed)
+	case int64:
+		return float64(typed)
+	case bson.D:
+		normalized := make(bson.D, 0, len(typed))
+		for _, elem := range typed {
+			normalized = append(normalized, bson.DocElem{elem.Name, normalizeIndexValue(elem.Value)})
+		}
+		return normalized
+	case bson.M:
+		return normalizeIndexValue(map[string]interface{}(typed))
+	case map[string]interface{}:
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		normalized := make(bson.D, 0, len(typed))
+		for _, key := range keys {
+			normalized = append(normalized, bson.DocElem{key, normalizeIndexValue(typed[key])})
+		}
+		return normalized
+	case []interface{}:
+		normalized := make([]interface{}, len(typed))
+		for i := range typed {
+			normalized[i] = normalizeIndexValue(typed[i])
+		}
+		return normalized
+	}
+	return value
+}
+
+// listIndexes returns the indexes on the intent's collection.
+func listIndexes(session *mgo.Session, intent *intents.Intent) ([]IndexDocument, error) {
+	iter, err := db.GetIndexes(session.DB(intent.DB).C(intent.C))
+	if err != nil {
+		return nil, err
+	}
+	found := []IndexDocument{}
+	index := IndexDocument{}
+	for iter.Next(&index) {
+		found = append(found, index)
+		index = IndexDocument{}
+	}
+	if err = iter.Close(); err != nil {
+		return nil, fmt.Errorf("error listing indexes: %v", err)
+	}
+	return found, nil
+}
+
+// VerifyIndexes compares the indexes on the intent's collection with those
+// that were restored to it, logging any difference and recording the
+// collection so that the restore can fail once it is complete. Indexes the
+// restore did not create only cause a warning.
+func (restore *MongoRestore) VerifyIndexes(intent *intents.Intent, indexes []IndexDocument) error {
+	session, err := restore.sessionProviderFor(intent.DB).GetSession()
+	if err != nil {
+		return fmt.Errorf("error establishing connection: %v", err)
+	}
+	defer session.Close()
+
+	found, err := listIndexes(session, intent)
+	if err != nil {
+		return err
+	}
+
+	diff := compareIndexes(indexes, found, restore.OutputOptions.KeepIndexVersion)
+	if len(diff.Extra) > 0 {
+		log.Logf(log.Always, "warning: %v has indexes that were not restored from the dump: %v",
+			intent.Namespace(), strings.Join(diff.Extra, ", "))
+	}
+	if diff.matches() {
+		log.Logf(log.Info, "verified %v indexes of %v", len(indexes), intent.Namespace())
+		return nil
+	}
+	log.Logf(log.Always, "index verification failed for %v: %v", intent.Namespace(), diff)
+	restore.indexMismatchesMutex.Lock()
+	defer restore.indexMismatchesMutex.Unlock()
+	restore.indexMismatches = append(restore.indexMismatches, intent.Namespace())
+	return nil
+}
+
+// indexMismatchesError returns an error listing the collections whose
+// indexes failed --verifyIndexes, or nil if there were none.
+func (restore *MongoRestore) indexMismatchesError() error {
+	restore.indexMismatchesMutex.Lock()
+	defer restore.indexMismatchesMutex.Unlock()
+	if len(restore.indexMismatches) == 0 {
+		return nil
+	}
+	return fmt.Errorf("the indexes of %v collection(s) do not match the dump: %v",
+		len(restore.indexMismatches), strings.Join(restore.indexMismatches, ", "))
+}
@@ -0,0 +1,60 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestCompareIndexes(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With the indexes restored from a metadata file", t, func() {
+		expected := []IndexDocument{
+			{Key: bson.D{{"_id", float64(1)}}, Options: bson.M{"name": "_id_", "ns": "test.c"}},
+			{Key: bson.D{{"a", float64(1)}, {"b", float64(-1)}},
+				Options: bson.M{"name": "a_1_b_-1", "unique": true, "background": true}},
+			{Key: bson.D{{"t", float64(1)}}, Options: bson.M{"name": "t_1", "expireAfterSeconds": float64(60)}},
+		}
+
+		Convey("the same indexes read back from the server should match", func() {
+			found := []IndexDocument{
+				{Key: bson.D{{"_id", 1}}, Options: bson.M{"name": "_id_", "v": 2}},
+				{Key: bson.D{{"a", 1}, {"b", -1}}, Options: bson.M{"name": "a_1_b_-1", "unique": true, "v": 2}},
+				{Key: bson.D{{"t", int64(1)}}, Options: bson.M{"name": "t_1", "expireAfterSeconds": int32(60), "v": 2}},
+			}
+			So(compareIndexes(expected, found, false).matches(), ShouldBeTrue)
+
+			Convey("unless the index version is compared", func() {
+				diff := compareIndexes(expected, found, true)
+				So(len(diff.Divergent), ShouldEqual, 3)
+			})
+		})
+
+		Convey("missing, extra and different indexes should be reported", func() {
+			found := []IndexDocument{
+				{Key: bson.D{{"_id", 1}}, Options: bson.M{"name": "_id_"}},
+				{Key: bson.D{{"b", -1}, {"a", 1}}, Options: bson.M{"name": "a_1_b_-1"}},
+				{Key: bson.D{{"x", 1}}, Options: bson.M{"name": "x_1"}},
+			}
+			diff := compareIndexes(expected, found, false)
+			So(diff.Missing, ShouldResemble, []string{"t_1"})
+			So(diff.Extra, ShouldResemble, []string{"x_1"})
+			So(len(diff.Divergent), ShouldEqual, 1)
+			So(diff.Divergent[0], ShouldStartWith, "a_1_b_-1 (key ")
+			So(diff.Divergent[0], ShouldContainSubstring, "unique true, found <nil>")
+			So(diff.matches(), ShouldBeFalse)
+			So(diff.String(), ShouldNotContainSubstring, "x_1")
+		})
+
+		Convey("indexes the restore did not create should not be a mismatch", func() {
+			found := append([]IndexDocument{}, expected...)
+			found = append(found, IndexDocument{Key: bson.D{{"x", 1}}, Options: bson.M{"name": "x_1"}})
+			diff := compareIndexes(expected, found, false)
+			So(diff.Extra, ShouldResemble, []string{"x_1"})
+			So(diff.matches(), ShouldBeTrue)
+		})
+	})
+}
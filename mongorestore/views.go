@@ -0,0 +1,104 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+)
+
+// isView returns true if the create options define a view.
+func isView(options bson.D) bool {
+	viewOn, _ := bsonutil.FindValueByKey("viewOn", &options)
+	return viewOn != nil
+}
+
+// viewDependencies returns the namespaces that the view defined by options
+// reads from: the collection or view it is defined on, and any collection
+// named by a $lookup or $graphLookup stage of its pipeline. Views can only
+// read from their own database. It returns nil for options that do not
+// define a view.
+func viewDependencies(dbName string, options bson.D) []string {
+	viewOn, _ := bsonutil.FindValueByKey("viewOn", &options)
+	source, ok := viewOn.(string)
+	if !ok {
+		return nil
+	}
+	dependencies := []string{dbName + "." + source}
+
+	pipeline, _ := bsonutil.FindValueByKey("pipeline", &options)
+	stages, _ := pipeline.([]interface{})
+	for _, stage := range stages {
+		for _, operator := range []string{"$lookup", "$graphLookup"} {
+			if from, ok := stageField(stage, operator, "from").(string); ok {
+				dependencies = append(dependencies, dbName+"."+from)
+			}
+		}
+	}
+	return dependencies
+}
+
+// stageField returns stage[operator][field] from a pipeline stage, which may
+// be decoded as either a bson.D or a map.
+func stageField(stage interface{}, operator, field string) interface{} {
+	return documentField(documentField(stage, operator), field)
+}
+
+// documentField returns the value of a field of a bson.D or map, or nil.
+func documentField(document interface{}, field string) interface{} {
+	switch typed := document.(type) {
+	case bson.D:
+		value, _ := bsonutil.FindValueByKey(field, &typed)
+		return value
+	case bson.M:
+		return typed[field]
+	case map[string]interface{}:
+		return typed[field]
+	}
+	return nil
+}
+
+// readCollectionOrder reads the metadata file of each intent for the
+// creationOrder mongodump recorded, for the collections each view depends
+// on, and for options such as validators that may call functions stored in
+// system.js, so that the intents can be scheduled accordingly. It must be
+// called before the intent manager is finalized.
+func (restore *MongoRestore) readCollectionOrder() error {
+	err := restore.manager.ForEach(func(intent *intents.Intent) error {
+		if intent.MetadataPath == "" {
+			return nil
+		}
+		jsonBytes, err := ioutil.ReadFile(intent.MetadataPath)
+		if err != nil {
+			return fmt.Errorf("error reading metadata file %v: %v", intent.MetadataPath, err)
+		}
+		if len(jsonBytes) == 0 {
+			return nil
+		}
+		meta := &Metadata{}
+		if err = json.Unmarshal(jsonBytes, meta); err != nil {
+			return fmt.Errorf("error parsing metadata file %v: %v", intent.MetadataPath, err)
+		}
+		intent.CreationOrder = meta.CreationOrder
+		if options, err := bsonutil.GetExtendedBsonD(meta.Options); err == nil {
+			intent.DependsOn = viewDependencies(intent.DB, options)
+			if len(intent.DependsOn) > 0 {
+				log.Logf(log.DebugLow, "view %v depends on %v", intent.Namespace(), intent.DependsOn)
+			}
+			if scripts := scriptDependencies(intent.DB, options); scripts != nil && intent.C != "system.js" {
+				log.Logf(log.DebugLow, "options of %v run JavaScript, so it is restored after %v",
+					intent.Namespace(), scripts[0])
+				intent.DependsOn = append(intent.DependsOn, scripts...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	restore.manager.OrderByCreation()
+	return nil
+}
@@ -0,0 +1,40 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestViewDependencies(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With the metadata of a dumped view", t, func() {
+		meta := &Metadata{}
+		So(json.Unmarshal([]byte(`{"indexes":[],"creationOrder":4,"options":{`+
+			`"viewOn":"orders","pipeline":[`+
+			`{"$match":{"status":"A"}},`+
+			`{"$lookup":{"from":"customers","localField":"c","foreignField":"_id","as":"customer"}},`+
+			`{"$graphLookup":{"from":"employees","startWith":"$m","connectFromField":"m",`+
+			`"connectToField":"_id","as":"chain"}}]}}`), meta), ShouldBeNil)
+		So(meta.CreationOrder, ShouldEqual, 4)
+		options, err := bsonutil.GetExtendedBsonD(meta.Options)
+		So(err, ShouldBeNil)
+
+		Convey("the view should depend on its source and looked up collections", func() {
+			So(isView(options), ShouldBeTrue)
+			So(viewDependencies("shop", options), ShouldResemble,
+				[]string{"shop.orders", "shop.customers", "shop.employees"})
+		})
+	})
+
+	Convey("Collection options should not be considered a view", t, func() {
+		options := bson.D{{"capped", true}, {"size", 4096}}
+		So(isView(options), ShouldBeFalse)
+		So(viewDependencies("shop", options), ShouldBeNil)
+	})
+}
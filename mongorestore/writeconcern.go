@@ -0,0 +1,65 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/json"
+	"gopkg.in/mgo.v2"
+	"io/ioutil"
+)
+
+// readCollectionWriteConcerns reads a --collectionWriteConcern file: a JSON
+// document mapping full namespaces to write concerns. Each write concern
+// takes the same forms as --writeConcern, either a document such as
+// {w: "majority", j: true} or a bare w value such as "majority" or 1.
+func readCollectionWriteConcerns(path string, nodeType db.NodeType) (map[string]*mgo.Safe, error) {
+	jsonBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseCollectionWriteConcerns(jsonBytes, nodeType)
+}
+
+// parseCollectionWriteConcerns parses and validates the contents of a
+// --collectionWriteConcern file for the given type of node.
+func parseCollectionWriteConcerns(jsonBytes []byte, nodeType db.NodeType) (map[string]*mgo.Safe, error) {
+	raw := map[string]interface{}{}
+	if err := json.Unmarshal(jsonBytes, &raw); err != nil {
+		return nil, fmt.Errorf("expected a JSON document mapping namespaces to write concerns: %v", err)
+	}
+	concerns := map[string]*mgo.Safe{}
+	for namespace, value := range raw {
+		if _, _, err := splitNamespace(namespace); err != nil {
+			return nil, err
+		}
+		var writeConcern string
+		switch v := value.(type) {
+		case string:
+			writeConcern = v
+		case map[string]interface{}:
+			asJSON, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid write concern for %v: %v", namespace, err)
+			}
+			writeConcern = string(asJSON)
+		default:
+			writeConcern = fmt.Sprintf("%v", v)
+		}
+		safety, err := db.BuildWriteConcern(writeConcern, nodeType)
+		if err != nil {
+			return nil, fmt.Errorf("invalid write concern for %v: %v", namespace, err)
+		}
+		concerns[namespace] = safety
+	}
+	return concerns, nil
+}
+
+// safetyFor returns the write concern to restore the given namespace with:
+// its --collectionWriteConcern entry if it has one, or the global
+// --writeConcern otherwise.
+func (restore *MongoRestore) safetyFor(namespace string) *mgo.Safe {
+	if safety, ok := restore.collectionSafety[namespace]; ok {
+		return safety
+	}
+	return restore.safety
+}
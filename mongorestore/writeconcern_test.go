@@ -0,0 +1,55 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2"
+	"testing"
+)
+
+func TestCollectionWriteConcerns(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When parsing --collectionWriteConcern against a replica set", t, func() {
+
+		Convey("documents and bare w values should both be accepted", func() {
+			concerns, err := parseCollectionWriteConcerns([]byte(`{
+				"bank.ledger": {"w": "majority", "j": true},
+				"scratch.tmp": 1,
+				"scratch.cache": "majority"
+			}`), db.ReplSet)
+			So(err, ShouldBeNil)
+			So(concerns["bank.ledger"], ShouldResemble, &mgo.Safe{WMode: "majority", J: true})
+			So(concerns["scratch.tmp"], ShouldResemble, &mgo.Safe{W: 1})
+			So(concerns["scratch.cache"], ShouldResemble, &mgo.Safe{WMode: "majority"})
+		})
+
+		Convey("an unacknowledged write concern should be kept as nil", func() {
+			concerns, err := parseCollectionWriteConcerns([]byte(`{"scratch.tmp": {"w": 0}}`), db.ReplSet)
+			So(err, ShouldBeNil)
+			safety, ok := concerns["scratch.tmp"]
+			So(ok, ShouldBeTrue)
+			So(safety, ShouldBeNil)
+
+			Convey("and used instead of the global write concern", func() {
+				restore := &MongoRestore{safety: &mgo.Safe{W: 1}, collectionSafety: concerns}
+				So(restore.safetyFor("scratch.tmp"), ShouldBeNil)
+				So(restore.safetyFor("scratch.other"), ShouldResemble, &mgo.Safe{W: 1})
+			})
+		})
+
+		Convey("invalid namespaces and write concerns should be rejected", func() {
+			for _, contents := range []string{
+				`[]`,
+				`{"nodot": 1}`,
+				`{"test.c": -1}`,
+				`{"test.c": {"w": true}}`,
+			} {
+				_, err := parseCollectionWriteConcerns([]byte(contents), db.ReplSet)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}